@@ -15,6 +15,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	_ "go-demo/docs"
 
@@ -22,7 +23,9 @@ import (
 	"go-demo/internal/config"
 	"go-demo/internal/db"
 	apihttp "go-demo/internal/http"
+	"go-demo/internal/mail"
 	"go-demo/internal/observability"
+	"go-demo/internal/oidc"
 	"go-demo/internal/sqllog"
 )
 
@@ -46,13 +49,63 @@ func main() {
 		}
 	}()
 
-	// Seed default roles (DEMO.ROLE): USER and ADMIN
-	if err := dbx.SeedDefaultRoles(context.Background()); err != nil {
-		log.Error("seed default roles failed", "err", err)
+	// Seed roles from ROLES_FILE (DEMO.ROLE) and default permissions (DEMO.PERMISSION, DEMO.ROLE_PERMISSION)
+	roleDefs, err := db.LoadRoleDefinitions(cfg.RolesFile)
+	if err != nil {
+		log.Error("role definitions load failed", "err", err)
+		os.Exit(1)
+	}
+	if err := dbx.SeedRoles(context.Background(), roleDefs); err != nil {
+		log.Error("seed roles failed", "err", err)
+		os.Exit(1)
+	}
+	if err := dbx.SeedDefaultPermissions(context.Background()); err != nil {
+		log.Error("seed default permissions failed", "err", err)
 		os.Exit(1)
 	}
 
 	authSvc := auth.NewService(dbx, cfg, log)
+	mailer, err := mail.New(cfg, log)
+	if err != nil {
+		log.Error("mailer initialization failed", "err", err)
+		os.Exit(1)
+	}
+	authSvc.SetMailer(mailer)
+	if cfg.BreachedPasswordsFile != "" {
+		breached, err := auth.LoadBreachedPasswords(cfg.BreachedPasswordsFile)
+		if err != nil {
+			log.Error("breached password list load failed", "err", err)
+			os.Exit(1)
+		}
+		authSvc.SetBreachedPasswords(breached)
+		log.Info("breached password list loaded", "hashes", breached.Len())
+	}
+
+	if cfg.JWTKeyRingFile != "" {
+		ring, err := auth.LoadKeyRing(cfg.JWTKeyRingFile)
+		if err != nil {
+			log.Error("jwt key ring load failed", "err", err)
+			os.Exit(1)
+		}
+		authSvc.SetKeyRing(ring)
+		if active := ring.Active(time.Now()); active != nil {
+			log.Info("jwt key ring loaded", "active_kid", active.ID, "alg", active.Algorithm)
+		} else {
+			log.Warn("jwt key ring has no active key; logins fail until one becomes active")
+		}
+	}
+
+	if cfg.OIDCIssuer != "" {
+		if cfg.OIDCClientID == "" {
+			log.Error("OIDC_CLIENT_ID is required when OIDC_ISSUER is set")
+			os.Exit(1)
+		}
+		if _, err := oidc.ParseRoleMap(cfg.OIDCRoleMap); err != nil {
+			log.Error("invalid OIDC_ROLE_MAP", "err", err)
+			os.Exit(1)
+		}
+		log.Info("single sign-on enabled", "issuer", cfg.OIDCIssuer)
+	}
 
 	// Initialize sql log repository and migrate table
 	sqlRepo := sqllog.NewRepository(dbx.Gorm)
@@ -60,6 +113,11 @@ func main() {
 		log.Error("sql log migration failed", "err", err)
 		os.Exit(1)
 	}
+	sqlRepo.SetRedactionDefaults(sqllog.RedactionPolicy{
+		RedactAtIngest: cfg.RedactAtIngest,
+		RedactAtExport: cfg.RedactAtExport,
+		RetainRaw:      cfg.RedactRetainRaw,
+	})
 
 	// On startup: parse logfile/logsql.txt if present; log parsing errors and continue with valid entries
 	if err := loadSQLLogOnStartup(context.Background(), sqlRepo, log, "logfile/logsql.txt"); err != nil {
@@ -74,6 +132,11 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	// Purge expired refresh tokens and access token denylist entries
+	go authSvc.RunTokenCleanup(ctx, cfg.TokenCleanupInterval)
+	// Pick up keys staged in the key ring manifest
+	go authSvc.RunKeyRingReload(ctx, cfg.JWTKeyRingFile, cfg.JWTKeyRingReload)
+
 	if err := server.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
 		log.Error("server exited with error", "err", err)
 		os.Exit(1)
@@ -35,10 +35,19 @@ func main() {
 		}
 	}()
 
-	if err := dbx.SeedDefaultRoles(context.Background()); err != nil {
-		log.Error("seed default roles failed", "err", err)
+	roleDefs, err := db.LoadRoleDefinitions(cfg.RolesFile)
+	if err != nil {
+		log.Error("role definitions load failed", "err", err)
+		os.Exit(1)
+	}
+	if err := dbx.SeedRoles(context.Background(), roleDefs); err != nil {
+		log.Error("seed roles failed", "err", err)
+		os.Exit(1)
+	}
+	if err := dbx.SeedDefaultPermissions(context.Background()); err != nil {
+		log.Error("seed default permissions failed", "err", err)
 		os.Exit(1)
 	}
 
-	log.Info("seed default roles completed")
+	log.Info("seed default roles and permissions completed")
 }
\ No newline at end of file
@@ -0,0 +1,132 @@
+// Package audit records security and administrative actions in the
+// append-only DEMO.AUDIT_EVENT table and reads them back for admins.
+package audit
+
+import (
+	"context"
+	"log/slog"
+
+	"go-demo/internal/authctx"
+	"go-demo/internal/db"
+
+	"gorm.io/gorm"
+)
+
+// Actions recorded in DEMO.AUDIT_EVENT.
+const (
+	ActionLogin            = "auth.login"
+	ActionRefresh          = "auth.refresh"
+	ActionUserCreate       = "user.create"
+	ActionUserRoleChange   = "user.role_change"
+	ActionUserStatusChange = "user.status_change"
+	ActionUserDelete       = "user.delete"
+	ActionUserRestore      = "user.restore"
+	ActionUserExport       = "user.export"
+	ActionInvitationCreate = "invitation.create"
+	ActionInvitationRevoke = "invitation.revoke"
+	ActionRoleCreate       = "role.create"
+	ActionRoleUpdate       = "role.update"
+	ActionRolePermissions  = "role.permissions"
+	ActionRoleDelete       = "role.delete"
+	ActionSQLLogUpload     = "sqllog.upload"
+	ActionReportExport     = "report.export"
+	ActionAIAnalysis       = "ai.analysis"
+)
+
+// Outcomes of an action.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Target types.
+const (
+	TargetUser       = "user"
+	TargetDatabase   = "database"
+	TargetFile       = "file"
+	TargetInvitation = "invitation"
+	TargetRole       = "role"
+)
+
+// Event is an action to record. The actor defaults to the authenticated user
+// in the context; the client IP and request ID always come from the context.
+type Event struct {
+	Action     string
+	Outcome    string // OutcomeSuccess when empty
+	ActorID    string
+	ActorName  string
+	TargetType string
+	TargetID   string
+	Before     map[string]any
+	After      map[string]any
+	Details    map[string]any
+}
+
+// Recorder writes and queries audit events. A nil Recorder records nothing.
+type Recorder struct {
+	db  *gorm.DB
+	log *slog.Logger
+}
+
+func NewRecorder(g *gorm.DB, log *slog.Logger) *Recorder {
+	if log == nil {
+		log = slog.Default()
+	}
+	return &Recorder{db: g, log: log}
+}
+
+// Record appends e to the audit log. Failures are logged rather than
+// returned so that auditing never fails the action being audited; the write
+// is not cancelled with the request.
+func (r *Recorder) Record(ctx context.Context, e Event) {
+	if r == nil || r.db == nil {
+		return
+	}
+	row := newAuditEvent(ctx, e)
+	if err := r.db.WithContext(context.WithoutCancel(ctx)).Create(&row).Error; err != nil {
+		r.log.Error("audit event not recorded", "err", err, "action", row.Action, "actor_id", row.ActorID,
+			"target_id", row.TargetID, "request_id", row.RequestID)
+	}
+}
+
+// newAuditEvent fills in what e leaves to the context.
+func newAuditEvent(ctx context.Context, e Event) db.AuditEvent {
+	row := db.AuditEvent{
+		Action:     e.Action,
+		Outcome:    e.Outcome,
+		ActorID:    e.ActorID,
+		ActorName:  e.ActorName,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		RequestID:  truncate(authctx.RequestIDFrom(ctx), 64),
+		Before:     e.Before,
+		After:      e.After,
+		Details:    e.Details,
+	}
+	if row.Outcome == "" {
+		row.Outcome = OutcomeSuccess
+	}
+	if row.ActorID == "" && row.ActorName == "" {
+		if u, ok := authctx.UserFrom(ctx); ok && u != nil {
+			row.ActorID = u.ID
+			row.ActorName = u.Username
+		}
+	}
+	if t, ok := authctx.TokenFrom(ctx); ok && t.APIKeyID != "" {
+		if row.Details == nil {
+			row.Details = map[string]any{}
+		}
+		row.Details["api_key_id"] = t.APIKeyID
+	}
+	if c, ok := authctx.ClientFrom(ctx); ok {
+		row.IP = truncate(c.IP, 64)
+	}
+	return row
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
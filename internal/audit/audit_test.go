@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"go-demo/internal/authctx"
+	"go-demo/internal/db"
+)
+
+func TestNewAuditEventFromContext(t *testing.T) {
+	ctx := authctx.WithUser(context.Background(), &db.User{ID: "u1", Username: "alice"})
+	ctx = authctx.WithClient(ctx, authctx.Client{IP: "192.0.2.1"})
+	ctx = authctx.WithRequestID(ctx, strings.Repeat("r", 100))
+	ctx = authctx.WithToken(ctx, authctx.Token{APIKeyID: "k1"})
+
+	row := newAuditEvent(ctx, Event{Action: ActionUserDelete, TargetType: TargetUser, TargetID: "u2"})
+	require.Equal(t, OutcomeSuccess, row.Outcome)
+	require.Equal(t, "u1", row.ActorID)
+	require.Equal(t, "alice", row.ActorName)
+	require.Equal(t, "192.0.2.1", row.IP)
+	require.Len(t, row.RequestID, 64)
+	require.Equal(t, "k1", row.Details["api_key_id"])
+
+	// An explicit actor wins over the caller.
+	row = newAuditEvent(ctx, Event{Action: ActionLogin, Outcome: OutcomeFailure, ActorName: "oidc"})
+	require.Equal(t, OutcomeFailure, row.Outcome)
+	require.Empty(t, row.ActorID)
+	require.Equal(t, "oidc", row.ActorName)
+
+	row = newAuditEvent(context.Background(), Event{Action: ActionLogin})
+	require.Empty(t, row.ActorID)
+	require.Empty(t, row.IP)
+	require.Nil(t, row.Details)
+}
+
+func TestNilRecorder(t *testing.T) {
+	var r *Recorder
+	r.Record(context.Background(), Event{Action: ActionLogin})
+}
+
+func TestCSVRecord(t *testing.T) {
+	rec := csvRecord(db.AuditEvent{
+		ID:          7,
+		Action:      ActionUserRoleChange,
+		Outcome:     OutcomeSuccess,
+		ActorID:     "u1",
+		TargetType:  TargetUser,
+		TargetID:    "u2",
+		Before:      map[string]any{"role": "USER"},
+		After:       map[string]any{"role": "ANALYZER"},
+		CreatedTime: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC),
+	})
+	require.Len(t, rec, len(csvHeader))
+	require.Equal(t, "7", rec[0])
+	require.Equal(t, "2026-10-01T12:00:00Z", rec[1])
+	require.Equal(t, `{"role":"USER"}`, rec[10])
+	require.Equal(t, `{"role":"ANALYZER"}`, rec[11])
+	require.Equal(t, "", rec[12])
+
+	rec = csvRecord(db.AuditEvent{ActorName: "=HYPERLINK(\"http://evil\")", TargetID: "-1+2", IP: "@SUM(A1)"})
+	require.Equal(t, `'=HYPERLINK("http://evil")`, rec[5])
+	require.Equal(t, "'-1+2", rec[7])
+	require.Equal(t, "'@SUM(A1)", rec[8])
+}
+
+func TestEscapeCSVFormulas(t *testing.T) {
+	require.Equal(t,
+		[]string{"'=1+1", "'+1", "'-1", "'@x", "'\tx", "'\rx", "a=b", "", "{\"k\":1}"},
+		EscapeCSVFormulas([]string{"=1+1", "+1", "-1", "@x", "\tx", "\rx", "a=b", "", `{"k":1}`}))
+}
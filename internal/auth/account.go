@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go-demo/internal/db"
+	"go-demo/internal/mail"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidUserToken is returned for unknown, expired or already used
+// password reset and verification tokens.
+var ErrInvalidUserToken = errors.New("invalid or expired token")
+
+// issueUserToken creates a single-use token for purpose, replacing any
+// unused one the user already has for the same purpose.
+func (s *Service) issueUserToken(ctx context.Context, userID, purpose string, ttl time.Duration) (string, error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("rand: %w", err)
+	}
+	plain := hex.EncodeToString(b[:])
+
+	err := s.transaction(ctx, func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Delete(&db.UserToken{}).Error; err != nil {
+			return fmt.Errorf("replace user token: %w", err)
+		}
+		t := &db.UserToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: hashRefreshToken(plain),
+			ExpiresAt: time.Now().Add(ttl),
+		}
+		if err := tx.Create(t).Error; err != nil {
+			return fmt.Errorf("store user token: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return plain, nil
+}
+
+// consumeUserToken marks a token for purpose used and returns it. It must run
+// inside tx so the token is only spent if the caller's change commits.
+func consumeUserToken(tx *gorm.DB, plain, purpose string) (*db.UserToken, error) {
+	if plain == "" {
+		return nil, ErrInvalidUserToken
+	}
+	var t db.UserToken
+	err := tx.Where("token_hash = ? AND purpose = ?", hashRefreshToken(plain), purpose).First(&t).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidUserToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find user token: %w", err)
+	}
+	if t.UsedAt != nil || time.Now().After(t.ExpiresAt) {
+		return nil, ErrInvalidUserToken
+	}
+	res := tx.Model(&db.UserToken{}).
+		Where("id = ? AND used_at IS NULL", t.ID).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return nil, fmt.Errorf("use user token: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrInvalidUserToken
+	}
+	return &t, nil
+}
+
+// link builds an absolute link to path on the configured application URL.
+func (s *Service) link(path, token string) string {
+	return s.cfg.AppBaseURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// RequestPasswordReset mails a reset link to the active account with the given
+// email. Unknown addresses are ignored so callers cannot probe for accounts;
+// the token is issued and mailed in the background so that the response time
+// does not give the account away either.
+func (s *Service) RequestPasswordReset(ctx context.Context, email string) error {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return nil
+	}
+	var u db.User
+	err := s.dbx.Gorm.WithContext(ctx).First(&u, "email = ?", email).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("find user: %w", err)
+	}
+	if !s.IsUserActive(&u) || u.ServiceAccount {
+		return nil
+	}
+
+	mailer := s.mailer
+	s.inBackground(ctx, func(ctx context.Context) error {
+		return s.sendPasswordReset(ctx, mailer, &u)
+	}, "failed to send password reset", "user_id", u.ID)
+	return nil
+}
+
+// inBackground runs fn on its own goroutine with a context that outlives the
+// request, and logs msg with args if it fails. The account endpoints use it so
+// that issuing and mailing a token does not show in their response time.
+func (s *Service) inBackground(ctx context.Context, fn func(ctx context.Context) error, msg string, args ...any) {
+	go func(ctx context.Context) {
+		if err := fn(ctx); err != nil {
+			s.log.Error(msg, append(args, "err", err)...)
+		}
+	}(context.WithoutCancel(ctx))
+}
+
+// sendPasswordReset issues a reset token for u and mails the link.
+func (s *Service) sendPasswordReset(ctx context.Context, mailer mail.Mailer, u *db.User) error {
+	token, err := s.issueUserToken(ctx, u.ID, db.UserTokenPasswordReset, s.cfg.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(ctx, mail.Message{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nUse the link below to choose a new password. It expires in %s.\n\n%s\n\n"+
+			"If you did not ask for a password reset you can ignore this email.\n",
+			u.Username, s.cfg.PasswordResetTTL, s.link("/reset-password", token)),
+	})
+}
+
+// ResetPassword sets a new password using a reset token and signs the user out
+// everywhere. Completing a reset also proves ownership of the email address.
+func (s *Service) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if newPassword == "" {
+		return fmt.Errorf("missing required fields")
+	}
+
+	var userID string
+	err := s.transaction(ctx, func(tx *gorm.DB) error {
+		t, err := consumeUserToken(tx, token, db.UserTokenPasswordReset)
+		if err != nil {
+			return err
+		}
+		userID = t.UserID
+		var u db.User
+		if err := tx.First(&u, "id = ?", t.UserID).Error; err != nil {
+			return fmt.Errorf("find user: %w", err)
+		}
+		// A policy violation rolls back, so the token can be used again.
+		return s.setPassword(tx, &u, newPassword, map[string]interface{}{
+			"email_verified_at": gorm.Expr("COALESCE(email_verified_at, ?)", time.Now()),
+			"updated_by":        "password-reset",
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.RevokeAllSessions(ctx, userID); err != nil {
+		s.log.Error("failed to revoke sessions after password reset", "user_id", userID, "err", err)
+	}
+	return nil
+}
+
+// SendEmailVerification mails a verification link to u unless already verified.
+func (s *Service) SendEmailVerification(ctx context.Context, u *db.User) error {
+	if u.EmailVerifiedAt != nil {
+		return nil
+	}
+	return s.sendEmailVerification(ctx, s.mailer, u)
+}
+
+// sendEmailVerification issues a verification token for u and mails the link.
+func (s *Service) sendEmailVerification(ctx context.Context, mailer mail.Mailer, u *db.User) error {
+	token, err := s.issueUserToken(ctx, u.ID, db.UserTokenEmailVerify, s.cfg.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(ctx, mail.Message{
+		To:      u.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hello %s,\n\nPlease confirm your email address using the link below. It expires in %s.\n\n%s\n",
+			u.Username, s.cfg.EmailVerificationTTL, s.link("/verify-email", token)),
+	})
+}
+
+// ResendEmailVerification sends a new verification link to the unverified
+// account with the given email. Unknown or verified addresses are ignored;
+// like RequestPasswordReset, the link is issued and mailed in the background.
+func (s *Service) ResendEmailVerification(ctx context.Context, email string) error {
+	var u db.User
+	err := s.dbx.Gorm.WithContext(ctx).First(&u, "email = ?", strings.TrimSpace(email)).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("find user: %w", err)
+	}
+	if !s.IsUserActive(&u) || u.EmailVerifiedAt != nil {
+		return nil
+	}
+	mailer := s.mailer
+	s.inBackground(ctx, func(ctx context.Context) error {
+		return s.sendEmailVerification(ctx, mailer, &u)
+	}, "failed to resend verification email", "user_id", u.ID)
+	return nil
+}
+
+// VerifyEmail marks the email address of the token's user as verified.
+func (s *Service) VerifyEmail(ctx context.Context, token string) (*db.User, error) {
+	var u db.User
+	err := s.transaction(ctx, func(tx *gorm.DB) error {
+		t, err := consumeUserToken(tx, token, db.UserTokenEmailVerify)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&db.User{}).
+			Where("id = ? AND email_verified_at IS NULL", t.UserID).
+			Update("email_verified_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("verify email: %w", err)
+		}
+		return tx.First(&u, "id = ?", t.UserID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
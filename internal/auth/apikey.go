@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go-demo/internal/authctx"
+	"go-demo/internal/db"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotServiceAccount = errors.New("user is not a service account")
+	ErrAPIKeyNotFound    = errors.New("api key not found")
+)
+
+// apiKeyPrefix marks keys issued by this service, which helps secret scanners.
+const apiKeyPrefix = "gdk_"
+
+// apiKeyLastUsedInterval limits how often last-used tracking writes to the database.
+const apiKeyLastUsedInterval = time.Minute
+
+// newAPIKey returns a new plaintext key "gdk_<id>_<secret>" and its public prefix "gdk_<id>".
+func newAPIKey() (string, string, error) {
+	var id [4]byte
+	var secret [24]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", "", fmt.Errorf("rand: %w", err)
+	}
+	if _, err := rand.Read(secret[:]); err != nil {
+		return "", "", fmt.Errorf("rand: %w", err)
+	}
+	prefix := apiKeyPrefix + hex.EncodeToString(id[:])
+	return prefix + "_" + hex.EncodeToString(secret[:]), prefix, nil
+}
+
+// CreateServiceAccount creates a user without a password that can only
+// authenticate with API keys. Like CreateUser it refuses ADMIN and roles the
+// caller could not delegate.
+func (s *Service) CreateServiceAccount(ctx context.Context, username, role, createdBy string) (*db.User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" || role == "" {
+		return nil, fmt.Errorf("missing required fields")
+	}
+	if err := s.checkAssignableRole(ctx, role); err != nil {
+		return nil, err
+	}
+	if err := s.dbx.Gorm.WithContext(ctx).First(&db.Role{}, "code = ?", role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidRole, role)
+		}
+		return nil, fmt.Errorf("check role: %w", err)
+	}
+	// Email is required and unique; .invalid can never receive mail.
+	email := strings.ToLower(username) + "@service-accounts.invalid"
+
+	var count int64
+	if err := s.dbx.Gorm.WithContext(ctx).
+		Model(&db.User{}).
+		Where("username = ? OR email = ?", username, email).
+		Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("check existing: %w", err)
+	}
+	if count > 0 {
+		return nil, ErrUserExists
+	}
+
+	now := time.Now()
+	u := &db.User{
+		Username:        username,
+		Email:           email,
+		PasswordHash:    "", // never matches a bcrypt comparison
+		CreatedBy:       createdBy,
+		UpdatedBy:       createdBy,
+		Role:            role,
+		ServiceAccount:  true,
+		EmailVerifiedAt: &now,
+	}
+	if err := s.dbx.Gorm.WithContext(ctx).Create(u).Error; err != nil {
+		return nil, fmt.Errorf("create service account: %w", err)
+	}
+	s.auditUserCreate(ctx, u, map[string]any{"source": "service_account"})
+	return u, nil
+}
+
+// ListServiceAccounts returns all service accounts ordered by username.
+func (s *Service) ListServiceAccounts(ctx context.Context) ([]db.User, error) {
+	var users []db.User
+	if err := s.dbx.Gorm.WithContext(ctx).
+		Where("service_account").
+		Order("username").
+		Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("list service accounts: %w", err)
+	}
+	return users, nil
+}
+
+func (s *Service) findServiceAccount(tx *gorm.DB, userID string) (*db.User, error) {
+	var u db.User
+	if err := tx.First(&u, "id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	if !u.ServiceAccount {
+		return nil, ErrNotServiceAccount
+	}
+	return &u, nil
+}
+
+// normalizeScopes dedupes and sorts scopes and checks they are known permissions.
+func normalizeScopes(tx *gorm.DB, scopes []string) ([]string, error) {
+	uniq := make(map[string]struct{}, len(scopes))
+	for _, sc := range scopes {
+		if sc = strings.TrimSpace(sc); sc != "" {
+			uniq[sc] = struct{}{}
+		}
+	}
+	out := make([]string, 0, len(uniq))
+	for sc := range uniq {
+		out = append(out, sc)
+	}
+	sort.Strings(out)
+	if len(out) == 0 {
+		return out, nil
+	}
+	var known int64
+	if err := tx.Model(&db.Permission{}).Where("code IN ?", out).Count(&known).Error; err != nil {
+		return nil, fmt.Errorf("check scopes: %w", err)
+	}
+	if known != int64(len(out)) {
+		return nil, ErrUnknownPermission
+	}
+	return out, nil
+}
+
+// CreateAPIKey issues a key for the service account. The plaintext key is
+// returned only here; scopes must be permission codes and limit the key to
+// those the account's role also grants.
+func (s *Service) CreateAPIKey(ctx context.Context, userID, name string, scopes []string, expiresAt *time.Time, createdBy string) (string, *db.APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, fmt.Errorf("missing required fields")
+	}
+	plain, prefix, err := newAPIKey()
+	if err != nil {
+		return "", nil, err
+	}
+	var key db.APIKey
+	err = s.transaction(ctx, func(tx *gorm.DB) error {
+		if _, err := s.findServiceAccount(tx, userID); err != nil {
+			return err
+		}
+		scopes, err := normalizeScopes(tx, scopes)
+		if err != nil {
+			return err
+		}
+		key = db.APIKey{
+			UserID:    userID,
+			Name:      name,
+			Prefix:    prefix,
+			KeyHash:   hashRefreshToken(plain),
+			Scopes:    scopes,
+			ExpiresAt: expiresAt,
+			CreatedBy: createdBy,
+			UpdatedBy: createdBy,
+		}
+		if err := tx.Create(&key).Error; err != nil {
+			return fmt.Errorf("store api key: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	s.log.Info("api key created", "user_id", userID, "key_id", key.ID, "prefix", prefix, "by", createdBy)
+	return plain, &key, nil
+}
+
+// ListAPIKeys returns the service account's keys, newest first, including
+// revoked and expired ones.
+func (s *Service) ListAPIKeys(ctx context.Context, userID string) ([]db.APIKey, error) {
+	if _, err := s.findServiceAccount(s.dbx.Gorm.WithContext(ctx), userID); err != nil {
+		return nil, err
+	}
+	var keys []db.APIKey
+	if err := s.dbx.Gorm.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_time DESC").
+		Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("list api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RotateAPIKey replaces the secret of an active key. The old secret stops
+// working immediately; name, scopes and expiry are kept.
+func (s *Service) RotateAPIKey(ctx context.Context, userID, keyID, by string) (string, *db.APIKey, error) {
+	plain, prefix, err := newAPIKey()
+	if err != nil {
+		return "", nil, err
+	}
+	var key db.APIKey
+	err = s.transaction(ctx, func(tx *gorm.DB) error {
+		if err := tx.First(&key, "id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrAPIKeyNotFound
+			}
+			return fmt.Errorf("find api key: %w", err)
+		}
+		return tx.Model(&key).Updates(map[string]interface{}{
+			"prefix":     prefix,
+			"key_hash":   hashRefreshToken(plain),
+			"updated_by": by,
+		}).Error
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	key.Prefix = prefix
+	s.log.Info("api key rotated", "user_id", userID, "key_id", keyID, "prefix", prefix, "by", by)
+	return plain, &key, nil
+}
+
+// RevokeAPIKey permanently disables a key.
+func (s *Service) RevokeAPIKey(ctx context.Context, userID, keyID, by string) error {
+	res := s.dbx.Gorm.WithContext(ctx).Model(&db.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "updated_by": by})
+	if res.Error != nil {
+		return fmt.Errorf("revoke api key: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	s.log.Info("api key revoked", "user_id", userID, "key_id", keyID, "by", by)
+	return nil
+}
+
+// AuthenticateAPIKey resolves a plaintext key to its active service account.
+// Unknown, revoked and expired keys all return ErrInvalidCredentials.
+func (s *Service) AuthenticateAPIKey(ctx context.Context, plain string) (*db.User, *db.APIKey, error) {
+	if !strings.HasPrefix(plain, apiKeyPrefix) {
+		return nil, nil, ErrInvalidCredentials
+	}
+	var key db.APIKey
+	err := s.dbx.Gorm.WithContext(ctx).First(&key, "key_hash = ?", hashRefreshToken(plain)).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("find api key: %w", err)
+	}
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, nil, ErrInvalidCredentials
+	}
+	u, err := s.GetUserByID(ctx, key.UserID)
+	if errors.Is(err, ErrInvalidCredentials) {
+		return nil, nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !s.IsUserActive(u) {
+		return nil, nil, ErrUserInactive
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyLastUsedInterval {
+		client, _ := authctx.ClientFrom(ctx)
+		if err := s.dbx.Gorm.WithContext(ctx).Model(&db.APIKey{}).Where("id = ?", key.ID).
+			UpdateColumns(map[string]interface{}{"last_used_at": now, "last_used_ip": truncate(client.IP, 64)}).Error; err != nil {
+			s.log.Warn("failed to record api key use", "key_id", key.ID, "err", err)
+		}
+		key.LastUsedAt = &now
+	}
+	return u, &key, nil
+}
+
+// ScopePermissions narrows the role permissions perms to the key's scopes.
+func ScopePermissions(perms []string, key *db.APIKey) []string {
+	if key == nil || len(key.Scopes) == 0 {
+		return perms
+	}
+	allowed := make(map[string]struct{}, len(key.Scopes))
+	for _, sc := range key.Scopes {
+		allowed[sc] = struct{}{}
+	}
+	out := make([]string, 0, len(perms))
+	for _, p := range perms {
+		if _, ok := allowed[p]; ok {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"go-demo/internal/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	plain, prefix, err := newAPIKey()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(prefix, "gdk_"))
+	require.True(t, strings.HasPrefix(plain, prefix+"_"))
+	require.Len(t, plain, len(prefix)+1+48)
+
+	other, _, err := newAPIKey()
+	require.NoError(t, err)
+	require.NotEqual(t, plain, other)
+}
+
+func TestScopePermissions(t *testing.T) {
+	perms := []string{db.PermReportView, db.PermSQLLogRead, db.PermSQLLogUpload}
+
+	require.Equal(t, perms, ScopePermissions(perms, nil))
+	require.Equal(t, perms, ScopePermissions(perms, &db.APIKey{}))
+	require.Equal(t, []string{db.PermSQLLogUpload},
+		ScopePermissions(perms, &db.APIKey{Scopes: []string{db.PermSQLLogUpload, db.PermUsersManage}}),
+		"scopes never add permissions the role lacks")
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"go-demo/internal/audit"
+	"go-demo/internal/authctx"
+	"go-demo/internal/db"
+)
+
+// auditLogin records the outcome of a login with method (password, 2fa or
+// oidc). u is the account the attempt was for, or empty when the identifier
+// matched no user. A pending second factor is not an outcome yet.
+func (s *Service) auditLogin(ctx context.Context, method, identifier string, u *db.User, err error) {
+	if errors.Is(err, ErrSecondFactorRequired) {
+		return
+	}
+	e := audit.Event{
+		Action:     audit.ActionLogin,
+		TargetType: audit.TargetUser,
+		TargetID:   u.ID,
+		Details:    map[string]any{"method": method},
+	}
+	if identifier != "" {
+		e.Details["identifier"] = identifier
+	}
+	if err != nil {
+		e.Outcome = audit.OutcomeFailure
+		e.Details["reason"] = loginFailureReason(err)
+	} else {
+		e.ActorID, e.ActorName = u.ID, u.Username
+	}
+	s.audit.Record(ctx, e)
+}
+
+// loginFailureReason names err for the audit log without leaking internals.
+func loginFailureReason(err error) string {
+	var locked *LockedError
+	switch {
+	case errors.Is(err, ErrInvalidCredentials):
+		return "invalid_credentials"
+	case errors.As(err, &locked):
+		return "account_locked"
+	case errors.Is(err, ErrUserInactive):
+		return "account_inactive"
+	case errors.Is(err, ErrEmailNotVerified):
+		return "email_not_verified"
+	case errors.Is(err, ErrPasswordExpired):
+		return "password_expired"
+	case errors.Is(err, ErrInvalidOTP):
+		return "invalid_code"
+	case errors.Is(err, ErrExternalEmailMissing):
+		return "email_missing"
+	case errors.Is(err, ErrExternalEmailTaken):
+		return "email_taken"
+	case errors.Is(err, ErrRegistrationClosed):
+		return "registration_closed"
+	case errors.Is(err, ErrRegistrationDisabled):
+		return "registration_disabled"
+	}
+	return "error"
+}
+
+// auditUserChange records an admin action on u. The actor is the caller in ctx.
+func (s *Service) auditUserChange(ctx context.Context, action string, u *db.User, before, after map[string]any) {
+	s.audit.Record(ctx, audit.Event{
+		Action:     action,
+		TargetType: audit.TargetUser,
+		TargetID:   u.ID,
+		Before:     before,
+		After:      after,
+		Details:    map[string]any{"username": u.Username},
+	})
+}
+
+// auditUserCreate records the creation of u; details say how it was created.
+func (s *Service) auditUserCreate(ctx context.Context, u *db.User, details map[string]any) {
+	e := audit.Event{
+		Action:     audit.ActionUserCreate,
+		TargetType: audit.TargetUser,
+		TargetID:   u.ID,
+		After:      map[string]any{"username": u.Username, "email": u.Email, "role": u.Role, "status": u.Status},
+		Details:    details,
+	}
+	if caller, ok := authctx.UserFrom(ctx); !ok || caller == nil {
+		// Self-registration and single sign-on: the new user is the actor.
+		e.ActorID, e.ActorName = u.ID, u.Username
+	}
+	s.audit.Record(ctx, e)
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// BreachedPasswords is an offline list of SHA-1 hashes of passwords known from
+// breaches. Hashes are grouped by their first five hex characters, the same
+// k-anonymity layout as the Have I Been Pwned range API, so a lookup only ever
+// touches one prefix bucket.
+type BreachedPasswords struct {
+	ranges map[string]map[string]struct{}
+	count  int
+}
+
+// LoadBreachedPasswords reads a breached password list from path.
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open breached password list: %w", err)
+	}
+	defer f.Close()
+	return ParseBreachedPasswords(f)
+}
+
+// ParseBreachedPasswords reads one uppercase or lowercase SHA-1 hex hash per
+// line, optionally followed by ":<count>" as in the Have I Been Pwned
+// downloads. Blank lines and lines starting with # are ignored.
+func ParseBreachedPasswords(r io.Reader) (*BreachedPasswords, error) {
+	b := &BreachedPasswords{ranges: make(map[string]map[string]struct{})}
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		hash, _, _ := strings.Cut(text, ":")
+		hash = strings.ToUpper(hash)
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("breached password list line %d: not a SHA-1 hash", line)
+		}
+		if _, err := hex.DecodeString(hash); err != nil {
+			return nil, fmt.Errorf("breached password list line %d: not a SHA-1 hash", line)
+		}
+		b.add(hash)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read breached password list: %w", err)
+	}
+	return b, nil
+}
+
+func (b *BreachedPasswords) add(hash string) {
+	prefix, suffix := hash[:5], hash[5:]
+	bucket, ok := b.ranges[prefix]
+	if !ok {
+		bucket = make(map[string]struct{})
+		b.ranges[prefix] = bucket
+	}
+	if _, dup := bucket[suffix]; !dup {
+		bucket[suffix] = struct{}{}
+		b.count++
+	}
+}
+
+// Len returns the number of distinct hashes in the list.
+func (b *BreachedPasswords) Len() int {
+	if b == nil {
+		return 0
+	}
+	return b.count
+}
+
+// Contains reports whether password appears in the list. A nil list contains nothing.
+func (b *BreachedPasswords) Contains(password string) bool {
+	if b == nil {
+		return false
+	}
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	_, ok := b.ranges[hash[:5]][hash[5:]]
+	return ok
+}
@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-demo/internal/audit"
+	"go-demo/internal/db"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrExternalEmailMissing = errors.New("identity provider did not return an email address")
+	ErrExternalEmailTaken   = errors.New("email belongs to an account that cannot be linked")
+)
+
+// externalCreatedBy is recorded as created_by/updated_by for changes made
+// during single sign-on.
+const externalCreatedBy = "oidc"
+
+// ExternalIdentity is a user authenticated by an OpenID Connect provider.
+type ExternalIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	// Role is the DEMO.ROLE code mapped from the provider's claims. When empty,
+	// new users get the default role; existing users keep their role unless
+	// RoleMapped is set, in which case they are reset to the default role.
+	Role string
+	// RoleMapped reports that role mapping is configured, making the
+	// provider the source of truth for every user's role.
+	RoleMapped bool
+}
+
+// LoginExternal signs in the user linked to id, provisioning one on first
+// login as REGISTRATION_MODE allows. An existing account with the same email
+// is linked only when both the provider and this service have verified that
+// address. Returns the same values as Login, including a
+// SecondFactorChallenge for users with 2FA.
+func (s *Service) LoginExternal(ctx context.Context, id ExternalIdentity, defaultRole string) (_ *db.User, _ string, _ time.Time, _ string, _ time.Time, err error) {
+	if id.Issuer == "" || id.Subject == "" {
+		return nil, "", time.Time{}, "", time.Time{}, fmt.Errorf("missing issuer or subject")
+	}
+
+	var u db.User
+	defer func() { s.auditLogin(ctx, "oidc", id.Email, &u, err) }()
+	created := false
+	var inv *db.Invitation
+	oldRole := ""
+	err = s.transaction(ctx, func(tx *gorm.DB) error {
+		now := time.Now()
+		var link db.UserIdentity
+		err := tx.Where("issuer = ? AND subject = ?", id.Issuer, id.Subject).First(&link).Error
+		switch {
+		case err == nil:
+			if err := tx.First(&u, "id = ?", link.UserID).Error; err != nil {
+				return fmt.Errorf("find user: %w", err)
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if id.Email == "" {
+				return ErrExternalEmailMissing
+			}
+			err := tx.Where("email = ?", id.Email).First(&u).Error
+			switch {
+			case err == nil:
+				if !id.EmailVerified || u.EmailVerifiedAt == nil || u.ServiceAccount {
+					return ErrExternalEmailTaken
+				}
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				if inv, err = s.provisionExternalUser(tx, &u, id, defaultRole); err != nil {
+					return err
+				}
+				created = true
+			default:
+				return fmt.Errorf("find user: %w", err)
+			}
+			link = db.UserIdentity{UserID: u.ID, Issuer: id.Issuer, Subject: id.Subject}
+			if err := tx.Create(&link).Error; err != nil {
+				return fmt.Errorf("link identity: %w", err)
+			}
+		default:
+			return fmt.Errorf("find identity: %w", err)
+		}
+
+		// The provider is the source of truth for mapped roles: with mapping
+		// configured, users no rule matches drop back to the default role.
+		role := id.Role
+		if role == "" && id.RoleMapped {
+			role = defaultRole
+		}
+		if role != "" && role != u.Role && !created {
+			if err := checkRoleExists(tx, role); err != nil {
+				return err
+			}
+			oldRole = u.Role
+			if err := tx.Model(&u).Updates(map[string]interface{}{"role": role, "updated_by": externalCreatedBy}).Error; err != nil {
+				return fmt.Errorf("update role: %w", err)
+			}
+			u.Role = role
+			s.log.Info("role updated from identity provider", "user_id", u.ID, "role", role)
+		}
+		return tx.Model(&link).Updates(map[string]interface{}{"email": id.Email, "last_login_at": now}).Error
+	})
+	if err != nil {
+		return nil, "", time.Time{}, "", time.Time{}, err
+	}
+	if created {
+		details := map[string]any{"source": externalCreatedBy, "issuer": id.Issuer}
+		if inv != nil {
+			details["invitation_id"] = inv.ID
+		}
+		s.auditUserCreate(ctx, &u, details)
+	}
+	if oldRole != "" {
+		s.audit.Record(ctx, audit.Event{
+			Action:     audit.ActionUserRoleChange,
+			ActorName:  externalCreatedBy,
+			TargetType: audit.TargetUser,
+			TargetID:   u.ID,
+			Before:     map[string]any{"role": oldRole},
+			After:      map[string]any{"role": u.Role},
+			Details:    map[string]any{"username": u.Username, "issuer": id.Issuer},
+		})
+	}
+
+	if created && u.EmailVerifiedAt == nil {
+		if err := s.SendEmailVerification(ctx, &u); err != nil {
+			s.log.Error("failed to send verification email", "user_id", u.ID, "err", err)
+		}
+	}
+	if !s.IsUserActive(&u) {
+		return nil, "", time.Time{}, "", time.Time{}, ErrUserInactive
+	}
+	if s.cfg.RequireEmailVerification && u.EmailVerifiedAt == nil {
+		return nil, "", time.Time{}, "", time.Time{}, ErrEmailNotVerified
+	}
+	if u.TOTPEnabledAt != nil {
+		return nil, "", time.Time{}, "", time.Time{}, s.secondFactorChallenge(ctx, u.ID)
+	}
+	return s.startSession(ctx, &u)
+}
+
+// provisionExternalUser creates a password-less user for id. The username is
+// taken from the provider and suffixed when it is already in use. Like
+// Register it follows REGISTRATION_MODE: in invite mode the provider must have
+// verified an email address with a pending invitation, which then supplies
+// the role and team and is marked accepted.
+func (s *Service) provisionExternalUser(tx *gorm.DB, u *db.User, id ExternalIdentity, defaultRole string) (*db.Invitation, error) {
+	var inv *db.Invitation
+	switch s.RegistrationMode() {
+	case RegistrationDisabled:
+		return nil, ErrRegistrationDisabled
+	case RegistrationInvite:
+		if !id.EmailVerified {
+			return nil, ErrRegistrationClosed
+		}
+		inv = &db.Invitation{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("LOWER(email) = LOWER(?) AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", id.Email, time.Now()).
+			First(inv).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRegistrationClosed
+		}
+		if err != nil {
+			return nil, fmt.Errorf("find invitation: %w", err)
+		}
+	}
+
+	role := id.Role
+	if role == "" {
+		role = defaultRole
+	}
+	if inv != nil {
+		role = inv.Role
+	}
+	if err := checkRoleExists(tx, role); err != nil {
+		return nil, err
+	}
+
+	base := id.Username
+	if base == "" {
+		base, _, _ = strings.Cut(id.Email, "@")
+	}
+	base = truncate(strings.TrimSpace(base), 56)
+	if base == "" {
+		base = "user"
+	}
+	username := base
+	for i := 2; ; i++ {
+		var count int64
+		if err := tx.Model(&db.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("check existing: %w", err)
+		}
+		if count == 0 {
+			break
+		}
+		if i > 100 {
+			return nil, ErrUserExists
+		}
+		username = fmt.Sprintf("%s-%d", base, i)
+	}
+
+	*u = db.User{
+		Username:  username,
+		Email:     id.Email,
+		CreatedBy: externalCreatedBy,
+		UpdatedBy: externalCreatedBy,
+		Role:      role,
+	}
+	if id.EmailVerified {
+		now := time.Now()
+		u.EmailVerifiedAt = &now
+	}
+	if err := tx.Create(u).Error; err != nil {
+		return nil, fmt.Errorf("create user: %w", err)
+	}
+	if inv != nil {
+		if inv.TeamID != nil {
+			if err := tx.Create(&db.TeamMember{TeamID: *inv.TeamID, UserID: u.ID, CreatedBy: inv.InvitedBy}).Error; err != nil {
+				return nil, fmt.Errorf("add team member: %w", err)
+			}
+		}
+		if err := tx.Model(inv).Updates(map[string]interface{}{"accepted_at": time.Now(), "user_id": u.ID}).Error; err != nil {
+			return nil, fmt.Errorf("accept invitation: %w", err)
+		}
+	}
+	s.log.Info("user provisioned from identity provider", "user_id", u.ID, "username", username, "issuer", id.Issuer)
+	return inv, nil
+}
+
+func checkRoleExists(tx *gorm.DB, role string) error {
+	var count int64
+	if err := tx.Model(&db.Role{}).Where("code = ?", role).Count(&count).Error; err != nil {
+		return fmt.Errorf("check role: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidRole, role)
+	}
+	return nil
+}
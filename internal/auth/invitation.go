@@ -0,0 +1,340 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	netmail "net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	"go-demo/internal/audit"
+	"go-demo/internal/db"
+	"go-demo/internal/mail"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Registration modes (REGISTRATION_MODE).
+const (
+	RegistrationOpen     = "open"
+	RegistrationInvite   = "invite"
+	RegistrationDisabled = "disabled"
+)
+
+// maxInvitationTTL caps how far in the future an invitation may expire.
+const maxInvitationTTL = 30 * 24 * time.Hour
+
+var (
+	ErrRegistrationClosed   = errors.New("registration requires an invitation")
+	ErrRegistrationDisabled = errors.New("registration is disabled")
+	ErrInvitationNotFound   = errors.New("invitation not found")
+	ErrInvalidInvitation    = errors.New("invalid or expired invitation")
+	ErrInvitationNotPending = errors.New("invitation is no longer pending")
+	ErrInvalidInvite        = errors.New("invalid invitation request")
+)
+
+// RegistrationMode returns the configured REGISTRATION_MODE.
+func (s *Service) RegistrationMode() string {
+	if s.cfg.RegistrationMode == "" {
+		return RegistrationOpen
+	}
+	return s.cfg.RegistrationMode
+}
+
+// InviteRequest describes an invitation. TeamID is optional for user
+// managers and required for team leaders; a zero ExpiresAt means INVITE_TTL.
+type InviteRequest struct {
+	Email     string
+	Role      string
+	TeamID    string
+	ExpiresAt time.Time
+}
+
+// CreateInvitation stores an invitation and mails its link to req.Email,
+// replacing a pending invitation for the same address. With asManager the
+// inviter manages users and may invite into any team; otherwise the inviter
+// must lead req.TeamID and may only hand out roles whose permissions their own
+// role has as well. ADMIN is never assignable. The token only goes out by
+// mail, so accepting it proves ownership of the address.
+func (s *Service) CreateInvitation(ctx context.Context, req InviteRequest, inviter *db.User, asManager bool) (*db.Invitation, error) {
+	if s.RegistrationMode() == RegistrationDisabled {
+		return nil, ErrRegistrationDisabled
+	}
+	email := strings.TrimSpace(req.Email)
+	if a, err := netmail.ParseAddress(email); err != nil || a.Address != email || len(email) > 255 {
+		return nil, fmt.Errorf("%w: email is not a valid address", ErrInvalidInvite)
+	}
+	if req.Role == "" {
+		req.Role = "USER"
+	}
+	if req.Role == "ADMIN" {
+		return nil, ErrAdminAssign
+	}
+	now := time.Now()
+	expires := req.ExpiresAt
+	if expires.IsZero() {
+		expires = now.Add(s.cfg.InviteTTL)
+	}
+	if !expires.After(now) || expires.Sub(now) > maxInvitationTTL {
+		return nil, fmt.Errorf("%w: expires_at must be in the future and within %s", ErrInvalidInvite, maxInvitationTTL)
+	}
+
+	if err := s.dbx.Gorm.WithContext(ctx).First(&db.Role{}, "code = ?", req.Role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: unknown role %q", ErrInvalidInvite, req.Role)
+		}
+		return nil, fmt.Errorf("check role: %w", err)
+	}
+	if req.TeamID != "" {
+		if err := s.ensureTeam(ctx, req.TeamID); err != nil {
+			return nil, err
+		}
+	}
+	if !asManager {
+		if req.TeamID == "" {
+			return nil, ErrNotTeamLeader
+		}
+		if err := s.requireLeader(ctx, req.TeamID, inviter.ID); err != nil {
+			return nil, err
+		}
+		if err := s.checkDelegableRole(ctx, inviter.Role, req.Role); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidInvite, err)
+		}
+	}
+
+	var count int64
+	if err := s.dbx.Gorm.WithContext(ctx).
+		Model(&db.User{}).
+		Where("LOWER(email) = LOWER(?)", email).
+		Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("check existing: %w", err)
+	}
+	if count > 0 {
+		return nil, ErrUserExists
+	}
+
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, fmt.Errorf("rand: %w", err)
+	}
+	token := hex.EncodeToString(b[:])
+	inv := &db.Invitation{
+		Email:       email,
+		Role:        req.Role,
+		TokenHash:   hashRefreshToken(token),
+		InvitedByID: inviter.ID,
+		InvitedBy:   inviter.Username,
+		ExpiresAt:   expires,
+	}
+	if req.TeamID != "" {
+		inv.TeamID = &req.TeamID
+	}
+	err := s.transaction(ctx, func(tx *gorm.DB) error {
+		if err := tx.Model(&db.Invitation{}).
+			Where("LOWER(email) = LOWER(?) AND accepted_at IS NULL AND revoked_at IS NULL", email).
+			Updates(map[string]interface{}{"revoked_at": now, "revoked_by": inviter.Username}).Error; err != nil {
+			return fmt.Errorf("replace invitation: %w", err)
+		}
+		if err := tx.Create(inv).Error; err != nil {
+			return fmt.Errorf("create invitation: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, audit.Event{
+		Action:     audit.ActionInvitationCreate,
+		TargetType: audit.TargetInvitation,
+		TargetID:   inv.ID,
+		After:      map[string]any{"email": inv.Email, "role": inv.Role, "team_id": req.TeamID, "expires_at": inv.ExpiresAt},
+	})
+
+	if err := s.mailer.Send(ctx, mail.Message{
+		To:      inv.Email,
+		Subject: "You have been invited",
+		Body: fmt.Sprintf("Hello,\n\n%s invited you to create an account. Use the link below to sign up. It expires on %s.\n\n%s\n",
+			inviter.Username, inv.ExpiresAt.UTC().Format(time.RFC1123), s.link("/accept-invitation", token)),
+	}); err != nil {
+		s.log.Error("failed to send invitation email", "invitation_id", inv.ID, "err", err)
+	}
+	return inv, nil
+}
+
+// checkDelegableRole rejects role unless its permissions are a subset of the
+// permissions of callerRole, so nobody can hand out more than they have.
+func (s *Service) checkDelegableRole(ctx context.Context, callerRole, role string) error {
+	own, err := s.PermissionsForRole(ctx, callerRole)
+	if err != nil {
+		return err
+	}
+	perms, err := s.PermissionsForRole(ctx, role)
+	if err != nil {
+		return err
+	}
+	for _, p := range perms {
+		if !slices.Contains(own, p) {
+			return fmt.Errorf("%w: role %s has permission %s", ErrRoleNotDelegable, role, p)
+		}
+	}
+	return nil
+}
+
+// ListInvitations returns invitations newest first, optionally only those in
+// status (pending, accepted, revoked or expired). Without asManager only
+// invitations to teams the actor leads are returned.
+func (s *Service) ListInvitations(ctx context.Context, status string, actor *db.User, asManager bool) ([]db.Invitation, error) {
+	q := s.dbx.Gorm.WithContext(ctx).Model(&db.Invitation{})
+	if !asManager {
+		q = q.Where(`team_id IN (SELECT team_id FROM "DEMO"."TEAM_MEMBER" WHERE user_id = ? AND is_leader)`, actor.ID)
+	}
+	now := time.Now()
+	switch status {
+	case "":
+	case db.InvitationPending:
+		q = q.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", now)
+	case db.InvitationAccepted:
+		q = q.Where("accepted_at IS NOT NULL")
+	case db.InvitationRevoked:
+		q = q.Where("accepted_at IS NULL AND revoked_at IS NOT NULL")
+	case db.InvitationExpired:
+		q = q.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at <= ?", now)
+	default:
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidInvite, status)
+	}
+	var out []db.Invitation
+	if err := q.Order("created_time DESC").Find(&out).Error; err != nil {
+		return nil, fmt.Errorf("list invitations: %w", err)
+	}
+	return out, nil
+}
+
+// RevokeInvitation withdraws a pending invitation. Without asManager the
+// actor must lead the invitation's team.
+func (s *Service) RevokeInvitation(ctx context.Context, id string, actor *db.User, asManager bool) error {
+	var inv db.Invitation
+	if err := s.dbx.Gorm.WithContext(ctx).First(&inv, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvitationNotFound
+		}
+		return fmt.Errorf("find invitation: %w", err)
+	}
+	if !asManager {
+		if inv.TeamID == nil {
+			return ErrNotTeamLeader
+		}
+		if err := s.requireLeader(ctx, *inv.TeamID, actor.ID); err != nil {
+			return err
+		}
+	}
+	res := s.dbx.Gorm.WithContext(ctx).
+		Model(&db.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_by": actor.Username})
+	if res.Error != nil {
+		return fmt.Errorf("revoke invitation: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrInvitationNotPending
+	}
+	s.audit.Record(ctx, audit.Event{
+		Action:     audit.ActionInvitationRevoke,
+		TargetType: audit.TargetInvitation,
+		TargetID:   inv.ID,
+		Before:     map[string]any{"email": inv.Email, "role": inv.Role},
+	})
+	return nil
+}
+
+// AcceptInvitation creates the invited account with the invitation's email,
+// role and team. The email counts as verified since the link was mailed to it.
+func (s *Service) AcceptInvitation(ctx context.Context, token, username, password string) (*db.User, error) {
+	if s.RegistrationMode() == RegistrationDisabled {
+		return nil, ErrRegistrationDisabled
+	}
+	username = strings.TrimSpace(username)
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("missing required fields")
+	}
+	if token == "" {
+		return nil, ErrInvalidInvitation
+	}
+
+	var inv db.Invitation
+	var u *db.User
+	err := s.transaction(ctx, func(tx *gorm.DB) error {
+		if err := tx.First(&inv, "token_hash = ?", hashRefreshToken(token)).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidInvitation
+			}
+			return fmt.Errorf("find invitation: %w", err)
+		}
+		now := time.Now()
+		if inv.Status(now) != db.InvitationPending {
+			return ErrInvalidInvitation
+		}
+
+		var count int64
+		if err := tx.Model(&db.User{}).
+			Where("username = ? OR LOWER(email) = LOWER(?)", username, inv.Email).
+			Count(&count).Error; err != nil {
+			return fmt.Errorf("check existing: %w", err)
+		}
+		if count > 0 {
+			return ErrUserExists
+		}
+		// A policy violation rolls back, so the invitation can be used again.
+		if err := s.CheckPasswordPolicy(password, username, inv.Email); err != nil {
+			return err
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("hash password: %w", err)
+		}
+
+		u = &db.User{
+			Username:        username,
+			Email:           inv.Email,
+			PasswordHash:    string(hash),
+			Role:            inv.Role,
+			CreatedBy:       inv.InvitedBy,
+			UpdatedBy:       inv.InvitedBy,
+			EmailVerifiedAt: &now,
+		}
+		if err := tx.Create(u).Error; err != nil {
+			return fmt.Errorf("create user: %w", err)
+		}
+		if err := s.recordPassword(tx, u.ID, u.PasswordHash); err != nil {
+			return err
+		}
+		if inv.TeamID != nil {
+			if err := tx.Create(&db.TeamMember{TeamID: *inv.TeamID, UserID: u.ID, CreatedBy: inv.InvitedBy}).Error; err != nil {
+				return fmt.Errorf("add team member: %w", err)
+			}
+		}
+		res := tx.Model(&db.Invitation{}).
+			Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", inv.ID).
+			Updates(map[string]interface{}{"accepted_at": now, "user_id": u.ID})
+		if res.Error != nil {
+			return fmt.Errorf("accept invitation: %w", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvalidInvitation
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	details := map[string]any{"source": "invitation", "invitation_id": inv.ID, "invited_by": inv.InvitedBy}
+	if inv.TeamID != nil {
+		details["team_id"] = *inv.TeamID
+	}
+	s.auditUserCreate(ctx, u, details)
+	return u, nil
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-demo/internal/config"
+	"go-demo/internal/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistrationModes(t *testing.T) {
+	ctx := context.Background()
+	inviter := &db.User{ID: "u1", Username: "admin", Role: "ADMIN"}
+
+	s := &Service{cfg: config.Config{RegistrationMode: RegistrationInvite, InviteTTL: time.Hour}}
+	_, err := s.Register(ctx, "alice", "alice@example.com", "alices-pass-123", "self")
+	require.ErrorIs(t, err, ErrRegistrationClosed)
+	_, err = s.CreateInvitation(ctx, InviteRequest{Email: "Alice <alice@example.com>"}, inviter, true)
+	require.ErrorIs(t, err, ErrInvalidInvite)
+	_, err = s.CreateInvitation(ctx, InviteRequest{Email: "alice@example.com", Role: "ADMIN"}, inviter, true)
+	require.ErrorIs(t, err, ErrAdminAssign)
+	_, err = s.CreateInvitation(ctx, InviteRequest{Email: "alice@example.com", ExpiresAt: time.Now().Add(31 * 24 * time.Hour)}, inviter, true)
+	require.ErrorIs(t, err, ErrInvalidInvite)
+
+	s.cfg.RegistrationMode = RegistrationDisabled
+	_, err = s.Register(ctx, "alice", "alice@example.com", "alices-pass-123", "self")
+	require.ErrorIs(t, err, ErrRegistrationDisabled)
+	_, err = s.CreateInvitation(ctx, InviteRequest{Email: "alice@example.com"}, inviter, true)
+	require.ErrorIs(t, err, ErrRegistrationDisabled)
+	_, err = s.AcceptInvitation(ctx, "deadbeef", "alice", "alices-pass-123")
+	require.ErrorIs(t, err, ErrRegistrationDisabled)
+
+	// Single sign-on cannot provision around the registration mode.
+	id := ExternalIdentity{Issuer: "https://idp", Subject: "1", Email: "alice@example.com"}
+	_, err = s.provisionExternalUser(nil, &db.User{}, id, "USER")
+	require.ErrorIs(t, err, ErrRegistrationDisabled)
+	s.cfg.RegistrationMode = RegistrationInvite
+	_, err = s.provisionExternalUser(nil, &db.User{}, id, "USER")
+	require.ErrorIs(t, err, ErrRegistrationClosed)
+
+	require.Equal(t, RegistrationOpen, (&Service{}).RegistrationMode())
+}
+
+func TestInvitationStatus(t *testing.T) {
+	now := time.Now()
+	inv := db.Invitation{ExpiresAt: now.Add(time.Hour)}
+	require.Equal(t, db.InvitationPending, inv.Status(now))
+	require.Equal(t, db.InvitationExpired, inv.Status(now.Add(2*time.Hour)))
+	inv.RevokedAt = &now
+	require.Equal(t, db.InvitationRevoked, inv.Status(now))
+	inv.AcceptedAt = &now
+	require.Equal(t, db.InvitationAccepted, inv.Status(now))
+}
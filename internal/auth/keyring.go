@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is one asymmetric access token key. It signs from NotBefore
+// until a newer key takes over, and is accepted for verification (and
+// published in the JWKS) until NotAfter; a zero NotAfter never expires.
+type SigningKey struct {
+	ID        string
+	Algorithm string // RS256 or EdDSA
+	NotBefore time.Time
+	NotAfter  time.Time
+
+	private crypto.Signer
+}
+
+// NewSigningKey wraps an RSA or Ed25519 private key.
+func NewSigningKey(kid string, priv crypto.Signer, notBefore, notAfter time.Time) (*SigningKey, error) {
+	if kid == "" {
+		return nil, fmt.Errorf("signing key: kid is required")
+	}
+	k := &SigningKey{ID: kid, NotBefore: notBefore, NotAfter: notAfter, private: priv}
+	switch key := priv.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("signing key %s: RSA keys must have at least 2048 bits", kid)
+		}
+		k.Algorithm = jwt.SigningMethodRS256.Alg()
+	case ed25519.PrivateKey:
+		k.Algorithm = jwt.SigningMethodEdDSA.Alg()
+	default:
+		return nil, fmt.Errorf("signing key %s: unsupported key type %T", kid, priv)
+	}
+	if !notAfter.IsZero() && !notAfter.After(notBefore) {
+		return nil, fmt.Errorf("signing key %s: not_after must be after not_before", kid)
+	}
+	return k, nil
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+func (k *SigningKey) expired(now time.Time) bool {
+	return !k.NotAfter.IsZero() && !now.Before(k.NotAfter)
+}
+
+// KeyRing holds the access token signing keys. Keys can be staged ahead of
+// their NotBefore so verifiers fetch them from the JWKS before the first
+// token is signed, and stay valid after being superseded so tokens signed
+// with them live out their TTL.
+type KeyRing struct {
+	keys []*SigningKey // sorted by NotBefore
+}
+
+// NewKeyRing returns a ring of keys; key IDs must be unique.
+func NewKeyRing(keys ...*SigningKey) (*KeyRing, error) {
+	seen := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if seen[k.ID] {
+			return nil, fmt.Errorf("duplicate key id %q", k.ID)
+		}
+		seen[k.ID] = true
+	}
+	sorted := append([]*SigningKey(nil), keys...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].NotBefore.Before(sorted[j].NotBefore) })
+	return &KeyRing{keys: sorted}, nil
+}
+
+// Active returns the key that signs at now: the most recent one whose
+// NotBefore has passed and which has not expired.
+func (r *KeyRing) Active(now time.Time) *SigningKey {
+	if r == nil {
+		return nil
+	}
+	for i := len(r.keys) - 1; i >= 0; i-- {
+		k := r.keys[i]
+		if !k.NotBefore.After(now) && !k.expired(now) {
+			return k
+		}
+	}
+	return nil
+}
+
+// Verifier returns the key with the given ID if it may verify tokens at now.
+func (r *KeyRing) Verifier(kid string, now time.Time) (*SigningKey, bool) {
+	if r == nil {
+		return nil, false
+	}
+	for _, k := range r.keys {
+		if k.ID == kid && !k.expired(now) {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS returns the public keys of every key that has not expired, including
+// keys staged for the future.
+func (r *KeyRing) JWKS(now time.Time) []JWK {
+	out := []JWK{}
+	if r == nil {
+		return out
+	}
+	for _, k := range r.keys {
+		if k.expired(now) {
+			continue
+		}
+		jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Algorithm}
+		switch pub := k.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		out = append(out, jwk)
+	}
+	return out
+}
+
+// keyRingFile is the JSON manifest read by LoadKeyRing.
+type keyRingFile struct {
+	Keys []struct {
+		Kid       string    `json:"kid"`
+		File      string    `json:"file"`
+		NotBefore time.Time `json:"not_before"`
+		NotAfter  time.Time `json:"not_after"`
+	} `json:"keys"`
+}
+
+// LoadKeyRing reads a manifest listing key IDs, PEM private key files
+// (relative paths are resolved against the manifest's directory) and their
+// not_before/not_after times.
+func LoadKeyRing(path string) (*KeyRing, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key ring: %w", err)
+	}
+	var manifest keyRingFile
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, fmt.Errorf("parse key ring %s: %w", path, err)
+	}
+	if len(manifest.Keys) == 0 {
+		return nil, fmt.Errorf("key ring %s has no keys", path)
+	}
+	keys := make([]*SigningKey, 0, len(manifest.Keys))
+	for _, entry := range manifest.Keys {
+		file := entry.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(path), file)
+		}
+		priv, err := loadPrivateKey(file)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", entry.Kid, err)
+		}
+		k, err := NewSigningKey(entry.Kid, priv, entry.NotBefore, entry.NotAfter)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return NewKeyRing(keys...)
+}
+
+// loadPrivateKey reads a PKCS#8 (RSA or Ed25519) or PKCS#1 (RSA) PEM file.
+func loadPrivateKey(path string) (crypto.Signer, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read private key: %w", err)
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%s: unsupported key type %T", path, key)
+		}
+		return signer, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+}
+
+// SetKeyRing switches access tokens to asymmetric signing with ring; nil
+// goes back to HS256 with JWT_SECRET. It is safe to call while serving.
+func (s *Service) SetKeyRing(ring *KeyRing) {
+	s.keyRing.Store(ring)
+}
+
+// KeyRing returns the current key ring, or nil when tokens use HS256.
+func (s *Service) KeyRing() *KeyRing {
+	return s.keyRing.Load()
+}
+
+// RunKeyRingReload re-reads the key ring manifest at path every interval
+// until ctx is cancelled, so staged keys can be added without a restart.
+// A failed reload keeps the current ring. A non-positive interval disables it.
+func (s *Service) RunKeyRingReload(ctx context.Context, path string, interval time.Duration) {
+	if interval <= 0 || path == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ring, err := LoadKeyRing(path)
+		if err != nil {
+			s.log.Error("key ring reload failed", "path", path, "err", err)
+			continue
+		}
+		s.SetKeyRing(ring)
+	}
+}
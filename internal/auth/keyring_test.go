@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+
+	"go-demo/internal/config"
+	"go-demo/internal/db"
+)
+
+func newEdKey(t *testing.T, kid string, notBefore, notAfter time.Time) *SigningKey {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	k, err := NewSigningKey(kid, priv, notBefore, notAfter)
+	require.NoError(t, err)
+	return k
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	now := time.Now()
+	old := newEdKey(t, "old", now.Add(-48*time.Hour), now.Add(time.Hour))
+	cur := newEdKey(t, "cur", now.Add(-time.Hour), time.Time{})
+	next := newEdKey(t, "next", now.Add(24*time.Hour), time.Time{})
+	ring, err := NewKeyRing(next, old, cur)
+	require.NoError(t, err)
+
+	require.Equal(t, "cur", ring.Active(now).ID)
+	require.Equal(t, "old", ring.Active(now.Add(-2*time.Hour)).ID)
+	require.Equal(t, "next", ring.Active(now.Add(25*time.Hour)).ID)
+
+	// The superseded key verifies until it expires; the staged one already verifies.
+	_, ok := ring.Verifier("old", now)
+	require.True(t, ok)
+	_, ok = ring.Verifier("old", now.Add(2*time.Hour))
+	require.False(t, ok)
+	_, ok = ring.Verifier("next", now)
+	require.True(t, ok)
+
+	jwks := ring.JWKS(now.Add(2 * time.Hour))
+	require.Len(t, jwks, 2)
+	require.Equal(t, "OKP", jwks[0].Kty)
+	require.Equal(t, "EdDSA", jwks[0].Alg)
+
+	_, err = NewKeyRing(cur, cur)
+	require.Error(t, err)
+}
+
+func TestTokenSigningWithKeyRing(t *testing.T) {
+	s := &Service{cfg: config.Config{JWTSecret: "legacy-secret", JWTTTL: time.Minute, JWTAcceptHS256: true}}
+	u := db.User{ID: "3c1f3c59-8d0b-4b6c-9a53-2b0c8a7d2f10", Role: "USER"}
+
+	legacy, _, err := s.signToken(Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: u.ID}, Role: u.Role})
+	require.NoError(t, err)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	k1, err := NewSigningKey("k1", rsaKey, time.Now().Add(-time.Hour), time.Time{})
+	require.NoError(t, err)
+	ring, err := NewKeyRing(k1)
+	require.NoError(t, err)
+	s.SetKeyRing(ring)
+
+	tok, _, err := s.signToken(Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: u.ID}, Role: u.Role})
+	require.NoError(t, err)
+	parsed, _, err := jwt.NewParser().ParseUnverified(tok, &Claims{})
+	require.NoError(t, err)
+	require.Equal(t, "RS256", parsed.Method.Alg())
+	require.Equal(t, "k1", parsed.Header["kid"])
+
+	claims, err := s.ParseToken(tok)
+	require.NoError(t, err)
+	require.Equal(t, u.ID, claims.Subject)
+
+	// HS256 tokens keep working during the migration, and stop once disabled.
+	_, err = s.ParseToken(legacy)
+	require.NoError(t, err)
+	s.cfg.JWTAcceptHS256 = false
+	_, err = s.ParseToken(legacy)
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// Tokens from keys that left the ring are rejected.
+	ring, err = NewKeyRing(newEdKey(t, "k2", time.Now().Add(-time.Minute), time.Time{}))
+	require.NoError(t, err)
+	s.SetKeyRing(ring)
+	_, err = s.ParseToken(tok)
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// A ring whose keys are all expired or not yet valid signs nothing instead
+	// of falling back to HS256.
+	ring, err = NewKeyRing(
+		newEdKey(t, "expired", time.Now().Add(-48*time.Hour), time.Now().Add(-time.Hour)),
+		newEdKey(t, "staged", time.Now().Add(time.Hour), time.Time{}),
+	)
+	require.NoError(t, err)
+	s.SetKeyRing(ring)
+	_, _, err = s.signToken(Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: u.ID}, Role: u.Role})
+	require.Error(t, err)
+}
+
+func TestLoadKeyRing(t *testing.T) {
+	dir := t.TempDir()
+	_, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(edPriv)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ed.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "rsa.pem"), pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), 0o600))
+
+	manifest := fmt.Sprintf(`{"keys": [
+		{"kid": "2026-09", "file": "rsa.pem", "not_before": %q, "not_after": %q},
+		{"kid": "2026-10", "file": "ed.pem", "not_before": %q}
+	]}`, time.Now().Add(-30*24*time.Hour).Format(time.RFC3339), time.Now().Add(24*time.Hour).Format(time.RFC3339),
+		time.Now().Add(-time.Hour).Format(time.RFC3339))
+	path := filepath.Join(dir, "keyring.json")
+	require.NoError(t, os.WriteFile(path, []byte(manifest), 0o600))
+
+	ring, err := LoadKeyRing(path)
+	require.NoError(t, err)
+	require.Equal(t, "2026-10", ring.Active(time.Now()).ID)
+	jwks := ring.JWKS(time.Now())
+	require.Len(t, jwks, 2)
+	require.Equal(t, "RSA", jwks[0].Kty)
+	require.Equal(t, "AQAB", jwks[0].E)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"keys": [{"kid": "x", "file": "missing.pem"}]}`), 0o600))
+	_, err = LoadKeyRing(path)
+	require.Error(t, err)
+}
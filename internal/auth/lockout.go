@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-demo/internal/db"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrAccountLocked = errors.New("account locked")
+
+// LockedError reports a login attempt against a locked account.
+// It matches ErrAccountLocked with errors.Is.
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("account locked until %s", e.Until.Format(time.RFC3339))
+}
+
+func (e *LockedError) Is(target error) bool { return target == ErrAccountLocked }
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// dummyCompare spends the same bcrypt work as a real password check so that
+// logins for unknown identifiers take as long as ones with a wrong password.
+func dummyCompare(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+	})
+	_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+// lockoutDuration returns how long an account stays locked after the given
+// number of consecutive failures: nothing below maxFailures, then base,
+// doubling with each further failure up to max.
+func lockoutDuration(failures, maxFailures int, base, max time.Duration) time.Duration {
+	if maxFailures <= 0 || failures < maxFailures || base <= 0 {
+		return 0
+	}
+	d := base
+	for i := maxFailures; i < failures; i++ {
+		d *= 2
+		if max > 0 && d >= max {
+			return max
+		}
+	}
+	if max > 0 && d > max {
+		return max
+	}
+	return d
+}
+
+// recordLoginFailure counts a failed password check and locks the account
+// once the configured threshold is reached.
+func (s *Service) recordLoginFailure(ctx context.Context, userID string) {
+	now := time.Now()
+	var u db.User
+	err := s.transaction(ctx, func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&u, "id = ?", userID).Error; err != nil {
+			return err
+		}
+		u.FailedLoginCount++
+		updates := map[string]interface{}{
+			"failed_login_count":   u.FailedLoginCount,
+			"last_failed_login_at": now,
+		}
+		if d := lockoutDuration(u.FailedLoginCount, s.cfg.LoginMaxFailures, s.cfg.LoginLockoutDuration, s.cfg.LoginLockoutMax); d > 0 {
+			until := now.Add(d)
+			u.LockedUntil = &until
+			updates["locked_until"] = until
+		}
+		return tx.Model(&db.User{}).Where("id = ?", userID).UpdateColumns(updates).Error
+	})
+	if err != nil {
+		s.log.Warn("failed to record login failure", "user_id", userID, "err", err)
+		return
+	}
+	if u.LockedUntil != nil && u.LockedUntil.After(now) {
+		s.log.Warn("account locked",
+			"event", "account_locked",
+			"user_id", userID,
+			"failures", u.FailedLoginCount,
+			"locked_until", *u.LockedUntil,
+		)
+	}
+}
+
+// maxTrackedIdentifiers bounds the memory used for unknown identifiers.
+const maxTrackedIdentifiers = 10000
+
+// failureTracker counts failed logins in memory for identifiers that have no
+// password account, so that they lock after the same number of failures as
+// real accounts and a lockout response does not reveal which accounts exist.
+// The zero value is ready to use.
+type failureTracker struct {
+	mu      sync.Mutex
+	entries map[string]*trackedFailures
+}
+
+type trackedFailures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// fail records a failed login for identifier at now. It returns a
+// *LockedError while the identifier is locked, without counting the attempt,
+// and ErrInvalidCredentials otherwise. Entries idle for longer than keep are
+// dropped when the tracker is full.
+func (t *failureTracker) fail(identifier string, now time.Time, maxFailures int, base, max, keep time.Duration) error {
+	if maxFailures <= 0 {
+		return ErrInvalidCredentials
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.entries == nil {
+		t.entries = make(map[string]*trackedFailures)
+	}
+	e, ok := t.entries[identifier]
+	if !ok {
+		if len(t.entries) >= maxTrackedIdentifiers {
+			for id, old := range t.entries {
+				if now.Sub(old.last) > keep && !old.lockedUntil.After(now) {
+					delete(t.entries, id)
+				}
+			}
+			if len(t.entries) >= maxTrackedIdentifiers {
+				return ErrInvalidCredentials
+			}
+		}
+		e = &trackedFailures{}
+		t.entries[identifier] = e
+	}
+	if e.lockedUntil.After(now) {
+		return &LockedError{Until: e.lockedUntil}
+	}
+	e.count++
+	e.last = now
+	if d := lockoutDuration(e.count, maxFailures, base, max); d > 0 {
+		e.lockedUntil = now.Add(d)
+	}
+	return ErrInvalidCredentials
+}
+
+// unknownLoginFailure records a failed login for an identifier without a
+// password account and returns the error a real account would produce.
+func (s *Service) unknownLoginFailure(identifier string) error {
+	keep := s.cfg.LoginLockoutMax
+	if keep < time.Hour {
+		keep = time.Hour
+	}
+	return s.unknownLogins.fail(identifier, time.Now(), s.cfg.LoginMaxFailures, s.cfg.LoginLockoutDuration, s.cfg.LoginLockoutMax, keep)
+}
+
+// Lockout describes an account with failed logins or an active lock.
+type Lockout struct {
+	UserID           string
+	Username         string
+	Email            string
+	FailedLoginCount int
+	LastFailedAt     *time.Time
+	LockedUntil      *time.Time
+}
+
+func toLockout(u db.User) Lockout {
+	return Lockout{
+		UserID:           u.ID,
+		Username:         u.Username,
+		Email:            u.Email,
+		FailedLoginCount: u.FailedLoginCount,
+		LastFailedAt:     u.LastFailedLoginAt,
+		LockedUntil:      u.LockedUntil,
+	}
+}
+
+// ListLockouts returns accounts that are currently locked or have failed
+// logins since their last success, most recent failure first.
+func (s *Service) ListLockouts(ctx context.Context) ([]Lockout, error) {
+	var users []db.User
+	if err := s.dbx.Gorm.WithContext(ctx).
+		Where("locked_until > ? OR failed_login_count > 0", time.Now()).
+		Order("last_failed_login_at DESC NULLS LAST").
+		Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("list lockouts: %w", err)
+	}
+	out := make([]Lockout, 0, len(users))
+	for _, u := range users {
+		out = append(out, toLockout(u))
+	}
+	return out, nil
+}
+
+// GetLockout returns the lockout state of one account.
+func (s *Service) GetLockout(ctx context.Context, userID string) (*Lockout, error) {
+	var u db.User
+	if err := s.dbx.Gorm.WithContext(ctx).First(&u, "id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	l := toLockout(u)
+	return &l, nil
+}
+
+// ClearLockout unlocks the account and resets its failure counter.
+func (s *Service) ClearLockout(ctx context.Context, userID, by string) error {
+	res := s.dbx.Gorm.WithContext(ctx).Model(&db.User{}).Where("id = ?", userID).
+		Updates(map[string]interface{}{
+			"failed_login_count": 0,
+			"locked_until":       nil,
+			"updated_by":         by,
+		})
+	if res.Error != nil {
+		return fmt.Errorf("clear lockout: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	base, max := time.Minute, 10*time.Minute
+	cases := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{4, 0},
+		{5, time.Minute},
+		{6, 2 * time.Minute},
+		{7, 4 * time.Minute},
+		{8, 8 * time.Minute},
+		{9, 10 * time.Minute},
+		{50, 10 * time.Minute},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.want, lockoutDuration(c.failures, 5, base, max), "failures=%d", c.failures)
+	}
+
+	require.Equal(t, time.Duration(0), lockoutDuration(100, 0, base, max), "threshold 0 disables lockout")
+}
+
+func TestFailureTracker(t *testing.T) {
+	var tr failureTracker
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		require.ErrorIs(t, tr.fail("nobody", now, 3, time.Minute, time.Hour, time.Hour), ErrInvalidCredentials)
+	}
+	// Locked like a real account, with the same error shape.
+	err := tr.fail("nobody", now, 3, time.Minute, time.Hour, time.Hour)
+	var locked *LockedError
+	require.ErrorAs(t, err, &locked)
+	require.Equal(t, now.Add(time.Minute), locked.Until)
+	require.ErrorIs(t, tr.fail("somebody", now, 3, time.Minute, time.Hour, time.Hour), ErrInvalidCredentials)
+
+	// After the lock the next failure doubles it.
+	later := now.Add(2 * time.Minute)
+	require.ErrorIs(t, tr.fail("nobody", later, 3, time.Minute, time.Hour, time.Hour), ErrInvalidCredentials)
+	require.ErrorAs(t, tr.fail("nobody", later, 3, time.Minute, time.Hour, time.Hour), &locked)
+	require.Equal(t, later.Add(2*time.Minute), locked.Until)
+
+	require.ErrorIs(t, (&failureTracker{}).fail("x", now, 0, time.Minute, time.Hour, time.Hour), ErrInvalidCredentials)
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"go-demo/internal/db"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var ErrWeakPassword = errors.New("password does not meet the policy")
+
+// Password policy violation codes, returned to clients as error codes.
+const (
+	PasswordTooShort        = "password_too_short"
+	PasswordTooLong         = "password_too_long"
+	PasswordTooSimple       = "password_too_simple"
+	PasswordMatchesIdentity = "password_matches_identity"
+	PasswordReused          = "password_reused"
+	PasswordBreached        = "password_breached"
+)
+
+// maxPasswordBytes is the most bcrypt will hash.
+const maxPasswordBytes = 72
+
+// PolicyError reports which password rule was violated.
+// It matches ErrWeakPassword with errors.Is.
+type PolicyError struct {
+	Code    string
+	Message string
+}
+
+func (e *PolicyError) Error() string { return e.Message }
+
+func (e *PolicyError) Is(target error) bool { return target == ErrWeakPassword }
+
+// SetBreachedPasswords sets the list new passwords are checked against; nil disables the check.
+func (s *Service) SetBreachedPasswords(b *BreachedPasswords) {
+	s.breached = b
+}
+
+// characterClasses counts how many of lowercase, uppercase, digits and other
+// characters appear in password.
+func characterClasses(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	n := 0
+	for _, ok := range []bool{lower, upper, digit, other} {
+		if ok {
+			n++
+		}
+	}
+	return n
+}
+
+// CheckPasswordPolicy validates password against the configured length and
+// character class rules, the account's own username and email, and the
+// breached password list. Reuse is checked separately when the password is stored.
+func (s *Service) CheckPasswordPolicy(password, username, email string) error {
+	if min := s.cfg.PasswordMinLength; min > 0 && len([]rune(password)) < min {
+		return &PolicyError{Code: PasswordTooShort, Message: fmt.Sprintf("password must be at least %d characters", min)}
+	}
+	if len(password) > maxPasswordBytes {
+		return &PolicyError{Code: PasswordTooLong, Message: fmt.Sprintf("password must be at most %d bytes", maxPasswordBytes)}
+	}
+	if min := s.cfg.PasswordMinClasses; min > 0 && characterClasses(password) < min {
+		return &PolicyError{Code: PasswordTooSimple, Message: fmt.Sprintf("password must mix at least %d of: lowercase, uppercase, digits, symbols", min)}
+	}
+	local, _, _ := strings.Cut(email, "@")
+	for _, id := range []string{username, email, local} {
+		if id != "" && strings.EqualFold(password, id) {
+			return &PolicyError{Code: PasswordMatchesIdentity, Message: "password must not be your username or email"}
+		}
+	}
+	if s.breached.Contains(password) {
+		return &PolicyError{Code: PasswordBreached, Message: "password appears in a known data breach; choose another"}
+	}
+	return nil
+}
+
+// checkPasswordReuse rejects password if it matches the user's current
+// password or one of the last PASSWORD_HISTORY ones.
+func (s *Service) checkPasswordReuse(tx *gorm.DB, u *db.User, password string) error {
+	if s.cfg.PasswordHistory <= 0 {
+		return nil
+	}
+	hashes := []string{u.PasswordHash}
+	var history []db.PasswordHistory
+	if err := tx.Where("user_id = ?", u.ID).
+		Order("created_time DESC").
+		Limit(s.cfg.PasswordHistory).
+		Find(&history).Error; err != nil {
+		return fmt.Errorf("load password history: %w", err)
+	}
+	for _, h := range history {
+		hashes = append(hashes, h.PasswordHash)
+	}
+	for _, h := range hashes {
+		if h != "" && bcrypt.CompareHashAndPassword([]byte(h), []byte(password)) == nil {
+			return &PolicyError{
+				Code:    PasswordReused,
+				Message: fmt.Sprintf("password must differ from your last %d passwords", s.cfg.PasswordHistory),
+			}
+		}
+	}
+	return nil
+}
+
+// recordPassword adds hash to the user's password history and drops entries
+// beyond PASSWORD_HISTORY.
+func (s *Service) recordPassword(tx *gorm.DB, userID, hash string) error {
+	if s.cfg.PasswordHistory <= 0 {
+		return nil
+	}
+	if err := tx.Create(&db.PasswordHistory{UserID: userID, PasswordHash: hash}).Error; err != nil {
+		return fmt.Errorf("record password history: %w", err)
+	}
+	keep := tx.Model(&db.PasswordHistory{}).Select("id").
+		Where("user_id = ?", userID).
+		Order("created_time DESC").
+		Limit(s.cfg.PasswordHistory)
+	if err := tx.Where("user_id = ? AND id NOT IN (?)", userID, keep).
+		Delete(&db.PasswordHistory{}).Error; err != nil {
+		return fmt.Errorf("prune password history: %w", err)
+	}
+	return nil
+}
+
+// setPassword checks newPassword against the policy and history of u, then
+// stores its hash together with extra column updates. A chosen password does
+// not expire.
+func (s *Service) setPassword(tx *gorm.DB, u *db.User, newPassword string, extra map[string]interface{}) error {
+	if err := s.CheckPasswordPolicy(newPassword, u.Username, u.Email); err != nil {
+		return err
+	}
+	if err := s.checkPasswordReuse(tx, u, newPassword); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+	updates := map[string]interface{}{"password": string(hash), "password_expires_at": nil}
+	for k, v := range extra {
+		updates[k] = v
+	}
+	if err := tx.Model(&db.User{}).Where("id = ?", u.ID).Updates(updates).Error; err != nil {
+		return fmt.Errorf("update password: %w", err)
+	}
+	u.PasswordHash = string(hash)
+	u.PasswordExpiresAt = nil
+	return s.recordPassword(tx, u.ID, string(hash))
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go-demo/internal/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPasswordPolicy(t *testing.T) {
+	breached, err := ParseBreachedPasswords(strings.NewReader(
+		"# sha1(\"Password1!\")\n" +
+			"32CA9FC1A0F5B6330E3F4C8C1BBECDE9BEDB9573:12\n"))
+	require.NoError(t, err)
+	s := &Service{cfg: config.Config{PasswordMinLength: 8, PasswordMinClasses: 2}}
+	s.SetBreachedPasswords(breached)
+
+	cases := map[string]string{
+		"Correct-Horse-7":        "",
+		"short1":                 PasswordTooShort,
+		"alllowercase":           PasswordTooSimple,
+		strings.Repeat("a1", 40): PasswordTooLong,
+		"Alice2024":              PasswordMatchesIdentity,
+		"alice2024@example.com":  PasswordMatchesIdentity,
+		"Password1!":             PasswordBreached,
+	}
+	for password, want := range cases {
+		err := s.CheckPasswordPolicy(password, "alice2024", "alice2024@example.com")
+		if want == "" {
+			require.NoError(t, err, password)
+			continue
+		}
+		var pe *PolicyError
+		require.True(t, errors.As(err, &pe), password)
+		require.Equal(t, want, pe.Code, password)
+		require.ErrorIs(t, err, ErrWeakPassword)
+	}
+}
+
+func TestParseBreachedPasswords(t *testing.T) {
+	b, err := ParseBreachedPasswords(strings.NewReader(
+		"\n32ca9fc1a0f5b6330e3f4c8c1bbecde9bedb9573\n32CA9FC1A0F5B6330E3F4C8C1BBECDE9BEDB9573:3\n"))
+	require.NoError(t, err)
+	require.Equal(t, 1, b.Len())
+	require.True(t, b.Contains("Password1!"))
+	require.False(t, b.Contains("password1!"))
+
+	_, err = ParseBreachedPasswords(strings.NewReader("not-a-hash\n"))
+	require.Error(t, err)
+
+	var none *BreachedPasswords
+	require.False(t, none.Contains("Password1!"))
+}
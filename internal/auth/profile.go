@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-demo/internal/authctx"
+	"go-demo/internal/db"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWrongPassword  = errors.New("current password is incorrect")
+	ErrInvalidProfile = errors.New("invalid profile")
+)
+
+// actor returns the username of the authenticated caller in ctx for the
+// created_by/updated_by audit columns.
+func actor(ctx context.Context) string {
+	if u, ok := authctx.UserFrom(ctx); ok && u != nil {
+		return u.Username
+	}
+	return "system"
+}
+
+// validUsername reports whether name fits DEMO.USER.username: at most 64
+// characters, with no spaces or "@" so it cannot be mistaken for an email.
+func validUsername(name string) bool {
+	return name != "" && len(name) <= 64 && !strings.ContainsAny(name, " @")
+}
+
+// ChangePassword replaces the user's password after checking the current one.
+// Wrong current passwords count towards the login lockout. All other sessions are signed out; the session in sessionID stays open and
+// gets a fresh access token, since the token version bump invalidates the old one.
+func (s *Service) ChangePassword(ctx context.Context, userID, sessionID, currentPassword, newPassword string) (string, time.Time, error) {
+	if currentPassword == "" || newPassword == "" {
+		return "", time.Time{}, fmt.Errorf("missing required fields")
+	}
+	var u db.User
+	if err := s.dbx.Gorm.WithContext(ctx).First(&u, "id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", time.Time{}, ErrUserNotFound
+		}
+		return "", time.Time{}, fmt.Errorf("find user: %w", err)
+	}
+	if u.LockedUntil != nil && u.LockedUntil.After(time.Now()) {
+		return "", time.Time{}, &LockedError{Until: *u.LockedUntil}
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(currentPassword)); err != nil {
+		s.recordLoginFailure(ctx, u.ID)
+		return "", time.Time{}, ErrWrongPassword
+	}
+
+	err := s.transaction(ctx, func(tx *gorm.DB) error {
+		if err := s.setPassword(tx, &u, newPassword, map[string]interface{}{
+			"token_version": gorm.Expr("token_version + 1"),
+			"updated_by":    actor(ctx),
+		}); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? AND family_id <> ?", userID, sessionID).
+			Delete(&db.RefreshToken{}).Error; err != nil {
+			return fmt.Errorf("revoke other sessions: %w", err)
+		}
+		return tx.First(&u, "id = ?", userID).Error
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return s.GenerateToken(ctx, u, sessionID)
+}
+
+// UpdateProfile changes the user's username and/or email; nil leaves a field
+// unchanged. A new email address has to be verified again.
+func (s *Service) UpdateProfile(ctx context.Context, userID string, username, email *string) (*db.User, error) {
+	var u db.User
+	if err := s.dbx.Gorm.WithContext(ctx).First(&u, "id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+
+	updates := map[string]interface{}{}
+	if username != nil {
+		name := strings.TrimSpace(*username)
+		if !validUsername(name) {
+			return nil, fmt.Errorf("%w: username must be 1-64 characters without spaces or @", ErrInvalidProfile)
+		}
+		if name != u.Username {
+			updates["username"] = name
+		}
+	}
+	emailChanged := false
+	if email != nil {
+		addr := strings.TrimSpace(*email)
+		if addr == "" || !strings.Contains(addr, "@") {
+			return nil, fmt.Errorf("%w: invalid email address", ErrInvalidProfile)
+		}
+		if !strings.EqualFold(addr, u.Email) {
+			updates["email"] = addr
+			updates["email_verified_at"] = nil
+			emailChanged = true
+		} else if addr != u.Email {
+			updates["email"] = addr // case-only change keeps verification
+		}
+	}
+	if len(updates) == 0 {
+		return &u, nil
+	}
+
+	q := s.dbx.Gorm.WithContext(ctx).Model(&db.User{}).Where("id <> ?", userID)
+	switch {
+	case updates["username"] != nil && updates["email"] != nil:
+		q = q.Where("username = ? OR LOWER(email) = LOWER(?)", updates["username"], updates["email"])
+	case updates["username"] != nil:
+		q = q.Where("username = ?", updates["username"])
+	default:
+		q = q.Where("LOWER(email) = LOWER(?)", updates["email"])
+	}
+	var count int64
+	if err := q.Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("check existing: %w", err)
+	}
+	if count > 0 {
+		return nil, ErrUserExists
+	}
+
+	updates["updated_by"] = actor(ctx)
+	if err := s.dbx.Gorm.WithContext(ctx).Model(&u).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("update profile: %w", err)
+	}
+	if err := s.dbx.Gorm.WithContext(ctx).First(&u, "id = ?", userID).Error; err != nil {
+		return nil, fmt.Errorf("reload user: %w", err)
+	}
+	if emailChanged {
+		if err := s.SendEmailVerification(ctx, &u); err != nil {
+			s.log.Error("failed to send verification email", "user_id", u.ID, "err", err)
+		}
+	}
+	return &u, nil
+}
@@ -0,0 +1,311 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go-demo/internal/audit"
+	"go-demo/internal/authctx"
+	"go-demo/internal/db"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrUnknownPermission = errors.New("unknown permission")
+	// ErrAdminLockout prevents removing the permission needed to undo the change.
+	ErrAdminLockout = errors.New("ADMIN must keep roles:manage")
+	ErrInvalidRole  = errors.New("invalid role")
+	ErrRoleExists   = errors.New("role already exists")
+	ErrBuiltInRole  = errors.New("built-in roles cannot be modified or deleted")
+	ErrRoleInUse    = errors.New("role is still in use")
+)
+
+// RoleInput describes a custom role. Permissions are only used on create.
+type RoleInput struct {
+	Code        string
+	Name        string
+	Description string
+	Permissions []string
+}
+
+// RoleWithPermissions is a role together with its granted permission codes.
+type RoleWithPermissions struct {
+	db.Role
+	Permissions []string
+}
+
+// PermissionsForRole returns the sorted permission codes granted to role.
+func (s *Service) PermissionsForRole(ctx context.Context, role string) ([]string, error) {
+	var perms []string
+	if err := s.dbx.Gorm.WithContext(ctx).
+		Model(&db.RolePermission{}).
+		Where("role_code = ?", role).
+		Order("permission_code").
+		Pluck("permission_code", &perms).Error; err != nil {
+		return nil, fmt.Errorf("load permissions: %w", err)
+	}
+	return perms, nil
+}
+
+// checkAssignableRole rejects assigning role to a user: ADMIN is only ever
+// granted by the seed, and an authenticated caller in ctx may only hand out
+// roles whose permissions their own role has as well.
+func (s *Service) checkAssignableRole(ctx context.Context, role string) error {
+	if role == "ADMIN" {
+		return ErrAdminAssign
+	}
+	if caller, ok := authctx.UserFrom(ctx); ok && caller != nil {
+		return s.checkDelegableRole(ctx, caller.Role, role)
+	}
+	return nil
+}
+
+// ListPermissions returns every known permission.
+func (s *Service) ListPermissions(ctx context.Context) ([]db.Permission, error) {
+	var perms []db.Permission
+	if err := s.dbx.Gorm.WithContext(ctx).Order("code").Find(&perms).Error; err != nil {
+		return nil, fmt.Errorf("list permissions: %w", err)
+	}
+	return perms, nil
+}
+
+// ListRolesWithPermissions returns all roles with their granted permissions.
+func (s *Service) ListRolesWithPermissions(ctx context.Context) ([]RoleWithPermissions, error) {
+	var roles []db.Role
+	if err := s.dbx.Gorm.WithContext(ctx).Order("code").Find(&roles).Error; err != nil {
+		return nil, fmt.Errorf("list roles: %w", err)
+	}
+	var grants []db.RolePermission
+	if err := s.dbx.Gorm.WithContext(ctx).Order("permission_code").Find(&grants).Error; err != nil {
+		return nil, fmt.Errorf("list grants: %w", err)
+	}
+	byRole := make(map[string][]string, len(roles))
+	for _, g := range grants {
+		byRole[g.RoleCode] = append(byRole[g.RoleCode], g.PermissionCode)
+	}
+	out := make([]RoleWithPermissions, 0, len(roles))
+	for _, r := range roles {
+		perms := byRole[r.Code]
+		if perms == nil {
+			perms = []string{}
+		}
+		out = append(out, RoleWithPermissions{Role: r, Permissions: perms})
+	}
+	return out, nil
+}
+
+// SetRolePermissions replaces the permissions granted to role and records the
+// previous and new grants in the audit log.
+func (s *Service) SetRolePermissions(ctx context.Context, role string, perms []string, updatedBy string) ([]string, error) {
+	if role == "" || updatedBy == "" {
+		return nil, fmt.Errorf("missing required fields")
+	}
+
+	codes := uniquePermissions(perms)
+	if role == "ADMIN" && !slices.Contains(codes, db.PermRolesManage) {
+		return nil, ErrAdminLockout
+	}
+
+	before := []string{}
+	err := s.transaction(ctx, func(tx *gorm.DB) error {
+		if err := tx.First(&db.Role{}, "code = ?", role).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRoleNotFound
+			}
+			return fmt.Errorf("find role: %w", err)
+		}
+		if err := tx.Model(&db.RolePermission{}).Where("role_code = ?", role).
+			Order("permission_code").Pluck("permission_code", &before).Error; err != nil {
+			return fmt.Errorf("list grants: %w", err)
+		}
+		if err := tx.Where("role_code = ?", role).Delete(&db.RolePermission{}).Error; err != nil {
+			return fmt.Errorf("clear grants: %w", err)
+		}
+		return grantPermissions(tx, role, codes, updatedBy)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Action:     audit.ActionRolePermissions,
+		TargetType: audit.TargetRole,
+		TargetID:   role,
+		Before:     map[string]any{"permissions": before},
+		After:      map[string]any{"permissions": codes},
+	})
+	s.log.Info("role permissions updated", "role", role, "permissions", codes, "by", updatedBy)
+	return codes, nil
+}
+
+// uniquePermissions returns perms sorted and without duplicates.
+func uniquePermissions(perms []string) []string {
+	codes := slices.Clone(perms)
+	slices.Sort(codes)
+	return slices.Compact(codes)
+}
+
+// grantPermissions grants codes to role after checking that they all exist.
+func grantPermissions(tx *gorm.DB, role string, codes []string, grantedBy string) error {
+	if len(codes) == 0 {
+		return nil
+	}
+	var known int64
+	if err := tx.Model(&db.Permission{}).Where("code IN ?", codes).Count(&known).Error; err != nil {
+		return fmt.Errorf("check permissions: %w", err)
+	}
+	if known != int64(len(codes)) {
+		return ErrUnknownPermission
+	}
+	for _, p := range codes {
+		rp := db.RolePermission{RoleCode: role, PermissionCode: p, CreatedBy: grantedBy}
+		if err := tx.Create(&rp).Error; err != nil {
+			return fmt.Errorf("grant %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// checkRoleInput trims the name and validates the fields of a custom role.
+func checkRoleInput(in *RoleInput) error {
+	in.Name = strings.TrimSpace(in.Name)
+	if !db.ValidRoleCode(in.Code) {
+		return fmt.Errorf("%w: code must be upper case letters, digits and underscores, starting with a letter, at most 64 characters", ErrInvalidRole)
+	}
+	if in.Name == "" || len(in.Name) > 128 {
+		return fmt.Errorf("%w: name is required and at most 128 characters", ErrInvalidRole)
+	}
+	return nil
+}
+
+// CreateRole adds a custom role with the given permissions.
+func (s *Service) CreateRole(ctx context.Context, in RoleInput, createdBy string) (*RoleWithPermissions, error) {
+	if err := checkRoleInput(&in); err != nil {
+		return nil, err
+	}
+	codes := uniquePermissions(in.Permissions)
+	role := db.Role{
+		Code:        in.Code,
+		Name:        in.Name,
+		Description: in.Description,
+		CreatedBy:   createdBy,
+		UpdatedBy:   createdBy,
+	}
+	err := s.transaction(ctx, func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&role)
+		if res.Error != nil {
+			return fmt.Errorf("create role: %w", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return ErrRoleExists
+		}
+		return grantPermissions(tx, role.Code, codes, createdBy)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, audit.Event{
+		Action:     audit.ActionRoleCreate,
+		TargetType: audit.TargetRole,
+		TargetID:   role.Code,
+		After:      map[string]any{"name": role.Name, "description": role.Description, "permissions": codes},
+	})
+	s.log.Info("role created", "role", role.Code, "permissions", codes, "by", createdBy)
+	return &RoleWithPermissions{Role: role, Permissions: codes}, nil
+}
+
+// UpdateRole changes the name and description of a custom role.
+func (s *Service) UpdateRole(ctx context.Context, code, name, description, updatedBy string) (*db.Role, error) {
+	in := RoleInput{Code: code, Name: name}
+	if err := checkRoleInput(&in); err != nil {
+		return nil, err
+	}
+	var role db.Role
+	if err := s.dbx.Gorm.WithContext(ctx).First(&role, "code = ?", code).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, fmt.Errorf("find role: %w", err)
+	}
+	if role.BuiltIn {
+		return nil, ErrBuiltInRole
+	}
+	before := map[string]any{"name": role.Name, "description": role.Description}
+	if err := s.dbx.Gorm.WithContext(ctx).
+		Model(&role).
+		Updates(map[string]interface{}{
+			"name":        in.Name,
+			"description": description,
+			"updated_by":  updatedBy,
+		}).Error; err != nil {
+		return nil, fmt.Errorf("update role: %w", err)
+	}
+	role.Name, role.Description, role.UpdatedBy = in.Name, description, updatedBy
+	s.audit.Record(ctx, audit.Event{
+		Action:     audit.ActionRoleUpdate,
+		TargetType: audit.TargetRole,
+		TargetID:   role.Code,
+		Before:     before,
+		After:      map[string]any{"name": role.Name, "description": role.Description},
+	})
+	return &role, nil
+}
+
+// DeleteRole removes a custom role and its permission grants. Roles are
+// referenced with ON DELETE RESTRICT, so a role still held by any user
+// (deleted users included) or by a pending invitation is refused with
+// ErrRoleInUse; accepted, revoked and expired invitations with the role are
+// removed along with it. The role row is locked so that no user can be given
+// the role between the check and the delete.
+func (s *Service) DeleteRole(ctx context.Context, code string) error {
+	var role db.Role
+	err := s.transaction(ctx, func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&role, "code = ?", code).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRoleNotFound
+			}
+			return fmt.Errorf("find role: %w", err)
+		}
+		if role.BuiltIn {
+			return ErrBuiltInRole
+		}
+
+		var users, pending int64
+		if err := tx.Model(&db.User{}).Where("role = ?", code).Count(&users).Error; err != nil {
+			return fmt.Errorf("count users: %w", err)
+		}
+		if err := tx.Model(&db.Invitation{}).
+			Where("role = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", code, time.Now()).
+			Count(&pending).Error; err != nil {
+			return fmt.Errorf("count invitations: %w", err)
+		}
+		if users > 0 || pending > 0 {
+			return fmt.Errorf("%w: assigned to %d users and %d pending invitations", ErrRoleInUse, users, pending)
+		}
+
+		if err := tx.Where("role = ?", code).Delete(&db.Invitation{}).Error; err != nil {
+			return fmt.Errorf("delete invitations: %w", err)
+		}
+		if err := tx.Delete(&role).Error; err != nil {
+			return fmt.Errorf("delete role: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.Event{
+		Action:     audit.ActionRoleDelete,
+		TargetType: audit.TargetRole,
+		TargetID:   role.Code,
+		Before:     map[string]any{"name": role.Name, "description": role.Description},
+	})
+	return nil
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"go-demo/internal/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUniquePermissions(t *testing.T) {
+	require.Equal(t, []string{"audit:read", "users:manage"},
+		uniquePermissions([]string{"users:manage", "audit:read", "users:manage"}))
+	require.Empty(t, uniquePermissions(nil))
+}
+
+func TestSetRolePermissions_AdminLockout(t *testing.T) {
+	_, err := (&Service{}).SetRolePermissions(context.Background(), "ADMIN", []string{db.PermUsersManage}, "admin")
+	require.ErrorIs(t, err, ErrAdminLockout)
+}
+
+func TestCreateRole_Validation(t *testing.T) {
+	s := &Service{}
+	ctx := context.Background()
+	for _, in := range []RoleInput{
+		{Code: "auditor", Name: "Auditor"},
+		{Code: "AUDITOR", Name: "  "},
+		{Code: "", Name: "Auditor"},
+	} {
+		_, err := s.CreateRole(ctx, in, "admin")
+		require.ErrorIs(t, err, ErrInvalidRole, "%+v", in)
+	}
+	_, err := s.UpdateRole(ctx, "AUDITOR", "", "", "admin")
+	require.ErrorIs(t, err, ErrInvalidRole)
+}
+
+func TestCreateUser_RefusesAdmin(t *testing.T) {
+	_, err := (&Service{}).CreateUser(context.Background(), "eve", "eve@example.com", "eves-pass-123", "ADMIN", "admin")
+	require.ErrorIs(t, err, ErrAdminAssign)
+}
+
+func TestCreateServiceAccount_RefusesAdmin(t *testing.T) {
+	_, err := (&Service{}).CreateServiceAccount(context.Background(), "ci-bot", "ADMIN", "admin")
+	require.ErrorIs(t, err, ErrAdminAssign)
+}
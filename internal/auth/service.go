@@ -8,12 +8,19 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"go-demo/internal/audit"
 	"go-demo/internal/config"
 	"go-demo/internal/db"
+	"go-demo/internal/mail"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -21,24 +28,94 @@ import (
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrUserExists         = errors.New("user already exists")
+	ErrUserInactive       = errors.New("user is not active")
+	ErrUserDeleted        = errors.New("user is deleted")
+	ErrUserNotDeleted     = errors.New("user is not deleted")
+	ErrEmailNotVerified   = errors.New("email address not verified")
+	ErrPasswordExpired    = errors.New("temporary password expired")
+	ErrInvalidUserQuery   = errors.New("invalid user query")
+
+	// ADMIN accounts cannot be changed through the user management API.
+	ErrAdminStatusChange = errors.New("cannot modify ADMIN user status")
+	ErrAdminRoleChange   = errors.New("cannot modify ADMIN user role")
+	ErrAdminDelete       = errors.New("cannot delete ADMIN user")
+	ErrAdminAssign       = errors.New("cannot assign ADMIN role")
+
+	// ErrRoleNotDelegable is returned when a caller assigns a role that has
+	// permissions the caller's own role lacks.
+	ErrRoleNotDelegable = errors.New("cannot assign a role with permissions you do not have")
 )
 
 type Claims struct {
 	jwt.RegisteredClaims
-	Role string `json:"role"`
+	Username string `json:"username,omitempty"`
+	Role     string `json:"role"`
+	// Permissions are the role's permissions when the token was issued.
+	Permissions []string `json:"perms,omitempty"`
+	// TokenVersion must match User.TokenVersion; bumping the user's version
+	// invalidates every access token issued before.
+	TokenVersion int `json:"tv"`
+	// SessionID is the refresh token family the access token was issued with.
+	SessionID string `json:"sid,omitempty"`
+	// Enroll2FA is set while the user's role requires 2FA they have not set up.
+	Enroll2FA bool `json:"enroll_2fa,omitempty"`
 }
 
 type Service struct {
-	dbx *db.DB
-	cfg config.Config
-	log *slog.Logger
+	dbx    *db.DB
+	cfg    config.Config
+	log    *slog.Logger
+	mailer mail.Mailer
+
+	breached *BreachedPasswords
+	keyRing  atomic.Pointer[KeyRing]
+	users    *userCache
+	audit    *audit.Recorder
+	// unknownLogins locks identifiers without a password account like real ones.
+	unknownLogins failureTracker
 }
 
+// NewService returns a Service that logs account emails; use SetMailer to deliver them.
 func NewService(dbx *db.DB, cfg config.Config, log *slog.Logger) *Service {
-	return &Service{dbx: dbx, cfg: cfg, log: log}
+	s := &Service{dbx: dbx, cfg: cfg, log: log, mailer: mail.NewLogMailer(log), users: newUserCache(cfg.UserCacheTTL)}
+	if dbx != nil {
+		s.audit = audit.NewRecorder(dbx.Gorm, log)
+	}
+	if dbx != nil && cfg.UserCacheTTL > 0 {
+		if err := s.users.registerInvalidation(dbx.Gorm); err != nil {
+			log.Warn("user cache disabled", "err", err)
+			s.users = nil
+		}
+	}
+	return s
+}
+
+// Stateless reports whether access tokens are trusted until they expire
+// without consulting the database (AUTH_STATELESS).
+func (s *Service) Stateless() bool {
+	return s.cfg.AuthStateless
+}
+
+// Audit returns the recorder of the audit log, for handlers that audit
+// actions outside this service.
+func (s *Service) Audit() *audit.Recorder {
+	return s.audit
+}
+
+// SetMailer sets how password reset and verification emails are delivered.
+func (s *Service) SetMailer(m mail.Mailer) {
+	s.mailer = m
 }
 
+// Register creates a USER account through self-service sign-up, which is
+// only allowed while REGISTRATION_MODE is open.
 func (s *Service) Register(ctx context.Context, username, email, password, createdBy string) (*db.User, error) {
+	switch s.RegistrationMode() {
+	case RegistrationInvite:
+		return nil, ErrRegistrationClosed
+	case RegistrationDisabled:
+		return nil, ErrRegistrationDisabled
+	}
 	if username == "" || email == "" || password == "" {
 		return nil, fmt.Errorf("missing required fields")
 	}
@@ -54,6 +131,9 @@ func (s *Service) Register(ctx context.Context, username, email, password, creat
 		return nil, ErrUserExists
 	}
 
+	if err := s.CheckPasswordPolicy(password, username, email); err != nil {
+		return nil, err
+	}
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, fmt.Errorf("hash password: %w", err)
@@ -67,8 +147,17 @@ func (s *Service) Register(ctx context.Context, username, email, password, creat
 		UpdatedBy:    createdBy,
 		Role:         "USER",
 	}
-	if err := s.dbx.Gorm.WithContext(ctx).Create(u).Error; err != nil {
-		return nil, fmt.Errorf("create user: %w", err)
+	if err := s.transaction(ctx, func(tx *gorm.DB) error {
+		if err := tx.Create(u).Error; err != nil {
+			return fmt.Errorf("create user: %w", err)
+		}
+		return s.recordPassword(tx, u.ID, u.PasswordHash)
+	}); err != nil {
+		return nil, err
+	}
+	s.auditUserCreate(ctx, u, map[string]any{"source": "register"})
+	if err := s.SendEmailVerification(ctx, u); err != nil {
+		s.log.Error("failed to send verification email", "user_id", u.ID, "err", err)
 	}
 	return u, nil
 }
@@ -78,6 +167,9 @@ func (s *Service) CreateUser(ctx context.Context, username, email, password, rol
 	if username == "" || email == "" || password == "" || role == "" {
 		return nil, fmt.Errorf("missing required fields")
 	}
+	if err := s.checkAssignableRole(ctx, role); err != nil {
+		return nil, err
+	}
 
 	// Validate role exists
 	var roleCount int64
@@ -88,7 +180,7 @@ func (s *Service) CreateUser(ctx context.Context, username, email, password, rol
 		return nil, fmt.Errorf("check role: %w", err)
 	}
 	if roleCount == 0 {
-		return nil, fmt.Errorf("invalid role: %s", role)
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRole, role)
 	}
 
 	// Check if user already exists
@@ -103,6 +195,9 @@ func (s *Service) CreateUser(ctx context.Context, username, email, password, rol
 		return nil, ErrUserExists
 	}
 
+	if err := s.CheckPasswordPolicy(password, username, email); err != nil {
+		return nil, err
+	}
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, fmt.Errorf("hash password: %w", err)
@@ -116,80 +211,210 @@ func (s *Service) CreateUser(ctx context.Context, username, email, password, rol
 		UpdatedBy:    createdBy,
 		Role:         role,
 	}
-	if err := s.dbx.Gorm.WithContext(ctx).Create(u).Error; err != nil {
-		return nil, fmt.Errorf("create user: %w", err)
+	if err := s.transaction(ctx, func(tx *gorm.DB) error {
+		if err := tx.Create(u).Error; err != nil {
+			return fmt.Errorf("create user: %w", err)
+		}
+		return s.recordPassword(tx, u.ID, u.PasswordHash)
+	}); err != nil {
+		return nil, err
+	}
+	s.auditUserCreate(ctx, u, map[string]any{"source": "admin"})
+	if err := s.SendEmailVerification(ctx, u); err != nil {
+		s.log.Error("failed to send verification email", "user_id", u.ID, "err", err)
 	}
 	return u, nil
 }
 
-func (s *Service) Login(ctx context.Context, identifier, password string) (*db.User, string, time.Time, string, time.Time, error) {
+func (s *Service) Login(ctx context.Context, identifier, password string) (_ *db.User, _ string, _ time.Time, _ string, _ time.Time, err error) {
 	var u db.User
+	defer func() { s.auditLogin(ctx, "password", identifier, &u, err) }()
 	if err := s.dbx.Gorm.WithContext(ctx).
 		Where("username = ? OR email = ?", identifier, identifier).
 		First(&u).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, "", time.Time{}, "", time.Time{}, ErrInvalidCredentials
+			dummyCompare(password)
+			return nil, "", time.Time{}, "", time.Time{}, s.unknownLoginFailure(identifier)
 		}
 		return nil, "", time.Time{}, "", time.Time{}, fmt.Errorf("find user: %w", err)
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)); err != nil {
+	// Service accounts and users provisioned by single sign-on have no password.
+	if u.ServiceAccount || u.PasswordHash == "" {
+		dummyCompare(password)
+		return nil, "", time.Time{}, "", time.Time{}, s.unknownLoginFailure(identifier)
+	}
+	// The password is always checked so that locked accounts take as long as
+	// any other attempt. Guesses made during the lock neither succeed nor
+	// extend it.
+	pwErr := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password))
+	if u.LockedUntil != nil && u.LockedUntil.After(time.Now()) {
+		return nil, "", time.Time{}, "", time.Time{}, &LockedError{Until: *u.LockedUntil}
+	}
+	if pwErr != nil {
+		s.recordLoginFailure(ctx, u.ID)
 		return nil, "", time.Time{}, "", time.Time{}, ErrInvalidCredentials
 	}
+	if !s.IsUserActive(&u) {
+		return nil, "", time.Time{}, "", time.Time{}, ErrUserInactive
+	}
+	if s.cfg.RequireEmailVerification && u.EmailVerifiedAt == nil {
+		return nil, "", time.Time{}, "", time.Time{}, ErrEmailNotVerified
+	}
+	if u.PasswordExpiresAt != nil && !u.PasswordExpiresAt.After(time.Now()) {
+		return nil, "", time.Time{}, "", time.Time{}, ErrPasswordExpired
+	}
 
-	accessTok, accessExp, err := s.GenerateToken(u)
+	if u.TOTPEnabledAt != nil {
+		return nil, "", time.Time{}, "", time.Time{}, s.secondFactorChallenge(ctx, u.ID)
+	}
+	return s.startSession(ctx, &u)
+}
+
+// startSession records a successful login and opens a new session for u.
+func (s *Service) startSession(ctx context.Context, u *db.User) (*db.User, string, time.Time, string, time.Time, error) {
+	now := time.Now()
+	if err := s.dbx.Gorm.WithContext(ctx).Model(u).UpdateColumns(map[string]interface{}{
+		"last_login_at":      now,
+		"failed_login_count": 0,
+		"locked_until":       nil,
+	}).Error; err != nil {
+		s.log.Warn("failed to record last login", "user_id", u.ID, "err", err)
+	}
+	u.LastLoginAt = &now
+	u.FailedLoginCount = 0
+	u.LockedUntil = nil
+
+	sessionID := uuid.NewString()
+	refreshTok, refreshExp, err := s.storeRefreshToken(s.dbx.Gorm.WithContext(ctx), newSessionToken(ctx, u.ID, sessionID))
 	if err != nil {
 		return nil, "", time.Time{}, "", time.Time{}, err
 	}
-	refreshTok, refreshExp, err := s.GenerateRefreshToken(ctx, u.ID, u.Role)
+	accessTok, accessExp, err := s.GenerateToken(ctx, *u, sessionID)
 	if err != nil {
 		return nil, "", time.Time{}, "", time.Time{}, err
 	}
 
-	return &u, accessTok, accessExp, refreshTok, refreshExp, nil
+	return u, accessTok, accessExp, refreshTok, refreshExp, nil
 }
 
-func (s *Service) GenerateToken(u db.User) (string, time.Time, error) {
-	if s.cfg.JWTSecret == "" {
-		return "", time.Time{}, fmt.Errorf("JWT_SECRET is required")
+// GenerateToken signs an access token for u within the given session (refresh
+// token family); sessionID may be empty for tokens not tied to a session.
+// The token carries the role's current permissions so that stateless
+// verification needs no database access.
+func (s *Service) GenerateToken(ctx context.Context, u db.User, sessionID string) (string, time.Time, error) {
+	perms, err := s.PermissionsForRole(ctx, u.Role)
+	if err != nil {
+		return "", time.Time{}, err
 	}
+	enroll, err := s.SecondFactorEnrollmentRequired(ctx, &u)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return s.signToken(Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: u.ID},
+		Username:         u.Username,
+		Role:             u.Role,
+		Permissions:      perms,
+		TokenVersion:     u.TokenVersion,
+		SessionID:        sessionID,
+		Enroll2FA:        enroll,
+	})
+}
+
+// accessTokenTTL is JWT_TTL, capped at JWT_STATELESS_TTL in stateless mode
+// because such tokens cannot be revoked.
+func (s *Service) accessTokenTTL() time.Duration {
 	ttl := s.cfg.JWTTTL
 	if ttl <= 0 {
 		ttl = 24 * time.Hour
 	}
-	exp := time.Now().Add(ttl)
-	claims := Claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			Subject:   u.ID,
-			ExpiresAt: jwt.NewNumericDate(exp),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-		Role: u.Role,
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	ss, err := token.SignedString([]byte(s.cfg.JWTSecret))
+	if s.cfg.AuthStateless && s.cfg.JWTStatelessTTL > 0 && ttl > s.cfg.JWTStatelessTTL {
+		ttl = s.cfg.JWTStatelessTTL
+	}
+	return ttl
+}
+
+// signToken fills in the registered claims (jti, iss, aud, iat, exp) and signs
+// claims with the active key ring key, or HS256 with JWT_SECRET when no key
+// ring is loaded. A loaded ring without an active key is an error rather than
+// a fallback, since ParseToken may no longer accept HS256 tokens.
+func (s *Service) signToken(claims Claims) (string, time.Time, error) {
+	now := time.Now()
+	ring := s.KeyRing()
+	key := ring.Active(now)
+	if key == nil && ring != nil {
+		return "", time.Time{}, fmt.Errorf("no JWT_KEYRING_FILE key is active at %s", now.UTC().Format(time.RFC3339))
+	}
+	if key == nil && s.cfg.JWTSecret == "" {
+		return "", time.Time{}, fmt.Errorf("JWT_SECRET or an active JWT_KEYRING_FILE key is required")
+	}
+	exp := now.Add(s.accessTokenTTL())
+	claims.ID = uuid.NewString()
+	claims.Issuer = s.cfg.JWTIssuer
+	if s.cfg.JWTAudience != "" {
+		claims.Audience = jwt.ClaimStrings{s.cfg.JWTAudience}
+	}
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(exp)
+
+	var (
+		ss  string
+		err error
+	)
+	if key != nil {
+		token := jwt.NewWithClaims(key.method(), claims)
+		token.Header["kid"] = key.ID
+		ss, err = token.SignedString(key.private)
+	} else {
+		ss, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.cfg.JWTSecret))
+	}
 	if err != nil {
 		return "", time.Time{}, fmt.Errorf("sign token: %w", err)
 	}
 	return ss, exp, nil
 }
 
-func (s *Service) ParseToken(tokenStr string) (string, error) {
-	if s.cfg.JWTSecret == "" {
-		return "", fmt.Errorf("JWT_SECRET is required")
-	}
-	parser := jwt.Parser{}
+// ParseToken verifies an access token's signature, expiry, issuer and
+// audience (allowing JWT_CLOCK_SKEW) and returns its claims. Tokens without
+// a jti are refused. Asymmetric tokens are verified with the key ring entry
+// named by their kid; HS256 tokens are accepted while a JWT_SECRET is configured and,
+// once a key ring is in use, only if JWT_ACCEPT_HS256 is set. Revocation is
+// checked by Authenticate.
+func (s *Service) ParseToken(tokenStr string) (*Claims, error) {
+	ring := s.KeyRing()
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(s.cfg.JWTClockSkew),
+	}
+	if s.cfg.JWTIssuer != "" {
+		opts = append(opts, jwt.WithIssuer(s.cfg.JWTIssuer))
+	}
+	if s.cfg.JWTAudience != "" {
+		opts = append(opts, jwt.WithAudience(s.cfg.JWTAudience))
+	}
+	parser := jwt.NewParser(opts...)
 	claims := &Claims{}
 	t, err := parser.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method")
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+			if s.cfg.JWTSecret == "" || (ring != nil && !s.cfg.JWTAcceptHS256) {
+				return nil, fmt.Errorf("HS256 tokens are not accepted")
+			}
+			return []byte(s.cfg.JWTSecret), nil
+		}
+		kid, _ := t.Header["kid"].(string)
+		key, ok := ring.Verifier(kid, time.Now())
+		if !ok || key.Algorithm != t.Method.Alg() {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
 		}
-		return []byte(s.cfg.JWTSecret), nil
+		return key.private.Public(), nil
 	})
-	if err != nil || !t.Valid {
-		return "", ErrInvalidCredentials
+	if err != nil || !t.Valid || claims.Subject == "" || claims.ID == "" {
+		return nil, ErrInvalidCredentials
 	}
-	return claims.Subject, nil
+	return claims, nil
 }
 
 func (s *Service) GetUserByID(ctx context.Context, id string) (*db.User, error) {
@@ -203,8 +428,14 @@ func (s *Service) GetUserByID(ctx context.Context, id string) (*db.User, error)
 	return &u, nil
 }
 
-// GenerateRefreshToken creates and stores an opaque refresh token (hashed) for the user.
+// GenerateRefreshToken creates and stores an opaque refresh token (hashed)
+// for the user. Each call starts a new session (token family); Refresh rotates within it.
 func (s *Service) GenerateRefreshToken(ctx context.Context, userID, role string) (string, time.Time, error) {
+	return s.storeRefreshToken(s.dbx.Gorm.WithContext(ctx), newSessionToken(ctx, userID, uuid.NewString()))
+}
+
+// storeRefreshToken generates a refresh token for rt, sets its hash and expiry and stores it.
+func (s *Service) storeRefreshToken(tx *gorm.DB, rt *db.RefreshToken) (string, time.Time, error) {
 	ttl := s.cfg.RefreshTTL
 	if ttl <= 0 {
 		ttl = 720 * time.Hour // 30d default
@@ -218,34 +449,34 @@ func (s *Service) GenerateRefreshToken(ctx context.Context, userID, role string)
 	}
 	plain := hex.EncodeToString(b[:])
 
-	// Store sha256 hash
-	sum := sha256.Sum256([]byte(plain))
-	hash := hex.EncodeToString(sum[:])
-
-	rt := &db.RefreshToken{
-		UserID:    userID,
-		TokenHash: hash,
-		ExpiresAt: exp,
-	}
-	if err := s.dbx.Gorm.WithContext(ctx).Create(rt).Error; err != nil {
+	rt.TokenHash = hashRefreshToken(plain)
+	rt.ExpiresAt = exp
+	if err := tx.Create(rt).Error; err != nil {
 		return "", time.Time{}, fmt.Errorf("store refresh token: %w", err)
 	}
 	return plain, exp, nil
 }
 
-// Refresh exchanges a valid refresh token for a new access token and a rotated refresh token.
+// hashRefreshToken returns the sha256 hex digest stored for a refresh token.
+func hashRefreshToken(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+// errRefreshReused marks a refresh token that was already rotated.
+var errRefreshReused = errors.New("refresh token reused")
+
+// Refresh exchanges a valid refresh token for a new access token and a rotated
+// refresh token in the same family. Rotated tokens are kept until they expire:
+// presenting one again means the token was copied, so the whole family is revoked.
 func (s *Service) Refresh(ctx context.Context, refreshToken string) (*db.User, string, time.Time, string, time.Time, error) {
 	if refreshToken == "" {
 		return nil, "", time.Time{}, "", time.Time{}, ErrInvalidCredentials
 	}
 
-	// Hash input token
-	sum := sha256.Sum256([]byte(refreshToken))
-	hash := hex.EncodeToString(sum[:])
-
 	var rt db.RefreshToken
 	err := s.dbx.Gorm.WithContext(ctx).
-		Where("token_hash = ?", hash).
+		Where("token_hash = ?", hashRefreshToken(refreshToken)).
 		First(&rt).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -253,6 +484,10 @@ func (s *Service) Refresh(ctx context.Context, refreshToken string) (*db.User, s
 		}
 		return nil, "", time.Time{}, "", time.Time{}, fmt.Errorf("find refresh token: %w", err)
 	}
+	if rt.RotatedAt != nil {
+		s.revokeFamilyOnReuse(ctx, rt)
+		return nil, "", time.Time{}, "", time.Time{}, ErrInvalidCredentials
+	}
 	if time.Now().After(rt.ExpiresAt) {
 		// Expired: delete and reject
 		_ = s.dbx.Gorm.WithContext(ctx).Delete(&rt).Error
@@ -264,91 +499,171 @@ func (s *Service) Refresh(ctx context.Context, refreshToken string) (*db.User, s
 	if err := s.dbx.Gorm.WithContext(ctx).First(&u, "id = ?", rt.UserID).Error; err != nil {
 		return nil, "", time.Time{}, "", time.Time{}, fmt.Errorf("load user: %w", err)
 	}
+	if !s.IsUserActive(&u) {
+		_ = s.dbx.Gorm.WithContext(ctx).Delete(&rt).Error
+		return nil, "", time.Time{}, "", time.Time{}, ErrInvalidCredentials
+	}
 
-	// Rotate: delete old, create new
-	if err := s.dbx.Gorm.WithContext(ctx).Delete(&rt).Error; err != nil {
-		return nil, "", time.Time{}, "", time.Time{}, fmt.Errorf("delete old refresh: %w", err)
+	// Rotate: mark the old token used and issue its child. Losing a race
+	// against a concurrent refresh of the same token counts as reuse.
+	var newRefresh string
+	var newRefreshExp time.Time
+	err = s.transaction(ctx, func(tx *gorm.DB) error {
+		res := tx.Model(&db.RefreshToken{}).
+			Where("id = ? AND rotated_at IS NULL", rt.ID).
+			Update("rotated_at", time.Now())
+		if res.Error != nil {
+			return fmt.Errorf("rotate refresh token: %w", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return errRefreshReused
+		}
+		var err error
+		newRefresh, newRefreshExp, err = s.storeRefreshToken(tx, rotatedSessionToken(ctx, rt))
+		return err
+	})
+	if errors.Is(err, errRefreshReused) {
+		s.revokeFamilyOnReuse(ctx, rt)
+		return nil, "", time.Time{}, "", time.Time{}, ErrInvalidCredentials
 	}
-	newRefresh, newRefreshExp, err := s.GenerateRefreshToken(ctx, u.ID, u.Role)
 	if err != nil {
 		return nil, "", time.Time{}, "", time.Time{}, err
 	}
 
 	// Issue new access token
-	access, accessExp, err := s.GenerateToken(u)
+	access, accessExp, err := s.GenerateToken(ctx, u, rt.FamilyID)
 	if err != nil {
 		return nil, "", time.Time{}, "", time.Time{}, err
 	}
+	s.audit.Record(ctx, audit.Event{
+		Action:     audit.ActionRefresh,
+		ActorID:    u.ID,
+		ActorName:  u.Username,
+		TargetType: audit.TargetUser,
+		TargetID:   u.ID,
+		Details:    map[string]any{"session_id": rt.FamilyID},
+	})
 
 	return &u, access, accessExp, newRefresh, newRefreshExp, nil
 }
 
-// ListUsers returns a paginated list of users (for admin use)
-func (s *Service) ListUsers(ctx context.Context, limit, offset int) ([]*db.User, int64, error) {
-	var users []*db.User
-	var total int64
+// UserQuery selects, orders and pages users for ListUsers.
+type UserQuery struct {
+	// Search matches a case-insensitive substring of the username or email.
+	Search string
+	Role   string
+	Status string
+	// Sort is one of UserSortColumns, prefixed with "-" for descending order.
+	// Empty sorts by -created_time.
+	Sort   string
+	Limit  int
+	Offset int
+}
 
-	// Get total count
-	if err := s.dbx.Gorm.WithContext(ctx).Model(&db.User{}).Count(&total).Error; err != nil {
-		return nil, 0, fmt.Errorf("count users: %w", err)
+// UserSortColumns are the columns ListUsers can sort by.
+var UserSortColumns = []string{"username", "email", "role", "status", "created_time", "updated_time", "last_login_at"}
+
+// likeEscaper escapes LIKE wildcards so search terms match literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Validate reports an unknown sort column or status as ErrInvalidUserQuery.
+func (q UserQuery) Validate() error {
+	if col := strings.TrimPrefix(q.Sort, "-"); q.Sort != "" && !slices.Contains(UserSortColumns, col) {
+		return fmt.Errorf("%w: cannot sort by %q", ErrInvalidUserQuery, col)
+	}
+	switch q.Status {
+	case "", db.UserStatusActive, db.UserStatusSuspended, db.UserStatusDeleted:
+		return nil
 	}
+	return fmt.Errorf("%w: unknown status %q", ErrInvalidUserQuery, q.Status)
+}
 
-	// Get paginated users
-	if err := s.dbx.Gorm.WithContext(ctx).
-		Limit(limit).
-		Offset(offset).
-		Order("created_time DESC").
+// ListUsers returns a page of the users matching q with the total number of
+// matches (for admin use). Invalid queries return ErrInvalidUserQuery.
+func (s *Service) ListUsers(ctx context.Context, q UserQuery) ([]*db.User, int64, error) {
+	if err := q.Validate(); err != nil {
+		return nil, 0, err
+	}
+	order := "created_time DESC"
+	if col, desc := strings.CutPrefix(q.Sort, "-"); col != "" {
+		order = col + " ASC NULLS LAST"
+		if desc {
+			order = col + " DESC NULLS LAST"
+		}
+	}
+	filtered := s.filterUsers(ctx, q)
+
+	var total int64
+	if err := filtered.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("count users: %w", err)
+	}
+	var users []*db.User
+	if err := filtered.Session(&gorm.Session{}).
+		Order(order).
+		Order("id").
+		Limit(q.Limit).
+		Offset(q.Offset).
 		Find(&users).Error; err != nil {
 		return nil, 0, fmt.Errorf("list users: %w", err)
 	}
-
 	return users, total, nil
 }
 
-// UpdateUserStatus activates or deactivates a user by adding/removing an "active" field
-// Since the current User model doesn't have an active field, we'll use a soft approach
-// by updating the user's role to include "_INACTIVE" suffix for inactive users
+// filterUsers applies the search, role and status of a validated q to a query
+// on DEMO.USER; sorting and paging are left to the caller.
+func (s *Service) filterUsers(ctx context.Context, q UserQuery) *gorm.DB {
+	filtered := s.dbx.Gorm.WithContext(ctx).Model(&db.User{})
+	if term := strings.TrimSpace(q.Search); term != "" {
+		pattern := "%" + likeEscaper.Replace(term) + "%"
+		filtered = filtered.Where("username ILIKE ? OR email ILIKE ?", pattern, pattern)
+	}
+	if q.Role != "" {
+		filtered = filtered.Where("role = ?", q.Role)
+	}
+	if q.Status != "" {
+		filtered = filtered.Where("status = ?", q.Status)
+	}
+	return filtered
+}
+
+// UpdateUserStatus suspends or reactivates a user. Suspending revokes the
+// user's refresh tokens; deleted users must be restored with RestoreUser.
 func (s *Service) UpdateUserStatus(ctx context.Context, userID string, active bool, updatedBy string) (*db.User, error) {
 	var user db.User
 	if err := s.dbx.Gorm.WithContext(ctx).First(&user, "id = ?", userID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, fmt.Errorf("find user: %w", err)
 	}
 
 	// Don't allow deactivating ADMIN users
 	if user.Role == "ADMIN" {
-		return nil, fmt.Errorf("cannot modify ADMIN user status")
+		return nil, ErrAdminStatusChange
+	}
+	if user.Status == db.UserStatusDeleted {
+		return nil, ErrUserDeleted
 	}
 
-	// Update role based on active status
-	var newRole string
+	status := db.UserStatusSuspended
 	if active {
-		// Remove _INACTIVE suffix if present
-		if len(user.Role) > 9 && user.Role[len(user.Role)-9:] == "_INACTIVE" {
-			newRole = user.Role[:len(user.Role)-9]
-		} else {
-			newRole = user.Role // Already active
-		}
-	} else {
-		// Add _INACTIVE suffix if not present
-		if len(user.Role) > 9 && user.Role[len(user.Role)-9:] == "_INACTIVE" {
-			newRole = user.Role // Already inactive
-		} else {
-			newRole = user.Role + "_INACTIVE"
-		}
+		status = db.UserStatusActive
 	}
-
-	// Update user
+	before := map[string]any{"status": user.Status}
 	if err := s.dbx.Gorm.WithContext(ctx).
 		Model(&user).
 		Updates(map[string]interface{}{
-			"role":       newRole,
+			"status":     status,
 			"updated_by": updatedBy,
 		}).Error; err != nil {
 		return nil, fmt.Errorf("update user status: %w", err)
 	}
+	s.auditUserChange(ctx, audit.ActionUserStatusChange, &user, before, map[string]any{"status": status})
+	if !active {
+		if err := s.RevokeAllSessions(ctx, userID); err != nil {
+			s.log.Error("failed to revoke sessions of suspended user", "user_id", userID, "err", err)
+		}
+	}
 
 	// Reload user to get updated data
 	if err := s.dbx.Gorm.WithContext(ctx).First(&user, "id = ?", userID).Error; err != nil {
@@ -358,60 +673,99 @@ func (s *Service) UpdateUserStatus(ctx context.Context, userID string, active bo
 	return &user, nil
 }
 
-// DeleteUser soft deletes a user by updating their username/email to include deleted timestamp
+// DeleteUser soft deletes a user: the account is marked deleted and its
+// refresh tokens are revoked, but the row and its name are kept for RestoreUser.
 func (s *Service) DeleteUser(ctx context.Context, userID, deletedBy string) error {
 	var user db.User
 	if err := s.dbx.Gorm.WithContext(ctx).First(&user, "id = ?", userID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return fmt.Errorf("user not found")
+			return ErrUserNotFound
 		}
 		return fmt.Errorf("find user: %w", err)
 	}
 
 	// Don't allow deleting ADMIN users
 	if user.Role == "ADMIN" {
-		return fmt.Errorf("cannot delete ADMIN user")
+		return ErrAdminDelete
 	}
-
-	// Soft delete by updating username and email to include timestamp
-	timestamp := time.Now().Unix()
-	deletedUsername := fmt.Sprintf("%s_deleted_%d", user.Username, timestamp)
-	deletedEmail := fmt.Sprintf("%s_deleted_%d", user.Email, timestamp)
+	if user.Status == db.UserStatusDeleted {
+		return nil
+	}
+	before := map[string]any{"status": user.Status}
 
 	if err := s.dbx.Gorm.WithContext(ctx).
 		Model(&user).
 		Updates(map[string]interface{}{
-			"username":   deletedUsername,
-			"email":      deletedEmail,
-			"role":       "DELETED",
+			"status":     db.UserStatusDeleted,
+			"deleted_at": time.Now(),
 			"updated_by": deletedBy,
 		}).Error; err != nil {
 		return fmt.Errorf("delete user: %w", err)
 	}
+	s.auditUserChange(ctx, audit.ActionUserDelete, &user, before, map[string]any{"status": db.UserStatusDeleted})
 
-	// Delete all refresh tokens for this user
-	if err := s.dbx.Gorm.WithContext(ctx).
-		Where("user_id = ?", userID).
-		Delete(&db.RefreshToken{}).Error; err != nil {
-		s.log.Error("failed to delete refresh tokens for deleted user", "user_id", userID, "err", err)
+	if err := s.RevokeAllSessions(ctx, userID); err != nil {
+		s.log.Error("failed to revoke sessions of deleted user", "user_id", userID, "err", err)
 	}
-
 	return nil
 }
 
-// IsUserActive checks if a user is active based on their role
-func (s *Service) IsUserActive(user *db.User) bool {
-	if user == nil {
-		return false
+// legacyDeletedSuffix matches the "_deleted_<unix>" suffix older releases
+// appended to the username and email of deleted users.
+var legacyDeletedSuffix = regexp.MustCompile(`_deleted_\d+$`)
+
+// RestoreUser reactivates a soft-deleted user. Usernames and emails renamed by
+// the old deletion scheme get their original value back unless it has been
+// taken by another account in the meantime.
+func (s *Service) RestoreUser(ctx context.Context, userID, restoredBy string) (*db.User, error) {
+	var user db.User
+	if err := s.dbx.Gorm.WithContext(ctx).First(&user, "id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("find user: %w", err)
 	}
-	// User is inactive if role ends with "_INACTIVE" or is "DELETED"
-	if user.Role == "DELETED" {
-		return false
+	if user.Status != db.UserStatusDeleted {
+		return nil, ErrUserNotDeleted
 	}
-	if len(user.Role) > 9 && user.Role[len(user.Role)-9:] == "_INACTIVE" {
-		return false
+
+	updates := map[string]interface{}{
+		"status":     db.UserStatusActive,
+		"deleted_at": nil,
+		"updated_by": restoredBy,
 	}
-	return true
+	for col, val := range map[string]string{"username": user.Username, "email": user.Email} {
+		orig := legacyDeletedSuffix.ReplaceAllString(val, "")
+		if orig == val {
+			continue
+		}
+		var count int64
+		if err := s.dbx.Gorm.WithContext(ctx).
+			Model(&db.User{}).
+			Where(col+" = ?", orig).
+			Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("check %s: %w", col, err)
+		}
+		if count == 0 {
+			updates[col] = orig
+		}
+	}
+
+	before := map[string]any{"status": user.Status, "username": user.Username, "email": user.Email}
+	if err := s.dbx.Gorm.WithContext(ctx).Model(&user).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("restore user: %w", err)
+	}
+	if err := s.dbx.Gorm.WithContext(ctx).First(&user, "id = ?", userID).Error; err != nil {
+		return nil, fmt.Errorf("reload user: %w", err)
+	}
+	s.auditUserChange(ctx, audit.ActionUserRestore, &user, before,
+		map[string]any{"status": user.Status, "username": user.Username, "email": user.Email})
+	return &user, nil
+}
+
+// IsUserActive reports whether a user may sign in and use the API.
+func (s *Service) IsUserActive(user *db.User) bool {
+	return user != nil && user.Status == db.UserStatusActive
 }
 
 // UpdateUserRole updates a user's role (for admin use)
@@ -420,6 +774,10 @@ func (s *Service) UpdateUserRole(ctx context.Context, userID, newRole, updatedBy
 		return nil, fmt.Errorf("missing required fields")
 	}
 
+	if err := s.checkAssignableRole(ctx, newRole); err != nil {
+		return nil, err
+	}
+
 	// Validate that the new role exists
 	var roleCount int64
 	if err := s.dbx.Gorm.WithContext(ctx).
@@ -429,28 +787,24 @@ func (s *Service) UpdateUserRole(ctx context.Context, userID, newRole, updatedBy
 		return nil, fmt.Errorf("check role: %w", err)
 	}
 	if roleCount == 0 {
-		return nil, fmt.Errorf("invalid role: %s", newRole)
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRole, newRole)
 	}
 
 	// Find the user to update
 	var user db.User
 	if err := s.dbx.Gorm.WithContext(ctx).First(&user, "id = ?", userID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, fmt.Errorf("find user: %w", err)
 	}
 
 	// Don't allow changing ADMIN users' roles
 	if user.Role == "ADMIN" {
-		return nil, fmt.Errorf("cannot modify ADMIN user role")
-	}
-
-	// Don't allow setting role to ADMIN
-	if newRole == "ADMIN" {
-		return nil, fmt.Errorf("cannot assign ADMIN role")
+		return nil, ErrAdminRoleChange
 	}
 
+	before := map[string]any{"role": user.Role}
 	// Update the user's role
 	if err := s.dbx.Gorm.WithContext(ctx).
 		Model(&user).
@@ -460,6 +814,7 @@ func (s *Service) UpdateUserRole(ctx context.Context, userID, newRole, updatedBy
 		}).Error; err != nil {
 		return nil, fmt.Errorf("update user role: %w", err)
 	}
+	s.auditUserChange(ctx, audit.ActionUserRoleChange, &user, before, map[string]any{"role": newRole})
 
 	// Reload user to get updated data
 	if err := s.dbx.Gorm.WithContext(ctx).First(&user, "id = ?", userID).Error; err != nil {
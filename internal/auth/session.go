@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-demo/internal/audit"
+	"go-demo/internal/authctx"
+	"go-demo/internal/db"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTokenRevoked    = errors.New("token has been revoked")
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// Session is a signed-in device: the live refresh token of a token family.
+type Session struct {
+	ID         string // refresh token family ID, also the "sid" access token claim
+	Label      string
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+}
+
+// newSessionToken prepares the first refresh token of a session, taking the
+// device details from the client stored in ctx.
+func newSessionToken(ctx context.Context, userID, sessionID string) *db.RefreshToken {
+	c, _ := authctx.ClientFrom(ctx)
+	now := time.Now()
+	return &db.RefreshToken{
+		UserID:           userID,
+		FamilyID:         sessionID,
+		UserAgent:        truncate(c.UserAgent, 512),
+		IP:               c.IP,
+		Label:            deviceLabel(c.UserAgent),
+		SessionStartedAt: now,
+		LastUsedAt:       now,
+	}
+}
+
+// rotatedSessionToken prepares the successor of parent in the same session,
+// refreshing the device details from the client stored in ctx.
+func rotatedSessionToken(ctx context.Context, parent db.RefreshToken) *db.RefreshToken {
+	rt := newSessionToken(ctx, parent.UserID, parent.FamilyID)
+	rt.ParentID = &parent.ID
+	rt.SessionStartedAt = parent.SessionStartedAt
+	if rt.UserAgent == "" {
+		rt.UserAgent, rt.Label = parent.UserAgent, parent.Label
+	}
+	if rt.IP == "" {
+		rt.IP = parent.IP
+	}
+	return rt
+}
+
+// Authenticate resolves an access token to its user. It rejects tokens that
+// were revoked individually (logout), by a token version bump (logout-all,
+// admin revoke) or whose session has ended, and users that are not active.
+// In stateless mode none of this is checked: the user is built from the
+// claims and the token stays valid until it expires.
+func (s *Service) Authenticate(ctx context.Context, tokenStr string) (*db.User, *Claims, error) {
+	claims, err := s.ParseToken(tokenStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.cfg.AuthStateless {
+		return userFromClaims(claims), claims, nil
+	}
+	u, err := s.cachedUserByID(ctx, claims.Subject)
+	if errors.Is(err, ErrInvalidCredentials) {
+		return nil, nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if claims.TokenVersion != u.TokenVersion {
+		return nil, nil, ErrTokenRevoked
+	}
+	if revoked, err := s.tokenRevoked(ctx, claims); err != nil {
+		return nil, nil, err
+	} else if revoked {
+		return nil, nil, ErrTokenRevoked
+	}
+	if !s.IsUserActive(u) {
+		return nil, nil, ErrUserInactive
+	}
+	return u, claims, nil
+}
+
+// tokenRevoked reports in one query whether the token's jti is on the denylist
+// or its session has ended, which happens with its refresh token family
+// (logout, revoke, reuse).
+func (s *Service) tokenRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	var (
+		checks []string
+		args   []interface{}
+	)
+	if claims.ID != "" {
+		checks = append(checks, `EXISTS (SELECT 1 FROM "DEMO"."REVOKED_TOKEN" WHERE jti = ?)`)
+		args = append(args, claims.ID)
+	}
+	if claims.SessionID != "" {
+		checks = append(checks, `NOT EXISTS (SELECT 1 FROM "DEMO"."REFRESH_TOKEN" WHERE family_id = ? AND rotated_at IS NULL)`)
+		args = append(args, claims.SessionID)
+	}
+	if len(checks) == 0 {
+		return false, nil
+	}
+	var revoked bool
+	if err := s.dbx.Gorm.WithContext(ctx).
+		Raw("SELECT "+strings.Join(checks, " OR "), args...).
+		Scan(&revoked).Error; err != nil {
+		return false, fmt.Errorf("check revoked token: %w", err)
+	}
+	return revoked, nil
+}
+
+// userFromClaims returns the partial user an access token describes: ID,
+// username, role and token version. Everything else is left empty.
+func userFromClaims(c *Claims) *db.User {
+	return &db.User{
+		ID:           c.Subject,
+		Username:     c.Username,
+		Role:         c.Role,
+		TokenVersion: c.TokenVersion,
+		Status:       db.UserStatusActive,
+	}
+}
+
+// Logout revokes the access token identified by jti and ends its session.
+// When refreshToken is given, the session it belongs to is ended as well;
+// sessions of other users are ignored.
+func (s *Service) Logout(ctx context.Context, userID, jti string, accessExp time.Time, sessionID, refreshToken string) error {
+	return s.transaction(ctx, func(tx *gorm.DB) error {
+		if jti != "" {
+			rt := db.RevokedToken{JTI: jti, UserID: userID, ExpiresAt: accessExp}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rt).Error; err != nil {
+				return fmt.Errorf("revoke access token: %w", err)
+			}
+		}
+		if sessionID != "" {
+			if err := tx.Where("family_id = ? AND user_id = ?", sessionID, userID).Delete(&db.RefreshToken{}).Error; err != nil {
+				return fmt.Errorf("end session: %w", err)
+			}
+		}
+		if refreshToken != "" {
+			if err := tx.
+				Where(`family_id IN (SELECT family_id FROM "DEMO"."REFRESH_TOKEN" WHERE token_hash = ? AND user_id = ?)`,
+					hashRefreshToken(refreshToken), userID).
+				Delete(&db.RefreshToken{}).Error; err != nil {
+				return fmt.Errorf("revoke refresh token: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// ListSessions returns the user's active sessions, most recently used first.
+func (s *Service) ListSessions(ctx context.Context, userID string) ([]Session, error) {
+	var tokens []db.RefreshToken
+	if err := s.dbx.Gorm.WithContext(ctx).
+		Where("user_id = ? AND rotated_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&tokens).Error; err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	out := make([]Session, 0, len(tokens))
+	for _, t := range tokens {
+		out = append(out, Session{
+			ID:         t.FamilyID,
+			Label:      t.Label,
+			UserAgent:  t.UserAgent,
+			IP:         t.IP,
+			CreatedAt:  t.SessionStartedAt,
+			LastUsedAt: t.LastUsedAt,
+			ExpiresAt:  t.ExpiresAt,
+		})
+	}
+	return out, nil
+}
+
+// RevokeSession ends one of the user's sessions. Access tokens issued within
+// it stop working as well.
+func (s *Service) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	res := s.dbx.Gorm.WithContext(ctx).
+		Where("family_id = ? AND user_id = ?", sessionID, userID).
+		Delete(&db.RefreshToken{})
+	if res.Error != nil {
+		return fmt.Errorf("revoke session: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeAllSessions logs a user out everywhere: all refresh tokens are
+// deleted and the token version is bumped so issued access tokens stop working.
+func (s *Service) RevokeAllSessions(ctx context.Context, userID string) error {
+	return s.transaction(ctx, func(tx *gorm.DB) error {
+		res := tx.Model(&db.User{}).
+			Where("id = ?", userID).
+			UpdateColumn("token_version", gorm.Expr("token_version + 1"))
+		if res.Error != nil {
+			return fmt.Errorf("bump token version: %w", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&db.RefreshToken{}).Error; err != nil {
+			return fmt.Errorf("delete refresh tokens: %w", err)
+		}
+		return nil
+	})
+}
+
+// revokeFamilyOnReuse deletes every refresh token descended from the same
+// login as rt, including the one the legitimate client or the attacker holds.
+func (s *Service) revokeFamilyOnReuse(ctx context.Context, rt db.RefreshToken) {
+	res := s.dbx.Gorm.WithContext(ctx).Where("family_id = ?", rt.FamilyID).Delete(&db.RefreshToken{})
+	s.log.Warn("security event: refresh token reuse detected, token family revoked",
+		"event", "refresh_token_reuse",
+		"user_id", rt.UserID,
+		"family_id", rt.FamilyID,
+		"token_id", rt.ID,
+		"revoked", res.RowsAffected,
+	)
+	if res.Error != nil {
+		s.log.Error("failed to revoke refresh token family", "family_id", rt.FamilyID, "err", res.Error)
+	}
+	s.audit.Record(ctx, audit.Event{
+		Action:     audit.ActionRefresh,
+		Outcome:    audit.OutcomeFailure,
+		TargetType: audit.TargetUser,
+		TargetID:   rt.UserID,
+		Details:    map[string]any{"reason": "refresh_token_reuse", "session_id": rt.FamilyID, "revoked": res.RowsAffected},
+	})
+}
+
+// RunTokenCleanup periodically deletes expired refresh tokens, denylist
+// entries and mailed user tokens until ctx is cancelled. A non-positive interval disables it.
+func (s *Service) RunTokenCleanup(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.cleanupExpiredTokens(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) cleanupExpiredTokens(ctx context.Context) {
+	now := time.Now()
+	removed := make([]any, 0, 6)
+	for _, t := range []struct {
+		name  string
+		model any
+	}{
+		{"refresh_tokens", &db.RefreshToken{}},
+		{"revoked_tokens", &db.RevokedToken{}},
+		{"user_tokens", &db.UserToken{}},
+	} {
+		res := s.dbx.Gorm.WithContext(ctx).Where("expires_at < ?", now).Delete(t.model)
+		if res.Error != nil {
+			if ctx.Err() == nil {
+				s.log.Error("token cleanup failed", "table", t.name, "err", res.Error)
+			}
+			return
+		}
+		if res.RowsAffected > 0 {
+			removed = append(removed, t.name, res.RowsAffected)
+		}
+	}
+	if len(removed) > 0 {
+		s.log.Info("expired tokens removed", removed...)
+	}
+}
@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go-demo/internal/db"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTeamExists      = errors.New("team already exists")
+	ErrTeamNotFound    = errors.New("team not found")
+	ErrUserNotFound    = errors.New("user not found")
+	ErrNotTeamLeader   = errors.New("not a leader of this team")
+	ErrMemberNotFound  = errors.New("team member not found")
+	ErrLeaderProtected = errors.New("only team managers can change leaders")
+)
+
+// TeamMemberInfo is a team member joined with the user's name.
+type TeamMemberInfo struct {
+	UserID   string
+	Username string
+	Email    string
+	IsLeader bool
+}
+
+// CreateTeam creates a team with a unique name.
+func (s *Service) CreateTeam(ctx context.Context, name, description, createdBy string) (*db.Team, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || createdBy == "" {
+		return nil, fmt.Errorf("missing required fields")
+	}
+	var count int64
+	if err := s.dbx.Gorm.WithContext(ctx).Model(&db.Team{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("check team: %w", err)
+	}
+	if count > 0 {
+		return nil, ErrTeamExists
+	}
+	t := &db.Team{Name: name, Description: description, CreatedBy: createdBy, UpdatedBy: createdBy}
+	if err := s.dbx.Gorm.WithContext(ctx).Create(t).Error; err != nil {
+		return nil, fmt.Errorf("create team: %w", err)
+	}
+	return t, nil
+}
+
+// ListTeams returns all teams, or only the teams userID belongs to when userID is not empty.
+func (s *Service) ListTeams(ctx context.Context, userID string) ([]db.Team, error) {
+	q := s.dbx.Gorm.WithContext(ctx).Model(&db.Team{})
+	if userID != "" {
+		q = q.Where(`id IN (SELECT team_id FROM "DEMO"."TEAM_MEMBER" WHERE user_id = ?)`, userID)
+	}
+	var teams []db.Team
+	if err := q.Order("name").Find(&teams).Error; err != nil {
+		return nil, fmt.Errorf("list teams: %w", err)
+	}
+	return teams, nil
+}
+
+// DeleteTeam removes a team; memberships and team grants go with it.
+func (s *Service) DeleteTeam(ctx context.Context, teamID string) error {
+	return s.transaction(ctx, func(tx *gorm.DB) error {
+		res := tx.Where("id = ?", teamID).Delete(&db.Team{})
+		if res.Error != nil {
+			return fmt.Errorf("delete team: %w", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return ErrTeamNotFound
+		}
+		// DB_GRANT rows reference teams by ID without a foreign key.
+		if err := tx.Exec(`DELETE FROM "DEMO"."DB_GRANT" WHERE subject_type = 'team' AND subject_id = ?`, teamID).Error; err != nil {
+			return fmt.Errorf("delete team grants: %w", err)
+		}
+		return nil
+	})
+}
+
+// TeamMembership returns the caller's membership of a team, or nil if not a member.
+func (s *Service) TeamMembership(ctx context.Context, teamID, userID string) (*db.TeamMember, error) {
+	var m db.TeamMember
+	err := s.dbx.Gorm.WithContext(ctx).First(&m, "team_id = ? AND user_id = ?", teamID, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find membership: %w", err)
+	}
+	return &m, nil
+}
+
+// ListTeamMembers returns a team's members ordered by username.
+func (s *Service) ListTeamMembers(ctx context.Context, teamID string) ([]TeamMemberInfo, error) {
+	if err := s.ensureTeam(ctx, teamID); err != nil {
+		return nil, err
+	}
+	var out []TeamMemberInfo
+	err := s.dbx.Gorm.WithContext(ctx).
+		Table(`"DEMO"."TEAM_MEMBER" m`).
+		Select("m.user_id, u.username, u.email, m.is_leader").
+		Joins(`JOIN "DEMO"."USER" u ON u.id = m.user_id`).
+		Where("m.team_id = ?", teamID).
+		Order("u.username").
+		Scan(&out).Error
+	if err != nil {
+		return nil, fmt.Errorf("list members: %w", err)
+	}
+	return out, nil
+}
+
+// SetTeamMember adds a user to a team or updates their leader flag. When
+// asManager is false the actor must lead the team and may not touch leaders.
+func (s *Service) SetTeamMember(ctx context.Context, teamID, userID string, leader bool, actor *db.User, asManager bool) error {
+	if err := s.ensureTeam(ctx, teamID); err != nil {
+		return err
+	}
+	if !asManager {
+		if err := s.requireLeader(ctx, teamID, actor.ID); err != nil {
+			return err
+		}
+		if leader {
+			return ErrLeaderProtected
+		}
+	}
+
+	var count int64
+	if err := s.dbx.Gorm.WithContext(ctx).Model(&db.User{}).Where("id = ?", userID).Count(&count).Error; err != nil {
+		return fmt.Errorf("check user: %w", err)
+	}
+	if count == 0 {
+		return ErrUserNotFound
+	}
+
+	existing, err := s.TeamMembership(ctx, teamID, userID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		if existing.IsLeader && !asManager {
+			return ErrLeaderProtected
+		}
+		if err := s.dbx.Gorm.WithContext(ctx).
+			Model(&db.TeamMember{}).
+			Where("team_id = ? AND user_id = ?", teamID, userID).
+			Update("is_leader", leader).Error; err != nil {
+			return fmt.Errorf("update member: %w", err)
+		}
+		return nil
+	}
+	m := db.TeamMember{TeamID: teamID, UserID: userID, IsLeader: leader, CreatedBy: actor.Username}
+	if err := s.dbx.Gorm.WithContext(ctx).Create(&m).Error; err != nil {
+		return fmt.Errorf("add member: %w", err)
+	}
+	return nil
+}
+
+// RemoveTeamMember removes a user from a team. When asManager is false the
+// actor must lead the team and may not remove another leader.
+func (s *Service) RemoveTeamMember(ctx context.Context, teamID, userID string, actor *db.User, asManager bool) error {
+	if err := s.ensureTeam(ctx, teamID); err != nil {
+		return err
+	}
+	if !asManager {
+		if err := s.requireLeader(ctx, teamID, actor.ID); err != nil {
+			return err
+		}
+	}
+	existing, err := s.TeamMembership(ctx, teamID, userID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return ErrMemberNotFound
+	}
+	if existing.IsLeader && !asManager && userID != actor.ID {
+		return ErrLeaderProtected
+	}
+	if err := s.dbx.Gorm.WithContext(ctx).
+		Where("team_id = ? AND user_id = ?", teamID, userID).
+		Delete(&db.TeamMember{}).Error; err != nil {
+		return fmt.Errorf("remove member: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) ensureTeam(ctx context.Context, teamID string) error {
+	var count int64
+	if err := s.dbx.Gorm.WithContext(ctx).Model(&db.Team{}).Where("id = ?", teamID).Count(&count).Error; err != nil {
+		return fmt.Errorf("check team: %w", err)
+	}
+	if count == 0 {
+		return ErrTeamNotFound
+	}
+	return nil
+}
+
+func (s *Service) requireLeader(ctx context.Context, teamID, userID string) error {
+	m, err := s.TeamMembership(ctx, teamID, userID)
+	if err != nil {
+		return err
+	}
+	if m == nil || !m.IsLeader {
+		return ErrNotTeamLeader
+	}
+	return nil
+}
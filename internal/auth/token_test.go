@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"go-demo/internal/config"
+	"go-demo/internal/db"
+)
+
+func tokenTestService() *Service {
+	return &Service{cfg: config.Config{
+		JWTSecret:       "test-secret",
+		JWTTTL:          time.Hour,
+		JWTIssuer:       "go-demo",
+		JWTAudience:     "go-demo-api",
+		JWTClockSkew:    30 * time.Second,
+		JWTStatelessTTL: 5 * time.Minute,
+	}}
+}
+
+func signHS256(t *testing.T, claims Claims) string {
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+	require.NoError(t, err)
+	return tok
+}
+
+func TestParseTokenValidatesClaims(t *testing.T) {
+	s := tokenTestService()
+	tok, _, err := s.signToken(Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "u1"}, Username: "alice", Role: "USER"})
+	require.NoError(t, err)
+	claims, err := s.ParseToken(tok)
+	require.NoError(t, err)
+	require.Equal(t, "go-demo", claims.Issuer)
+	require.Equal(t, jwt.ClaimStrings{"go-demo-api"}, claims.Audience)
+	require.NotEmpty(t, claims.ID)
+	require.Equal(t, "alice", claims.Username)
+
+	now := time.Now()
+	valid := func() Claims {
+		return Claims{RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "jti",
+			Subject:   "u1",
+			Issuer:    "go-demo",
+			Audience:  jwt.ClaimStrings{"go-demo-api"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		}}
+	}
+	_, err = s.ParseToken(signHS256(t, valid()))
+	require.NoError(t, err)
+
+	wrongIssuer := valid()
+	wrongIssuer.Issuer = "someone-else"
+	noAudience := valid()
+	noAudience.Audience = nil
+	noJTI := valid()
+	noJTI.ID = ""
+	expired := valid()
+	expired.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute))
+	future := valid()
+	future.IssuedAt = jwt.NewNumericDate(now.Add(time.Minute))
+	for name, c := range map[string]Claims{
+		"issuer":   wrongIssuer,
+		"audience": noAudience,
+		"jti":      noJTI,
+		"expired":  expired,
+		"iat":      future,
+	} {
+		_, err := s.ParseToken(signHS256(t, c))
+		require.ErrorIs(t, err, ErrInvalidCredentials, name)
+	}
+
+	// Small clock differences between issuer and verifier are tolerated.
+	skewed := valid()
+	skewed.ExpiresAt = jwt.NewNumericDate(now.Add(-10 * time.Second))
+	skewed.IssuedAt = jwt.NewNumericDate(now.Add(10 * time.Second))
+	_, err = s.ParseToken(signHS256(t, skewed))
+	require.NoError(t, err)
+}
+
+func TestAuthenticateStateless(t *testing.T) {
+	s := tokenTestService()
+	s.cfg.AuthStateless = true
+	require.Equal(t, 5*time.Minute, s.accessTokenTTL())
+
+	tok, exp, err := s.signToken(Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "u1"},
+		Username:         "alice",
+		Role:             "ADMIN",
+		Permissions:      []string{db.PermUsersManage},
+		TokenVersion:     3,
+	})
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(5*time.Minute), exp, time.Second)
+
+	// No database is configured: the user must come from the claims.
+	u, claims, err := s.Authenticate(context.Background(), tok)
+	require.NoError(t, err)
+	require.Equal(t, "u1", u.ID)
+	require.Equal(t, "alice", u.Username)
+	require.Equal(t, "ADMIN", u.Role)
+	require.Equal(t, 3, u.TokenVersion)
+	require.Equal(t, []string{db.PermUsersManage}, claims.Permissions)
+}
+
+func TestUserCache(t *testing.T) {
+	c := newUserCache(time.Minute)
+	_, ok := c.get("u1")
+	require.False(t, ok)
+
+	c.put(&db.User{ID: "u1", Username: "alice"})
+	u, ok := c.get("u1")
+	require.True(t, ok)
+	require.Equal(t, "alice", u.Username)
+
+	// Callers get a copy.
+	u.Username = "mallory"
+	u, _ = c.get("u1")
+	require.Equal(t, "alice", u.Username)
+
+	c.clear()
+	_, ok = c.get("u1")
+	require.False(t, ok)
+
+	expired := newUserCache(time.Nanosecond)
+	expired.put(&db.User{ID: "u1"})
+	time.Sleep(time.Millisecond)
+	_, ok = expired.get("u1")
+	require.False(t, ok)
+
+	var disabled *userCache
+	disabled.put(&db.User{ID: "u1"})
+	_, ok = disabled.get("u1")
+	require.False(t, ok)
+}
+
+func TestUserCacheInvalidation(t *testing.T) {
+	g, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, SkipDefaultTransaction: true, DisableAutomaticPing: true})
+	require.NoError(t, err)
+	c := newUserCache(time.Minute)
+	require.NoError(t, c.registerInvalidation(g))
+
+	changed := false
+	ctx := context.WithValue(context.Background(), userChangesKey{}, &changed)
+	c.put(&db.User{ID: "u1"})
+	require.NoError(t, g.WithContext(ctx).Model(&db.Team{}).Where("id = ?", "t1").Update("name", "x").Error)
+	_, ok := c.get("u1")
+	require.True(t, ok)
+	require.False(t, changed)
+
+	require.NoError(t, g.WithContext(ctx).Model(&db.User{}).Where("id = ?", "u1").Update("username", "x").Error)
+	_, ok = c.get("u1")
+	require.False(t, ok)
+	require.True(t, changed, "transaction is told to empty the cache again after commit")
+
+	// Role changes, including new grants, empty the cached role access.
+	c.putRole("USER", roleAccess{perms: []string{db.PermSQLLogRead}})
+	require.NoError(t, g.Create(&db.RolePermission{RoleCode: "USER", PermissionCode: db.PermAIAnalyze}).Error)
+	_, ok = c.getRole("USER")
+	require.False(t, ok)
+}
+
+func TestRoleAccess(t *testing.T) {
+	s := &Service{users: newUserCache(time.Minute)}
+	s.users.putRole("ANALYZER", roleAccess{perms: []string{db.PermAIAnalyze}, require2FA: true})
+
+	perms, enroll, err := s.RoleAccess(context.Background(), &db.User{Role: "ANALYZER"})
+	require.NoError(t, err)
+	require.Equal(t, []string{db.PermAIAnalyze}, perms)
+	require.True(t, enroll)
+
+	// Enrolled users and service accounts are never asked to enroll.
+	now := time.Now()
+	_, enroll, err = s.RoleAccess(context.Background(), &db.User{Role: "ANALYZER", TOTPEnabledAt: &now})
+	require.NoError(t, err)
+	require.False(t, enroll)
+	_, enroll, err = s.RoleAccess(context.Background(), &db.User{Role: "ANALYZER", ServiceAccount: true})
+	require.NoError(t, err)
+	require.False(t, enroll)
+
+	// Callers get a copy of the cached permissions.
+	perms[0] = db.PermUsersManage
+	perms, _, _ = s.RoleAccess(context.Background(), &db.User{Role: "ANALYZER"})
+	require.Equal(t, []string{db.PermAIAnalyze}, perms)
+}
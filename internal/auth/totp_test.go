@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// RFC 6238 appendix B test secret ("12345678901234567890"), truncated to 6 digits.
+var rfcSecret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range cases {
+		require.Equal(t, want, totpCode([]byte("12345678901234567890"), uint64(unix/30)), "t=%d", unix)
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+
+	counter, ok := verifyTOTP(rfcSecret, "081804", now, 0)
+	require.True(t, ok)
+	require.Equal(t, int64(1111111109/30), counter)
+
+	// Codes from the adjacent time step are accepted for clock drift.
+	_, ok = verifyTOTP(rfcSecret, "081804", now.Add(30*time.Second), 0)
+	require.True(t, ok)
+	_, ok = verifyTOTP(rfcSecret, "081804", now.Add(90*time.Second), 0)
+	require.False(t, ok)
+
+	// An accepted time step cannot be used again.
+	_, ok = verifyTOTP(rfcSecret, "081804", now, counter)
+	require.False(t, ok)
+
+	_, ok = verifyTOTP(rfcSecret, "000000", now, 0)
+	require.False(t, ok)
+	_, ok = verifyTOTP("not base32!", "081804", now, 0)
+	require.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := totpURI("go-demo", "alice@example.com", "ABC")
+	require.True(t, strings.HasPrefix(uri, "otpauth://totp/go-demo:alice@example.com?"), uri)
+	require.Contains(t, uri, "secret=ABC")
+	require.Contains(t, uri, "issuer=go-demo")
+}
@@ -0,0 +1,325 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-demo/internal/db"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSecondFactorRequired = errors.New("second factor required")
+	ErrInvalidOTP           = errors.New("invalid one-time code")
+	Err2FAAlreadyEnabled    = errors.New("two-factor authentication already enabled")
+	Err2FANotEnabled        = errors.New("two-factor authentication not enabled")
+	Err2FASetupMissing      = errors.New("two-factor setup not started")
+)
+
+// recoveryCodeCount is how many recovery codes are issued on enrollment.
+const recoveryCodeCount = 10
+
+// SecondFactorChallenge is returned by Login when the password was correct but
+// the account has 2FA enabled. The token is exchanged together with a TOTP or
+// recovery code in CompleteLogin. It matches ErrSecondFactorRequired with errors.Is.
+type SecondFactorChallenge struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+func (c *SecondFactorChallenge) Error() string { return ErrSecondFactorRequired.Error() }
+
+func (c *SecondFactorChallenge) Is(target error) bool { return target == ErrSecondFactorRequired }
+
+func (s *Service) challengeTTL() time.Duration {
+	if s.cfg.TwoFactorChallengeTTL > 0 {
+		return s.cfg.TwoFactorChallengeTTL
+	}
+	return 5 * time.Minute
+}
+
+// secondFactorChallenge issues a login challenge for userID and returns it as an error.
+func (s *Service) secondFactorChallenge(ctx context.Context, userID string) error {
+	ttl := s.challengeTTL()
+	token, err := s.issueUserToken(ctx, userID, db.UserTokenLogin2FA, ttl)
+	if err != nil {
+		return err
+	}
+	return &SecondFactorChallenge{Token: token, ExpiresAt: time.Now().Add(ttl)}
+}
+
+// CompleteLogin finishes a two-step login: it checks code (TOTP or recovery
+// code) for the challenge issued by Login and opens a session. Wrong codes
+// count as failed logins towards the account lockout and leave the challenge
+// usable until it expires.
+func (s *Service) CompleteLogin(ctx context.Context, challenge, code string) (_ *db.User, _ string, _ time.Time, _ string, _ time.Time, err error) {
+	var u db.User
+	defer func() { s.auditLogin(ctx, "2fa", "", &u, err) }()
+	err = s.transaction(ctx, func(tx *gorm.DB) error {
+		t, err := consumeUserToken(tx, challenge, db.UserTokenLogin2FA)
+		if err != nil {
+			return err
+		}
+		if err := tx.First(&u, "id = ?", t.UserID).Error; err != nil {
+			return fmt.Errorf("find user: %w", err)
+		}
+		if u.LockedUntil != nil && u.LockedUntil.After(time.Now()) {
+			return &LockedError{Until: *u.LockedUntil}
+		}
+		if !s.IsUserActive(&u) {
+			return ErrUserInactive
+		}
+		return s.verifySecondFactor(tx, &u, code)
+	})
+	if errors.Is(err, ErrInvalidOTP) {
+		s.recordLoginFailure(ctx, u.ID)
+	}
+	if err != nil {
+		return nil, "", time.Time{}, "", time.Time{}, err
+	}
+	return s.startSession(ctx, &u)
+}
+
+// verifySecondFactor accepts a current TOTP code or an unused recovery code of
+// u and marks it spent.
+func (s *Service) verifySecondFactor(tx *gorm.DB, u *db.User, code string) error {
+	code = strings.TrimSpace(code)
+	if u.TOTPEnabledAt == nil || code == "" {
+		return ErrInvalidOTP
+	}
+	if counter, ok := verifyTOTP(u.TOTPSecret, code, time.Now(), u.TOTPLastCounter); ok {
+		// Conditional so two requests racing with the same code cannot both pass.
+		res := tx.Model(&db.User{}).
+			Where("id = ? AND totp_last_counter < ?", u.ID, counter).
+			UpdateColumn("totp_last_counter", counter)
+		if res.Error != nil {
+			return fmt.Errorf("record totp use: %w", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvalidOTP
+		}
+		u.TOTPLastCounter = counter
+		return nil
+	}
+
+	res := tx.Model(&db.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", u.ID, hashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return fmt.Errorf("use recovery code: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrInvalidOTP
+	}
+	s.log.Warn("recovery code used", "event", "recovery_code_used", "user_id", u.ID)
+	return nil
+}
+
+// hashRecoveryCode normalises a recovery code (case, dashes, spaces) and hashes it.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return hashRefreshToken(code)
+}
+
+// newRecoveryCodes replaces u's recovery codes and returns the new plaintext codes.
+func newRecoveryCodes(tx *gorm.DB, userID string) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&db.RecoveryCode{}).Error; err != nil {
+		return nil, fmt.Errorf("clear recovery codes: %w", err)
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		var b [5]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return nil, fmt.Errorf("rand: %w", err)
+		}
+		h := hex.EncodeToString(b[:])
+		code := h[:5] + "-" + h[5:]
+		if err := tx.Create(&db.RecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(code)}).Error; err != nil {
+			return nil, fmt.Errorf("store recovery code: %w", err)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// SetupTOTP starts 2FA enrollment: it stores a new secret for the user and
+// returns it with an otpauth:// URI for authenticator apps. 2FA is not active
+// until the first code is confirmed with EnableTOTP.
+func (s *Service) SetupTOTP(ctx context.Context, userID string) (string, string, error) {
+	var u db.User
+	if err := s.dbx.Gorm.WithContext(ctx).First(&u, "id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", "", ErrUserNotFound
+		}
+		return "", "", fmt.Errorf("find user: %w", err)
+	}
+	if u.TOTPEnabledAt != nil {
+		return "", "", Err2FAAlreadyEnabled
+	}
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.dbx.Gorm.WithContext(ctx).Model(&u).UpdateColumns(map[string]interface{}{
+		"totp_secret":       secret,
+		"totp_last_counter": 0,
+	}).Error; err != nil {
+		return "", "", fmt.Errorf("store totp secret: %w", err)
+	}
+	issuer := s.cfg.TOTPIssuer
+	if issuer == "" {
+		issuer = "go-demo"
+	}
+	return secret, totpURI(issuer, u.Email, secret), nil
+}
+
+// EnableTOTP confirms enrollment with a code from the authenticator app and
+// returns the user's recovery codes. They are shown only this once. Like
+// DisableTOTP it is refused while the account is locked, and wrong codes count
+// towards the login lockout.
+func (s *Service) EnableTOTP(ctx context.Context, userID, code string) ([]string, error) {
+	var codes []string
+	err := s.transaction(ctx, func(tx *gorm.DB) error {
+		var u db.User
+		if err := tx.First(&u, "id = ?", userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUserNotFound
+			}
+			return fmt.Errorf("find user: %w", err)
+		}
+		if u.TOTPEnabledAt != nil {
+			return Err2FAAlreadyEnabled
+		}
+		if u.TOTPSecret == "" {
+			return Err2FASetupMissing
+		}
+		if u.LockedUntil != nil && u.LockedUntil.After(time.Now()) {
+			return &LockedError{Until: *u.LockedUntil}
+		}
+		counter, ok := verifyTOTP(u.TOTPSecret, strings.TrimSpace(code), time.Now(), u.TOTPLastCounter)
+		if !ok {
+			return ErrInvalidOTP
+		}
+		if err := tx.Model(&u).Updates(map[string]interface{}{
+			"totp_enabled_at":   time.Now(),
+			"totp_last_counter": counter,
+			"updated_by":        actor(ctx),
+		}).Error; err != nil {
+			return fmt.Errorf("enable totp: %w", err)
+		}
+		var err error
+		codes, err = newRecoveryCodes(tx, userID)
+		return err
+	})
+	if errors.Is(err, ErrInvalidOTP) {
+		s.recordLoginFailure(ctx, userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("two-factor authentication enabled", "user_id", userID)
+	return codes, nil
+}
+
+// DisableTOTP turns 2FA off after checking a current TOTP or recovery code.
+// Wrong codes count towards the login lockout, and a locked account cannot
+// disable 2FA, so a stolen access token is not enough to guess the code.
+func (s *Service) DisableTOTP(ctx context.Context, userID, code string) error {
+	err := s.transaction(ctx, func(tx *gorm.DB) error {
+		var u db.User
+		if err := tx.First(&u, "id = ?", userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUserNotFound
+			}
+			return fmt.Errorf("find user: %w", err)
+		}
+		if u.TOTPEnabledAt == nil {
+			return Err2FANotEnabled
+		}
+		if u.LockedUntil != nil && u.LockedUntil.After(time.Now()) {
+			return &LockedError{Until: *u.LockedUntil}
+		}
+		if err := s.verifySecondFactor(tx, &u, code); err != nil {
+			return err
+		}
+		return clearTOTP(tx, userID, actor(ctx))
+	})
+	if errors.Is(err, ErrInvalidOTP) {
+		s.recordLoginFailure(ctx, userID)
+	}
+	return err
+}
+
+// ResetTOTP turns 2FA off for a user who lost their authenticator and
+// recovery codes (admin use). Their sessions are revoked.
+func (s *Service) ResetTOTP(ctx context.Context, userID, by string) error {
+	err := s.transaction(ctx, func(tx *gorm.DB) error {
+		if err := tx.First(&db.User{}, "id = ?", userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUserNotFound
+			}
+			return fmt.Errorf("find user: %w", err)
+		}
+		return clearTOTP(tx, userID, by)
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.RevokeAllSessions(ctx, userID); err != nil {
+		s.log.Error("failed to revoke sessions after 2FA reset", "user_id", userID, "err", err)
+	}
+	s.log.Info("two-factor authentication reset", "user_id", userID, "by", by)
+	return nil
+}
+
+func clearTOTP(tx *gorm.DB, userID, by string) error {
+	if err := tx.Model(&db.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"totp_secret":       "",
+		"totp_enabled_at":   nil,
+		"totp_last_counter": 0,
+		"updated_by":        by,
+	}).Error; err != nil {
+		return fmt.Errorf("disable totp: %w", err)
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&db.RecoveryCode{}).Error; err != nil {
+		return fmt.Errorf("clear recovery codes: %w", err)
+	}
+	return nil
+}
+
+// SecondFactorEnrollmentRequired reports whether u's role requires 2FA and u
+// has not enabled it yet. Service accounts are exempt.
+func (s *Service) SecondFactorEnrollmentRequired(ctx context.Context, u *db.User) (bool, error) {
+	if u.TOTPEnabledAt != nil || u.ServiceAccount {
+		return false, nil
+	}
+	var role db.Role
+	err := s.dbx.Gorm.WithContext(ctx).Select("require_2fa").First(&role, "code = ?", u.Role).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("load role: %w", err)
+	}
+	return role.Require2FA, nil
+}
+
+// SetRoleRequire2FA sets whether members of role must use two-factor authentication.
+func (s *Service) SetRoleRequire2FA(ctx context.Context, role string, required bool, updatedBy string) error {
+	res := s.dbx.Gorm.WithContext(ctx).Model(&db.Role{}).Where("code = ?", role).
+		Updates(map[string]interface{}{"require_2fa": required, "updated_by": updatedBy})
+	if res.Error != nil {
+		return fmt.Errorf("update role: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrRoleNotFound
+	}
+	s.log.Info("role 2FA requirement updated", "role", role, "required", required, "by", updatedBy)
+	return nil
+}
@@ -0,0 +1,471 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	netmail "net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-demo/internal/audit"
+	"go-demo/internal/db"
+	"go-demo/internal/mail"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidImport is returned when an import file cannot be read as a whole:
+// it is not CSV, lacks a required column or has too many rows.
+var ErrInvalidImport = errors.New("invalid import file")
+
+// MaxImportRows caps the number of users one import may create.
+const MaxImportRows = 1000
+
+// How imported users get their first password.
+const (
+	// ImportPassword generates a temporary password that is returned once
+	// and stops working after INVITE_TTL unless the user changes it.
+	ImportPassword = "password"
+	// ImportInvite mails a link to choose a password (valid for INVITE_TTL).
+	ImportInvite = "invite"
+)
+
+// Per-row import error codes.
+const (
+	ImportMissingField    = "missing_field"
+	ImportInvalidUsername = "invalid_username"
+	ImportInvalidEmail    = "invalid_email"
+	ImportInvalidRole     = "invalid_role"
+	ImportTeamNotFound    = "team_not_found"
+	ImportDuplicateRow    = "duplicate_row"
+	ImportUserExists      = "user_exists"
+	ImportFailed          = "server_error"
+)
+
+// ImportRow is one user read from an import file. Line is the CSV line number.
+type ImportRow struct {
+	Line     int
+	Username string
+	Email    string
+	Role     string
+	Team     string
+}
+
+// ImportError explains why a row was not imported.
+type ImportError struct {
+	Code    string
+	Message string
+}
+
+func (e *ImportError) Error() string { return e.Message }
+
+// ImportResult is the outcome of one row. UserID is set once the user has
+// been created; Password is the temporary password in ImportPassword mode.
+type ImportResult struct {
+	ImportRow
+	UserID   string
+	Password string
+	Err      *ImportError
+}
+
+// ParseUserImport reads users from CSV with a header row naming the columns
+// username, email, role and optionally team, in any order and case. An empty
+// role defaults to USER; blank lines are skipped.
+func ParseUserImport(r io.Reader) ([]ImportRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: empty file", ErrInvalidImport)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	cols := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if _, dup := cols[name]; dup {
+			return nil, fmt.Errorf("%w: duplicate column %q", ErrInvalidImport, name)
+		}
+		cols[name] = i
+	}
+	for _, name := range []string{"username", "email", "role"} {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("%w: missing column %q", ErrInvalidImport, name)
+		}
+	}
+	field := func(rec []string, name string) string {
+		i, ok := cols[name]
+		if !ok || i >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[i])
+	}
+
+	var rows []ImportRow
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+		line, _ := cr.FieldPos(0)
+		row := ImportRow{
+			Line:     line,
+			Username: field(rec, "username"),
+			Email:    field(rec, "email"),
+			Role:     field(rec, "role"),
+			Team:     field(rec, "team"),
+		}
+		if row == (ImportRow{Line: line}) {
+			continue
+		}
+		if row.Role == "" {
+			row.Role = "USER"
+		}
+		if len(rows) == MaxImportRows {
+			return nil, fmt.Errorf("%w: more than %d rows", ErrInvalidImport, MaxImportRows)
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%w: no rows", ErrInvalidImport)
+	}
+	return rows, nil
+}
+
+// ImportUsers validates rows and, unless dryRun is set, creates the valid
+// ones. Each user is created in its own transaction, so invalid rows do not
+// stop the others; a dry run reports the same per-row errors without writing.
+// mode is ImportPassword or ImportInvite.
+func (s *Service) ImportUsers(ctx context.Context, rows []ImportRow, mode string, dryRun bool, createdBy string) ([]ImportResult, error) {
+	if mode != ImportPassword && mode != ImportInvite {
+		return nil, fmt.Errorf("%w: mode must be %s or %s", ErrInvalidImport, ImportPassword, ImportInvite)
+	}
+	results, teams, err := s.validateImport(ctx, rows)
+	if err != nil || dryRun {
+		return results, err
+	}
+	for i := range results {
+		res := &results[i]
+		if res.Err != nil {
+			continue
+		}
+		if err := s.importUser(ctx, res, teams[res.Team], mode, createdBy); err != nil {
+			s.log.Error("import user failed", "line", res.Line, "username", res.Username, "err", err)
+			res.Password = ""
+			res.Err = &ImportError{Code: ImportFailed, Message: "could not create user"}
+		}
+	}
+	return results, nil
+}
+
+// validateImport checks every row against the roles, teams and users in the
+// database and against the other rows. It returns the team IDs by name.
+func (s *Service) validateImport(ctx context.Context, rows []ImportRow) ([]ImportResult, map[string]string, error) {
+	var codes []string
+	if err := s.dbx.Gorm.WithContext(ctx).Model(&db.Role{}).Pluck("code", &codes).Error; err != nil {
+		return nil, nil, fmt.Errorf("list roles: %w", err)
+	}
+	// roles tells for every existing role whether the caller may assign it.
+	roles := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		err := s.checkAssignableRole(ctx, code)
+		if err != nil && !errors.Is(err, ErrAdminAssign) && !errors.Is(err, ErrRoleNotDelegable) {
+			return nil, nil, err
+		}
+		roles[code] = err == nil
+	}
+	var teamRows []db.Team
+	if err := s.dbx.Gorm.WithContext(ctx).Select("id", "name").Find(&teamRows).Error; err != nil {
+		return nil, nil, fmt.Errorf("list teams: %w", err)
+	}
+	teams := make(map[string]string, len(teamRows))
+	for _, t := range teamRows {
+		teams[t.Name] = t.ID
+	}
+
+	// Names are compared case-insensitively so near duplicates are caught too.
+	var usernames, emails []string
+	for _, r := range rows {
+		usernames = append(usernames, strings.ToLower(r.Username))
+		emails = append(emails, strings.ToLower(r.Email))
+	}
+	var existing []db.User
+	if err := s.dbx.Gorm.WithContext(ctx).
+		Select("username", "email").
+		Where("LOWER(username) IN ? OR LOWER(email) IN ?", usernames, emails).
+		Find(&existing).Error; err != nil {
+		return nil, nil, fmt.Errorf("check existing: %w", err)
+	}
+	taken := map[string]bool{}
+	for _, u := range existing {
+		taken["u:"+strings.ToLower(u.Username)] = true
+		taken["e:"+strings.ToLower(u.Email)] = true
+	}
+
+	seen := map[string]int{}
+	results := make([]ImportResult, len(rows))
+	for i, r := range rows {
+		results[i] = ImportResult{ImportRow: r, Err: checkImportRow(r, roles, teams)}
+		if results[i].Err != nil {
+			continue
+		}
+		for _, k := range []string{"u:" + strings.ToLower(r.Username), "e:" + strings.ToLower(r.Email)} {
+			if taken[k] {
+				results[i].Err = &ImportError{Code: ImportUserExists, Message: "a user with this username or email already exists"}
+				break
+			}
+			if line, ok := seen[k]; ok {
+				results[i].Err = &ImportError{Code: ImportDuplicateRow, Message: fmt.Sprintf("username or email repeats line %d", line)}
+				break
+			}
+		}
+		if results[i].Err == nil {
+			seen["u:"+strings.ToLower(r.Username)] = r.Line
+			seen["e:"+strings.ToLower(r.Email)] = r.Line
+		}
+	}
+	return results, teams, nil
+}
+
+func checkImportRow(r ImportRow, roles map[string]bool, teams map[string]string) *ImportError {
+	switch {
+	case r.Username == "":
+		return &ImportError{Code: ImportMissingField, Message: "username is required"}
+	case r.Email == "":
+		return &ImportError{Code: ImportMissingField, Message: "email is required"}
+	case !validUsername(r.Username):
+		return &ImportError{Code: ImportInvalidUsername, Message: "username must be at most 64 characters without spaces or @"}
+	}
+	if a, err := netmail.ParseAddress(r.Email); err != nil || a.Address != r.Email || len(r.Email) > 255 {
+		return &ImportError{Code: ImportInvalidEmail, Message: "email is not a valid address"}
+	}
+	if assignable, ok := roles[r.Role]; !ok {
+		return &ImportError{Code: ImportInvalidRole, Message: fmt.Sprintf("unknown role %q", r.Role)}
+	} else if !assignable {
+		return &ImportError{Code: ImportInvalidRole, Message: fmt.Sprintf("you cannot assign role %s", r.Role)}
+	}
+	if _, ok := teams[r.Team]; r.Team != "" && !ok {
+		return &ImportError{Code: ImportTeamNotFound, Message: fmt.Sprintf("unknown team %q", r.Team)}
+	}
+	return nil
+}
+
+// importUser creates the user of a validated row, adds it to its team and
+// sends the verification or invitation email.
+func (s *Service) importUser(ctx context.Context, res *ImportResult, teamID, mode, createdBy string) error {
+	u := &db.User{
+		Username:  res.Username,
+		Email:     res.Email,
+		Role:      res.Role,
+		CreatedBy: createdBy,
+		UpdatedBy: createdBy,
+	}
+	if mode == ImportPassword {
+		password, err := s.temporaryPassword(u.Username, u.Email)
+		if err != nil {
+			return err
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("hash password: %w", err)
+		}
+		expires := time.Now().Add(s.cfg.InviteTTL)
+		u.PasswordHash = string(hash)
+		u.PasswordExpiresAt = &expires
+		res.Password = password
+	}
+	// Invited users have no password until they follow the link, so they
+	// cannot log in before that.
+	err := s.transaction(ctx, func(tx *gorm.DB) error {
+		if err := tx.Create(u).Error; err != nil {
+			return fmt.Errorf("create user: %w", err)
+		}
+		if u.PasswordHash != "" {
+			if err := s.recordPassword(tx, u.ID, u.PasswordHash); err != nil {
+				return err
+			}
+		}
+		if teamID != "" {
+			if err := tx.Create(&db.TeamMember{TeamID: teamID, UserID: u.ID, CreatedBy: createdBy}).Error; err != nil {
+				return fmt.Errorf("add team member: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	res.UserID = u.ID
+	s.auditUserCreate(ctx, u, map[string]any{"source": "import", "mode": mode, "team": res.Team})
+
+	if mode == ImportInvite {
+		err = s.sendInvite(ctx, u, createdBy)
+	} else {
+		err = s.SendEmailVerification(ctx, u)
+	}
+	if err != nil {
+		s.log.Error("failed to send email to imported user", "user_id", u.ID, "mode", mode, "err", err)
+	}
+	return nil
+}
+
+// sendInvite mails u a link to choose a first password. It is a password
+// reset token, so completing it also verifies the email address.
+func (s *Service) sendInvite(ctx context.Context, u *db.User, invitedBy string) error {
+	token, err := s.issueUserToken(ctx, u.ID, db.UserTokenPasswordReset, s.cfg.InviteTTL)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mail.Message{
+		To:      u.Email,
+		Subject: "You have been invited",
+		Body: fmt.Sprintf("Hello %s,\n\n%s created an account for you. Use the link below to choose your password. It expires in %s.\n\n%s\n",
+			u.Username, invitedBy, s.cfg.InviteTTL, s.link("/reset-password", token)),
+	})
+}
+
+// tempPasswordAlphabet leaves out characters that are easily confused.
+const tempPasswordAlphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789!#%+-=?@"
+
+// temporaryPassword returns a random password that satisfies the password
+// policy for the given account.
+func (s *Service) temporaryPassword(username, email string) (string, error) {
+	n := min(max(16, s.cfg.PasswordMinLength), maxPasswordBytes)
+	for range 100 {
+		b := make([]byte, n)
+		for i := range b {
+			j, err := rand.Int(rand.Reader, big.NewInt(int64(len(tempPasswordAlphabet))))
+			if err != nil {
+				return "", fmt.Errorf("rand: %w", err)
+			}
+			b[i] = tempPasswordAlphabet[j.Int64()]
+		}
+		// Retry the rare draw that misses a character class.
+		if p := string(b); characterClasses(p) == 4 && s.CheckPasswordPolicy(p, username, email) == nil {
+			return p, nil
+		}
+	}
+	return "", errors.New("cannot generate a password that satisfies the password policy")
+}
+
+// userExportBatch is how many users ExportUsersCSV reads per query.
+const userExportBatch = 500
+
+// userExportHeader is the first row written by ExportUsersCSV.
+var userExportHeader = []string{"id", "username", "email", "role", "status", "teams", "service_account",
+	"email_verified", "two_factor", "last_login_at", "created_time", "created_by"}
+
+// ExportUsersCSV writes the users matching the search, role and status of q
+// to w as CSV, ordered by username, for access reviews. Teams are listed by
+// name separated by semicolons. Rows are read in batches, paging on
+// (username, id) so that no user is skipped or repeated.
+func (s *Service) ExportUsersCSV(ctx context.Context, q UserQuery, w io.Writer) error {
+	if err := q.Validate(); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(userExportHeader); err != nil {
+		return err
+	}
+	rows := 0
+	var last *db.User
+	for {
+		page := s.filterUsers(ctx, q)
+		if last != nil {
+			page = page.Where("(username, id) > (?, ?)", last.Username, last.ID)
+		}
+		var batch []db.User
+		if err := page.Order("username, id").Limit(userExportBatch).Find(&batch).Error; err != nil {
+			return fmt.Errorf("export users: %w", err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+		teams, err := s.teamNames(ctx, batch)
+		if err != nil {
+			return err
+		}
+		for _, u := range batch {
+			if err := cw.Write(userExportRecord(u, teams[u.ID])); err != nil {
+				return err
+			}
+			rows++
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+		if len(batch) < userExportBatch {
+			break
+		}
+		last = &batch[len(batch)-1]
+	}
+	s.audit.Record(ctx, audit.Event{
+		Action:  audit.ActionUserExport,
+		Details: map[string]any{"q": q.Search, "role": q.Role, "status": q.Status, "rows": rows},
+	})
+	return nil
+}
+
+// teamNames returns the names of the teams of each user, by user ID.
+func (s *Service) teamNames(ctx context.Context, users []db.User) (map[string][]string, error) {
+	ids := make([]string, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	var rows []struct {
+		UserID string
+		Name   string
+	}
+	if err := s.dbx.Gorm.WithContext(ctx).
+		Table(`"DEMO"."TEAM_MEMBER" m`).
+		Select("m.user_id, t.name").
+		Joins(`JOIN "DEMO"."TEAM" t ON t.id = m.team_id`).
+		Where("m.user_id IN ?", ids).
+		Order("t.name").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("list user teams: %w", err)
+	}
+	out := make(map[string][]string, len(rows))
+	for _, r := range rows {
+		out[r.UserID] = append(out[r.UserID], r.Name)
+	}
+	return out, nil
+}
+
+func userExportRecord(u db.User, teams []string) []string {
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	// Usernames, emails and team names are user-supplied.
+	return audit.EscapeCSVFormulas([]string{
+		u.ID,
+		u.Username,
+		u.Email,
+		u.Role,
+		u.Status,
+		strings.Join(teams, ";"),
+		strconv.FormatBool(u.ServiceAccount),
+		strconv.FormatBool(u.EmailVerifiedAt != nil),
+		strconv.FormatBool(u.TOTPEnabledAt != nil),
+		formatTime(u.LastLoginAt),
+		u.CreatedTime.UTC().Format(time.RFC3339),
+		u.CreatedBy,
+	})
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go-demo/internal/config"
+	"go-demo/internal/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUserImport(t *testing.T) {
+	rows, err := ParseUserImport(strings.NewReader("\ufeffEmail, Username,role,Team\n" +
+		"alice@example.com,alice,ANALYZER,Payments\n" +
+		"\n" +
+		"bob@example.com,bob,,\n" +
+		"carol@example.com,carol\n"))
+	require.NoError(t, err)
+	require.Equal(t, []ImportRow{
+		{Line: 2, Username: "alice", Email: "alice@example.com", Role: "ANALYZER", Team: "Payments"},
+		{Line: 4, Username: "bob", Email: "bob@example.com", Role: "USER"},
+		{Line: 5, Username: "carol", Email: "carol@example.com", Role: "USER"},
+	}, rows)
+
+	for name, in := range map[string]string{
+		"empty":            "",
+		"header only":      "username,email,role\n",
+		"missing column":   "username,email\nalice,alice@example.com\n",
+		"duplicate column": "username,email,role,email\n",
+		"bad quoting":      "username,email,role\n\"alice,alice@example.com,USER\n",
+		"too many rows":    "username,email,role\n" + strings.Repeat("u,u@example.com,USER\n", MaxImportRows+1),
+	} {
+		_, err := ParseUserImport(strings.NewReader(in))
+		require.True(t, errors.Is(err, ErrInvalidImport), "%s: %v", name, err)
+	}
+}
+
+func TestCheckImportRow(t *testing.T) {
+	roles := map[string]bool{"USER": true, "ANALYZER": true, "ADMIN": false}
+	teams := map[string]string{"Payments": "t1"}
+	cases := []struct {
+		row  ImportRow
+		code string
+	}{
+		{ImportRow{Username: "alice", Email: "alice@example.com", Role: "USER", Team: "Payments"}, ""},
+		{ImportRow{Email: "alice@example.com", Role: "USER"}, ImportMissingField},
+		{ImportRow{Username: "alice", Role: "USER"}, ImportMissingField},
+		{ImportRow{Username: "al ice", Email: "alice@example.com", Role: "USER"}, ImportInvalidUsername},
+		{ImportRow{Username: "alice", Email: "Alice <alice@example.com>", Role: "USER"}, ImportInvalidEmail},
+		{ImportRow{Username: "alice", Email: "not-an-email", Role: "USER"}, ImportInvalidEmail},
+		{ImportRow{Username: "alice", Email: "alice@example.com", Role: "ADMIN"}, ImportInvalidRole},
+		{ImportRow{Username: "alice", Email: "alice@example.com", Role: "NOPE"}, ImportInvalidRole},
+		{ImportRow{Username: "alice", Email: "alice@example.com", Role: "USER", Team: "Nope"}, ImportTeamNotFound},
+	}
+	for _, c := range cases {
+		err := checkImportRow(c.row, roles, teams)
+		if c.code == "" {
+			require.Nil(t, err, "%+v", c.row)
+			continue
+		}
+		require.NotNil(t, err, "%+v", c.row)
+		require.Equal(t, c.code, err.Code, "%+v", c.row)
+	}
+}
+
+func TestTemporaryPassword(t *testing.T) {
+	s := &Service{cfg: config.Config{PasswordMinLength: 20, PasswordMinClasses: 4}}
+	seen := map[string]bool{}
+	for range 20 {
+		p, err := s.temporaryPassword("alice", "alice@example.com")
+		require.NoError(t, err)
+		require.Len(t, p, 20)
+		require.NoError(t, s.CheckPasswordPolicy(p, "alice", "alice@example.com"))
+		require.False(t, seen[p])
+		seen[p] = true
+	}
+
+	s.cfg.PasswordMinLength = 100
+	_, err := s.temporaryPassword("alice", "alice@example.com")
+	require.Error(t, err)
+}
+
+func TestUserExportRecord(t *testing.T) {
+	verified := time.Date(2026, 9, 1, 8, 0, 0, 0, time.UTC)
+	rec := userExportRecord(db.User{
+		ID:              "u1",
+		Username:        "alice",
+		Email:           "alice@example.com",
+		Role:            "ANALYZER",
+		Status:          db.UserStatusActive,
+		EmailVerifiedAt: &verified,
+		CreatedTime:     time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC),
+		CreatedBy:       "admin",
+	}, []string{"Data", "Payments"})
+	require.Len(t, rec, len(userExportHeader))
+	require.Equal(t, []string{"u1", "alice", "alice@example.com", "ANALYZER", "active", "Data;Payments", "false",
+		"true", "false", "", "2026-08-01T12:00:00Z", "admin"}, rec)
+
+	rec = userExportRecord(db.User{Username: "=cmd|' /C calc'!A0", Email: "@evil@example.com"}, []string{"+Team"})
+	require.Equal(t, "'=cmd|' /C calc'!A0", rec[1])
+	require.Equal(t, "'@evil@example.com", rec[2])
+	require.Equal(t, "'+Team", rec[5])
+}
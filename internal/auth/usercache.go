@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go-demo/internal/db"
+
+	"gorm.io/gorm"
+)
+
+// userCacheMax bounds the number of cached users; the cache is emptied when it
+// is reached, which is cheaper than tracking recency for a short TTL.
+const userCacheMax = 10000
+
+type cachedUser struct {
+	user    db.User
+	expires time.Time
+}
+
+// roleAccess is what authenticated requests need to know about a role.
+type roleAccess struct {
+	perms      []string
+	require2FA bool
+	expires    time.Time
+}
+
+// userCache keeps users looked up by Authenticate, and the permissions and 2FA
+// requirement of their roles, for a short time so that authenticated requests
+// do not each load them. Any write to DEMO.USER, DEMO.ROLE or
+// DEMO.ROLE_PERMISSION through this process empties it, and transactions run
+// by Service.transaction empty it again after they end; other instances see
+// the change when their entries expire.
+type userCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedUser
+	roles   map[string]roleAccess
+}
+
+func newUserCache(ttl time.Duration) *userCache {
+	return &userCache{ttl: ttl, entries: make(map[string]cachedUser), roles: make(map[string]roleAccess)}
+}
+
+func (c *userCache) get(id string) (*db.User, bool) {
+	if c == nil || c.ttl <= 0 {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[id]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	u := e.user
+	return &u, true
+}
+
+func (c *userCache) put(u *db.User) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= userCacheMax {
+		c.entries = make(map[string]cachedUser)
+	}
+	c.entries[u.ID] = cachedUser{user: *u, expires: time.Now().Add(c.ttl)}
+}
+
+func (c *userCache) getRole(code string) (roleAccess, bool) {
+	if c == nil || c.ttl <= 0 {
+		return roleAccess{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.roles[code]
+	if !ok || time.Now().After(r.expires) {
+		return roleAccess{}, false
+	}
+	return r, true
+}
+
+func (c *userCache) putRole(code string, r roleAccess) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.roles) >= userCacheMax {
+		c.roles = make(map[string]roleAccess)
+	}
+	r.expires = time.Now().Add(c.ttl)
+	c.roles[code] = r
+}
+
+func (c *userCache) clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+	clear(c.roles)
+}
+
+// userChangesKey carries the flag Service.transaction uses to learn that its
+// transaction changed a user or role.
+type userChangesKey struct{}
+
+// cachedTables are the tables whose changes empty the cache.
+var cachedTables = []string{(db.User{}).TableName(), (db.Role{}).TableName(), (db.RolePermission{}).TableName()}
+
+// registerInvalidation empties the cache after every create, update or delete
+// in cachedTables made through g.
+func (c *userCache) registerInvalidation(g *gorm.DB) error {
+	invalidate := func(tx *gorm.DB) {
+		if tx.Error == nil && tx.Statement.Schema != nil && slices.Contains(cachedTables, tx.Statement.Schema.Table) {
+			if changed, ok := tx.Statement.Context.Value(userChangesKey{}).(*bool); ok {
+				*changed = true
+			}
+			c.clear()
+		}
+	}
+	if err := g.Callback().Create().After("gorm:create").Register("auth:user_cache_create", invalidate); err != nil {
+		return err
+	}
+	if err := g.Callback().Update().After("gorm:update").Register("auth:user_cache_update", invalidate); err != nil {
+		return err
+	}
+	return g.Callback().Delete().After("gorm:delete").Register("auth:user_cache_delete", invalidate)
+}
+
+// transaction runs fn in a database transaction. The invalidation callbacks
+// run before the commit, while concurrent lookups still read the old rows and
+// may cache them again, so the cache is emptied once more after a transaction
+// that changed a user or role has ended.
+func (s *Service) transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	changed := false
+	err := s.dbx.Gorm.WithContext(context.WithValue(ctx, userChangesKey{}, &changed)).Transaction(fn)
+	if changed {
+		s.users.clear()
+	}
+	return err
+}
+
+// cachedUserByID is GetUserByID through the user cache.
+func (s *Service) cachedUserByID(ctx context.Context, id string) (*db.User, error) {
+	if u, ok := s.users.get(id); ok {
+		return u, nil
+	}
+	u, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.users.put(u)
+	return u, nil
+}
+
+// RoleAccess returns the permissions of u's role and whether u still has to
+// enroll in 2FA, through the cache. RequireAuth calls it on every request.
+func (s *Service) RoleAccess(ctx context.Context, u *db.User) ([]string, bool, error) {
+	r, ok := s.users.getRole(u.Role)
+	if !ok {
+		var role db.Role
+		err := s.dbx.Gorm.WithContext(ctx).Select("require_2fa").First(&role, "code = ?", u.Role).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, fmt.Errorf("load role: %w", err)
+		}
+		perms, err := s.PermissionsForRole(ctx, u.Role)
+		if err != nil {
+			return nil, false, err
+		}
+		r = roleAccess{perms: perms, require2FA: role.Require2FA}
+		s.users.putRole(u.Role, r)
+	}
+	enroll := r.require2FA && u.TOTPEnabledAt == nil && !u.ServiceAccount
+	return slices.Clone(r.perms), enroll, nil
+}
@@ -2,13 +2,41 @@ package authctx
 
 import (
 	"context"
+	"sort"
+	"time"
 
 	"go-demo/internal/db"
 )
 
 type ctxKey int
 
-const userKey ctxKey = iota
+const (
+	userKey ctxKey = iota
+	permissionsKey
+	tokenKey
+	clientKey
+	requestIDKey
+)
+
+// Token identifies the access token that authenticated the request. For
+// requests authenticated with an API key only APIKeyID and ExpiresAt are set.
+type Token struct {
+	ID        string
+	SessionID string
+	APIKeyID  string
+	ExpiresAt time.Time
+}
+
+// WithToken stores the request's access token details in the context.
+func WithToken(ctx context.Context, t Token) context.Context {
+	return context.WithValue(ctx, tokenKey, t)
+}
+
+// TokenFrom retrieves the request's access token details from the context.
+func TokenFrom(ctx context.Context) (Token, bool) {
+	t, ok := ctx.Value(tokenKey).(Token)
+	return t, ok
+}
 
 // WithUser stores the authenticated user in the context.
 func WithUser(ctx context.Context, u *db.User) context.Context {
@@ -23,4 +51,59 @@ func UserFrom(ctx context.Context) (*db.User, bool) {
 	}
 	u, ok := v.(*db.User)
 	return u, ok
-}
\ No newline at end of file
+}
+
+// WithPermissions stores the authenticated user's permission codes in the context.
+func WithPermissions(ctx context.Context, perms []string) context.Context {
+	set := make(map[string]struct{}, len(perms))
+	for _, p := range perms {
+		set[p] = struct{}{}
+	}
+	return context.WithValue(ctx, permissionsKey, set)
+}
+
+// PermissionsFrom returns the permission codes stored in the context, sorted.
+func PermissionsFrom(ctx context.Context) []string {
+	set, _ := ctx.Value(permissionsKey).(map[string]struct{})
+	out := make([]string, 0, len(set))
+	for p := range set {
+		out = append(out, p)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// HasPermission reports whether the context grants perm.
+func HasPermission(ctx context.Context, perm string) bool {
+	set, _ := ctx.Value(permissionsKey).(map[string]struct{})
+	_, ok := set[perm]
+	return ok
+}
+
+// Client describes the device a request came from.
+type Client struct {
+	UserAgent string
+	IP        string
+}
+
+// WithClient stores the request's client details in the context.
+func WithClient(ctx context.Context, c Client) context.Context {
+	return context.WithValue(ctx, clientKey, c)
+}
+
+// ClientFrom retrieves the request's client details from the context.
+func ClientFrom(ctx context.Context) (Client, bool) {
+	c, ok := ctx.Value(clientKey).(Client)
+	return c, ok
+}
+
+// WithRequestID stores the request's ID (X-Request-Id) in the context.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFrom returns the request's ID, or "" when there is none.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
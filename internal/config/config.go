@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
@@ -20,9 +21,98 @@ type Config struct {
 	JWTSecret   string
 	JWTTTL      time.Duration
 	RefreshTTL  time.Duration
+	// Asymmetric access token signing: a JSON manifest of RS256/EdDSA keys,
+	// how often it is re-read, and whether HS256 tokens signed with JWTSecret
+	// are still accepted once the key ring is in use.
+	JWTKeyRingFile   string
+	JWTKeyRingReload time.Duration
+	JWTAcceptHS256   bool
+	// Access token iss/aud claims (verified on every request) and the clock
+	// skew tolerated on exp/iat.
+	JWTIssuer    string
+	JWTAudience  string
+	JWTClockSkew time.Duration
+	// AuthStateless makes RequireAuth trust valid access tokens until they
+	// expire instead of loading the user; their lifetime is capped at
+	// JWTStatelessTTL. Otherwise users are cached for UserCacheTTL (0 disables).
+	AuthStateless   bool
+	JWTStatelessTTL time.Duration
+	UserCacheTTL    time.Duration
+	// How often expired refresh tokens and revoked access tokens are purged; 0 disables.
+	TokenCleanupInterval time.Duration
+
+	// Self-service sign-up: RegistrationMode is open (anyone may register),
+	// invite (only with an invitation) or disabled (neither).
+	RegistrationMode string
+
+	// RolesFile is a JSON file of built-in role definitions seeded at startup;
+	// empty uses the defaults compiled into the binary.
+	RolesFile string
+
+	// Account emails: base URL for links, token lifetimes and whether
+	// unverified accounts may log in. InviteTTL is how long invitations, the
+	// link mailed to invited users and imported temporary passwords stay valid.
+	AppBaseURL               string
+	PasswordResetTTL         time.Duration
+	EmailVerificationTTL     time.Duration
+	InviteTTL                time.Duration
+	RequireEmailVerification bool
+
+	// Login protection: accounts lock for LoginLockoutDuration after
+	// LoginMaxFailures consecutive failures, doubling with every further failure
+	// up to LoginLockoutMax. Attempts are also rate limited per client IP and per
+	// identifier within LoginRateWindow; 0 disables a limit.
+	LoginMaxFailures         int
+	LoginLockoutDuration     time.Duration
+	LoginLockoutMax          time.Duration
+	LoginRateLimitIP         int
+	LoginRateLimitIdentifier int
+	LoginRateWindow          time.Duration
+
+	// Password policy: minimum length, how many of lowercase, uppercase,
+	// digits and symbols must appear, how many previous passwords may not be
+	// reused, and an optional file of breached password SHA-1 hashes.
+	PasswordMinLength     int
+	PasswordMinClasses    int
+	PasswordHistory       int
+	BreachedPasswordsFile string
+
+	// Two-factor authentication: issuer shown in authenticator apps and how
+	// long the challenge between password and code stays valid.
+	TOTPIssuer            string
+	TwoFactorChallengeTTL time.Duration
+
+	// Single sign-on with an OpenID Connect provider; enabled when OIDCIssuer
+	// is set. Users are provisioned on first login with the role mapped from
+	// OIDCRoleClaim via OIDCRoleMap ("value=ROLE,..."), or OIDCDefaultRole.
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       []string
+	OIDCRoleClaim    string
+	OIDCRoleMap      string
+	OIDCDefaultRole  string
+
+	// Mail delivery: MailDriver is log, file or smtp.
+	MailDriver   string
+	MailFrom     string
+	MailDir      string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
 
 	// OpenAI
 	OpenAIAPIKey string
+	// Per-user AI quotas over a rolling 24h window; 0 disables the limit.
+	AIQueriesPerDay int64
+	AITokensPerDay  int64
+
+	// SQL log redaction defaults, used until an admin stores a policy.
+	RedactAtIngest  bool
+	RedactAtExport  bool
+	RedactRetainRaw bool
 }
 
 func FromEnv() (Config, error) {
@@ -39,7 +129,77 @@ func FromEnv() (Config, error) {
 		JWTTTL:      parseDuration(getenv("JWT_TTL", "24h"), 24*time.Hour),
 		RefreshTTL:  parseDuration(getenv("REFRESH_TTL", "720h"), 720*time.Hour), // 30 days
 
-		OpenAIAPIKey: getenv("OPENAI_API_KEY", ""),
+		JWTKeyRingFile:   getenv("JWT_KEYRING_FILE", ""),
+		JWTKeyRingReload: parseDuration(getenv("JWT_KEYRING_RELOAD", "5m"), 5*time.Minute),
+		JWTAcceptHS256:   parseBool(getenv("JWT_ACCEPT_HS256", "true"), true),
+		JWTIssuer:        getenv("JWT_ISSUER", "go-demo"),
+		JWTAudience:      getenv("JWT_AUDIENCE", "go-demo-api"),
+		JWTClockSkew:     parseDuration(getenv("JWT_CLOCK_SKEW", "30s"), 30*time.Second),
+		AuthStateless:    parseBool(getenv("AUTH_STATELESS", "false"), false),
+		JWTStatelessTTL:  parseDuration(getenv("JWT_STATELESS_TTL", "5m"), 5*time.Minute),
+		UserCacheTTL:     parseDuration(getenv("USER_CACHE_TTL", "30s"), 30*time.Second),
+
+		TokenCleanupInterval: parseDuration(getenv("TOKEN_CLEANUP_INTERVAL", "1h"), time.Hour),
+
+		RegistrationMode: strings.ToLower(getenv("REGISTRATION_MODE", "open")),
+
+		RolesFile: getenv("ROLES_FILE", ""),
+
+		AppBaseURL:               strings.TrimRight(getenv("APP_BASE_URL", "http://localhost:8080"), "/"),
+		PasswordResetTTL:         parseDuration(getenv("PASSWORD_RESET_TTL", "1h"), time.Hour),
+		EmailVerificationTTL:     parseDuration(getenv("EMAIL_VERIFICATION_TTL", "48h"), 48*time.Hour),
+		InviteTTL:                parseDuration(getenv("INVITE_TTL", "168h"), 168*time.Hour),
+		RequireEmailVerification: parseBool(getenv("REQUIRE_EMAIL_VERIFICATION", "false"), false),
+
+		LoginMaxFailures:         int(parseInt64(getenv("LOGIN_MAX_FAILURES", "5"), 5)),
+		LoginLockoutDuration:     parseDuration(getenv("LOGIN_LOCKOUT_DURATION", "1m"), time.Minute),
+		LoginLockoutMax:          parseDuration(getenv("LOGIN_LOCKOUT_MAX", "1h"), time.Hour),
+		LoginRateLimitIP:         int(parseInt64(getenv("LOGIN_RATE_LIMIT_IP", "20"), 20)),
+		LoginRateLimitIdentifier: int(parseInt64(getenv("LOGIN_RATE_LIMIT_IDENTIFIER", "10"), 10)),
+		LoginRateWindow:          parseDuration(getenv("LOGIN_RATE_WINDOW", "1m"), time.Minute),
+
+		PasswordMinLength:     int(parseInt64(getenv("PASSWORD_MIN_LENGTH", "8"), 8)),
+		PasswordMinClasses:    int(parseInt64(getenv("PASSWORD_MIN_CLASSES", "2"), 2)),
+		PasswordHistory:       int(parseInt64(getenv("PASSWORD_HISTORY", "5"), 5)),
+		BreachedPasswordsFile: getenv("BREACHED_PASSWORDS_FILE", ""),
+
+		TOTPIssuer:            getenv("TOTP_ISSUER", "go-demo"),
+		TwoFactorChallengeTTL: parseDuration(getenv("TWO_FACTOR_CHALLENGE_TTL", "5m"), 5*time.Minute),
+
+		OIDCIssuer:       getenv("OIDC_ISSUER", ""),
+		OIDCClientID:     getenv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret: getenv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:  getenv("OIDC_REDIRECT_URL", ""),
+		OIDCScopes:       strings.Fields(getenv("OIDC_SCOPES", "openid email profile")),
+		OIDCRoleClaim:    getenv("OIDC_ROLE_CLAIM", "groups"),
+		OIDCRoleMap:      getenv("OIDC_ROLE_MAP", ""),
+		OIDCDefaultRole:  getenv("OIDC_DEFAULT_ROLE", "USER"),
+
+		MailDriver:   getenv("MAIL_DRIVER", "log"),
+		MailFrom:     getenv("MAIL_FROM", "no-reply@localhost"),
+		MailDir:      getenv("MAIL_DIR", "tmp/mail"),
+		SMTPHost:     getenv("SMTP_HOST", ""),
+		SMTPPort:     int(parseInt64(getenv("SMTP_PORT", "587"), 587)),
+		SMTPUsername: getenv("SMTP_USERNAME", ""),
+		SMTPPassword: getenv("SMTP_PASSWORD", ""),
+
+		OpenAIAPIKey:    getenv("OPENAI_API_KEY", ""),
+		AIQueriesPerDay: parseInt64(getenv("AI_QUERIES_PER_DAY", "100"), 100),
+		AITokensPerDay:  parseInt64(getenv("AI_TOKENS_PER_DAY", "200000"), 200000),
+
+		RedactAtIngest:  parseBool(getenv("REDACT_AT_INGEST", "true"), true),
+		RedactAtExport:  parseBool(getenv("REDACT_AT_EXPORT", "true"), true),
+		RedactRetainRaw: parseBool(getenv("REDACT_RETAIN_RAW", "false"), false),
+	}
+
+	switch cfg.RegistrationMode {
+	case "open", "invite", "disabled":
+	default:
+		return Config{}, fmt.Errorf("REGISTRATION_MODE must be open, invite or disabled, got %q", cfg.RegistrationMode)
+	}
+
+	if cfg.OIDCRedirectURL == "" {
+		cfg.OIDCRedirectURL = cfg.AppBaseURL + "/v1/auth/oidc/callback"
 	}
 
 	// Default to permissive CORS in non-production if not explicitly configured.
@@ -72,6 +232,13 @@ func parseInt64(s string, def int64) int64 {
 	return def
 }
 
+func parseBool(s string, def bool) bool {
+	if v, err := strconv.ParseBool(s); err == nil {
+		return v
+	}
+	return def
+}
+
 func parseCSV(s string) []string {
 	if strings.TrimSpace(s) == "" {
 		return nil
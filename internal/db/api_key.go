@@ -0,0 +1,41 @@
+package db
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// APIKey is a long-lived credential of a service account, sent in the
+// X-API-Key header. Only the sha256 hash of the key is stored; Prefix is the
+// non-secret start of the key so admins can tell keys apart.
+// Scopes narrows the account's role permissions; empty means all of them.
+type APIKey struct {
+	ID          string     `gorm:"column:id;type:uuid;primaryKey"`
+	UserID      string     `gorm:"column:user_id;type:uuid;index;not null"`
+	Name        string     `gorm:"column:name;type:varchar(128);not null"`
+	Prefix      string     `gorm:"column:prefix;type:varchar(32);uniqueIndex;not null"`
+	KeyHash     string     `gorm:"column:key_hash;type:char(64);uniqueIndex;not null"` // sha256 hex
+	Scopes      []string   `gorm:"column:scopes;type:jsonb;serializer:json"`
+	ExpiresAt   *time.Time `gorm:"column:expires_at"`
+	LastUsedAt  *time.Time `gorm:"column:last_used_at"`
+	LastUsedIP  string     `gorm:"column:last_used_ip;type:varchar(64)"`
+	RevokedAt   *time.Time `gorm:"column:revoked_at"`
+	CreatedBy   string     `gorm:"column:created_by;type:varchar(64)"`
+	UpdatedBy   string     `gorm:"column:updated_by;type:varchar(64)"`
+	CreatedTime time.Time  `gorm:"column:created_time;autoCreateTime"`
+	UpdatedTime time.Time  `gorm:"column:updated_time;autoUpdateTime"`
+
+	User User `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+func (APIKey) TableName() string { return "DEMO.API_KEY" }
+
+// BeforeCreate hook to ensure UUID primary key is set.
+func (k *APIKey) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == "" {
+		k.ID = uuid.NewString()
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuditEvent is one entry of the append-only audit log: who did what to
+// which target, from where, and the values before and after the change.
+// Actor and target are stored by value without foreign keys so events
+// outlive the users they mention.
+type AuditEvent struct {
+	ID          uint64         `gorm:"column:id;primaryKey;autoIncrement"`
+	Action      string         `gorm:"column:action;type:varchar(64);not null;index"`
+	Outcome     string         `gorm:"column:outcome;type:varchar(16);not null"`
+	ActorID     string         `gorm:"column:actor_id;type:varchar(64);index"`
+	ActorName   string         `gorm:"column:actor_name;type:varchar(255)"`
+	TargetType  string         `gorm:"column:target_type;type:varchar(32)"`
+	TargetID    string         `gorm:"column:target_id;type:varchar(255);index"`
+	IP          string         `gorm:"column:ip;type:varchar(64)"`
+	RequestID   string         `gorm:"column:request_id;type:varchar(64);index"`
+	Before      map[string]any `gorm:"column:before;type:jsonb;serializer:json"`
+	After       map[string]any `gorm:"column:after;type:jsonb;serializer:json"`
+	Details     map[string]any `gorm:"column:details;type:jsonb;serializer:json"`
+	CreatedTime time.Time      `gorm:"column:created_time;autoCreateTime;index"`
+}
+
+func (AuditEvent) TableName() string { return "DEMO.AUDIT_EVENT" }
+
+// protectAuditEvents makes DEMO.AUDIT_EVENT append-only: updates and deletes
+// of rows fail. Old events can only be purged with TRUNCATE by the table owner.
+func protectAuditEvents(g *gorm.DB) error {
+	if err := g.Exec(`CREATE OR REPLACE FUNCTION "DEMO".audit_event_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'DEMO.AUDIT_EVENT is append-only';
+		END;
+		$$ LANGUAGE plpgsql`).Error; err != nil {
+		return fmt.Errorf("create function: %w", err)
+	}
+	if err := g.Exec(`DROP TRIGGER IF EXISTS audit_event_append_only ON "DEMO"."AUDIT_EVENT"`).Error; err != nil {
+		return fmt.Errorf("drop trigger: %w", err)
+	}
+	if err := g.Exec(`CREATE TRIGGER audit_event_append_only BEFORE UPDATE OR DELETE ON "DEMO"."AUDIT_EVENT"
+		FOR EACH ROW EXECUTE FUNCTION "DEMO".audit_event_append_only()`).Error; err != nil {
+		return fmt.Errorf("create trigger: %w", err)
+	}
+	return nil
+}
@@ -57,10 +57,32 @@ func New(cfg config.Config, log *slog.Logger) (*DB, error) {
 		return nil, fmt.Errorf("create schema: %w", err)
 	}
 
-	// AutoMigrate role, user, and refresh token tables in DEMO schema (respect FK order)
-	if err := g.AutoMigrate(&Role{}, &User{}, &RefreshToken{}); err != nil {
+	// Accounts created before email verification existed are treated as verified.
+	backfillVerified := g.Migrator().HasTable(&User{}) && !g.Migrator().HasColumn(&User{}, "email_verified_at")
+
+	// AutoMigrate role, user, token, permission, team, invitation and audit tables in DEMO schema (respect FK order)
+	if err := g.AutoMigrate(&Role{}, &User{}, &RefreshToken{}, &RevokedToken{}, &UserToken{}, &PasswordHistory{}, &RecoveryCode{}, &APIKey{}, &UserIdentity{}, &Permission{}, &RolePermission{}, &Team{}, &TeamMember{}, &Invitation{}, &AuditEvent{}); err != nil {
 		return nil, fmt.Errorf("auto migrate: %w", err)
 	}
+	if backfillVerified {
+		if err := g.Exec(`UPDATE "DEMO"."USER" SET email_verified_at = created_time WHERE email_verified_at IS NULL`).Error; err != nil {
+			return nil, fmt.Errorf("backfill email verification: %w", err)
+		}
+	}
+	if err := protectAuditEvents(g); err != nil {
+		return nil, fmt.Errorf("protect audit events: %w", err)
+	}
+	if err := migrateUserStatus(g); err != nil {
+		return nil, fmt.Errorf("migrate user status: %w", err)
+	}
+	// Refresh tokens issued before token families each start their own family.
+	if err := g.Exec(`UPDATE "DEMO"."REFRESH_TOKEN" SET family_id = id WHERE family_id IS NULL`).Error; err != nil {
+		return nil, fmt.Errorf("migrate refresh token families: %w", err)
+	}
+	if err := g.Exec(`UPDATE "DEMO"."REFRESH_TOKEN" SET session_started_at = created_time, last_used_at = created_time
+		WHERE session_started_at IS NULL`).Error; err != nil {
+		return nil, fmt.Errorf("migrate refresh token sessions: %w", err)
+	}
 
 	return &DB{Gorm: g, SQL: sqlDB, log: log}, nil
 }
@@ -78,6 +100,8 @@ type Role struct {
 	Code        string    `gorm:"column:code;type:varchar(64);primaryKey"`
 	Name        string    `gorm:"column:name;type:varchar(128);not null"`
 	Description string    `gorm:"column:description;type:text"`
+	Require2FA  bool      `gorm:"column:require_2fa;not null;default:false"` // members must enroll in TOTP before using the API
+	BuiltIn     bool      `gorm:"column:built_in;not null;default:false"`    // defined in the roles file; cannot be edited or deleted through the API
 	CreatedBy   string    `gorm:"column:created_by;type:varchar(64)"`
 	UpdatedBy   string    `gorm:"column:updated_by;type:varchar(64)"`
 	CreatedTime time.Time `gorm:"column:created_time;autoCreateTime"`
@@ -86,17 +110,37 @@ type Role struct {
 
 func (Role) TableName() string { return "DEMO.ROLE" }
 
+// User lifecycle states stored in User.Status.
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+	UserStatusDeleted   = "deleted"
+)
+
 // User represents the application user mapped to table "USER".
 type User struct {
-	ID           string    `gorm:"column:id;type:uuid;primaryKey"`
-	Username     string    `gorm:"column:username;type:varchar(64);uniqueIndex;not null"`
-	Email        string    `gorm:"column:email;type:varchar(255);uniqueIndex;not null"`
-	PasswordHash string    `gorm:"column:password;type:text;not null"`
-	CreatedBy    string    `gorm:"column:created_by;type:varchar(64)"`
-	UpdatedBy    string    `gorm:"column:updated_by;type:varchar(64)"`
-	Role         string    `gorm:"column:role;type:varchar(64);index"` // references Role.code
-	CreatedTime  time.Time `gorm:"column:created_time;autoCreateTime"`
-	UpdatedTime  time.Time `gorm:"column:updated_time;autoUpdateTime"`
+	ID                string     `gorm:"column:id;type:uuid;primaryKey"`
+	Username          string     `gorm:"column:username;type:varchar(64);uniqueIndex;not null"`
+	Email             string     `gorm:"column:email;type:varchar(255);uniqueIndex;not null"`
+	PasswordHash      string     `gorm:"column:password;type:text;not null"`
+	CreatedBy         string     `gorm:"column:created_by;type:varchar(64)"`
+	UpdatedBy         string     `gorm:"column:updated_by;type:varchar(64)"`
+	Role              string     `gorm:"column:role;type:varchar(64);index"` // references Role.code
+	Status            string     `gorm:"column:status;type:varchar(16);not null;default:active;index"`
+	ServiceAccount    bool       `gorm:"column:service_account;not null;default:false"` // no password; authenticates with API keys only
+	TokenVersion      int        `gorm:"column:token_version;not null;default:0"`       // bumped to invalidate all issued access tokens
+	DeletedAt         *time.Time `gorm:"column:deleted_at"`
+	EmailVerifiedAt   *time.Time `gorm:"column:email_verified_at"`
+	LastLoginAt       *time.Time `gorm:"column:last_login_at"`
+	FailedLoginCount  int        `gorm:"column:failed_login_count;not null;default:0"` // consecutive failed logins, reset on success
+	LastFailedLoginAt *time.Time `gorm:"column:last_failed_login_at"`
+	LockedUntil       *time.Time `gorm:"column:locked_until"`
+	PasswordExpiresAt *time.Time `gorm:"column:password_expires_at"` // set for generated passwords, cleared once the user chooses one
+	TOTPSecret        string     `gorm:"column:totp_secret;type:varchar(64)"` // base32; set during enrollment, active once TOTPEnabledAt is set
+	TOTPEnabledAt     *time.Time `gorm:"column:totp_enabled_at"`
+	TOTPLastCounter   int64      `gorm:"column:totp_last_counter;not null;default:0"` // last accepted time step, prevents code replay
+	CreatedTime       time.Time  `gorm:"column:created_time;autoCreateTime"`
+	UpdatedTime       time.Time  `gorm:"column:updated_time;autoUpdateTime"`
 
 	// Association to enforce FK via AutoMigrate.
 	RoleRecord   Role `gorm:"foreignKey:Role;references:Code;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
@@ -105,12 +149,25 @@ type User struct {
 func (User) TableName() string { return "DEMO.USER" }
 
 // RefreshToken persists opaque refresh tokens (hashed) for users.
+// Tokens rotated from the same login share a FamilyID; ParentID points at the
+// token that was exchanged for this one and RotatedAt is set once it has been used.
 type RefreshToken struct {
-	ID          string    `gorm:"column:id;type:uuid;primaryKey"`
-	UserID      string    `gorm:"column:user_id;type:uuid;index;not null"`
-	TokenHash   string    `gorm:"column:token_hash;type:char(64);uniqueIndex;not null"` // sha256 hex
-	ExpiresAt   time.Time `gorm:"column:expires_at;not null"`
-	CreatedTime time.Time `gorm:"column:created_time;autoCreateTime"`
+	ID          string     `gorm:"column:id;type:uuid;primaryKey"`
+	UserID      string     `gorm:"column:user_id;type:uuid;index;not null"`
+	FamilyID    string     `gorm:"column:family_id;type:uuid;index"`
+	ParentID    *string    `gorm:"column:parent_id;type:uuid"`
+	TokenHash   string     `gorm:"column:token_hash;type:char(64);uniqueIndex;not null"` // sha256 hex
+	ExpiresAt   time.Time  `gorm:"column:expires_at;not null"`
+	RotatedAt   *time.Time `gorm:"column:rotated_at"`
+	CreatedTime time.Time  `gorm:"column:created_time;autoCreateTime"`
+
+	// Session metadata, carried over on rotation so the newest token of a
+	// family describes the whole session.
+	UserAgent        string    `gorm:"column:user_agent;type:varchar(512)"`
+	IP               string    `gorm:"column:ip;type:varchar(64)"`
+	Label            string    `gorm:"column:label;type:varchar(128)"`
+	SessionStartedAt time.Time `gorm:"column:session_started_at"`
+	LastUsedAt       time.Time `gorm:"column:last_used_at"`
 
 	// FK to User
 	User User `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
@@ -118,6 +175,16 @@ type RefreshToken struct {
 
 func (RefreshToken) TableName() string { return "DEMO.REFRESH_TOKEN" }
 
+// RevokedToken denylists a single access token by its jti until it expires.
+type RevokedToken struct {
+	JTI         string    `gorm:"column:jti;type:varchar(64);primaryKey"`
+	UserID      string    `gorm:"column:user_id;type:uuid;index;not null"`
+	ExpiresAt   time.Time `gorm:"column:expires_at;not null;index"`
+	CreatedTime time.Time `gorm:"column:created_time;autoCreateTime"`
+}
+
+func (RevokedToken) TableName() string { return "DEMO.REVOKED_TOKEN" }
+
 // BeforeCreate hook to ensure UUID primary key is set.
 func (rt *RefreshToken) BeforeCreate(tx *gorm.DB) error {
 	if rt.ID == "" {
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Invitation states, derived from the timestamps of an Invitation.
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// Invitation lets the owner of Email sign up with a pre-assigned role and,
+// optionally, team. Like other mailed tokens only the sha256 hash is stored.
+// UserID is the account created on acceptance.
+type Invitation struct {
+	ID          string     `gorm:"column:id;type:uuid;primaryKey"`
+	Email       string     `gorm:"column:email;type:varchar(255);index;not null"`
+	Role        string     `gorm:"column:role;type:varchar(64);not null"`
+	TeamID      *string    `gorm:"column:team_id;type:uuid;index"`
+	TokenHash   string     `gorm:"column:token_hash;type:char(64);uniqueIndex;not null"` // sha256 hex
+	InvitedByID string     `gorm:"column:invited_by_id;type:uuid"`
+	InvitedBy   string     `gorm:"column:invited_by;type:varchar(64)"`
+	ExpiresAt   time.Time  `gorm:"column:expires_at;not null"`
+	AcceptedAt  *time.Time `gorm:"column:accepted_at"`
+	UserID      *string    `gorm:"column:user_id;type:uuid"`
+	RevokedAt   *time.Time `gorm:"column:revoked_at"`
+	RevokedBy   string     `gorm:"column:revoked_by;type:varchar(64)"`
+	CreatedTime time.Time  `gorm:"column:created_time;autoCreateTime"`
+
+	RoleRecord Role  `gorm:"foreignKey:Role;references:Code;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT"`
+	Team       *Team `gorm:"foreignKey:TeamID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+func (Invitation) TableName() string { return "DEMO.INVITATION" }
+
+// BeforeCreate hook to ensure UUID primary key is set.
+func (i *Invitation) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == "" {
+		i.ID = uuid.NewString()
+	}
+	return nil
+}
+
+// Status reports the state of the invitation at now.
+func (i *Invitation) Status(now time.Time) string {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationAccepted
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case !now.Before(i.ExpiresAt):
+		return InvitationExpired
+	}
+	return InvitationPending
+}
@@ -0,0 +1,29 @@
+package db
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PasswordHistory keeps bcrypt hashes of a user's previous passwords so they
+// cannot be reused. Only the most recent PASSWORD_HISTORY entries are kept.
+type PasswordHistory struct {
+	ID           string    `gorm:"column:id;type:uuid;primaryKey"`
+	UserID       string    `gorm:"column:user_id;type:uuid;index;not null"`
+	PasswordHash string    `gorm:"column:password;type:text;not null"`
+	CreatedTime  time.Time `gorm:"column:created_time;autoCreateTime;index"`
+
+	User User `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+func (PasswordHistory) TableName() string { return "DEMO.PASSWORD_HISTORY" }
+
+// BeforeCreate hook to ensure UUID primary key is set.
+func (h *PasswordHistory) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == "" {
+		h.ID = uuid.NewString()
+	}
+	return nil
+}
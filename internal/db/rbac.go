@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// Permission codes checked by handlers. Roles are granted permissions through DEMO.ROLE_PERMISSION.
+const (
+	PermSQLLogRead      = "sqllog:read"
+	PermSQLLogUpload    = "sqllog:upload"
+	PermSQLLogRaw       = "sqllog:raw"
+	PermSQLLogAllDBs    = "sqllog:all_dbs"
+	PermReportView      = "report:view"
+	PermReportExport    = "report:export"
+	PermAIAnalyze       = "ai:analyze"
+	PermUsersManage     = "users:manage"
+	PermRolesManage     = "roles:manage"
+	PermRedactionManage = "redaction:manage"
+	PermGrantsManage    = "grants:manage"
+	PermTeamsManage     = "teams:manage"
+	PermAPIKeysManage   = "apikeys:manage"
+	PermAuditRead       = "audit:read"
+)
+
+// Permission is a named capability mapped to DEMO.PERMISSION.
+type Permission struct {
+	Code        string    `gorm:"column:code;type:varchar(64);primaryKey"`
+	Description string    `gorm:"column:description;type:text"`
+	CreatedTime time.Time `gorm:"column:created_time;autoCreateTime"`
+}
+
+func (Permission) TableName() string { return "DEMO.PERMISSION" }
+
+// RolePermission grants a permission to a role.
+type RolePermission struct {
+	RoleCode       string    `gorm:"column:role_code;type:varchar(64);primaryKey"`
+	PermissionCode string    `gorm:"column:permission_code;type:varchar(64);primaryKey"`
+	CreatedBy      string    `gorm:"column:created_by;type:varchar(64)"`
+	CreatedTime    time.Time `gorm:"column:created_time;autoCreateTime"`
+
+	Role       Role       `gorm:"foreignKey:RoleCode;references:Code;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Permission Permission `gorm:"foreignKey:PermissionCode;references:Code;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+func (RolePermission) TableName() string { return "DEMO.ROLE_PERMISSION" }
+
+// defaultPermissions lists every permission with the roles that receive it when it is first created.
+var defaultPermissions = []struct {
+	Permission
+	Roles []string
+}{
+	{Permission{Code: PermSQLLogRead, Description: "List databases, queries and scan results"}, []string{"ADMIN", "USER", "ANALYZER", "MONITOR", "TEAM_LEADER"}},
+	{Permission{Code: PermSQLLogUpload, Description: "Upload SQL log files"}, []string{"ADMIN", "USER", "ANALYZER", "MONITOR", "TEAM_LEADER"}},
+	{Permission{Code: PermSQLLogRaw, Description: "View unredacted SQL text"}, []string{"ADMIN"}},
+	{Permission{Code: PermSQLLogAllDBs, Description: "Read SQL logs of every database regardless of grants"}, []string{"ADMIN"}},
+	{Permission{Code: PermReportView, Description: "View the JSON report"}, []string{"ADMIN"}},
+	{Permission{Code: PermReportExport, Description: "Download CSV/PDF reports"}, []string{"ADMIN", "TEAM_LEADER"}},
+	{Permission{Code: PermAIAnalyze, Description: "Run AI analysis"}, []string{"ADMIN", "ANALYZER"}},
+	{Permission{Code: PermUsersManage, Description: "Create, update and delete users"}, []string{"ADMIN"}},
+	{Permission{Code: PermRolesManage, Description: "Edit role to permission mappings"}, []string{"ADMIN"}},
+	{Permission{Code: PermRedactionManage, Description: "Edit the SQL redaction policy"}, []string{"ADMIN"}},
+	{Permission{Code: PermGrantsManage, Description: "Grant users and teams access to databases"}, []string{"ADMIN"}},
+	{Permission{Code: PermTeamsManage, Description: "Create teams and manage any team's members"}, []string{"ADMIN"}},
+	{Permission{Code: PermAPIKeysManage, Description: "Create service accounts and manage their API keys"}, []string{"ADMIN"}},
+	{Permission{Code: PermAuditRead, Description: "View and export the audit log"}, []string{"ADMIN"}},
+}
+
+// SeedDefaultPermissions upserts DEMO.PERMISSION. Default role grants are only
+// inserted for permissions created by this call, so mappings edited by an admin
+// are never re-added on restart. Roles must be seeded first; grants to roles
+// missing from the roles file are skipped.
+func (d *DB) SeedDefaultPermissions(ctx context.Context) error {
+	var codes []string
+	if err := d.Gorm.WithContext(ctx).Model(&Role{}).Pluck("code", &codes).Error; err != nil {
+		return fmt.Errorf("load roles: %w", err)
+	}
+	roles := make(map[string]bool, len(codes))
+	for _, c := range codes {
+		roles[c] = true
+	}
+	for _, dp := range defaultPermissions {
+		perm := dp.Permission
+		res := d.Gorm.WithContext(ctx).
+			Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "code"}},
+				DoNothing: true,
+			}).
+			Create(&perm)
+		if res.Error != nil {
+			return fmt.Errorf("seed permission %s: %w", perm.Code, res.Error)
+		}
+		if res.RowsAffected == 0 {
+			continue
+		}
+		for _, role := range dp.Roles {
+			if !roles[role] {
+				continue
+			}
+			rp := RolePermission{RoleCode: role, PermissionCode: perm.Code, CreatedBy: "system"}
+			if err := d.Gorm.WithContext(ctx).
+				Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&rp).Error; err != nil {
+				return fmt.Errorf("seed grant %s to %s: %w", perm.Code, role, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package db
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RecoveryCode is a single-use code that stands in for a TOTP code when the
+// user has lost their authenticator. Only the sha256 hash is stored.
+type RecoveryCode struct {
+	ID          string     `gorm:"column:id;type:uuid;primaryKey"`
+	UserID      string     `gorm:"column:user_id;type:uuid;index;not null"`
+	CodeHash    string     `gorm:"column:code_hash;type:char(64);not null"` // sha256 hex
+	UsedAt      *time.Time `gorm:"column:used_at"`
+	CreatedTime time.Time  `gorm:"column:created_time;autoCreateTime"`
+
+	User User `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+func (RecoveryCode) TableName() string { return "DEMO.RECOVERY_CODE" }
+
+// BeforeCreate hook to ensure UUID primary key is set.
+func (c *RecoveryCode) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == "" {
+		c.ID = uuid.NewString()
+	}
+	return nil
+}
@@ -1,52 +1,116 @@
 package db
 
 import (
+	"bytes"
 	"context"
+	_ "embed"
+	"encoding/json"
 	"fmt"
+	"os"
+	"regexp"
 
 	"gorm.io/gorm/clause"
 )
 
-// SeedDefaultRoles upserts the default roles into DEMO.ROLE.
-func (d *DB) SeedDefaultRoles(ctx context.Context) error {
-	roles := []Role{
-		{
-			Code:        "USER",
-			Name:        "User",
-			Description: "Standard user role",
-		},
-		{
-			Code:        "ADMIN",
-			Name:        "Administrator",
-			Description: "Administrator role",
-		},
-		{
-			Code:        "ANALYZER",
-			Name:        "Analyzer",
-			Description: "Data analyzer role",
-		},
-		{
-			Code:        "MONITOR",
-			Name:        "Monitor",
-			Description: "System monitor role",
-		},
-		{
-			Code:        "TEAM_LEADER",
-			Name:        "Team Leader",
-			Description: "Team leader role",
-		},
+// defaultRolesJSON holds the built-in roles used when ROLES_FILE is not set.
+//
+//go:embed roles.json
+var defaultRolesJSON []byte
+
+var roleCodePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]{0,63}$`)
+
+// ValidRoleCode reports whether code can name a role: upper case letters,
+// digits and underscores, starting with a letter, at most 64 characters.
+func ValidRoleCode(code string) bool {
+	return roleCodePattern.MatchString(code)
+}
+
+// RoleDefinition is a built-in role listed in the roles file.
+type RoleDefinition struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Require2FA  bool   `json:"require_2fa"`
+}
+
+// LoadRoleDefinitions reads the roles file at path, or the defaults compiled
+// into the binary when path is empty.
+func LoadRoleDefinitions(path string) ([]RoleDefinition, error) {
+	data := defaultRolesJSON
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("read roles file: %w", err)
+		}
+	}
+	return ParseRoleDefinitions(data)
+}
+
+// ParseRoleDefinitions decodes {"roles": [...]} and checks that every role
+// has a valid, unique code and a name, and that USER and ADMIN, which the
+// application relies on, are present.
+func ParseRoleDefinitions(data []byte) ([]RoleDefinition, error) {
+	var file struct {
+		Roles []RoleDefinition `json:"roles"`
 	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("parse roles file: %w", err)
+	}
+	seen := make(map[string]bool, len(file.Roles))
+	for _, r := range file.Roles {
+		if !ValidRoleCode(r.Code) {
+			return nil, fmt.Errorf("roles file: invalid role code %q", r.Code)
+		}
+		if seen[r.Code] {
+			return nil, fmt.Errorf("roles file: duplicate role %s", r.Code)
+		}
+		if r.Name == "" || len(r.Name) > 128 {
+			return nil, fmt.Errorf("roles file: role %s needs a name of at most 128 characters", r.Code)
+		}
+		seen[r.Code] = true
+	}
+	for _, code := range []string{"USER", "ADMIN"} {
+		if !seen[code] {
+			return nil, fmt.Errorf("roles file: role %s is required", code)
+		}
+	}
+	return file.Roles, nil
+}
 
-	for _, r := range roles {
-		role := r // copy to avoid loop variable capture
+// SeedRoles upserts the defined roles into DEMO.ROLE and marks them built-in.
+// The file is the source of truth for names and descriptions, which the API
+// cannot change for built-in roles; the 2FA requirement of an existing role
+// is managed through the API and kept. A role that is no longer defined stays
+// but becomes an ordinary custom role.
+func (d *DB) SeedRoles(ctx context.Context, defs []RoleDefinition) error {
+	codes := make([]string, 0, len(defs))
+	for _, def := range defs {
+		role := Role{
+			Code:        def.Code,
+			Name:        def.Name,
+			Description: def.Description,
+			Require2FA:  def.Require2FA,
+			BuiltIn:     true,
+			CreatedBy:   "system",
+			UpdatedBy:   "system",
+		}
 		if err := d.Gorm.WithContext(ctx).
 			Clauses(clause.OnConflict{
 				Columns:   []clause.Column{{Name: "code"}},
-				DoNothing: true, // do not overwrite existing roles
+				DoUpdates: clause.AssignmentColumns([]string{"name", "description", "built_in"}),
 			}).
 			Create(&role).Error; err != nil {
 			return fmt.Errorf("seed role %s: %w", role.Code, err)
 		}
+		codes = append(codes, def.Code)
+	}
+	if err := d.Gorm.WithContext(ctx).
+		Model(&Role{}).
+		Where("built_in AND code NOT IN ?", codes).
+		Update("built_in", false).Error; err != nil {
+		return fmt.Errorf("unmark removed roles: %w", err)
 	}
 	return nil
 }
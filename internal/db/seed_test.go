@@ -0,0 +1,57 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRoleDefinitions(t *testing.T) {
+	defs, err := LoadRoleDefinitions("")
+	require.NoError(t, err)
+	codes := make([]string, 0, len(defs))
+	for _, d := range defs {
+		codes = append(codes, d.Code)
+	}
+	require.Equal(t, []string{"USER", "ADMIN", "ANALYZER", "MONITOR", "TEAM_LEADER"}, codes)
+
+	path := filepath.Join(t.TempDir(), "roles.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"roles": [
+		{"code": "USER", "name": "User"},
+		{"code": "ADMIN", "name": "Administrator", "require_2fa": true},
+		{"code": "AUDITOR", "name": "Auditor", "description": "Reads the audit log"}
+	]}`), 0o600))
+	defs, err = LoadRoleDefinitions(path)
+	require.NoError(t, err)
+	require.Len(t, defs, 3)
+	require.True(t, defs[1].Require2FA)
+	require.Equal(t, "Reads the audit log", defs[2].Description)
+
+	_, err = LoadRoleDefinitions(filepath.Join(t.TempDir(), "missing.json"))
+	require.Error(t, err)
+}
+
+func TestParseRoleDefinitions_Invalid(t *testing.T) {
+	for name, in := range map[string]string{
+		"not json":       `roles`,
+		"unknown field":  `{"roles": [{"code": "USER", "name": "User", "perms": []}, {"code": "ADMIN", "name": "Admin"}]}`,
+		"lower case":     `{"roles": [{"code": "user", "name": "User"}, {"code": "ADMIN", "name": "Admin"}]}`,
+		"missing name":   `{"roles": [{"code": "USER"}, {"code": "ADMIN", "name": "Admin"}]}`,
+		"duplicate code": `{"roles": [{"code": "USER", "name": "User"}, {"code": "USER", "name": "User"}, {"code": "ADMIN", "name": "Admin"}]}`,
+		"without admin":  `{"roles": [{"code": "USER", "name": "User"}]}`,
+	} {
+		_, err := ParseRoleDefinitions([]byte(in))
+		require.Error(t, err, name)
+	}
+}
+
+func TestValidRoleCode(t *testing.T) {
+	for _, code := range []string{"USER", "TEAM_LEADER", "L2_SUPPORT"} {
+		require.True(t, ValidRoleCode(code), code)
+	}
+	for _, code := range []string{"", "user", "2FA", "_X", "A-B", "A B"} {
+		require.False(t, ValidRoleCode(code), code)
+	}
+}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Team groups users that own the same databases, mapped to DEMO.TEAM.
+type Team struct {
+	ID          string    `gorm:"column:id;type:uuid;primaryKey"`
+	Name        string    `gorm:"column:name;type:varchar(128);uniqueIndex;not null"`
+	Description string    `gorm:"column:description;type:text"`
+	CreatedBy   string    `gorm:"column:created_by;type:varchar(64)"`
+	UpdatedBy   string    `gorm:"column:updated_by;type:varchar(64)"`
+	CreatedTime time.Time `gorm:"column:created_time;autoCreateTime"`
+	UpdatedTime time.Time `gorm:"column:updated_time;autoUpdateTime"`
+}
+
+func (Team) TableName() string { return "DEMO.TEAM" }
+
+// BeforeCreate hook to ensure UUID primary key is set.
+func (t *Team) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == "" {
+		t.ID = uuid.NewString()
+	}
+	return nil
+}
+
+// TeamMember links a user to a team. Leaders may manage the team's members.
+type TeamMember struct {
+	TeamID      string    `gorm:"column:team_id;type:uuid;primaryKey"`
+	UserID      string    `gorm:"column:user_id;type:uuid;primaryKey;index"`
+	IsLeader    bool      `gorm:"column:is_leader;not null;default:false"`
+	CreatedBy   string    `gorm:"column:created_by;type:varchar(64)"`
+	CreatedTime time.Time `gorm:"column:created_time;autoCreateTime"`
+
+	Team Team `gorm:"foreignKey:TeamID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	User User `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+func (TeamMember) TableName() string { return "DEMO.TEAM_MEMBER" }
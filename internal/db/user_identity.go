@@ -0,0 +1,32 @@
+package db
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UserIdentity links a user to an account at an external OpenID Connect
+// provider, identified by the provider's issuer and subject.
+type UserIdentity struct {
+	ID          string     `gorm:"column:id;type:uuid;primaryKey"`
+	UserID      string     `gorm:"column:user_id;type:uuid;index;not null"`
+	Issuer      string     `gorm:"column:issuer;type:varchar(255);not null;uniqueIndex:idx_user_identity_subject"`
+	Subject     string     `gorm:"column:subject;type:varchar(255);not null;uniqueIndex:idx_user_identity_subject"`
+	Email       string     `gorm:"column:email;type:varchar(255)"` // as last reported by the provider
+	LastLoginAt *time.Time `gorm:"column:last_login_at"`
+	CreatedTime time.Time  `gorm:"column:created_time;autoCreateTime"`
+
+	User User `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+func (UserIdentity) TableName() string { return "DEMO.USER_IDENTITY" }
+
+// BeforeCreate hook to ensure UUID primary key is set.
+func (i *UserIdentity) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == "" {
+		i.ID = uuid.NewString()
+	}
+	return nil
+}
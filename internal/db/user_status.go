@@ -0,0 +1,29 @@
+package db
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// migrateUserStatus converts users from the old role-suffix convention to
+// explicit status values. Deactivated users carried a "<ROLE>_INACTIVE" role
+// and deleted users the "DELETED" role with "_deleted_<unix>" appended to their
+// username and email. The renamed username/email are kept so they do not clash
+// with accounts created since; RestoreUser strips the suffix when it can.
+// The statements only match legacy rows, so running them again is a no-op.
+func migrateUserStatus(g *gorm.DB) error {
+	if err := g.Exec(`UPDATE "DEMO"."USER"
+		SET status = ?, role = left(role, length(role) - length('_INACTIVE'))
+		WHERE role LIKE '%\_INACTIVE' AND length(role) > length('_INACTIVE')`,
+		UserStatusSuspended).Error; err != nil {
+		return fmt.Errorf("suspended users: %w", err)
+	}
+	if err := g.Exec(`UPDATE "DEMO"."USER"
+		SET status = ?, role = 'USER', deleted_at = COALESCE(deleted_at, updated_time)
+		WHERE role = 'DELETED'`,
+		UserStatusDeleted).Error; err != nil {
+		return fmt.Errorf("deleted users: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UserToken purposes.
+const (
+	UserTokenPasswordReset = "password_reset"
+	UserTokenEmailVerify   = "email_verify"
+	UserTokenLogin2FA      = "login_2fa" // challenge between password and second factor
+)
+
+// UserToken is a single-use token mailed to a user (password reset, email
+// verification) or handed out as a login challenge. Like refresh tokens only the sha256 hash is stored.
+type UserToken struct {
+	ID          string     `gorm:"column:id;type:uuid;primaryKey"`
+	UserID      string     `gorm:"column:user_id;type:uuid;index;not null"`
+	Purpose     string     `gorm:"column:purpose;type:varchar(32);not null"`
+	TokenHash   string     `gorm:"column:token_hash;type:char(64);uniqueIndex;not null"` // sha256 hex
+	ExpiresAt   time.Time  `gorm:"column:expires_at;not null;index"`
+	UsedAt      *time.Time `gorm:"column:used_at"`
+	CreatedTime time.Time  `gorm:"column:created_time;autoCreateTime"`
+
+	User User `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+func (UserToken) TableName() string { return "DEMO.USER_TOKEN" }
+
+// BeforeCreate hook to ensure UUID primary key is set.
+func (t *UserToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == "" {
+		t.ID = uuid.NewString()
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"go-demo/internal/auth"
+)
+
+type ForgotPasswordReq struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordReq struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+type VerifyEmailReq struct {
+	Token string `json:"token"`
+}
+
+type ResendVerificationReq struct {
+	Email string `json:"email"`
+}
+
+// writePasswordPolicyError writes a 400 carrying the violated rule's code
+// (e.g. password_too_short) when err is a password policy error.
+func writePasswordPolicyError(w http.ResponseWriter, err error) bool {
+	var pe *auth.PolicyError
+	if !errors.As(err, &pe) {
+		return false
+	}
+	writeError(w, http.StatusBadRequest, pe.Code, pe.Message)
+	return true
+}
+
+// decodeBody decodes a JSON request body into v, writing a 400 on failure.
+func (h Auth) decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(io.LimitReader(r.Body, h.MaxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", "invalid JSON payload")
+		return false
+	}
+	return true
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Mails a single-use reset link to the account with this email. Always returns 202 so the response does not reveal whether the account exists. Counts towards the login rate limits for the client's IP and the email.
+// @Tags auth
+// @Accept json
+// @Param request body ForgotPasswordReq true "Account email"
+// @Success 202 "Accepted"
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 429 {object} ErrorEnvelope
+// @Router /v1/auth/password/forgot [post]
+func (h Auth) ForgotPassword() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		var req ForgotPasswordReq
+		if !h.decodeBody(w, r, &req) {
+			return
+		}
+		if req.Email == "" {
+			writeError(w, http.StatusBadRequest, "bad_request", "email is required")
+			return
+		}
+		ctx := withClient(r)
+		if !h.allowAttempt(w, ctx, req.Email) {
+			return
+		}
+		if err := h.S.RequestPasswordReset(ctx, req.Email); err != nil {
+			// Logged only: failing visibly would reveal that the account exists.
+			h.Log.Error("password reset request failed", "err", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Sets a new password using the token from the reset email. All sessions of the account are signed out.
+// @Tags auth
+// @Accept json
+// @Param request body ResetPasswordReq true "Reset token and new password"
+// @Success 204 "No Content"
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/auth/password/reset [post]
+func (h Auth) ResetPassword() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		var req ResetPasswordReq
+		if !h.decodeBody(w, r, &req) {
+			return
+		}
+		if req.Token == "" || req.NewPassword == "" {
+			writeError(w, http.StatusBadRequest, "bad_request", "token and new_password are required")
+			return
+		}
+		if err := h.S.ResetPassword(r.Context(), req.Token, req.NewPassword); err != nil {
+			if errors.Is(err, auth.ErrInvalidUserToken) {
+				writeError(w, http.StatusBadRequest, "invalid_token", "invalid or expired token")
+				return
+			}
+			if writePasswordPolicyError(w, err) {
+				return
+			}
+			h.Log.Error("password reset failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not reset password")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// VerifyEmail godoc
+// @Summary Verify email address
+// @Description Confirms the account's email address using the token from the verification email.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body VerifyEmailReq true "Verification token"
+// @Success 200 {object} UserResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/auth/verify-email [post]
+func (h Auth) VerifyEmail() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		var req VerifyEmailReq
+		if !h.decodeBody(w, r, &req) {
+			return
+		}
+		u, err := h.S.VerifyEmail(r.Context(), req.Token)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidUserToken) {
+				writeError(w, http.StatusBadRequest, "invalid_token", "invalid or expired token")
+				return
+			}
+			h.Log.Error("email verification failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not verify email")
+			return
+		}
+		writeJSON(w, http.StatusOK, toUserResp(u))
+	})
+}
+
+// ResendVerification godoc
+// @Summary Resend verification email
+// @Description Mails a new verification link to an unverified account. Always returns 202 so the response does not reveal whether the account exists. Counts towards the login rate limits for the client's IP and the email.
+// @Tags auth
+// @Accept json
+// @Param request body ResendVerificationReq true "Account email"
+// @Success 202 "Accepted"
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 429 {object} ErrorEnvelope
+// @Router /v1/auth/verify-email/resend [post]
+func (h Auth) ResendVerification() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		var req ResendVerificationReq
+		if !h.decodeBody(w, r, &req) {
+			return
+		}
+		if req.Email == "" {
+			writeError(w, http.StatusBadRequest, "bad_request", "email is required")
+			return
+		}
+		ctx := withClient(r)
+		if !h.allowAttempt(w, ctx, req.Email) {
+			return
+		}
+		if err := h.S.ResendEmailVerification(ctx, req.Email); err != nil {
+			h.Log.Error("resend verification failed", "err", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
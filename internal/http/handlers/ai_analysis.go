@@ -3,14 +3,18 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
-	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
+	"go-demo/internal/audit"
+	"go-demo/internal/authctx"
 	"go-demo/internal/config"
 	"go-demo/internal/sqllog"
 
@@ -22,6 +26,12 @@ type AIAnalysisHandler struct {
 	repo   *sqllog.Repository
 	log    *slog.Logger
 	client *openai.Client
+
+	queriesPerDay int64
+	tokensPerDay  int64
+
+	// Audit records analyses in the audit log; nil disables.
+	Audit *audit.Recorder
 }
 
 // NewAIAnalysisHandler creates a new AI analysis handler
@@ -36,12 +46,34 @@ func NewAIAnalysisHandler(repo *sqllog.Repository, log *slog.Logger, cfg config.
 	}
 
 	return &AIAnalysisHandler{
-		repo:   repo,
-		log:    log,
-		client: client,
+		repo:          repo,
+		log:           log,
+		client:        client,
+		queriesPerDay: cfg.AIQueriesPerDay,
+		tokensPerDay:  cfg.AITokensPerDay,
 	}
 }
 
+// tokenUsage accumulates provider token counts across the queries of one request.
+type tokenUsage struct {
+	mu         sync.Mutex
+	prompt     int
+	completion int
+}
+
+func (u *tokenUsage) add(prompt, completion int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.prompt += prompt
+	u.completion += completion
+}
+
+func (u *tokenUsage) totals() (prompt, completion int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.prompt, u.completion
+}
+
 // AnalysisResult represents the response structure
 type AnalysisResult struct {
 	Status string          `json:"status"`
@@ -49,51 +81,48 @@ type AnalysisResult struct {
 	Error  string          `json:"error,omitempty"`
 }
 
-// QueryAnalysis represents analysis of a single query
+// QueryAnalysis represents analysis of a single query.
+// Suggestions is the human-readable summary; StructuredSuggestions carries the
+// same advice in machine-readable form. Source is "ai" or "local".
 type QueryAnalysis struct {
-	ID          uint64 `json:"id"`
-	SQLQuery    string `json:"sql_query"`
-	ExecTimeMs  int64  `json:"exec_time_ms"`
-	ExecCount   int64  `json:"exec_count"`
-	Suggestions string `json:"suggestions"`
+	ID                    uint64       `json:"id"`
+	SQLQuery              string       `json:"sql_query"`
+	ExecTimeMs            int64        `json:"exec_time_ms"`
+	ExecCount             int64        `json:"exec_count"`
+	Suggestions           string       `json:"suggestions"`
+	StructuredSuggestions []Suggestion `json:"structured_suggestions"`
+	Source                string       `json:"source"`
 }
 
 // AIAnalysis godoc
 // @Summary AI analysis endpoint
+// @Description Requires the ai:analyze permission. Each call counts against the caller's daily query and token quota and is audited.
 // @Tags ai
+// @Security BearerAuth
 // @Param db_name query string true "Database name"
 // @Param limit query int false "Maximum number of queries to analyze (default: 5)" minimum(1)
 // @Success 200 {object} AnalysisResult
 // @Failure 400 {object} AnalysisResult
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 429 {object} AnalysisResult
 // @Failure 500 {object} AnalysisResult
 // @Router /v1/ai-analysis [get]
 func (h *AIAnalysisHandler) AIAnalysis() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		u, ok := authctx.UserFrom(r.Context())
+		if !ok || u == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+
 		dbName := r.URL.Query().Get("db_name")
 		if dbName == "" {
 			h.writeErrorResponse(w, http.StatusBadRequest, "db_name parameter is required")
 			return
 		}
 
-		limit := r.URL.Query().Get("limit")
-		if limit == "" {
-			limit = "5"
-		}
-
-		// Query slow queries from database
-		queries, err := h.repo.FindSlowQueries(r.Context(), dbName)
-
-		limit_, err := strconv.Atoi(limit)
-		if err != nil || limit_ <= 0 {
-			limit_ = 5
-		}
-		if len(queries) > limit_ {
-			// Limit to top N by exec_time_ms
-			sort.Slice(queries, func(i, j int) bool {
-				return queries[i].ExecTimeMs > queries[j].ExecTimeMs
-			})
-			queries = queries[:limit_]
-		}
+		queries, err := h.selectQueries(r.Context(), dbName, r.URL.Query().Get("limit"))
 		if err != nil {
 			h.log.Error("Failed to query slow queries", "error", err, "db_name", dbName)
 			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to query database")
@@ -105,104 +134,230 @@ func (h *AIAnalysisHandler) AIAnalysis() http.HandlerFunc {
 			return
 		}
 
+		inv, queries, err := h.reserveQuota(r.Context(), u.ID, u.Username, dbName, "ai-analysis", queries)
+		if err != nil {
+			if errors.Is(err, sqllog.ErrAIQuotaExceeded) {
+				h.writeErrorResponse(w, http.StatusTooManyRequests, "AI quota exceeded; try again later")
+				return
+			}
+			h.log.Error("Failed to check AI quota", "error", err, "user_id", u.ID)
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to check AI quota")
+			return
+		}
+
 		// Analyze queries with AI
+		usage := &tokenUsage{}
 		analyses := make([]QueryAnalysis, len(queries))
 		for i, query := range queries {
-			suggestions, err := h.analyzeQueryWithAI(r.Context(), query.SQLQuery)
-			if err != nil {
-				h.log.Error("Failed to analyze query with AI", "error", err, "query_id", query.ID)
-				suggestions = "Recommendation: manual review required"
-			}
-
-			analyses[i] = QueryAnalysis{
-				ID:          query.ID,
-				SQLQuery:    query.SQLQuery,
-				ExecTimeMs:  query.ExecTimeMs,
-				ExecCount:   query.ExecCount,
-				Suggestions: suggestions,
-			}
+			analyses[i] = h.analyze(r.Context(), query, nil, usage)
 		}
+		h.recordInvocation(r.Context(), inv, len(analyses), usage)
 
 		h.writeSuccessResponse(w, analyses)
 	}
 }
 
-// analyzeQueryWithAI uses OpenAI to analyze SQL queries and provide optimization suggestions
-func (h *AIAnalysisHandler) analyzeQueryWithAI(ctx context.Context, sqlQuery string) (string, error) {
-	if h.client == nil {
-		return h.analyzeQueryLocally(sqlQuery), nil
+// reserveQuota records the invocation up front and trims queries to the caller's
+// remaining daily allowance over a rolling 24h window, so concurrent requests cannot
+// both spend the same allowance. It returns sqllog.ErrAIQuotaExceeded when nothing
+// is left.
+func (h *AIAnalysisHandler) reserveQuota(ctx context.Context, userID, username, dbName, endpoint string, queries []sqllog.SQLLog) (*sqllog.AIInvocation, []sqllog.SQLLog, error) {
+	inv := &sqllog.AIInvocation{
+		UserID:     userID,
+		Username:   username,
+		DBName:     dbName,
+		Endpoint:   endpoint,
+		QueryCount: len(queries),
 	}
+	if err := h.repo.ReserveAIUsage(ctx, inv, h.queriesPerDay, h.tokensPerDay); err != nil {
+		return nil, nil, err
+	}
+	return inv, queries[:inv.QueryCount], nil
+}
 
-	prompt := fmt.Sprintf(`You are a database optimization assistant.
-Your task is to analyze unusual SQL queries and provide optimization suggestions based on the following rules:
-When an SQL query is detected, analyze the WHERE clause to identify the fields used.
-If the WHERE clause contains a single field, suggest: "Add index on [field_name]".
-If the WHERE clause has multiple fields, suggest indexes for all relevant fields.
-Continue analysis the query to identify potential performance improvements.
-If the query cannot be analyzed to provide suggestions, return: "Recommendation: manual review required".
-Apply these rules to any SQL statement I provide.
-
-Limit answer to 100 words.
-Query to analyze:
-%s`, sqlQuery)
-
-	resp, err := h.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model: openai.GPT4Dot1Nano,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: prompt,
-			},
-		},
-		MaxTokens:   16 * 1024,
-		Temperature: 0.1,
+// recordInvocation completes the reserved record of an AI request with the number of
+// queries analyzed and the tokens used. Failures are logged, not returned: the
+// analysis has already been served. The record is written even if the client has
+// disconnected.
+func (h *AIAnalysisHandler) recordInvocation(ctx context.Context, inv *sqllog.AIInvocation, queryCount int, usage *tokenUsage) {
+	prompt, completion := usage.totals()
+	inv.QueryCount = queryCount
+	inv.PromptTokens = prompt
+	inv.CompletionTokens = completion
+	inv.TotalTokens = prompt + completion
+	h.Audit.Record(ctx, audit.Event{
+		Action:     audit.ActionAIAnalysis,
+		TargetType: audit.TargetDatabase,
+		TargetID:   inv.DBName,
+		Details:    map[string]any{"endpoint": inv.Endpoint, "queries": queryCount, "total_tokens": inv.TotalTokens},
 	})
+	if err := h.repo.FinishAIInvocation(context.WithoutCancel(ctx), inv); err != nil {
+		h.log.Error("Failed to record AI invocation", "error", err, "user_id", inv.UserID, "db_name", inv.DBName)
+		return
+	}
+	h.log.Info("ai invocation",
+		"user_id", inv.UserID,
+		"username", inv.Username,
+		"db_name", inv.DBName,
+		"endpoint", inv.Endpoint,
+		"queries", queryCount,
+		"total_tokens", inv.TotalTokens,
+	)
+}
 
+// selectQueries loads the slow queries of dbName and keeps the top limit by exec_time_ms.
+// An empty or invalid limit defaults to 5.
+func (h *AIAnalysisHandler) selectQueries(ctx context.Context, dbName, limit string) ([]sqllog.SQLLog, error) {
+	queries, err := h.repo.FindSlowQueries(ctx, dbName)
 	if err != nil {
-		return "", fmt.Errorf("OpenAI API error: %w", err)
+		return nil, err
 	}
 
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no response from OpenAI")
+	limit_, err := strconv.Atoi(limit)
+	if err != nil || limit_ <= 0 {
+		limit_ = 5
+	}
+	if len(queries) > limit_ {
+		// Limit to top N by exec_time_ms
+		sort.Slice(queries, func(i, j int) bool {
+			return queries[i].ExecTimeMs > queries[j].ExecTimeMs
+		})
+		queries = queries[:limit_]
 	}
+	return queries, nil
+}
 
-	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+// analyze builds the QueryAnalysis for one query. When onDelta is non-nil and OpenAI
+// is configured, the provider's streaming API is used and each content chunk is passed to onDelta.
+// Provider token consumption is added to usage.
+func (h *AIAnalysisHandler) analyze(ctx context.Context, query sqllog.SQLLog, onDelta func(string), usage *tokenUsage) QueryAnalysis {
+	suggs, source := h.analyzeQuery(ctx, query.ID, query.SQLQuery, onDelta, usage)
+	return QueryAnalysis{
+		ID:                    query.ID,
+		SQLQuery:              query.SQLQuery,
+		ExecTimeMs:            query.ExecTimeMs,
+		ExecCount:             query.ExecCount,
+		Suggestions:           summarizeSuggestions(suggs),
+		StructuredSuggestions: suggs,
+		Source:                source,
+	}
 }
 
-// analyzeQueryLocally provides basic local analysis as fallback
-func (h *AIAnalysisHandler) analyzeQueryLocally(sqlQuery string) string {
-	// Basic regex to extract WHERE clause fields
-	whereRegex := regexp.MustCompile(`(?i)WHERE\s+(.+?)(?:\s+ORDER\s+BY|\s+GROUP\s+BY|\s+HAVING|\s+LIMIT|$)`)
-	matches := whereRegex.FindStringSubmatch(sqlQuery)
+// analyzeQuery returns structured suggestions for one query, preferring OpenAI and
+// falling back to the local analyzer when the client is not configured, the call
+// fails, or the response does not validate against suggestionSchema.
+func (h *AIAnalysisHandler) analyzeQuery(ctx context.Context, id uint64, sqlQuery string, onDelta func(string), usage *tokenUsage) ([]Suggestion, string) {
+	if h.client == nil {
+		return localSuggestions(sqlQuery), AnalysisSourceLocal
+	}
+	// Query text never leaves the service unredacted, whatever the stored policy says.
+	rd, err := h.repo.Redactor(ctx)
+	if err != nil {
+		h.log.Error("Failed to load redactor; not sending query to AI", "error", err, "query_id", id)
+		return localSuggestions(sqlQuery), AnalysisSourceLocal
+	}
+	redacted := rd.Redact(sqlQuery)
+
+	var suggs []Suggestion
+	if onDelta != nil {
+		suggs, err = h.analyzeQueryWithAIStream(ctx, redacted, onDelta, usage)
+	} else {
+		suggs, err = h.analyzeQueryWithAI(ctx, redacted, usage)
+	}
+	if err != nil {
+		h.log.Warn("AI analysis unusable, falling back to local analyzer", "error", err, "query_id", id)
+		return localSuggestions(sqlQuery), AnalysisSourceLocal
+	}
+	return suggs, AnalysisSourceAI
+}
 
-	if len(matches) < 2 {
-		return "Recommendation: manual review required"
+// analyzeQueryWithAI asks OpenAI for optimization suggestions using a strict JSON schema
+// and validates the returned document.
+func (h *AIAnalysisHandler) analyzeQueryWithAI(ctx context.Context, sqlQuery string, usage *tokenUsage) ([]Suggestion, error) {
+	resp, err := h.client.CreateChatCompletion(ctx, suggestionRequest(sqlQuery))
+	if err != nil {
+		return nil, fmt.Errorf("OpenAI API error: %w", err)
 	}
+	usage.add(resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
 
-	whereClause := matches[1]
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response from OpenAI")
+	}
 
-	// Extract field names (basic approach)
-	fieldRegex := regexp.MustCompile(`(\w+)\s*[=<>!]`)
-	fieldMatches := fieldRegex.FindAllStringSubmatch(whereClause, -1)
+	return parseSuggestions(resp.Choices[0].Message.Content)
+}
 
-	if len(fieldMatches) == 0 {
-		return "Recommendation: manual review required"
+// analyzeQueryWithAIStream is the streaming variant of analyzeQueryWithAI: content
+// chunks are forwarded to onDelta as they arrive and the assembled document is
+// validated once the stream ends.
+func (h *AIAnalysisHandler) analyzeQueryWithAIStream(ctx context.Context, sqlQuery string, onDelta func(string), usage *tokenUsage) ([]Suggestion, error) {
+	req := suggestionRequest(sqlQuery)
+	req.Stream = true
+	req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	stream, err := h.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("OpenAI API error: %w", err)
 	}
+	defer stream.Close()
 
-	var fields []string
-	for _, match := range fieldMatches {
-		if len(match) > 1 {
-			fields = append(fields, match[1])
+	var content strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("OpenAI stream error: %w", err)
+		}
+		if chunk.Usage != nil {
+			usage.add(chunk.Usage.PromptTokens, chunk.Usage.CompletionTokens)
 		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		content.WriteString(chunk.Choices[0].Delta.Content)
+		onDelta(chunk.Choices[0].Delta.Content)
 	}
-
-	if len(fields) == 1 {
-		return fmt.Sprintf("Add index on %s", fields[0])
-	} else if len(fields) > 1 {
-		return fmt.Sprintf("Add indexes on %s", strings.Join(fields, ", "))
+	if content.Len() == 0 {
+		return nil, fmt.Errorf("no response from OpenAI")
 	}
+	return parseSuggestions(content.String())
+}
 
-	return "Recommendation: manual review required"
+// suggestionRequest builds the chat completion request for one query.
+func suggestionRequest(sqlQuery string) openai.ChatCompletionRequest {
+	prompt := fmt.Sprintf(`You are a database optimization assistant.
+Your task is to analyze unusual SQL queries and provide optimization suggestions based on the following rules:
+When an SQL query is detected, analyze the WHERE clause to identify the fields used.
+If the WHERE clause contains fields, suggest an index (type "index") on the table and those columns, with a CREATE INDEX statement in "ddl".
+Continue analysis the query to identify potential performance improvements (type "rewrite" or "cache").
+If the query cannot be analyzed to provide suggestions, return a single suggestion of type "manual_review".
+Use an empty string for "table" and "ddl" and an empty array for "columns" when they do not apply.
+"confidence" is a number between 0 and 1. Keep each "rationale" under 40 words.
+Respond only with JSON matching the provided schema.
+
+Query to analyze:
+%s`, sqlQuery)
+
+	return openai.ChatCompletionRequest{
+		Model: openai.GPT4Dot1Nano,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: prompt,
+			},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:   "query_suggestions",
+				Schema: suggestionSchema,
+				Strict: true,
+			},
+		},
+		MaxTokens:   16 * 1024,
+		Temperature: 0.1,
+	}
 }
 
 func (h *AIAnalysisHandler) writeSuccessResponse(w http.ResponseWriter, data []QueryAnalysis) {
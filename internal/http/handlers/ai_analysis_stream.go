@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-demo/internal/authctx"
+	"go-demo/internal/sqllog"
+)
+
+const (
+	// sseHeartbeatInterval keeps proxies and load balancers from closing idle streams.
+	sseHeartbeatInterval = 15 * time.Second
+	// aiStreamConcurrency bounds parallel provider calls for one stream.
+	aiStreamConcurrency = 3
+)
+
+// sseEvent is one Server-Sent Event: an event name and a JSON payload.
+type sseEvent struct {
+	Name string
+	Data any
+}
+
+// StreamStartEvent is sent once before any analysis.
+type StreamStartEvent struct {
+	DBName string `json:"db_name"`
+	Total  int    `json:"total"`
+}
+
+// StreamDeltaEvent carries a raw content chunk from the provider for one query.
+type StreamDeltaEvent struct {
+	ID      uint64 `json:"id"`
+	Content string `json:"content"`
+}
+
+// StreamDoneEvent is sent after the last analysis.
+type StreamDoneEvent struct {
+	Count int `json:"count"`
+}
+
+// AIAnalysisStream godoc
+// @Summary AI analysis stream (Server-Sent Events)
+// @Description Requires the ai:analyze permission. Streams one "analysis" event per query as soon as it completes. Other events: "start", "delta" (provider content chunks, when deltas=true), "heartbeat" and "done". When there is nothing to analyze the stream holds only "start" and "done" and no quota is used.
+// @Tags ai
+// @Security BearerAuth
+// @Produce text/event-stream
+// @Param db_name query string true "Database name"
+// @Param limit query int false "Maximum number of queries to analyze (default: 5)" minimum(1)
+// @Param deltas query bool false "Emit token-level delta events from the provider"
+// @Success 200 {string} string "event stream"
+// @Failure 400 {object} AnalysisResult
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 429 {object} AnalysisResult
+// @Failure 500 {object} AnalysisResult
+// @Router /v1/ai-analysis/stream [get]
+func (h *AIAnalysisHandler) AIAnalysisStream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, ok := authctx.UserFrom(r.Context())
+		if !ok || u == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+
+		dbName := r.URL.Query().Get("db_name")
+		if dbName == "" {
+			h.writeErrorResponse(w, http.StatusBadRequest, "db_name parameter is required")
+			return
+		}
+		deltas, _ := strconv.ParseBool(r.URL.Query().Get("deltas"))
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Streaming not supported")
+			return
+		}
+
+		ctx := r.Context()
+		queries, err := h.selectQueries(ctx, dbName, r.URL.Query().Get("limit"))
+		if err != nil {
+			h.log.Error("Failed to query slow queries", "error", err, "db_name", dbName)
+			h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to query database")
+			return
+		}
+
+		// Nothing to analyze: stream just start and done without touching the quota.
+		var inv *sqllog.AIInvocation
+		if len(queries) > 0 {
+			inv, queries, err = h.reserveQuota(ctx, u.ID, u.Username, dbName, "ai-analysis/stream", queries)
+			if err != nil {
+				if errors.Is(err, sqllog.ErrAIQuotaExceeded) {
+					h.writeErrorResponse(w, http.StatusTooManyRequests, "AI quota exceeded; try again later")
+					return
+				}
+				h.log.Error("Failed to check AI quota", "error", err, "user_id", u.ID)
+				h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to check AI quota")
+				return
+			}
+		}
+
+		// The server-wide WriteTimeout would cut long streams; lift it for this response.
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			h.log.Debug("could not clear write deadline", "error", err)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		send := func(ev sseEvent) error {
+			b, err := json.Marshal(ev.Data)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Name, b); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return nil
+		}
+
+		if err := send(sseEvent{Name: "start", Data: StreamStartEvent{DBName: dbName, Total: len(queries)}}); err != nil {
+			return
+		}
+
+		// Workers push events; this goroutine is the only writer to w. They get
+		// their own context so a failed write stops them as well.
+		usage := &tokenUsage{}
+		events := make(chan sseEvent)
+		workCtx, cancel := context.WithCancel(ctx)
+		go h.runStreamWorkers(workCtx, queries, deltas, usage, events)
+
+		// Record the reserved queries once the workers have finished, so the
+		// token totals are complete even for streams cut by the client.
+		count := 0
+		defer func() {
+			cancel()
+			for range events {
+			}
+			if inv != nil {
+				h.recordInvocation(ctx, inv, len(queries), usage)
+			}
+		}()
+
+		heartbeat := time.NewTicker(sseHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				// Client went away; workers observe the same context and stop.
+				return
+			case <-heartbeat.C:
+				if err := send(sseEvent{Name: "heartbeat", Data: map[string]any{"time": time.Now().UTC()}}); err != nil {
+					return
+				}
+			case ev, ok := <-events:
+				if !ok {
+					_ = send(sseEvent{Name: "done", Data: StreamDoneEvent{Count: count}})
+					return
+				}
+				if ev.Name == "analysis" {
+					count++
+				}
+				if err := send(ev); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// runStreamWorkers analyzes queries with bounded concurrency and closes events when done.
+// Sends are abandoned as soon as the request context is canceled.
+func (h *AIAnalysisHandler) runStreamWorkers(ctx context.Context, queries []sqllog.SQLLog, deltas bool, usage *tokenUsage, events chan<- sseEvent) {
+	defer close(events)
+
+	emit := func(ev sseEvent) bool {
+		select {
+		case events <- ev:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	sem := make(chan struct{}, aiStreamConcurrency)
+	var wg sync.WaitGroup
+	for _, q := range queries {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func(q sqllog.SQLLog) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			var onDelta func(string)
+			if deltas {
+				onDelta = func(chunk string) {
+					emit(sseEvent{Name: "delta", Data: StreamDeltaEvent{ID: q.ID, Content: chunk}})
+				}
+			}
+			a := h.analyze(ctx, q, onDelta, usage)
+			if ctx.Err() != nil {
+				return
+			}
+			emit(sseEvent{Name: "analysis", Data: a})
+		}(q)
+	}
+	wg.Wait()
+}
@@ -2,17 +2,21 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync"
 	"testing"
 
 	"github.com/gavv/httpexpect/v2"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
+	"go-demo/internal/authctx"
 	"go-demo/internal/config"
 	"go-demo/internal/db"
 	"go-demo/internal/sqllog"
@@ -364,6 +368,90 @@ func (suite *AIAnalysisTestSuite) insertVariedTestData() {
 	require.NoError(suite.T(), err)
 }
 
+func (suite *AIAnalysisTestSuite) TestAIAnalysis_Quota() {
+	ctx := context.Background()
+	require.NoError(suite.T(), suite.repo.Migrate(ctx))
+	logs := make([]sqllog.SQLLog, 3)
+	for i := range logs {
+		logs[i] = sqllog.SQLLog{DBName: "quotadb", SQLQuery: fmt.Sprintf("SELECT * FROM t%d", i), ExecTimeMs: 1000, ExecCount: 200}
+	}
+	require.NoError(suite.T(), suite.repo.InsertBatch(ctx, logs))
+	user := &db.User{ID: uuid.NewString(), Username: "quota"}
+	other := uuid.NewString()
+	defer func() {
+		suite.dbx.Gorm.Where("db_name = ?", "quotadb").Delete(&sqllog.SQLLog{})
+		suite.dbx.Gorm.Where("user_id IN ?", []string{user.ID, other}).Delete(&sqllog.AIInvocation{})
+	}()
+
+	h := NewAIAnalysisHandler(suite.repo, slog.Default(), config.Config{AIQueriesPerDay: 2})
+	call := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/ai-analysis?db_name=quotadb", nil)
+		reqCtx := authctx.WithUser(req.Context(), user)
+		reqCtx = authctx.WithPermissions(reqCtx, []string{db.PermAIAnalyze, db.PermSQLLogAllDBs})
+		rec := httptest.NewRecorder()
+		h.AIAnalysis().ServeHTTP(rec, req.WithContext(reqCtx))
+		return rec
+	}
+
+	// The first call is trimmed to the allowance, the next one refused.
+	rec := call()
+	require.Equal(suite.T(), http.StatusOK, rec.Code)
+	var res AnalysisResult
+	require.NoError(suite.T(), json.Unmarshal(rec.Body.Bytes(), &res))
+	require.Len(suite.T(), res.Data, 2)
+	require.Equal(suite.T(), http.StatusTooManyRequests, call().Code)
+
+	// A stream with nothing to analyze succeeds without touching the quota.
+	req := httptest.NewRequest(http.MethodGet, "/v1/ai-analysis/stream?db_name=emptydb", nil)
+	reqCtx := authctx.WithUser(req.Context(), user)
+	reqCtx = authctx.WithPermissions(reqCtx, []string{db.PermAIAnalyze, db.PermSQLLogAllDBs})
+	rec = httptest.NewRecorder()
+	h.AIAnalysisStream().ServeHTTP(rec, req.WithContext(reqCtx))
+	require.Equal(suite.T(), http.StatusOK, rec.Code)
+	require.Contains(suite.T(), rec.Body.String(), "event: done\ndata: {\"count\":0}")
+
+	// Concurrent reservations cannot overrun the limit.
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = suite.repo.ReserveAIUsage(ctx, &sqllog.AIInvocation{UserID: other, DBName: "quotadb", QueryCount: 1}, 3, 0)
+		}()
+	}
+	wg.Wait()
+	granted := 0
+	for _, err := range errs {
+		if err == nil {
+			granted++
+			continue
+		}
+		require.ErrorIs(suite.T(), err, sqllog.ErrAIQuotaExceeded)
+	}
+	require.Equal(suite.T(), 3, granted)
+}
+
+func TestAIAnalysis_RequiresAuthentication(t *testing.T) {
+	h := NewAIAnalysisHandler(nil, slog.Default(), config.Config{})
+	for _, handler := range []http.Handler{h.AIAnalysis(), h.AIAnalysisStream()} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/ai-analysis?db_name=x", nil))
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+	}
+}
+
+func TestAIAnalysis_RequiresPermission(t *testing.T) {
+	h := NewAIAnalysisHandler(nil, slog.Default(), config.Config{})
+	req := httptest.NewRequest(http.MethodGet, "/v1/ai-analysis?db_name=x", nil)
+	ctx := authctx.WithUser(req.Context(), &db.User{ID: "u1", Username: "reader", Role: "MONITOR"})
+	ctx = authctx.WithPermissions(ctx, []string{db.PermSQLLogRead})
+	rec := httptest.NewRecorder()
+	RequirePermission(db.PermAIAnalyze)(h.AIAnalysis()).ServeHTTP(rec, req.WithContext(ctx))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), db.PermAIAnalyze)
+}
+
 func TestAIAnalysisTestSuite(t *testing.T) {
 	suite.Run(t, new(AIAnalysisTestSuite))
 }
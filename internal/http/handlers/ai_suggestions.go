@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Suggestion types understood by tooling consuming AnalysisResult.
+const (
+	SuggestionIndex        = "index"
+	SuggestionRewrite      = "rewrite"
+	SuggestionCache        = "cache"
+	SuggestionManualReview = "manual_review"
+)
+
+// Sources of a query analysis.
+const (
+	AnalysisSourceAI    = "ai"
+	AnalysisSourceLocal = "local"
+)
+
+const manualReviewText = "Recommendation: manual review required"
+
+// Suggestion is a single machine-readable optimization hint for a query.
+type Suggestion struct {
+	Type       string   `json:"type"`
+	Table      string   `json:"table"`
+	Columns    []string `json:"columns"`
+	DDL        string   `json:"ddl"`
+	Rationale  string   `json:"rationale"`
+	Confidence float64  `json:"confidence"`
+}
+
+// suggestionList is the top-level object the model must return.
+type suggestionList struct {
+	Suggestions []Suggestion `json:"suggestions"`
+}
+
+// suggestionSchema is the JSON schema sent to OpenAI (strict mode) for structured output.
+var suggestionSchema = json.RawMessage(`{
+  "type": "object",
+  "additionalProperties": false,
+  "required": ["suggestions"],
+  "properties": {
+    "suggestions": {
+      "type": "array",
+      "minItems": 1,
+      "maxItems": 5,
+      "items": {
+        "type": "object",
+        "additionalProperties": false,
+        "required": ["type", "table", "columns", "ddl", "rationale", "confidence"],
+        "properties": {
+          "type": {"type": "string", "enum": ["index", "rewrite", "cache", "manual_review"]},
+          "table": {"type": "string"},
+          "columns": {"type": "array", "items": {"type": "string"}},
+          "ddl": {"type": "string"},
+          "rationale": {"type": "string"},
+          "confidence": {"type": "number", "minimum": 0, "maximum": 1}
+        }
+      }
+    }
+  }
+}`)
+
+// identRE matches plain or schema-qualified SQL identifiers.
+var identRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*(\.[A-Za-z_][A-Za-z0-9_$]*)?$`)
+
+// parseSuggestions decodes and validates a model response against suggestionSchema.
+// The model output is untrusted: any deviation from the schema is an error so the
+// caller can fall back to the local analyzer.
+func parseSuggestions(content string) ([]Suggestion, error) {
+	content = strings.TrimSpace(content)
+	// Tolerate a fenced code block even though the schema asks for bare JSON.
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimSuffix(content, "```")
+
+	dec := json.NewDecoder(strings.NewReader(content))
+	dec.DisallowUnknownFields()
+	var out suggestionList
+	if err := dec.Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode suggestions: %w", err)
+	}
+	if len(out.Suggestions) == 0 {
+		return nil, fmt.Errorf("no suggestions returned")
+	}
+	if len(out.Suggestions) > 5 {
+		return nil, fmt.Errorf("too many suggestions: %d", len(out.Suggestions))
+	}
+	for i := range out.Suggestions {
+		s := &out.Suggestions[i]
+		s.Type = strings.ToLower(strings.TrimSpace(s.Type))
+		s.Table = strings.TrimSpace(s.Table)
+		s.DDL = strings.TrimSpace(s.DDL)
+		s.Rationale = strings.TrimSpace(s.Rationale)
+		if s.Columns == nil {
+			s.Columns = []string{}
+		}
+		if err := validateSuggestion(*s); err != nil {
+			return nil, fmt.Errorf("suggestion %d: %w", i, err)
+		}
+	}
+	return out.Suggestions, nil
+}
+
+func validateSuggestion(s Suggestion) error {
+	switch s.Type {
+	case SuggestionIndex, SuggestionRewrite, SuggestionCache, SuggestionManualReview:
+	default:
+		return fmt.Errorf("unknown type %q", s.Type)
+	}
+	if s.Rationale == "" {
+		return fmt.Errorf("missing rationale")
+	}
+	if s.Confidence < 0 || s.Confidence > 1 {
+		return fmt.Errorf("confidence out of range: %v", s.Confidence)
+	}
+	if s.Table != "" && !identRE.MatchString(s.Table) {
+		return fmt.Errorf("invalid table %q", s.Table)
+	}
+	for _, c := range s.Columns {
+		if !identRE.MatchString(c) {
+			return fmt.Errorf("invalid column %q", c)
+		}
+	}
+	if s.Type == SuggestionIndex {
+		if s.Table == "" || len(s.Columns) == 0 {
+			return fmt.Errorf("index suggestion requires table and columns")
+		}
+		if s.DDL != "" && !strings.HasPrefix(strings.ToUpper(s.DDL), "CREATE ") {
+			return fmt.Errorf("index ddl must be a CREATE statement")
+		}
+	}
+	return nil
+}
+
+// summarizeSuggestions renders suggestions as the human-readable text exposed in QueryAnalysis.Suggestions.
+func summarizeSuggestions(suggs []Suggestion) string {
+	if len(suggs) == 0 {
+		return manualReviewText
+	}
+	parts := make([]string, 0, len(suggs))
+	for _, s := range suggs {
+		switch s.Type {
+		case SuggestionIndex:
+			parts = append(parts, fmt.Sprintf("Add index on %s (%s)", s.Table, strings.Join(s.Columns, ", ")))
+		case SuggestionRewrite:
+			parts = append(parts, "Rewrite: "+s.Rationale)
+		case SuggestionCache:
+			parts = append(parts, "Cache: "+s.Rationale)
+		default:
+			parts = append(parts, manualReviewText)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+var (
+	whereRE      = regexp.MustCompile(`(?i)WHERE\s+(.+?)(?:\s+ORDER\s+BY|\s+GROUP\s+BY|\s+HAVING|\s+LIMIT|$)`)
+	whereFieldRE = regexp.MustCompile(`(?:^|[^\w.$])([A-Za-z_][\w$]*(?:\.[A-Za-z_][\w$]*)?)\s*(?:[=<>]|!=)`)
+	stringLitRE  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	tableRE      = regexp.MustCompile(`(?i)\b(?:FROM|UPDATE|INTO)\s+([A-Za-z_][A-Za-z0-9_$]*(?:\.[A-Za-z_][A-Za-z0-9_$]*)?)`)
+	selectStarRE = regexp.MustCompile(`(?i)\bSELECT\s+\*`)
+)
+
+// localSuggestions is the rule-based analyzer used when OpenAI is not configured
+// or its output fails validation.
+func localSuggestions(sqlQuery string) []Suggestion {
+	var out []Suggestion
+
+	table := ""
+	if m := tableRE.FindStringSubmatch(sqlQuery); len(m) > 1 {
+		table = m[1]
+	}
+
+	if m := whereRE.FindStringSubmatch(sqlQuery); len(m) > 1 && table != "" {
+		var cols []string
+		seen := map[string]bool{}
+		// Only the column left of each comparison counts; string literals are
+		// blanked first and a qualifier such as o.user_id is dropped.
+		where := stringLitRE.ReplaceAllString(m[1], "?")
+		for _, fm := range whereFieldRE.FindAllStringSubmatch(where, -1) {
+			col := strings.ToLower(fm[1][strings.LastIndex(fm[1], ".")+1:])
+			if !seen[col] {
+				seen[col] = true
+				cols = append(cols, col)
+			}
+		}
+		if len(cols) > 0 {
+			idxName := "idx_" + strings.ReplaceAll(table, ".", "_") + "_" + strings.Join(cols, "_")
+			out = append(out, Suggestion{
+				Type:       SuggestionIndex,
+				Table:      table,
+				Columns:    cols,
+				DDL:        fmt.Sprintf("CREATE INDEX %s ON %s (%s);", idxName, table, strings.Join(cols, ", ")),
+				Rationale:  "Columns used in the WHERE clause are candidates for an index",
+				Confidence: 0.5,
+			})
+		}
+	}
+
+	if selectStarRE.MatchString(sqlQuery) {
+		out = append(out, Suggestion{
+			Type:       SuggestionRewrite,
+			Table:      table,
+			Columns:    []string{},
+			Rationale:  "Select only the columns you need instead of SELECT *",
+			Confidence: 0.4,
+		})
+	}
+
+	if len(out) == 0 {
+		out = append(out, Suggestion{
+			Type:       SuggestionManualReview,
+			Columns:    []string{},
+			Rationale:  "Query could not be analyzed automatically",
+			Confidence: 0,
+		})
+	}
+	return out
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSuggestions(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+		want    int
+	}{
+		{
+			name:    "valid index suggestion",
+			content: `{"suggestions":[{"type":"index","table":"orders","columns":["user_id","status"],"ddl":"CREATE INDEX idx_orders_user_status ON orders (user_id, status);","rationale":"filter columns","confidence":0.8}]}`,
+			want:    1,
+		},
+		{
+			name:    "fenced json is accepted",
+			content: "```json\n{\"suggestions\":[{\"type\":\"cache\",\"table\":\"\",\"columns\":[],\"ddl\":\"\",\"rationale\":\"hot query\",\"confidence\":0.3}]}\n```",
+			want:    1,
+		},
+		{
+			name:    "free-form text",
+			content: "Add index on user_id",
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			content: `{"suggestions":[{"type":"drop_table","table":"t","columns":[],"ddl":"","rationale":"x","confidence":0.5}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "confidence out of range",
+			content: `{"suggestions":[{"type":"cache","table":"","columns":[],"ddl":"","rationale":"x","confidence":1.5}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "index without columns",
+			content: `{"suggestions":[{"type":"index","table":"orders","columns":[],"ddl":"","rationale":"x","confidence":0.5}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "index ddl is not a create statement",
+			content: `{"suggestions":[{"type":"index","table":"orders","columns":["id"],"ddl":"DROP TABLE orders","rationale":"x","confidence":0.5}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unexpected field",
+			content: `{"suggestions":[{"type":"cache","table":"","columns":[],"ddl":"","rationale":"x","confidence":0.5,"extra":1}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "empty list",
+			content: `{"suggestions":[]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSuggestions(tt.content)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, got, tt.want)
+		})
+	}
+}
+
+func TestLocalSuggestions(t *testing.T) {
+	suggs := localSuggestions("SELECT * FROM orders WHERE user_id = ? AND status = ?")
+	require.Len(t, suggs, 2)
+	require.Equal(t, SuggestionIndex, suggs[0].Type)
+	require.Equal(t, "orders", suggs[0].Table)
+	require.Equal(t, []string{"user_id", "status"}, suggs[0].Columns)
+	require.Equal(t, SuggestionRewrite, suggs[1].Type)
+	for _, s := range suggs {
+		require.NoError(t, validateSuggestion(s))
+	}
+	require.Equal(t, "Add index on orders (user_id, status); Rewrite: Select only the columns you need instead of SELECT *", summarizeSuggestions(suggs))
+
+	// Only column names on the left of a comparison count, not numbers,
+	// values or the column a join compares against.
+	suggs = localSuggestions("SELECT id FROM orders o WHERE 1 = 1 AND o.created_at >= 20240101 AND total<>0 AND note = 'a=b' AND o.user_id = u.id")
+	require.Len(t, suggs, 1)
+	require.Equal(t, []string{"created_at", "total", "note", "user_id"}, suggs[0].Columns)
+	require.NoError(t, validateSuggestion(suggs[0]))
+
+	manual := localSuggestions("VACUUM")
+	require.Len(t, manual, 1)
+	require.Equal(t, SuggestionManualReview, manual[0].Type)
+	require.Equal(t, manualReviewText, summarizeSuggestions(manual))
+}
@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-demo/internal/auth"
+	"go-demo/internal/authctx"
+	"go-demo/internal/db"
+
+	"github.com/google/uuid"
+)
+
+type CreateServiceAccountReq struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type CreateAPIKeyReq struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type APIKeyResp struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// APIKeySecretResp is returned when a key is created or rotated; Key is the
+// only time the plaintext is available.
+type APIKeySecretResp struct {
+	APIKeyResp
+	Key string `json:"key"`
+}
+
+func toAPIKeyResp(k *db.APIKey) APIKeyResp {
+	scopes := k.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return APIKeyResp{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     scopes,
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		LastUsedIP: k.LastUsedIP,
+		RevokedAt:  k.RevokedAt,
+		CreatedBy:  k.CreatedBy,
+		CreatedAt:  k.CreatedTime,
+	}
+}
+
+// serviceAccountID reads and validates the {id} path value, writing a 400 on failure.
+func serviceAccountID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("id")
+	if _, err := uuid.Parse(id); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_path", "service account ID must be a UUID")
+		return "", false
+	}
+	return id, true
+}
+
+// writeAPIKeyError maps service account and API key errors to responses.
+func (h Auth) writeAPIKeyError(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case errors.Is(err, auth.ErrUserNotFound), errors.Is(err, auth.ErrNotServiceAccount):
+		writeError(w, http.StatusNotFound, "service_account_not_found", "service account not found")
+	case errors.Is(err, auth.ErrAPIKeyNotFound):
+		writeError(w, http.StatusNotFound, "api_key_not_found", "API key not found or revoked")
+	case errors.Is(err, auth.ErrUnknownPermission):
+		writeError(w, http.StatusBadRequest, "unknown_permission", "unknown permission in scopes")
+	default:
+		h.Log.Error(msg, "err", err)
+		writeError(w, http.StatusInternalServerError, "server_error", "could not "+strings.TrimSuffix(msg, " failed"))
+	}
+}
+
+// CreateServiceAccount godoc
+// @Summary Create a service account (Admin only)
+// @Description Creates a user without a password for automation. It authenticates with API keys in the X-API-Key header (apikeys:manage required)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateServiceAccountReq true "Service account"
+// @Success 201 {object} UserResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 409 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/service-accounts [post]
+func (h Auth) CreateServiceAccount() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		adminUser, ok := authctx.UserFrom(r.Context())
+		if !ok || adminUser == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		var req CreateServiceAccountReq
+		if !h.decodeBody(w, r, &req) {
+			return
+		}
+		if strings.TrimSpace(req.Username) == "" || req.Role == "" {
+			writeError(w, http.StatusBadRequest, "bad_request", "username and role are required")
+			return
+		}
+		u, err := h.S.CreateServiceAccount(r.Context(), req.Username, req.Role, adminUser.Username)
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrUserExists):
+				writeError(w, http.StatusConflict, "user_exists", "username already exists")
+			case errors.Is(err, auth.ErrAdminAssign):
+				writeError(w, http.StatusBadRequest, "invalid_role", "service accounts cannot have the ADMIN role")
+			case errors.Is(err, auth.ErrInvalidRole), errors.Is(err, auth.ErrRoleNotDelegable):
+				writeError(w, http.StatusBadRequest, "invalid_role", err.Error())
+			default:
+				h.Log.Error("create service account failed", "err", err)
+				writeError(w, http.StatusInternalServerError, "server_error", "could not create service account")
+			}
+			return
+		}
+		writeJSON(w, http.StatusCreated, toUserResp(u))
+	})
+}
+
+// ListServiceAccounts godoc
+// @Summary List service accounts (Admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} UserResp
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/service-accounts [get]
+func (h Auth) ListServiceAccounts() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		users, err := h.S.ListServiceAccounts(r.Context())
+		if err != nil {
+			h.Log.Error("list service accounts failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not list service accounts")
+			return
+		}
+		out := make([]UserResp, 0, len(users))
+		for i := range users {
+			out = append(out, toUserResp(&users[i]))
+		}
+		writeJSON(w, http.StatusOK, out)
+	})
+}
+
+// CreateAPIKey godoc
+// @Summary Create an API key (Admin only)
+// @Description Issues a key for a service account. The key is returned only in this response. Scopes are permission codes that narrow what the account's role allows; omit them to allow everything the role grants (apikeys:manage required)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Service account ID"
+// @Param request body CreateAPIKeyReq true "Key settings"
+// @Success 201 {object} APIKeySecretResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/service-accounts/{id}/keys [post]
+func (h Auth) CreateAPIKey() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		adminUser, ok := authctx.UserFrom(r.Context())
+		if !ok || adminUser == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		userID, ok := serviceAccountID(w, r)
+		if !ok {
+			return
+		}
+		var req CreateAPIKeyReq
+		if !h.decodeBody(w, r, &req) {
+			return
+		}
+		if strings.TrimSpace(req.Name) == "" {
+			writeError(w, http.StatusBadRequest, "bad_request", "name is required")
+			return
+		}
+		if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+			writeError(w, http.StatusBadRequest, "bad_request", "expires_at must be in the future")
+			return
+		}
+		plain, key, err := h.S.CreateAPIKey(r.Context(), userID, req.Name, req.Scopes, req.ExpiresAt, adminUser.Username)
+		if err != nil {
+			h.writeAPIKeyError(w, err, "create api key failed")
+			return
+		}
+		writeJSON(w, http.StatusCreated, APIKeySecretResp{APIKeyResp: toAPIKeyResp(key), Key: plain})
+	})
+}
+
+// ListAPIKeys godoc
+// @Summary List a service account's API keys (Admin only)
+// @Description Lists keys with their prefix, scopes, expiry and last use; secrets are never returned (apikeys:manage required)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Service account ID"
+// @Success 200 {array} APIKeyResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/service-accounts/{id}/keys [get]
+func (h Auth) ListAPIKeys() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := serviceAccountID(w, r)
+		if !ok {
+			return
+		}
+		keys, err := h.S.ListAPIKeys(r.Context(), userID)
+		if err != nil {
+			h.writeAPIKeyError(w, err, "list api keys failed")
+			return
+		}
+		out := make([]APIKeyResp, 0, len(keys))
+		for i := range keys {
+			out = append(out, toAPIKeyResp(&keys[i]))
+		}
+		writeJSON(w, http.StatusOK, out)
+	})
+}
+
+// RotateAPIKey godoc
+// @Summary Rotate an API key (Admin only)
+// @Description Replaces the key's secret; the old one stops working immediately. The new key is returned only in this response (apikeys:manage required)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Service account ID"
+// @Param key_id path string true "API key ID"
+// @Success 200 {object} APIKeySecretResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/service-accounts/{id}/keys/{key_id}/rotate [post]
+func (h Auth) RotateAPIKey() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adminUser, ok := authctx.UserFrom(r.Context())
+		if !ok || adminUser == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		userID, ok := serviceAccountID(w, r)
+		if !ok {
+			return
+		}
+		keyID := r.PathValue("key_id")
+		if _, err := uuid.Parse(keyID); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_path", "key ID must be a UUID")
+			return
+		}
+		plain, key, err := h.S.RotateAPIKey(r.Context(), userID, keyID, adminUser.Username)
+		if err != nil {
+			h.writeAPIKeyError(w, err, "rotate api key failed")
+			return
+		}
+		writeJSON(w, http.StatusOK, APIKeySecretResp{APIKeyResp: toAPIKeyResp(key), Key: plain})
+	})
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key (Admin only)
+// @Tags admin
+// @Security BearerAuth
+// @Param id path string true "Service account ID"
+// @Param key_id path string true "API key ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/service-accounts/{id}/keys/{key_id} [delete]
+func (h Auth) RevokeAPIKey() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adminUser, ok := authctx.UserFrom(r.Context())
+		if !ok || adminUser == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		userID, ok := serviceAccountID(w, r)
+		if !ok {
+			return
+		}
+		keyID := r.PathValue("key_id")
+		if _, err := uuid.Parse(keyID); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_path", "key ID must be a UUID")
+			return
+		}
+		if err := h.S.RevokeAPIKey(r.Context(), userID, keyID, adminUser.Username); err != nil {
+			h.writeAPIKeyError(w, err, "revoke api key failed")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
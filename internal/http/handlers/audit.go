@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-demo/internal/audit"
+	"go-demo/internal/db"
+)
+
+// AuditLog serves the audit log to admins.
+type AuditLog struct {
+	Rec *audit.Recorder
+	Log *slog.Logger
+}
+
+func NewAuditLog(rec *audit.Recorder, log *slog.Logger) AuditLog {
+	if log == nil {
+		log = slog.Default()
+	}
+	return AuditLog{Rec: rec, Log: log}
+}
+
+type AuditEventResp struct {
+	ID         uint64         `json:"id"`
+	Time       time.Time      `json:"time"`
+	Action     string         `json:"action"`
+	Outcome    string         `json:"outcome"`
+	ActorID    string         `json:"actor_id,omitempty"`
+	ActorName  string         `json:"actor_name,omitempty"`
+	TargetType string         `json:"target_type,omitempty"`
+	TargetID   string         `json:"target_id,omitempty"`
+	IP         string         `json:"ip,omitempty"`
+	RequestID  string         `json:"request_id,omitempty"`
+	Before     map[string]any `json:"before,omitempty"`
+	After      map[string]any `json:"after,omitempty"`
+	Details    map[string]any `json:"details,omitempty"`
+}
+
+type ListAuditResp struct {
+	Events []AuditEventResp `json:"events"`
+	Total  int64            `json:"total"`
+	Limit  int              `json:"limit"`
+	Offset int              `json:"offset"`
+}
+
+func toAuditEventResp(e db.AuditEvent) AuditEventResp {
+	return AuditEventResp{
+		ID:         e.ID,
+		Time:       e.CreatedTime,
+		Action:     e.Action,
+		Outcome:    e.Outcome,
+		ActorID:    e.ActorID,
+		ActorName:  e.ActorName,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		IP:         e.IP,
+		RequestID:  e.RequestID,
+		Before:     e.Before,
+		After:      e.After,
+		Details:    e.Details,
+	}
+}
+
+// parseAuditFilter reads the audit log filters from the query. from/to accept
+// RFC3339 or YYYY-MM-DD; a date-only "to" includes that whole day.
+func parseAuditFilter(r *http.Request) (audit.Filter, error) {
+	q := r.URL.Query()
+	f := audit.Filter{
+		Action:     strings.TrimSpace(q.Get("action")),
+		Outcome:    strings.TrimSpace(q.Get("outcome")),
+		ActorID:    strings.TrimSpace(q.Get("actor_id")),
+		TargetType: strings.TrimSpace(q.Get("target_type")),
+		TargetID:   strings.TrimSpace(q.Get("target_id")),
+		RequestID:  strings.TrimSpace(q.Get("request_id")),
+		IP:         strings.TrimSpace(q.Get("ip")),
+	}
+	if f.Outcome != "" && f.Outcome != audit.OutcomeSuccess && f.Outcome != audit.OutcomeFailure {
+		return audit.Filter{}, fmt.Errorf("outcome must be %s or %s", audit.OutcomeSuccess, audit.OutcomeFailure)
+	}
+	var err error
+	if from := strings.TrimSpace(q.Get("from")); from != "" {
+		if f.From, err = parseTime(from); err != nil {
+			return audit.Filter{}, fmt.Errorf("invalid 'from': %w", err)
+		}
+	}
+	if to := strings.TrimSpace(q.Get("to")); to != "" {
+		if f.To, err = parseTime(to); err != nil {
+			return audit.Filter{}, fmt.Errorf("invalid 'to': %w", err)
+		}
+		if len(to) == len("2006-01-02") {
+			f.To = f.To.Add(24 * time.Hour)
+		}
+	}
+	return f, nil
+}
+
+// List godoc
+// @Summary List audit events
+// @Description Security and administrative actions, newest first. Requires the audit:read permission.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param action query string false "Action, e.g. auth.login, user.role_change"
+// @Param outcome query string false "success or failure"
+// @Param actor_id query string false "Actor user ID"
+// @Param target_type query string false "Target type (user, database, file)"
+// @Param target_id query string false "Target ID"
+// @Param request_id query string false "Request ID (X-Request-Id)"
+// @Param ip query string false "Client IP"
+// @Param from query string false "Start time (RFC3339 or YYYY-MM-DD)"
+// @Param to query string false "End time (RFC3339 or YYYY-MM-DD, inclusive for dates)"
+// @Param limit query int false "Number of events to return" default(50) maximum(500)
+// @Param offset query int false "Number of events to skip" default(0)
+// @Success 200 {object} ListAuditResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/audit [get]
+func (h AuditLog) List() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, err := parseAuditFilter(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		limit, offset := 50, 0
+		if v, err := parsePositiveInt(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 500 {
+			limit = v
+		}
+		if v, err := parsePositiveInt(r.URL.Query().Get("offset")); err == nil {
+			offset = v
+		}
+
+		events, total, err := h.Rec.List(r.Context(), f, limit, offset)
+		if err != nil {
+			h.Log.Error("list audit events failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not list audit events")
+			return
+		}
+		resp := ListAuditResp{Events: make([]AuditEventResp, 0, len(events)), Total: total, Limit: limit, Offset: offset}
+		for _, e := range events {
+			resp.Events = append(resp.Events, toAuditEventResp(e))
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
+
+// ExportCSV godoc
+// @Summary Export audit events (CSV)
+// @Description Downloads every event matching the filters, oldest first. Before, after and details are JSON-encoded cells; cells starting with =, +, -, @, tab or carriage return are prefixed with a single quote. Requires the audit:read permission.
+// @Tags admin
+// @Produce text/csv
+// @Security BearerAuth
+// @Param action query string false "Action, e.g. auth.login, user.role_change"
+// @Param outcome query string false "success or failure"
+// @Param actor_id query string false "Actor user ID"
+// @Param target_type query string false "Target type (user, database, file)"
+// @Param target_id query string false "Target ID"
+// @Param request_id query string false "Request ID (X-Request-Id)"
+// @Param ip query string false "Client IP"
+// @Param from query string false "Start time (RFC3339 or YYYY-MM-DD)"
+// @Param to query string false "End time (RFC3339 or YYYY-MM-DD, inclusive for dates)"
+// @Success 200 {string} string "CSV content"
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Router /v1/admin/audit.csv [get]
+func (h AuditLog) ExportCSV() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, err := parseAuditFilter(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		name := fmt.Sprintf("audit-%s.csv", time.Now().UTC().Format("20060102-1504"))
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		// The body is streamed, so a failure part way can only be logged.
+		if err := h.Rec.ExportCSV(r.Context(), f, w); err != nil {
+			h.Log.Error("export audit events failed", "err", err)
+		}
+	})
+}
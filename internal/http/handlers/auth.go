@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,12 +13,18 @@ import (
 
 	"go-demo/internal/auth"
 	"go-demo/internal/authctx"
+	"go-demo/internal/db"
+	"go-demo/internal/ratelimit"
 )
 
 type Auth struct {
 	S            *auth.Service
 	Log          *slog.Logger
 	MaxBodyBytes int64
+
+	// Optional login rate limits per client IP and per identifier; nil disables.
+	LoginIPLimiter         *ratelimit.Limiter
+	LoginIdentifierLimiter *ratelimit.Limiter
 }
 
 func NewAuth(s *auth.Service, log *slog.Logger, maxBodyBytes int64) Auth {
@@ -38,23 +45,50 @@ type CreateUserReq struct {
 }
 
 type UserResp struct {
-	ID          string    `json:"id"`
-	Username    string    `json:"username"`
-	Email       string    `json:"email"`
-	CreatedBy   string    `json:"created_by"`
-	CreatedTime time.Time `json:"created_time"`
-	UpdatedTime time.Time `json:"updated_time"`
-	Role        string    `json:"role"`
+	ID             string     `json:"id"`
+	Username       string     `json:"username"`
+	Email          string     `json:"email"`
+	CreatedBy      string     `json:"created_by"`
+	CreatedTime    time.Time  `json:"created_time"`
+	UpdatedTime    time.Time  `json:"updated_time"`
+	Role           string     `json:"role"`
+	Status         string     `json:"status"`
+	EmailVerified  bool       `json:"email_verified"`
+	TwoFactor      bool       `json:"two_factor_enabled"`
+	ServiceAccount bool       `json:"service_account,omitempty"`
+	LastLoginAt    *time.Time `json:"last_login_at,omitempty"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+	Permissions    []string   `json:"permissions,omitempty"`
+}
+
+func toUserResp(u *db.User) UserResp {
+	return UserResp{
+		ID:             u.ID,
+		Username:       u.Username,
+		Email:          u.Email,
+		CreatedBy:      u.CreatedBy,
+		CreatedTime:    u.CreatedTime,
+		UpdatedTime:    u.UpdatedTime,
+		Role:           u.Role,
+		Status:         u.Status,
+		EmailVerified:  u.EmailVerifiedAt != nil,
+		TwoFactor:      u.TOTPEnabledAt != nil,
+		ServiceAccount: u.ServiceAccount,
+		LastLoginAt:    u.LastLoginAt,
+		DeletedAt:      u.DeletedAt,
+	}
 }
 
 // Register godoc
 // @Summary Register user
+// @Description Creates an account with role USER. Passwords violating the password policy are rejected with 400 and a code such as password_too_short or password_breached. Refused with 403 when REGISTRATION_MODE is invite (registration_closed) or disabled (registration_disabled).
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param request body RegisterReq true "Register request"
 // @Success 201 {object} UserResp
 // @Failure 400 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
 // @Failure 409 {object} ErrorEnvelope
 // @Failure 500 {object} ErrorEnvelope
 // @Router /v1/auth/register [post]
@@ -76,7 +110,16 @@ func (h Auth) Register() http.Handler {
 		}
 		u, err := h.S.Register(r.Context(), req.Username, req.Email, req.Password, "self")
 		if err != nil {
+			if writePasswordPolicyError(w, err) {
+				return
+			}
 			switch err {
+			case auth.ErrRegistrationClosed:
+				writeError(w, http.StatusForbidden, "registration_closed", "registration requires an invitation")
+				return
+			case auth.ErrRegistrationDisabled:
+				writeError(w, http.StatusForbidden, "registration_disabled", "registration is disabled")
+				return
 			case auth.ErrUserExists:
 				writeError(w, http.StatusConflict, "user_exists", "username or email already exists")
 				return
@@ -86,15 +129,7 @@ func (h Auth) Register() http.Handler {
 			}
 		}
 
-		resp := UserResp{
-			ID:          u.ID,
-			Username:    u.Username,
-			Email:       u.Email,
-			CreatedBy:   u.CreatedBy,
-			CreatedTime: u.CreatedTime,
-			UpdatedTime: u.UpdatedTime,
-			Role:        u.Role,
-		}
+		resp := toUserResp(u)
 		writeJSON(w, http.StatusCreated, resp)
 	})
 }
@@ -112,16 +147,36 @@ type LoginResp struct {
 	User             UserResp  `json:"user"`
 }
 
+// allowAttempt counts an unauthenticated attempt against the login limiters
+// for the client's IP and for identifier (a username or email), and answers
+// 429 once either is exhausted.
+func (h Auth) allowAttempt(w http.ResponseWriter, ctx context.Context, identifier string) bool {
+	client, _ := authctx.ClientFrom(ctx)
+	if ok, retry := h.LoginIPLimiter.Allow(client.IP); !ok {
+		writeRateLimited(w, retry)
+		return false
+	}
+	if ok, retry := h.LoginIdentifierLimiter.Allow(strings.ToLower(strings.TrimSpace(identifier))); !ok {
+		writeRateLimited(w, retry)
+		return false
+	}
+	return true
+}
+
 // Login godoc
 // @Summary Login
-// @Description Login with username or email
+// @Description Login with username or email. Accounts with two-factor authentication get 202 with a challenge token to complete at /v1/auth/login/2fa.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param request body LoginReq true "Login request"
 // @Success 200 {object} LoginResp
+// @Success 202 {object} LoginChallengeResp
 // @Failure 400 {object} ErrorEnvelope
 // @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 423 {object} ErrorEnvelope
+// @Failure 429 {object} ErrorEnvelope
 // @Failure 500 {object} ErrorEnvelope
 // @Router /v1/auth/login [post]
 func (h Auth) Login() http.Handler {
@@ -141,12 +196,43 @@ func (h Auth) Login() http.Handler {
 			return
 		}
 
-		u, tok, exp, rtok, rexp, err := h.S.Login(r.Context(), req.Identifier, req.Password)
+		ctx := withClient(r)
+		if !h.allowAttempt(w, ctx, req.Identifier) {
+			return
+		}
+
+		u, tok, exp, rtok, rexp, err := h.S.Login(ctx, req.Identifier, req.Password)
 		if err != nil {
 			if err == auth.ErrInvalidCredentials {
 				writeError(w, http.StatusUnauthorized, "invalid_credentials", "invalid username/email or password")
 				return
 			}
+			var challenge *auth.SecondFactorChallenge
+			if errors.As(err, &challenge) {
+				writeJSON(w, http.StatusAccepted, LoginChallengeResp{
+					ChallengeToken: challenge.Token,
+					ExpiresAt:      challenge.ExpiresAt,
+				})
+				return
+			}
+			var locked *auth.LockedError
+			if errors.As(err, &locked) {
+				setRetryAfter(w, time.Until(locked.Until))
+				writeError(w, http.StatusLocked, "account_locked", "too many failed logins; try again later")
+				return
+			}
+			if errors.Is(err, auth.ErrUserInactive) {
+				writeError(w, http.StatusForbidden, "account_inactive", "account is suspended or deleted")
+				return
+			}
+			if errors.Is(err, auth.ErrEmailNotVerified) {
+				writeError(w, http.StatusForbidden, "email_not_verified", "verify your email address before logging in")
+				return
+			}
+			if errors.Is(err, auth.ErrPasswordExpired) {
+				writeError(w, http.StatusForbidden, "password_expired", "your temporary password has expired; request a password reset")
+				return
+			}
 			writeError(w, http.StatusInternalServerError, "server_error", "could not login")
 			return
 		}
@@ -156,15 +242,7 @@ func (h Auth) Login() http.Handler {
 			ExpiresAt:        exp,
 			RefreshToken:     rtok,
 			RefreshExpiresAt: rexp,
-			User: UserResp{
-				ID:          u.ID,
-				Username:    u.Username,
-				Email:       u.Email,
-				CreatedBy:   u.CreatedBy,
-				CreatedTime: u.CreatedTime,
-				UpdatedTime: u.UpdatedTime,
-				Role:        u.Role,
-			},
+			User:             toUserResp(u),
 		}
 		writeJSON(w, http.StatusOK, resp)
 	})
@@ -172,11 +250,13 @@ func (h Auth) Login() http.Handler {
 
 // Me godoc
 // @Summary Get current user
+// @Description Returns the caller's profile, including the permissions granted by their role.
 // @Tags auth
 // @Produce json
 // @Security BearerAuth
 // @Success 200 {object} UserResp
 // @Failure 401 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
 // @Router /v1/auth/me [get]
 func (h Auth) Me() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -189,15 +269,22 @@ func (h Auth) Me() http.Handler {
 			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
 			return
 		}
-		resp := UserResp{
-			ID:          u.ID,
-			Username:    u.Username,
-			Email:       u.Email,
-			CreatedBy:   u.CreatedBy,
-			CreatedTime: u.CreatedTime,
-			UpdatedTime: u.UpdatedTime,
-			Role:        u.Role,
+		if h.S.Stateless() {
+			// The context user was built from the token's claims; load the full profile.
+			full, err := h.S.GetUserByID(r.Context(), u.ID)
+			if errors.Is(err, auth.ErrInvalidCredentials) {
+				writeError(w, http.StatusUnauthorized, "unauthorized", "user no longer exists")
+				return
+			}
+			if err != nil {
+				h.Log.Error("get user failed", "err", err, "user_id", u.ID)
+				writeError(w, http.StatusInternalServerError, "server_error", "could not load user")
+				return
+			}
+			u = full
 		}
+		resp := toUserResp(u)
+		resp.Permissions = authctx.PermissionsFrom(r.Context())
 		writeJSON(w, http.StatusOK, resp)
 	})
 }
@@ -243,7 +330,7 @@ func (h Auth) Refresh() http.Handler {
 			return
 		}
 
-		u, atok, aexp, rtok, rexp, err := h.S.Refresh(r.Context(), req.RefreshToken)
+		u, atok, aexp, rtok, rexp, err := h.S.Refresh(withClient(r), req.RefreshToken)
 		if err != nil {
 			if errors.Is(err, auth.ErrInvalidCredentials) {
 				writeError(w, http.StatusUnauthorized, "invalid_refresh", "invalid or expired refresh token")
@@ -258,15 +345,7 @@ func (h Auth) Refresh() http.Handler {
 			ExpiresAt:        aexp,
 			RefreshToken:     rtok,
 			RefreshExpiresAt: rexp,
-			User: UserResp{
-				ID:          u.ID,
-				Username:    u.Username,
-				Email:       u.Email,
-				CreatedBy:   u.CreatedBy,
-				CreatedTime: u.CreatedTime,
-				UpdatedTime: u.UpdatedTime,
-				Role:        u.Role,
-			},
+			User:             toUserResp(u),
 		}
 		writeJSON(w, http.StatusOK, resp)
 	})
@@ -311,28 +390,28 @@ func (h Auth) CreateUser() http.Handler {
 			return
 		}
 
-		// Validate role - ADMIN cannot create other ADMIN users
-		if req.Role == "ADMIN" {
-			writeError(w, http.StatusBadRequest, "invalid_role", "cannot create ADMIN users")
-			return
-		}
-
-		// Validate role is one of the allowed roles
-		allowedRoles := []string{"USER", "ANALYZER", "MONITOR", "TEAM_LEADER"}
-		validRole := false
-		for _, role := range allowedRoles {
-			if req.Role == role {
-				validRole = true
-				break
-			}
-		}
-		if !validRole {
+		if req.Role == "" {
 			writeError(w, http.StatusBadRequest, "invalid_role", "invalid role specified")
 			return
 		}
 
 		u, err := h.S.CreateUser(r.Context(), req.Username, req.Email, req.Password, req.Role, adminUser.Username)
 		if err != nil {
+			if writePasswordPolicyError(w, err) {
+				return
+			}
+			if errors.Is(err, auth.ErrInvalidRole) {
+				writeError(w, http.StatusBadRequest, "invalid_role", "invalid role specified")
+				return
+			}
+			if errors.Is(err, auth.ErrAdminAssign) {
+				writeError(w, http.StatusBadRequest, "invalid_role", "cannot create ADMIN users")
+				return
+			}
+			if errors.Is(err, auth.ErrRoleNotDelegable) {
+				writeError(w, http.StatusBadRequest, "invalid_role", err.Error())
+				return
+			}
 			switch err {
 			case auth.ErrUserExists:
 				writeError(w, http.StatusConflict, "user_exists", "username or email already exists")
@@ -344,15 +423,7 @@ func (h Auth) CreateUser() http.Handler {
 			}
 		}
 
-		resp := UserResp{
-			ID:          u.ID,
-			Username:    u.Username,
-			Email:       u.Email,
-			CreatedBy:   u.CreatedBy,
-			CreatedTime: u.CreatedTime,
-			UpdatedTime: u.UpdatedTime,
-			Role:        u.Role,
-		}
+		resp := toUserResp(u)
 		writeJSON(w, http.StatusCreated, resp)
 	})
 }
@@ -366,10 +437,14 @@ type ListUsersResp struct {
 
 // ListUsers godoc
 // @Summary List users (Admin only)
-// @Description Get a paginated list of all users (ADMIN role required)
+// @Description Search, filter, sort and page users (users:manage required)
 // @Tags admin
 // @Produce json
 // @Security BearerAuth
+// @Param q query string false "Case-insensitive substring of username or email"
+// @Param role query string false "Role code"
+// @Param status query string false "active, suspended or deleted"
+// @Param sort query string false "username, email, role, status, created_time, updated_time or last_login_at; prefix with - for descending" default(-created_time)
 // @Param limit query int false "Number of users to return" default(20)
 // @Param offset query int false "Number of users to skip" default(0)
 // @Success 200 {object} ListUsersResp
@@ -408,7 +483,19 @@ func (h Auth) ListUsers() http.Handler {
 			}
 		}
 
-		users, total, err := h.S.ListUsers(r.Context(), limit, offset)
+		q := r.URL.Query()
+		users, total, err := h.S.ListUsers(r.Context(), auth.UserQuery{
+			Search: q.Get("q"),
+			Role:   strings.TrimSpace(q.Get("role")),
+			Status: strings.TrimSpace(q.Get("status")),
+			Sort:   strings.TrimSpace(q.Get("sort")),
+			Limit:  limit,
+			Offset: offset,
+		})
+		if errors.Is(err, auth.ErrInvalidUserQuery) {
+			writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
 		if err != nil {
 			h.Log.Error("list users failed", "err", err)
 			writeError(w, http.StatusInternalServerError, "server_error", "could not list users")
@@ -417,15 +504,7 @@ func (h Auth) ListUsers() http.Handler {
 
 		userResps := make([]UserResp, len(users))
 		for i, user := range users {
-			userResps[i] = UserResp{
-				ID:          user.ID,
-				Username:    user.Username,
-				Email:       user.Email,
-				CreatedBy:   user.CreatedBy,
-				CreatedTime: user.CreatedTime,
-				UpdatedTime: user.UpdatedTime,
-				Role:        user.Role,
-			}
+			userResps[i] = toUserResp(user)
 		}
 
 		resp := ListUsersResp{
@@ -447,8 +526,8 @@ type UpdateUserRoleReq struct {
 }
 
 // UpdateUserStatus godoc
-// @Summary Activate/Deactivate user (Admin only)
-// @Description Activate or deactivate a user (ADMIN role required)
+// @Summary Activate/Suspend user (Admin only)
+// @Description Reactivate or suspend a user (users:manage required). Suspending revokes the user's refresh tokens; deleted users must be restored instead.
 // @Tags admin
 // @Accept json
 // @Produce json
@@ -460,6 +539,7 @@ type UpdateUserRoleReq struct {
 // @Failure 401 {object} ErrorEnvelope
 // @Failure 403 {object} ErrorEnvelope
 // @Failure 404 {object} ErrorEnvelope
+// @Failure 409 {object} ErrorEnvelope
 // @Failure 500 {object} ErrorEnvelope
 // @Router /v1/admin/users/{id}/status [put]
 func (h Auth) UpdateUserStatus() http.Handler {
@@ -499,31 +579,27 @@ func (h Auth) UpdateUserStatus() http.Handler {
 				writeError(w, http.StatusNotFound, "user_not_found", "user not found")
 				return
 			}
-			if err.Error() == "cannot modify ADMIN user status" {
+			if errors.Is(err, auth.ErrAdminStatusChange) {
 				writeError(w, http.StatusBadRequest, "invalid_operation", "cannot modify ADMIN user status")
 				return
 			}
+			if errors.Is(err, auth.ErrUserDeleted) {
+				writeError(w, http.StatusConflict, "user_deleted", "user is deleted; restore it first")
+				return
+			}
 			h.Log.Error("update user status failed", "err", err)
 			writeError(w, http.StatusInternalServerError, "server_error", "could not update user status")
 			return
 		}
 
-		resp := UserResp{
-			ID:          user.ID,
-			Username:    user.Username,
-			Email:       user.Email,
-			CreatedBy:   user.CreatedBy,
-			CreatedTime: user.CreatedTime,
-			UpdatedTime: user.UpdatedTime,
-			Role:        user.Role,
-		}
+		resp := toUserResp(user)
 		writeJSON(w, http.StatusOK, resp)
 	})
 }
 
 // DeleteUser godoc
 // @Summary Delete user (Admin only)
-// @Description Soft delete a user (ADMIN role required)
+// @Description Soft delete a user (users:manage required). The account is kept with status "deleted" and can be restored.
 // @Tags admin
 // @Produce json
 // @Security BearerAuth
@@ -568,7 +644,7 @@ func (h Auth) DeleteUser() http.Handler {
 				writeError(w, http.StatusNotFound, "user_not_found", "user not found")
 				return
 			}
-			if err.Error() == "cannot delete ADMIN user" {
+			if errors.Is(err, auth.ErrAdminDelete) {
 				writeError(w, http.StatusBadRequest, "invalid_operation", "cannot delete ADMIN user")
 				return
 			}
@@ -581,6 +657,55 @@ func (h Auth) DeleteUser() http.Handler {
 	})
 }
 
+// RestoreUser godoc
+// @Summary Restore deleted user (Admin only)
+// @Description Reactivates a soft-deleted user (users:manage required)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} UserResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 409 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/users/{id}/restore [post]
+func (h Auth) RestoreUser() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adminUser, ok := authctx.UserFrom(r.Context())
+		if !ok || adminUser == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+
+		userID := r.PathValue("id")
+		if userID == "" {
+			writeError(w, http.StatusBadRequest, "invalid_path", "user ID is required")
+			return
+		}
+
+		user, err := h.S.RestoreUser(r.Context(), userID, adminUser.Username)
+		if err != nil {
+			if errors.Is(err, auth.ErrUserNotFound) {
+				writeError(w, http.StatusNotFound, "user_not_found", "user not found")
+				return
+			}
+			if errors.Is(err, auth.ErrUserNotDeleted) {
+				writeError(w, http.StatusConflict, "user_not_deleted", "user is not deleted")
+				return
+			}
+			h.Log.Error("restore user failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not restore user")
+			return
+		}
+
+		h.Log.Info("user restored", "user_id", user.ID, "by", adminUser.Username)
+		writeJSON(w, http.StatusOK, toUserResp(user))
+	})
+}
+
 // Helper functions
 func parsePositiveInt(s string) (int, error) {
 	var result int
@@ -651,48 +776,39 @@ func (h Auth) UpdateUserRole() http.Handler {
 			return
 		}
 
-		// Validate role is one of the allowed roles
-		allowedRoles := []string{"USER", "ANALYZER", "MONITOR", "TEAM_LEADER"}
-		validRole := false
-		for _, role := range allowedRoles {
-			if req.Role == role {
-				validRole = true
-				break
-			}
-		}
-		if !validRole {
+		if req.Role == "" {
 			writeError(w, http.StatusBadRequest, "invalid_role", "invalid role specified")
 			return
 		}
 
 		user, err := h.S.UpdateUserRole(r.Context(), userID, req.Role, adminUser.Username)
 		if err != nil {
+			if errors.Is(err, auth.ErrInvalidRole) {
+				writeError(w, http.StatusBadRequest, "invalid_role", "invalid role specified")
+				return
+			}
 			if err.Error() == "user not found" {
 				writeError(w, http.StatusNotFound, "user_not_found", "user not found")
 				return
 			}
-			if err.Error() == "cannot modify ADMIN user role" {
+			if errors.Is(err, auth.ErrAdminRoleChange) {
 				writeError(w, http.StatusBadRequest, "invalid_operation", "cannot modify ADMIN user role")
 				return
 			}
-			if err.Error() == "cannot assign ADMIN role" {
+			if errors.Is(err, auth.ErrAdminAssign) {
 				writeError(w, http.StatusBadRequest, "invalid_operation", "cannot assign ADMIN role")
 				return
 			}
+			if errors.Is(err, auth.ErrRoleNotDelegable) {
+				writeError(w, http.StatusBadRequest, "invalid_role", err.Error())
+				return
+			}
 			h.Log.Error("update user role failed", "err", err)
 			writeError(w, http.StatusInternalServerError, "server_error", "could not update user role")
 			return
 		}
 
-		resp := UserResp{
-			ID:          user.ID,
-			Username:    user.Username,
-			Email:       user.Email,
-			CreatedBy:   user.CreatedBy,
-			CreatedTime: user.CreatedTime,
-			UpdatedTime: user.UpdatedTime,
-			Role:        user.Role,
-		}
+		resp := toUserResp(user)
 		writeJSON(w, http.StatusOK, resp)
 	})
 }
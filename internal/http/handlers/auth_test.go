@@ -1,11 +1,22 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
 	"os"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -13,9 +24,15 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
+	"go-demo/internal/audit"
 	"go-demo/internal/auth"
+	"go-demo/internal/authctx"
 	"go-demo/internal/config"
 	"go-demo/internal/db"
+	"go-demo/internal/mail"
+	"go-demo/internal/oidc"
+	"go-demo/internal/oidc/oidctest"
+	"go-demo/internal/ratelimit"
 )
 
 type AuthTestSuite struct {
@@ -33,6 +50,7 @@ func (suite *AuthTestSuite) SetupSuite() {
 		JWTSecret:    "test-jwt-secret-key-for-testing-only",
 		JWTTTL:       15 * time.Minute,
 		RefreshTTL:   24 * time.Hour,
+		InviteTTL:    24 * time.Hour,
 		MaxBodyBytes: 1024 * 1024,
 	}
 
@@ -57,6 +75,7 @@ func (suite *AuthTestSuite) SetupSuite() {
 	mux := http.NewServeMux()
 	mux.Handle("POST /v1/auth/register", authHandler.Register())
 	mux.Handle("POST /v1/auth/login", authHandler.Login())
+	mux.Handle("POST /v1/auth/login/2fa", authHandler.LoginTwoFactor())
 	mux.Handle("POST /v1/auth/refresh", authHandler.Refresh())
 
 	suite.server = httptest.NewServer(mux)
@@ -99,7 +118,16 @@ func (suite *AuthTestSuite) seedTestRoles() {
 func (suite *AuthTestSuite) cleanupTestData() {
 	// Clean up in reverse order of dependencies
 	tables := []string{
+		"DEMO.USER_IDENTITY",
+		"DEMO.API_KEY",
+		"DEMO.RECOVERY_CODE",
+		"DEMO.PASSWORD_HISTORY",
+		"DEMO.USER_TOKEN",
+		"DEMO.REVOKED_TOKEN",
 		"DEMO.REFRESH_TOKEN",
+		"DEMO.INVITATION",
+		"DEMO.TEAM_MEMBER",
+		"DEMO.TEAM",
 		"DEMO.USER",
 	}
 
@@ -109,6 +137,15 @@ func (suite *AuthTestSuite) cleanupTestData() {
 			suite.T().Logf("Warning: could not clean table %s: %v", table, err)
 		}
 	}
+	// Custom roles created by tests
+	if err := suite.dbx.Gorm.Where("code NOT IN ?", []string{"ADMIN", "USER", "ANALYZER", "MONITOR", "TEAM_LEADER"}).
+		Delete(&db.Role{}).Error; err != nil {
+		suite.T().Logf("Warning: could not clean roles: %v", err)
+	}
+	// The audit log rejects DELETE; TRUNCATE bypasses its row trigger.
+	if err := suite.dbx.Gorm.Exec(`TRUNCATE "DEMO"."AUDIT_EVENT"`).Error; err != nil {
+		suite.T().Logf("Warning: could not clean audit events: %v", err)
+	}
 }
 
 func getTestDatabaseURL() string {
@@ -231,6 +268,53 @@ func (suite *AuthTestSuite) TestLogin_InvalidCredentials() {
 		Value("code").String().IsEqual("invalid_credentials")
 }
 
+func (suite *AuthTestSuite) TestLogin_SuspendedUser() {
+	user := suite.createTestUser("test@example.com", "testuser", "USER")
+	_, err := suite.authSvc.UpdateUserStatus(context.Background(), user.ID, false, "test-admin")
+	require.NoError(suite.T(), err)
+
+	payload := map[string]interface{}{
+		"identifier": "test@example.com",
+		"password":   "password123",
+	}
+
+	suite.e.POST("/v1/auth/login").
+		WithJSON(payload).
+		Expect().
+		Status(http.StatusForbidden).
+		JSON().Object().
+		Value("code").String().IsEqual("account_inactive")
+
+	// Restoring only applies to deleted users; reactivation lets the user back in.
+	_, err = suite.authSvc.RestoreUser(context.Background(), user.ID, "test-admin")
+	require.ErrorIs(suite.T(), err, auth.ErrUserNotDeleted)
+	_, err = suite.authSvc.UpdateUserStatus(context.Background(), user.ID, true, "test-admin")
+	require.NoError(suite.T(), err)
+
+	suite.e.POST("/v1/auth/login").
+		WithJSON(payload).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().
+		Value("user").Object().Value("status").String().IsEqual("active")
+}
+
+func (suite *AuthTestSuite) TestDeleteAndRestoreUser() {
+	user := suite.createTestUser("test@example.com", "testuser", "USER")
+	require.NoError(suite.T(), suite.authSvc.DeleteUser(context.Background(), user.ID, "test-admin"))
+
+	suite.e.POST("/v1/auth/login").
+		WithJSON(map[string]interface{}{"identifier": "testuser", "password": "password123"}).
+		Expect().
+		Status(http.StatusForbidden)
+
+	restored, err := suite.authSvc.RestoreUser(context.Background(), user.ID, "test-admin")
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), db.UserStatusActive, restored.Status)
+	require.Equal(suite.T(), "testuser", restored.Username)
+	require.Nil(suite.T(), restored.DeletedAt)
+}
+
 func (suite *AuthTestSuite) TestLogin_InvalidJSON() {
 	suite.e.POST("/v1/auth/login").
 		WithText("invalid json").
@@ -306,8 +390,11 @@ func (suite *AuthTestSuite) createTestUser(email, username, role string) *db.Use
 	user, err := suite.authSvc.Register(context.Background(), username, email, "password123", "test-admin")
 	require.NoError(suite.T(), err)
 
-	// Update role if different from default
-	if role != "USER" {
+	// Update role if different from default. ADMIN cannot be granted through
+	// the service, so it is written directly.
+	if role == "ADMIN" {
+		require.NoError(suite.T(), suite.dbx.Gorm.Model(user).Update("role", role).Error)
+	} else if role != "USER" {
 		user, err = suite.authSvc.UpdateUserRole(context.Background(), user.ID, role, "test-admin")
 		require.NoError(suite.T(), err)
 	}
@@ -436,6 +523,113 @@ func (suite *AuthTestSuite) TestListUsers_WithPagination() {
 	resp.Value("offset").Number().IsEqual(0)
 }
 
+func (suite *AuthTestSuite) TestListUsers_SearchFilterSort() {
+	api := suite.usersAPI()
+	adminToken := suite.createAdminUserAndGetToken()
+	suite.createTestUser("zoe@example.com", "zoe_analyst", "ANALYZER")
+	suite.createTestUser("bob@example.com", "bob_analyst", "ANALYZER")
+	suspended := suite.createTestUser("carl@example.com", "carl", "USER")
+	_, err := suite.authSvc.UpdateUserStatus(context.Background(), suspended.ID, false, "test-admin")
+	require.NoError(suite.T(), err)
+
+	resp := api.GET("/v1/admin/users").
+		WithHeader("Authorization", "Bearer "+adminToken).
+		WithQuery("q", "_ANALYST").
+		WithQuery("role", "ANALYZER").
+		WithQuery("sort", "username").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object()
+	resp.Value("total").Number().IsEqual(2)
+	users := resp.Value("users").Array()
+	users.Value(0).Object().Value("username").String().IsEqual("bob_analyst")
+	users.Value(1).Object().Value("username").String().IsEqual("zoe_analyst")
+
+	// "_" is matched literally, not as a LIKE wildcard.
+	api.GET("/v1/admin/users").
+		WithHeader("Authorization", "Bearer "+adminToken).
+		WithQuery("q", "b_b").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("total").Number().IsEqual(0)
+
+	api.GET("/v1/admin/users").
+		WithHeader("Authorization", "Bearer "+adminToken).
+		WithQuery("status", "suspended").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("users").Array().Value(0).Object().Value("id").String().IsEqual(suspended.ID)
+
+	api.GET("/v1/admin/users").
+		WithHeader("Authorization", "Bearer "+adminToken).
+		WithQuery("sort", "password_hash").
+		Expect().
+		Status(http.StatusBadRequest)
+	api.GET("/v1/admin/users").
+		WithHeader("Authorization", "Bearer "+adminToken).
+		WithQuery("status", "bogus").
+		Expect().
+		Status(http.StatusBadRequest)
+}
+
+func (suite *AuthTestSuite) TestBulkUsers() {
+	api := suite.usersAPI()
+	adminToken := suite.createAdminUserAndGetToken()
+	u1 := suite.createTestUser("bulk1@example.com", "bulk1", "USER")
+	u2 := suite.createTestUser("bulk2@example.com", "bulk2", "USER")
+	missing := "0b6f8e9a-1c2d-4e3f-8a9b-0c1d2e3f4a5b"
+
+	resp := api.POST("/v1/admin/users/bulk").
+		WithHeader("Authorization", "Bearer "+adminToken).
+		WithJSON(map[string]interface{}{
+			"action": "change_role",
+			"role":   "MONITOR",
+			"ids":    []string{u1.ID, u2.ID, u1.ID, missing, "not-a-uuid"},
+		}).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object()
+	resp.Value("succeeded").Number().IsEqual(2)
+	resp.Value("failed").Number().IsEqual(2)
+	results := resp.Value("results").Array()
+	results.Length().IsEqual(4)
+	results.Value(0).Object().Value("ok").Boolean().IsTrue()
+	results.Value(2).Object().Value("error").Object().Value("code").String().IsEqual("user_not_found")
+	results.Value(3).Object().Value("error").Object().Value("code").String().IsEqual("invalid_id")
+
+	got, err := suite.authSvc.GetUserByID(context.Background(), u2.ID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), "MONITOR", got.Role)
+
+	api.POST("/v1/admin/users/bulk").
+		WithHeader("Authorization", "Bearer "+adminToken).
+		WithJSON(map[string]interface{}{"action": "delete", "ids": []string{u1.ID}}).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("succeeded").Number().IsEqual(1)
+	resp = api.POST("/v1/admin/users/bulk").
+		WithHeader("Authorization", "Bearer "+adminToken).
+		WithJSON(map[string]interface{}{"action": "deactivate", "ids": []string{u1.ID, u2.ID}}).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object()
+	resp.Value("results").Array().Value(0).Object().Value("error").Object().Value("code").String().IsEqual("user_deleted")
+	resp.Value("results").Array().Value(1).Object().Value("ok").Boolean().IsTrue()
+
+	resp = api.POST("/v1/admin/users/bulk").
+		WithHeader("Authorization", "Bearer "+adminToken).
+		WithJSON(map[string]interface{}{"action": "change_role", "role": "ADMIN", "ids": []string{u2.ID}}).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object()
+	resp.Value("results").Array().Value(0).Object().Value("error").Object().Value("code").String().IsEqual("invalid_role")
+	api.POST("/v1/admin/users/bulk").
+		WithHeader("Authorization", "Bearer "+adminToken).
+		WithJSON(map[string]interface{}{"action": "purge", "ids": []string{u2.ID}}).
+		Expect().
+		Status(http.StatusBadRequest)
+}
+
 func (suite *AuthTestSuite) TestUpdateUserStatus_Success() {
 	adminToken := suite.createAdminUserAndGetToken()
 
@@ -570,14 +764,14 @@ func (suite *AuthTestSuite) createAdminUserAndGetToken() string {
 	// Login to get token
 	loginResp := suite.e.POST("/v1/auth/login").
 		WithJSON(map[string]interface{}{
-			"email":    "admin@example.com",
-			"password": "password123",
+			"identifier": "admin@example.com",
+			"password":   "password123",
 		}).
 		Expect().
 		Status(http.StatusOK).
 		JSON().Object()
 
-	return loginResp.Value("access_token").String().Raw()
+	return loginResp.Value("token").String().Raw()
 }
 
 func (suite *AuthTestSuite) createUserAndGetToken(email, username string) string {
@@ -587,16 +781,1083 @@ func (suite *AuthTestSuite) createUserAndGetToken(email, username string) string
 	// Login to get token
 	loginResp := suite.e.POST("/v1/auth/login").
 		WithJSON(map[string]interface{}{
-			"email":    email,
-			"password": "password123",
+			"identifier": email,
+			"password":   "password123",
 		}).
 		Expect().
 		Status(http.StatusOK).
 		JSON().Object()
 
-	return loginResp.Value("access_token").String().Raw()
+	return loginResp.Value("token").String().Raw()
+}
+
+// usersAPI serves the user management endpoints behind the same
+// authentication and users:manage check as the router.
+func (suite *AuthTestSuite) usersAPI() *httpexpect.Expect {
+	require.NoError(suite.T(), suite.dbx.SeedDefaultPermissions(context.Background()))
+	h := NewAuth(suite.authSvc, slog.Default(), 1024*1024)
+	users := func(next http.Handler) http.Handler {
+		return RequireAuth(suite.authSvc)(RequirePermission(db.PermUsersManage)(next))
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /v1/admin/users", users(h.ListUsers()))
+	mux.Handle("POST /v1/admin/users/bulk", users(h.BulkUsers()))
+	mux.Handle("POST /v1/admin/users/import", users(h.ImportUsers()))
+	mux.Handle("GET /v1/admin/users/export.csv", users(h.ExportUsersCSV()))
+	srv := httptest.NewServer(mux)
+	suite.T().Cleanup(srv.Close)
+	return httpexpect.Default(suite.T(), srv.URL)
 }
 
 func TestAuthTestSuite(t *testing.T) {
 	suite.Run(t, new(AuthTestSuite))
 }
+
+func (suite *AuthTestSuite) TestLogoutRevokesTokens() {
+	ctx := context.Background()
+	suite.createTestUser("test@example.com", "testuser", "USER")
+
+	u, access, accessExp, refresh, _, err := suite.authSvc.Login(ctx, "testuser", "password123")
+	require.NoError(suite.T(), err)
+	_, claims, err := suite.authSvc.Authenticate(ctx, access)
+	require.NoError(suite.T(), err)
+
+	require.NoError(suite.T(), suite.authSvc.Logout(ctx, u.ID, claims.ID, accessExp, claims.SessionID, refresh))
+	_, _, err = suite.authSvc.Authenticate(ctx, access)
+	require.ErrorIs(suite.T(), err, auth.ErrTokenRevoked)
+	_, _, _, _, _, err = suite.authSvc.Refresh(ctx, refresh)
+	require.ErrorIs(suite.T(), err, auth.ErrInvalidCredentials)
+
+	// Logging out everywhere invalidates tokens from other sessions too.
+	_, access, _, refresh, _, err = suite.authSvc.Login(ctx, "testuser", "password123")
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), suite.authSvc.RevokeAllSessions(ctx, u.ID))
+	_, _, err = suite.authSvc.Authenticate(ctx, access)
+	require.ErrorIs(suite.T(), err, auth.ErrTokenRevoked)
+	_, _, _, _, _, err = suite.authSvc.Refresh(ctx, refresh)
+	require.ErrorIs(suite.T(), err, auth.ErrInvalidCredentials)
+}
+
+func (suite *AuthTestSuite) TestRefresh_ReuseRevokesFamily() {
+	ctx := context.Background()
+	suite.createTestUser("test@example.com", "testuser", "USER")
+
+	_, _, _, first, _, err := suite.authSvc.Login(ctx, "testuser", "password123")
+	require.NoError(suite.T(), err)
+	_, _, _, second, _, err := suite.authSvc.Refresh(ctx, first)
+	require.NoError(suite.T(), err)
+
+	// Replaying the rotated token fails and takes its successor down with it.
+	suite.e.POST("/v1/auth/refresh").
+		WithJSON(map[string]interface{}{"refresh_token": first}).
+		Expect().
+		Status(http.StatusUnauthorized)
+	suite.e.POST("/v1/auth/refresh").
+		WithJSON(map[string]interface{}{"refresh_token": second}).
+		Expect().
+		Status(http.StatusUnauthorized)
+}
+
+func (suite *AuthTestSuite) TestSessions_ListAndRevoke() {
+	ctx := authctx.WithClient(context.Background(), authctx.Client{
+		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:128.0) Gecko/20100101 Firefox/128.0",
+		IP:        "192.0.2.10",
+	})
+	u := suite.createTestUser("test@example.com", "testuser", "USER")
+
+	_, access, _, _, _, err := suite.authSvc.Login(ctx, "testuser", "password123")
+	require.NoError(suite.T(), err)
+	_, _, _, _, _, err = suite.authSvc.Login(context.Background(), "testuser", "password123")
+	require.NoError(suite.T(), err)
+
+	sessions, err := suite.authSvc.ListSessions(ctx, u.ID)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), sessions, 2)
+
+	_, claims, err := suite.authSvc.Authenticate(ctx, access)
+	require.NoError(suite.T(), err)
+	var firefox *auth.Session
+	for i := range sessions {
+		if sessions[i].ID == claims.SessionID {
+			firefox = &sessions[i]
+		}
+	}
+	require.NotNil(suite.T(), firefox)
+	require.Equal(suite.T(), "Firefox on Windows", firefox.Label)
+	require.Equal(suite.T(), "192.0.2.10", firefox.IP)
+
+	// Revoking the session also ends the access tokens issued within it.
+	require.NoError(suite.T(), suite.authSvc.RevokeSession(ctx, u.ID, claims.SessionID))
+	_, _, err = suite.authSvc.Authenticate(ctx, access)
+	require.ErrorIs(suite.T(), err, auth.ErrTokenRevoked)
+	require.ErrorIs(suite.T(), suite.authSvc.RevokeSession(ctx, u.ID, claims.SessionID), auth.ErrSessionNotFound)
+}
+
+// captureMailer records sent messages instead of delivering them.
+type captureMailer struct {
+	mu   sync.Mutex
+	msgs []mail.Message
+}
+
+func (m *captureMailer) Send(_ context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.msgs = append(m.msgs, msg)
+	return nil
+}
+
+// sent returns the number of messages sent so far.
+func (m *captureMailer) sent() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.msgs)
+}
+
+// lastToken extracts the token query parameter from the last message's link.
+func (m *captureMailer) lastToken() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.msgs) == 0 {
+		return ""
+	}
+	match := regexp.MustCompile(`token=([0-9a-f]+)`).FindStringSubmatch(m.msgs[len(m.msgs)-1].Body)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+func (suite *AuthTestSuite) TestPasswordResetAndEmailVerification() {
+	ctx := context.Background()
+	mailer := &captureMailer{}
+	suite.authSvc.SetMailer(mailer)
+	defer suite.authSvc.SetMailer(mail.NewLogMailer(slog.Default()))
+
+	u := suite.createTestUser("test@example.com", "testuser", "USER")
+	require.Nil(suite.T(), u.EmailVerifiedAt)
+
+	verifyToken := mailer.lastToken()
+	require.NotEmpty(suite.T(), verifyToken)
+	verified, err := suite.authSvc.VerifyEmail(ctx, verifyToken)
+	require.NoError(suite.T(), err)
+	require.NotNil(suite.T(), verified.EmailVerifiedAt)
+	_, err = suite.authSvc.VerifyEmail(ctx, verifyToken)
+	require.ErrorIs(suite.T(), err, auth.ErrInvalidUserToken)
+
+	// Unknown addresses are accepted silently and send nothing. Known ones
+	// are mailed in the background.
+	sent := mailer.sent()
+	require.NoError(suite.T(), suite.authSvc.RequestPasswordReset(ctx, "nobody@example.com"))
+	require.NoError(suite.T(), suite.authSvc.RequestPasswordReset(ctx, "test@example.com"))
+	require.Eventually(suite.T(), func() bool { return mailer.sent() == sent+1 }, 5*time.Second, 10*time.Millisecond)
+	resetToken := mailer.lastToken()
+	require.NotEmpty(suite.T(), resetToken)
+	require.NoError(suite.T(), suite.authSvc.ResetPassword(ctx, resetToken, "new-password-456"))
+	require.ErrorIs(suite.T(), suite.authSvc.ResetPassword(ctx, resetToken, "another-789"), auth.ErrInvalidUserToken)
+
+	_, _, _, _, _, err = suite.authSvc.Login(ctx, "testuser", "password123")
+	require.ErrorIs(suite.T(), err, auth.ErrInvalidCredentials)
+	_, _, _, _, _, err = suite.authSvc.Login(ctx, "testuser", "new-password-456")
+	require.NoError(suite.T(), err)
+}
+
+func (suite *AuthTestSuite) TestChangePasswordAndUpdateProfile() {
+	ctx := context.Background()
+	mailer := &captureMailer{}
+	suite.authSvc.SetMailer(mailer)
+	defer suite.authSvc.SetMailer(mail.NewLogMailer(slog.Default()))
+	suite.createTestUser("other@example.com", "otheruser", "USER")
+	u := suite.createTestUser("test@example.com", "testuser", "USER")
+
+	_, access, _, _, _, err := suite.authSvc.Login(ctx, "testuser", "password123")
+	require.NoError(suite.T(), err)
+	_, otherAccess, _, otherRefresh, _, err := suite.authSvc.Login(ctx, "testuser", "password123")
+	require.NoError(suite.T(), err)
+	_, claims, err := suite.authSvc.Authenticate(ctx, access)
+	require.NoError(suite.T(), err)
+	ctx = authctx.WithUser(ctx, u)
+
+	_, _, err = suite.authSvc.ChangePassword(ctx, u.ID, claims.SessionID, "wrong", "new-password-456")
+	require.ErrorIs(suite.T(), err, auth.ErrWrongPassword)
+
+	// The current session continues with the new token; the other one is signed out.
+	fresh, _, err := suite.authSvc.ChangePassword(ctx, u.ID, claims.SessionID, "password123", "new-password-456")
+	require.NoError(suite.T(), err)
+	_, _, err = suite.authSvc.Authenticate(ctx, fresh)
+	require.NoError(suite.T(), err)
+	_, _, err = suite.authSvc.Authenticate(ctx, otherAccess)
+	require.ErrorIs(suite.T(), err, auth.ErrTokenRevoked)
+	_, _, _, _, _, err = suite.authSvc.Refresh(ctx, otherRefresh)
+	require.ErrorIs(suite.T(), err, auth.ErrInvalidCredentials)
+
+	taken := "otheruser"
+	_, err = suite.authSvc.UpdateProfile(ctx, u.ID, &taken, nil)
+	require.ErrorIs(suite.T(), err, auth.ErrUserExists)
+	takenEmail := "Other@Example.com"
+	_, err = suite.authSvc.UpdateProfile(ctx, u.ID, nil, &takenEmail)
+	require.ErrorIs(suite.T(), err, auth.ErrUserExists)
+	for _, bad := range []string{"has space", "a@b", strings.Repeat("x", 65)} {
+		_, err = suite.authSvc.UpdateProfile(ctx, u.ID, &bad, nil)
+		require.ErrorIs(suite.T(), err, auth.ErrInvalidProfile, bad)
+	}
+
+	name, email := "renamed", "renamed@example.com"
+	updated, err := suite.authSvc.UpdateProfile(ctx, u.ID, &name, &email)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), "renamed", updated.Username)
+	require.Equal(suite.T(), "renamed@example.com", updated.Email)
+	require.Nil(suite.T(), updated.EmailVerifiedAt)
+	require.Equal(suite.T(), "testuser", updated.UpdatedBy)
+	require.Equal(suite.T(), "renamed@example.com", mailer.msgs[len(mailer.msgs)-1].To)
+}
+
+func (suite *AuthTestSuite) TestLogin_LockoutAndRateLimit() {
+	ctx := context.Background()
+	u := suite.createTestUser("test@example.com", "testuser", "USER")
+
+	svc := auth.NewService(suite.dbx, config.Config{
+		JWTSecret:            "test-jwt-secret-key-for-testing-only",
+		JWTTTL:               15 * time.Minute,
+		RefreshTTL:           24 * time.Hour,
+		LoginMaxFailures:     3,
+		LoginLockoutDuration: time.Minute,
+		LoginLockoutMax:      time.Hour,
+	}, slog.Default())
+
+	for i := 0; i < 3; i++ {
+		_, _, _, _, _, err := svc.Login(ctx, "testuser", "wrong")
+		require.ErrorIs(suite.T(), err, auth.ErrInvalidCredentials)
+	}
+	// Even the right password is refused while the lock lasts.
+	_, _, _, _, _, err := svc.Login(ctx, "testuser", "password123")
+	require.ErrorIs(suite.T(), err, auth.ErrAccountLocked)
+
+	lockouts, err := svc.ListLockouts(ctx)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), lockouts, 1)
+	require.Equal(suite.T(), 3, lockouts[0].FailedLoginCount)
+
+	// Unknown identifiers lock the same way, so a lock reveals nothing.
+	for i := 0; i < 3; i++ {
+		_, _, _, _, _, err = svc.Login(ctx, "nobody", "wrong")
+		require.ErrorIs(suite.T(), err, auth.ErrInvalidCredentials)
+	}
+	_, _, _, _, _, err = svc.Login(ctx, "nobody", "wrong")
+	require.ErrorIs(suite.T(), err, auth.ErrAccountLocked)
+
+	require.NoError(suite.T(), svc.ClearLockout(ctx, u.ID, "admin"))
+	_, _, _, _, _, err = svc.Login(ctx, "testuser", "password123")
+	require.NoError(suite.T(), err)
+
+	// Guessing the current password on a password change locks as well.
+	for i := 0; i < 3; i++ {
+		_, _, err = svc.ChangePassword(ctx, u.ID, "", "wrong", "new-password-456")
+		require.ErrorIs(suite.T(), err, auth.ErrWrongPassword)
+	}
+	var locked *auth.LockedError
+	_, _, err = svc.ChangePassword(ctx, u.ID, "", "password123", "new-password-456")
+	require.ErrorAs(suite.T(), err, &locked)
+	require.NoError(suite.T(), svc.ClearLockout(ctx, u.ID, "admin"))
+
+	// The HTTP layer limits attempts per identifier.
+	h := NewAuth(svc, slog.Default(), 1024)
+	h.LoginIdentifierLimiter = ratelimit.New(1, time.Minute)
+	server := httptest.NewServer(h.Login())
+	defer server.Close()
+	e := httpexpect.Default(suite.T(), server.URL)
+	e.POST("/").WithJSON(map[string]interface{}{"identifier": "testuser", "password": "wrong"}).
+		Expect().Status(http.StatusUnauthorized)
+	e.POST("/").WithJSON(map[string]interface{}{"identifier": "TestUser", "password": "password123"}).
+		Expect().Status(http.StatusTooManyRequests).
+		Header("Retry-After").NotEmpty()
+
+	// Endpoints that mail an address count against the same limits.
+	mux := http.NewServeMux()
+	mux.Handle("POST /forgot", h.ForgotPassword())
+	mux.Handle("POST /resend", h.ResendVerification())
+	mailServer := httptest.NewServer(mux)
+	defer mailServer.Close()
+	e = httpexpect.Default(suite.T(), mailServer.URL)
+	e.POST("/forgot").WithJSON(map[string]interface{}{"email": "test@example.com"}).
+		Expect().Status(http.StatusAccepted)
+	e.POST("/resend").WithJSON(map[string]interface{}{"email": "TEST@example.com"}).
+		Expect().Status(http.StatusTooManyRequests)
+}
+
+func (suite *AuthTestSuite) TestChangePassword_RejectsReuse() {
+	ctx := context.Background()
+	u := suite.createTestUser("test@example.com", "testuser", "USER")
+
+	svc := auth.NewService(suite.dbx, config.Config{
+		JWTSecret:         "test-jwt-secret-key-for-testing-only",
+		JWTTTL:            15 * time.Minute,
+		RefreshTTL:        24 * time.Hour,
+		PasswordMinLength: 8,
+		PasswordHistory:   2,
+	}, slog.Default())
+
+	_, err := svc.Register(ctx, "shorty", "shorty@example.com", "abc", "self")
+	var pe *auth.PolicyError
+	require.ErrorAs(suite.T(), err, &pe)
+	require.Equal(suite.T(), auth.PasswordTooShort, pe.Code)
+
+	_, _, err = svc.ChangePassword(ctx, u.ID, "", "password123", "password123")
+	require.ErrorAs(suite.T(), err, &pe)
+	require.Equal(suite.T(), auth.PasswordReused, pe.Code)
+
+	_, _, err = svc.ChangePassword(ctx, u.ID, "", "password123", "second-pass-1")
+	require.NoError(suite.T(), err)
+	_, _, err = svc.ChangePassword(ctx, u.ID, "", "second-pass-1", "third-pass-2")
+	require.NoError(suite.T(), err)
+	_, _, err = svc.ChangePassword(ctx, u.ID, "", "third-pass-2", "second-pass-1")
+	require.ErrorIs(suite.T(), err, auth.ErrWeakPassword)
+}
+
+// totpNow computes the current 6-digit TOTP code for a base32 secret.
+func totpNow(secret string, offset time.Duration) string {
+	key, _ := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(time.Now().Add(offset).Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[off:off+4])&0x7fffffff)%1000000)
+}
+
+func (suite *AuthTestSuite) TestTwoFactorLogin() {
+	ctx := context.Background()
+	u := suite.createTestUser("test@example.com", "testuser", "USER")
+
+	secret, uri, err := suite.authSvc.SetupTOTP(ctx, u.ID)
+	require.NoError(suite.T(), err)
+	require.Contains(suite.T(), uri, "secret="+secret)
+	_, err = suite.authSvc.EnableTOTP(ctx, u.ID, "000000")
+	require.ErrorIs(suite.T(), err, auth.ErrInvalidOTP)
+	codes, err := suite.authSvc.EnableTOTP(ctx, u.ID, totpNow(secret, -30*time.Second))
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), codes, 10)
+
+	// The password alone only yields a challenge.
+	challenge := suite.e.POST("/v1/auth/login").
+		WithJSON(map[string]interface{}{"identifier": "testuser", "password": "password123"}).
+		Expect().
+		Status(http.StatusAccepted).
+		JSON().Object().Value("challenge_token").String().Raw()
+
+	suite.e.POST("/v1/auth/login/2fa").
+		WithJSON(map[string]interface{}{"challenge_token": challenge, "code": "000000"}).
+		Expect().
+		Status(http.StatusUnauthorized)
+	suite.e.POST("/v1/auth/login/2fa").
+		WithJSON(map[string]interface{}{"challenge_token": challenge, "code": totpNow(secret, 0)}).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("user").Object().Value("two_factor_enabled").Boolean().IsTrue()
+
+	// Challenges are single-use; recovery codes work once.
+	suite.e.POST("/v1/auth/login/2fa").
+		WithJSON(map[string]interface{}{"challenge_token": challenge, "code": codes[0]}).
+		Expect().
+		Status(http.StatusUnauthorized)
+	_, _, _, _, _, err = suite.authSvc.Login(ctx, "testuser", "password123")
+	var ch *auth.SecondFactorChallenge
+	require.ErrorAs(suite.T(), err, &ch)
+	_, _, _, _, _, err = suite.authSvc.CompleteLogin(ctx, ch.Token, codes[0])
+	require.NoError(suite.T(), err)
+	_, _, _, _, _, err = suite.authSvc.Login(ctx, "testuser", "password123")
+	require.ErrorAs(suite.T(), err, &ch)
+	_, _, _, _, _, err = suite.authSvc.CompleteLogin(ctx, ch.Token, codes[0])
+	require.ErrorIs(suite.T(), err, auth.ErrInvalidOTP)
+}
+
+func (suite *AuthTestSuite) TestTwoFactor_WrongCodesLock() {
+	ctx := context.Background()
+	u := suite.createTestUser("test@example.com", "testuser", "USER")
+	svc := auth.NewService(suite.dbx, config.Config{
+		JWTSecret:            "test-jwt-secret-key-for-testing-only",
+		JWTTTL:               15 * time.Minute,
+		RefreshTTL:           24 * time.Hour,
+		LoginMaxFailures:     3,
+		LoginLockoutDuration: time.Minute,
+		LoginLockoutMax:      time.Hour,
+	}, slog.Default())
+
+	secret, _, err := svc.SetupTOTP(ctx, u.ID)
+	require.NoError(suite.T(), err)
+	_, err = svc.EnableTOTP(ctx, u.ID, "000000")
+	require.ErrorIs(suite.T(), err, auth.ErrInvalidOTP)
+	codes, err := svc.EnableTOTP(ctx, u.ID, totpNow(secret, 0))
+	require.NoError(suite.T(), err)
+
+	// Guessing the code to switch 2FA off counts as failed logins; once the
+	// account is locked even a valid recovery code is refused.
+	for i := 0; i < 2; i++ {
+		require.ErrorIs(suite.T(), svc.DisableTOTP(ctx, u.ID, "000000"), auth.ErrInvalidOTP)
+	}
+	require.ErrorIs(suite.T(), svc.DisableTOTP(ctx, u.ID, codes[0]), auth.ErrAccountLocked)
+	_, _, _, _, _, err = svc.Login(ctx, "testuser", "password123")
+	require.ErrorIs(suite.T(), err, auth.ErrAccountLocked)
+
+	require.NoError(suite.T(), svc.ClearLockout(ctx, u.ID, "admin"))
+	require.NoError(suite.T(), svc.DisableTOTP(ctx, u.ID, codes[0]))
+}
+
+func (suite *AuthTestSuite) TestRoleRequiresTwoFactor() {
+	ctx := context.Background()
+	u := suite.createTestUser("test@example.com", "testuser", "USER")
+	require.NoError(suite.T(), suite.authSvc.SetRoleRequire2FA(ctx, "USER", true, "admin"))
+	defer suite.authSvc.SetRoleRequire2FA(ctx, "USER", false, "admin")
+
+	required, err := suite.authSvc.SecondFactorEnrollmentRequired(ctx, u)
+	require.NoError(suite.T(), err)
+	require.True(suite.T(), required)
+
+	_, access, _, _, _, err := suite.authSvc.Login(ctx, "testuser", "password123")
+	require.NoError(suite.T(), err)
+	handler := RequireAuth(suite.authSvc)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+access)
+	handler.ServeHTTP(rec, req)
+	require.Equal(suite.T(), http.StatusForbidden, rec.Code)
+	require.Contains(suite.T(), rec.Body.String(), "2fa_enrollment_required")
+
+	secret, _, err := suite.authSvc.SetupTOTP(ctx, u.ID)
+	require.NoError(suite.T(), err)
+	_, err = suite.authSvc.EnableTOTP(ctx, u.ID, totpNow(secret, 0))
+	require.NoError(suite.T(), err)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(suite.T(), http.StatusNoContent, rec.Code)
+}
+
+func (suite *AuthTestSuite) TestRolePermissions() {
+	ctx := context.Background()
+	require.NoError(suite.T(), suite.dbx.SeedDefaultPermissions(ctx))
+	original, err := suite.authSvc.PermissionsForRole(ctx, "MONITOR")
+	require.NoError(suite.T(), err)
+	defer func() {
+		_, err := suite.authSvc.SetRolePermissions(ctx, "MONITOR", original, "test-admin")
+		require.NoError(suite.T(), err)
+	}()
+
+	_, err = suite.authSvc.SetRolePermissions(ctx, "MONITOR", []string{db.PermAuditRead, "no:such"}, "test-admin")
+	require.ErrorIs(suite.T(), err, auth.ErrUnknownPermission)
+	_, err = suite.authSvc.SetRolePermissions(ctx, "NOPE", []string{db.PermAuditRead}, "test-admin")
+	require.ErrorIs(suite.T(), err, auth.ErrRoleNotFound)
+	_, err = suite.authSvc.SetRolePermissions(ctx, "ADMIN", nil, "test-admin")
+	require.ErrorIs(suite.T(), err, auth.ErrAdminLockout)
+
+	h := NewAuth(suite.authSvc, slog.Default(), 1024*1024)
+	mux := http.NewServeMux()
+	mux.Handle("GET /v1/auth/me", RequireAuth(suite.authSvc)(h.Me()))
+	mux.Handle("GET /v1/admin/permissions", RequireAuth(suite.authSvc)(RequirePermission(db.PermRolesManage)(h.ListPermissions())))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	api := httpexpect.Default(suite.T(), srv.URL)
+
+	suite.createTestUser("monitor@example.com", "monitor", "MONITOR")
+	token := suite.e.POST("/v1/auth/login").
+		WithJSON(map[string]interface{}{"identifier": "monitor", "password": "password123"}).
+		Expect().
+		Status(http.StatusOK).
+		JSON().Object().Value("token").String().Raw()
+
+	_, err = suite.authSvc.SetRolePermissions(ctx, "MONITOR", []string{db.PermSQLLogRead}, "test-admin")
+	require.NoError(suite.T(), err)
+	api.GET("/v1/auth/me").WithHeader("Authorization", "Bearer "+token).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("permissions").Array().IsEqual([]string{db.PermSQLLogRead})
+	api.GET("/v1/admin/permissions").WithHeader("Authorization", "Bearer "+token).
+		Expect().Status(http.StatusForbidden).
+		JSON().Object().Value("error").Object().Value("code").String().IsEqual("forbidden")
+
+	// Changes apply to existing tokens on the next request.
+	_, err = suite.authSvc.SetRolePermissions(ctx, "MONITOR", []string{db.PermSQLLogRead, db.PermRolesManage, db.PermRolesManage}, "test-admin")
+	require.NoError(suite.T(), err)
+	api.GET("/v1/auth/me").WithHeader("Authorization", "Bearer "+token).
+		Expect().Status(http.StatusOK).
+		JSON().Object().Value("permissions").Array().IsEqual([]string{db.PermRolesManage, db.PermSQLLogRead})
+	api.GET("/v1/admin/permissions").WithHeader("Authorization", "Bearer "+token).
+		Expect().Status(http.StatusOK)
+}
+
+func (suite *AuthTestSuite) TestTeamMembership() {
+	ctx := context.Background()
+	admin := suite.createTestUser("admin@example.com", "admin", "ADMIN")
+	lead := suite.createTestUser("lead@example.com", "lead", "TEAM_LEADER")
+	colead := suite.createTestUser("colead@example.com", "colead", "TEAM_LEADER")
+	alice := suite.createTestUser("alice@example.com", "alice", "USER")
+	bob := suite.createTestUser("bob@example.com", "bob", "USER")
+	team, err := suite.authSvc.CreateTeam(ctx, "Payments", "", "test-admin")
+	require.NoError(suite.T(), err)
+	_, err = suite.authSvc.CreateTeam(ctx, "Payments", "", "test-admin")
+	require.ErrorIs(suite.T(), err, auth.ErrTeamExists)
+
+	// Only managers appoint leaders.
+	require.ErrorIs(suite.T(), suite.authSvc.SetTeamMember(ctx, team.ID, alice.ID, false, lead, false), auth.ErrNotTeamLeader)
+	require.NoError(suite.T(), suite.authSvc.SetTeamMember(ctx, team.ID, lead.ID, true, admin, true))
+	require.NoError(suite.T(), suite.authSvc.SetTeamMember(ctx, team.ID, colead.ID, true, admin, true))
+
+	// Leaders add and remove ordinary members but cannot touch other leaders.
+	require.NoError(suite.T(), suite.authSvc.SetTeamMember(ctx, team.ID, alice.ID, false, lead, false))
+	require.NoError(suite.T(), suite.authSvc.SetTeamMember(ctx, team.ID, bob.ID, false, lead, false))
+	require.ErrorIs(suite.T(), suite.authSvc.SetTeamMember(ctx, team.ID, alice.ID, true, lead, false), auth.ErrLeaderProtected)
+	require.ErrorIs(suite.T(), suite.authSvc.SetTeamMember(ctx, team.ID, colead.ID, false, lead, false), auth.ErrLeaderProtected)
+	require.ErrorIs(suite.T(), suite.authSvc.RemoveTeamMember(ctx, team.ID, colead.ID, lead, false), auth.ErrLeaderProtected)
+	require.ErrorIs(suite.T(), suite.authSvc.SetTeamMember(ctx, team.ID, "0b6f8e9a-1c2d-4e3f-8a9b-0c1d2e3f4a5b", false, lead, false), auth.ErrUserNotFound)
+	require.NoError(suite.T(), suite.authSvc.RemoveTeamMember(ctx, team.ID, bob.ID, lead, false))
+	require.ErrorIs(suite.T(), suite.authSvc.RemoveTeamMember(ctx, team.ID, bob.ID, lead, false), auth.ErrMemberNotFound)
+
+	// Members are not leaders.
+	require.ErrorIs(suite.T(), suite.authSvc.SetTeamMember(ctx, team.ID, bob.ID, false, alice, false), auth.ErrNotTeamLeader)
+	require.ErrorIs(suite.T(), suite.authSvc.RemoveTeamMember(ctx, team.ID, lead.ID, alice, false), auth.ErrNotTeamLeader)
+
+	// A leader may step down; managers may demote and remove leaders.
+	require.NoError(suite.T(), suite.authSvc.RemoveTeamMember(ctx, team.ID, lead.ID, lead, false))
+	require.NoError(suite.T(), suite.authSvc.SetTeamMember(ctx, team.ID, colead.ID, false, admin, true))
+	require.NoError(suite.T(), suite.authSvc.RemoveTeamMember(ctx, team.ID, colead.ID, admin, true))
+
+	members, err := suite.authSvc.ListTeamMembers(ctx, team.ID)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), members, 1)
+	require.Equal(suite.T(), "alice", members[0].Username)
+	require.False(suite.T(), members[0].IsLeader)
+
+	require.NoError(suite.T(), suite.authSvc.DeleteTeam(ctx, team.ID))
+	require.ErrorIs(suite.T(), suite.authSvc.DeleteTeam(ctx, team.ID), auth.ErrTeamNotFound)
+	_, err = suite.authSvc.ListTeamMembers(ctx, team.ID)
+	require.ErrorIs(suite.T(), err, auth.ErrTeamNotFound)
+}
+
+func (suite *AuthTestSuite) TestServiceAccountAPIKeys() {
+	ctx := context.Background()
+	require.NoError(suite.T(), suite.dbx.SeedDefaultPermissions(ctx))
+	sa, err := suite.authSvc.CreateServiceAccount(ctx, "ci-bot", "USER", "admin")
+	require.NoError(suite.T(), err)
+	require.True(suite.T(), sa.ServiceAccount)
+
+	// Service accounts have no password and cannot log in.
+	suite.e.POST("/v1/auth/login").
+		WithJSON(map[string]interface{}{"identifier": "ci-bot", "password": "password123"}).
+		Expect().
+		Status(http.StatusUnauthorized)
+
+	_, _, err = suite.authSvc.CreateAPIKey(ctx, sa.ID, "ci", []string{"no:such"}, nil, "admin")
+	require.ErrorIs(suite.T(), err, auth.ErrUnknownPermission)
+	plain, key, err := suite.authSvc.CreateAPIKey(ctx, sa.ID, "ci", []string{db.PermSQLLogRead}, nil, "admin")
+	require.NoError(suite.T(), err)
+	require.True(suite.T(), len(plain) > len(key.Prefix) && plain[:len(key.Prefix)] == key.Prefix)
+
+	var perms []string
+	handler := RequireAuth(suite.authSvc)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		perms = authctx.PermissionsFrom(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	call := func(apiKey string) int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-API-Key", apiKey)
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Scopes narrow the role's permissions.
+	require.Equal(suite.T(), http.StatusNoContent, call(plain))
+	require.Equal(suite.T(), []string{db.PermSQLLogRead}, perms)
+	keys, err := suite.authSvc.ListAPIKeys(ctx, sa.ID)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), keys, 1)
+	require.NotNil(suite.T(), keys[0].LastUsedAt)
+
+	rotated, _, err := suite.authSvc.RotateAPIKey(ctx, sa.ID, key.ID, "admin")
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), http.StatusUnauthorized, call(plain))
+	require.Equal(suite.T(), http.StatusNoContent, call(rotated))
+
+	require.NoError(suite.T(), suite.authSvc.RevokeAPIKey(ctx, sa.ID, key.ID, "admin"))
+	require.Equal(suite.T(), http.StatusUnauthorized, call(rotated))
+	require.ErrorIs(suite.T(), suite.authSvc.RevokeAPIKey(ctx, sa.ID, key.ID, "admin"), auth.ErrAPIKeyNotFound)
+
+	expired := time.Now().Add(-time.Minute)
+	old, _, err := suite.authSvc.CreateAPIKey(ctx, sa.ID, "old", nil, &expired, "admin")
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), http.StatusUnauthorized, call(old))
+}
+
+func (suite *AuthTestSuite) TestOIDCLogin() {
+	idp := oidctest.New("go-demo", "client-secret")
+	defer idp.Close()
+
+	mux := http.NewServeMux()
+	app := httptest.NewServer(mux)
+	defer app.Close()
+	oh := NewOIDC(suite.authSvc, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError})), oidc.NewProvider(oidc.Config{
+		Issuer:       idp.Issuer(),
+		ClientID:     "go-demo",
+		ClientSecret: "client-secret",
+		RedirectURL:  app.URL + "/v1/auth/oidc/callback",
+	}, nil))
+	oh.Roles = oidc.RoleMapping{Claim: "groups", Rules: []oidc.RoleRule{{Value: "analysts", Role: "ANALYZER"}}}
+	oh.StateKey = []byte("state-key")
+	mux.Handle("GET /v1/auth/oidc/login", oh.Login())
+	callback := oh.Callback()
+	mux.Handle("GET /v1/auth/oidc/callback", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callback.ServeHTTP(w, r)
+	}))
+
+	login := func() *httpexpect.Response {
+		jar, err := cookiejar.New(nil)
+		require.NoError(suite.T(), err)
+		e := httpexpect.WithConfig(httpexpect.Config{
+			BaseURL:  app.URL,
+			Reporter: httpexpect.NewRequireReporter(suite.T()),
+			Client:   &http.Client{Jar: jar},
+		})
+		return e.GET("/v1/auth/oidc/login").Expect()
+	}
+
+	// First login provisions a password-less user with the mapped role.
+	idp.SetClaims(map[string]interface{}{
+		"sub": "idp-user-1", "email": "alice@example.com", "email_verified": true,
+		"preferred_username": "alice", "groups": []string{"analysts"},
+	})
+	user := login().Status(http.StatusOK).JSON().Object().Value("user").Object()
+	user.Value("username").String().IsEqual("alice")
+	user.Value("role").String().IsEqual("ANALYZER")
+	user.Value("email_verified").Boolean().IsTrue()
+	userID := user.Value("id").String().Raw()
+
+	_, _, _, _, _, err := suite.authSvc.Login(context.Background(), "alice", "")
+	require.ErrorIs(suite.T(), err, auth.ErrInvalidCredentials)
+
+	// Later logins find the same user by subject, even with a new email, and
+	// reset the role to the default when no rule matches any more.
+	idp.SetClaims(map[string]interface{}{"sub": "idp-user-1", "email": "alice@new.example.com", "email_verified": true})
+	user = login().Status(http.StatusOK).JSON().Object().Value("user").Object()
+	user.Value("id").String().IsEqual(userID)
+	user.Value("role").String().IsEqual("USER")
+
+	// Without role mapping configured, existing roles are left alone.
+	unmapped := oh
+	unmapped.Roles = oidc.RoleMapping{}
+	callback = unmapped.Callback()
+	require.NoError(suite.T(), suite.dbx.Gorm.Model(&db.User{}).Where("id = ?", userID).Update("role", "ANALYZER").Error)
+	login().Status(http.StatusOK).JSON().Object().Value("user").Object().Value("role").String().IsEqual("ANALYZER")
+	callback = oh.Callback()
+
+	// Usernames are made unique; unverified emails of local accounts are not linked.
+	suite.createTestUser("bob@example.com", "bob", "USER")
+	idp.SetClaims(map[string]interface{}{"sub": "idp-user-2", "email": "bob@example.com", "preferred_username": "bob"})
+	login().Status(http.StatusConflict)
+	idp.SetClaims(map[string]interface{}{"sub": "idp-user-2", "email": "robert@example.com", "preferred_username": "bob"})
+	login().Status(http.StatusOK).JSON().Object().Value("user").Object().Value("username").String().IsEqual("bob-2")
+
+	// A callback without the state cookie is rejected.
+	suite.e.GET("/v1/auth/oidc/callback").WithQuery("code", "x").WithQuery("state", "y").
+		WithURL(app.URL).Expect().Status(http.StatusBadRequest)
+}
+
+func (suite *AuthTestSuite) TestOIDCLogin_InviteOnly() {
+	ctx := context.Background()
+	svc := auth.NewService(suite.dbx, config.Config{
+		JWTSecret:        "test-jwt-secret-key-for-testing-only",
+		JWTTTL:           15 * time.Minute,
+		RefreshTTL:       24 * time.Hour,
+		InviteTTL:        time.Hour,
+		RegistrationMode: auth.RegistrationInvite,
+	}, slog.Default())
+	admin := suite.createTestUser("admin@example.com", "admin", "ADMIN")
+	team, err := suite.authSvc.CreateTeam(ctx, "Payments", "", "test-admin")
+	require.NoError(suite.T(), err)
+	id := auth.ExternalIdentity{Issuer: "https://idp.example.com", Subject: "idp-user-1", Email: "alice@example.com", EmailVerified: true, Role: "MONITOR"}
+
+	_, _, _, _, _, err = svc.LoginExternal(ctx, id, "USER")
+	require.ErrorIs(suite.T(), err, auth.ErrRegistrationClosed)
+
+	inv, err := svc.CreateInvitation(ctx, auth.InviteRequest{Email: "alice@example.com", Role: "ANALYZER", TeamID: team.ID}, admin, true)
+	require.NoError(suite.T(), err)
+	// The provider has to vouch for the invited address.
+	id.EmailVerified = false
+	_, _, _, _, _, err = svc.LoginExternal(ctx, id, "USER")
+	require.ErrorIs(suite.T(), err, auth.ErrRegistrationClosed)
+
+	id.EmailVerified = true
+	u, _, _, _, _, err := svc.LoginExternal(ctx, id, "USER")
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), "ANALYZER", u.Role)
+	members, err := svc.ListTeamMembers(ctx, team.ID)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), members, 1)
+	accepted, err := svc.ListInvitations(ctx, db.InvitationAccepted, admin, true)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), accepted, 1)
+	require.Equal(suite.T(), inv.ID, accepted[0].ID)
+	require.Equal(suite.T(), u.ID, *accepted[0].UserID)
+
+	// Linked users keep signing in, now with the mapped role.
+	u, _, _, _, _, err = svc.LoginExternal(ctx, id, "USER")
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), "MONITOR", u.Role)
+}
+
+func (suite *AuthTestSuite) TestAuditLog() {
+	ctx := context.Background()
+	rec := suite.authSvc.Audit()
+	user := suite.createTestUser("audited@example.com", "audited", "USER")
+
+	suite.e.POST("/v1/auth/login").
+		WithJSON(map[string]interface{}{"identifier": "audited", "password": "wrong-password"}).
+		Expect().
+		Status(http.StatusUnauthorized)
+	suite.e.POST("/v1/auth/login").
+		WithJSON(map[string]interface{}{"identifier": "audited", "password": "password123"}).
+		Expect().
+		Status(http.StatusOK)
+
+	logins, total, err := rec.List(ctx, audit.Filter{Action: audit.ActionLogin, TargetID: user.ID}, 10, 0)
+	require.NoError(suite.T(), err)
+	require.EqualValues(suite.T(), 2, total)
+	require.Equal(suite.T(), audit.OutcomeSuccess, logins[0].Outcome)
+	require.Equal(suite.T(), user.ID, logins[0].ActorID)
+	require.Equal(suite.T(), audit.OutcomeFailure, logins[1].Outcome)
+	require.Equal(suite.T(), "invalid_credentials", logins[1].Details["reason"])
+	require.Empty(suite.T(), logins[1].ActorID)
+
+	// Admin actions carry the caller, client and request ID from the context.
+	admin := &db.User{ID: "7f8c3a1e-2b4d-4c6e-9f0a-1b2c3d4e5f60", Username: "root-admin"}
+	adminCtx := authctx.WithRequestID(authctx.WithClient(authctx.WithUser(ctx, admin), authctx.Client{IP: "192.0.2.7"}), "req-123")
+	_, err = suite.authSvc.UpdateUserRole(adminCtx, user.ID, "ANALYZER", admin.Username)
+	require.NoError(suite.T(), err)
+
+	changes, _, err := rec.List(ctx, audit.Filter{Action: audit.ActionUserRoleChange, RequestID: "req-123"}, 10, 0)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), changes, 1)
+	require.Equal(suite.T(), admin.ID, changes[0].ActorID)
+	require.Equal(suite.T(), "192.0.2.7", changes[0].IP)
+	require.Equal(suite.T(), "USER", changes[0].Before["role"])
+	require.Equal(suite.T(), "ANALYZER", changes[0].After["role"])
+
+	// Events cannot be altered.
+	require.Error(suite.T(), suite.dbx.Gorm.Model(&db.AuditEvent{}).Where("id = ?", changes[0].ID).Update("outcome", "failure").Error)
+	require.Error(suite.T(), suite.dbx.Gorm.Where("id = ?", changes[0].ID).Delete(&db.AuditEvent{}).Error)
+
+	list := NewAuditLog(rec, nil)
+	w := httptest.NewRecorder()
+	list.List().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/admin/audit?outcome=bogus", nil))
+	require.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	list.ExportCSV().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/admin/audit.csv?target_id="+user.ID, nil))
+	require.Equal(suite.T(), http.StatusOK, w.Code)
+	require.Contains(suite.T(), w.Body.String(), "id,time,action,outcome,")
+	require.Contains(suite.T(), w.Body.String(), audit.ActionUserRoleChange)
+}
+
+func (suite *AuthTestSuite) TestImportAndExportUsers() {
+	ctx := context.Background()
+	mailer := &captureMailer{}
+	suite.authSvc.SetMailer(mailer)
+	defer suite.authSvc.SetMailer(mail.NewLogMailer(slog.Default()))
+	api := suite.usersAPI()
+	adminToken := suite.createAdminUserAndGetToken()
+	suite.createTestUser("taken@example.com", "taken", "USER")
+	_, err := suite.authSvc.CreateTeam(ctx, "Payments", "", "test-admin")
+	require.NoError(suite.T(), err)
+
+	file := "username,email,role,team\n" +
+		"alice,alice@example.com,ANALYZER,Payments\n" +
+		"bob,bob@example.com,,\n" +
+		"taken,other@example.com,USER,\n" +
+		"ALICE,alice2@example.com,USER,\n" +
+		"eve,eve@example.com,ADMIN,\n" +
+		"frank,frank@example.com,USER,Nope\n"
+	importCSV := func(query map[string]string) *httpexpect.Object {
+		req := api.POST("/v1/admin/users/import").
+			WithHeader("Authorization", "Bearer "+adminToken).
+			WithMultipart().
+			WithFileBytes("file", "users.csv", []byte(file))
+		for k, v := range query {
+			req = req.WithQuery(k, v)
+		}
+		return req.Expect().Status(http.StatusOK).JSON().Object()
+	}
+
+	// A dry run reports the same errors and creates nobody.
+	dry := importCSV(map[string]string{"dry_run": "true"})
+	dry.Value("valid").Number().IsEqual(2)
+	dry.Value("failed").Number().IsEqual(4)
+	dry.Value("created").Number().IsEqual(0)
+	rows := dry.Value("rows").Array()
+	rows.Value(2).Object().Value("error").Object().Value("code").String().IsEqual(auth.ImportUserExists)
+	rows.Value(3).Object().Value("error").Object().Value("code").String().IsEqual(auth.ImportDuplicateRow)
+	rows.Value(4).Object().Value("error").Object().Value("code").String().IsEqual(auth.ImportInvalidRole)
+	rows.Value(5).Object().Value("error").Object().Value("code").String().IsEqual(auth.ImportTeamNotFound)
+	rows.Value(5).Object().Value("line").Number().IsEqual(7)
+	var count int64
+	require.NoError(suite.T(), suite.dbx.Gorm.Model(&db.User{}).Where("username = ?", "alice").Count(&count).Error)
+	require.Zero(suite.T(), count)
+
+	resp := importCSV(nil)
+	resp.Value("created").Number().IsEqual(2)
+	alice := resp.Value("rows").Array().Value(0).Object()
+	password := alice.Value("temporary_password").String().NotEmpty().Raw()
+	_, _, _, _, _, err = suite.authSvc.Login(ctx, "alice", password)
+	require.NoError(suite.T(), err)
+
+	// Temporary passwords expire unless the user replaces them.
+	aliceID := alice.Value("user_id").String().Raw()
+	require.NoError(suite.T(), suite.dbx.Gorm.Model(&db.User{}).Where("id = ?", aliceID).
+		Update("password_expires_at", time.Now().Add(-time.Minute)).Error)
+	_, _, _, _, _, err = suite.authSvc.Login(ctx, "alice", password)
+	require.ErrorIs(suite.T(), err, auth.ErrPasswordExpired)
+	_, _, err = suite.authSvc.ChangePassword(ctx, aliceID, "", password, "alices-new-pass-1")
+	require.NoError(suite.T(), err)
+	_, _, _, _, _, err = suite.authSvc.Login(ctx, "alice", "alices-new-pass-1")
+	require.NoError(suite.T(), err)
+	members, err := suite.authSvc.ListTeamMembers(ctx, suite.teamID("Payments"))
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), members, 1)
+	require.Equal(suite.T(), "alice", members[0].Username)
+
+	// Invited users get a link instead of a password.
+	file = "username,email,role\ncarol,carol@example.com,MONITOR\n"
+	importCSV(map[string]string{"mode": "invite"}).
+		Value("rows").Array().Value(0).Object().NotContainsKey("temporary_password")
+	require.NoError(suite.T(), suite.authSvc.ResetPassword(ctx, mailer.lastToken(), "carols-new-pass-1"))
+	_, _, _, _, _, err = suite.authSvc.Login(ctx, "carol", "carols-new-pass-1")
+	require.NoError(suite.T(), err)
+
+	api.POST("/v1/admin/users/import").
+		WithHeader("Authorization", "Bearer "+adminToken).
+		WithMultipart().
+		WithFileBytes("file", "users.csv", []byte("name,mail\nx,y\n")).
+		Expect().
+		Status(http.StatusBadRequest).
+		JSON().Object().Value("error").Object().Value("code").String().IsEqual("invalid_file")
+
+	body := api.GET("/v1/admin/users/export.csv").
+		WithHeader("Authorization", "Bearer "+adminToken).
+		WithQuery("role", "ANALYZER").
+		Expect().
+		Status(http.StatusOK).
+		Body().Raw()
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	require.Len(suite.T(), lines, 2)
+	require.True(suite.T(), strings.HasPrefix(lines[0], "id,username,email,role,status,teams,"))
+	require.Contains(suite.T(), lines[1], ",alice,alice@example.com,ANALYZER,active,Payments,")
+}
+
+func (suite *AuthTestSuite) TestInvitations() {
+	ctx := context.Background()
+	mailer := &captureMailer{}
+	suite.authSvc.SetMailer(mailer)
+	defer suite.authSvc.SetMailer(mail.NewLogMailer(slog.Default()))
+	admin := suite.createTestUser("admin@example.com", "admin", "ADMIN")
+	leader := suite.createTestUser("lead@example.com", "lead", "TEAM_LEADER")
+	team, err := suite.authSvc.CreateTeam(ctx, "Payments", "", "test-admin")
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), suite.authSvc.SetTeamMember(ctx, team.ID, leader.ID, true, admin, true))
+
+	// Managers may invite with any role but ADMIN, and not existing users.
+	_, err = suite.authSvc.CreateInvitation(ctx, auth.InviteRequest{Email: "x@example.com", Role: "ADMIN"}, admin, true)
+	require.ErrorIs(suite.T(), err, auth.ErrAdminAssign)
+	_, err = suite.authSvc.CreateInvitation(ctx, auth.InviteRequest{Email: "lead@example.com"}, admin, true)
+	require.ErrorIs(suite.T(), err, auth.ErrUserExists)
+	_, err = suite.authSvc.CreateInvitation(ctx, auth.InviteRequest{Email: "x@example.com", ExpiresAt: time.Now().Add(-time.Hour)}, admin, true)
+	require.ErrorIs(suite.T(), err, auth.ErrInvalidInvite)
+
+	// Leaders only invite into their own teams.
+	_, err = suite.authSvc.CreateInvitation(ctx, auth.InviteRequest{Email: "alice@example.com"}, leader, false)
+	require.ErrorIs(suite.T(), err, auth.ErrNotTeamLeader)
+	inv, err := suite.authSvc.CreateInvitation(ctx, auth.InviteRequest{Email: "alice@example.com", TeamID: team.ID}, leader, false)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), "USER", inv.Role)
+	token := mailer.lastToken()
+	require.NotEmpty(suite.T(), token)
+
+	pending, err := suite.authSvc.ListInvitations(ctx, db.InvitationPending, leader, false)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), pending, 1)
+
+	_, err = suite.authSvc.AcceptInvitation(ctx, "deadbeef", "alice", "alices-pass-123")
+	require.ErrorIs(suite.T(), err, auth.ErrInvalidInvitation)
+	u, err := suite.authSvc.AcceptInvitation(ctx, token, "alice", "alices-pass-123")
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), "alice@example.com", u.Email)
+	require.NotNil(suite.T(), u.EmailVerifiedAt)
+	_, err = suite.authSvc.AcceptInvitation(ctx, token, "alice2", "alices-pass-123")
+	require.ErrorIs(suite.T(), err, auth.ErrInvalidInvitation)
+	members, err := suite.authSvc.ListTeamMembers(ctx, team.ID)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), members, 2)
+	_, _, _, _, _, err = suite.authSvc.Login(ctx, "alice", "alices-pass-123")
+	require.NoError(suite.T(), err)
+
+	// A new invitation replaces the pending one; revoked links stop working.
+	_, err = suite.authSvc.CreateInvitation(ctx, auth.InviteRequest{Email: "bob@example.com", Role: "ANALYZER"}, admin, true)
+	require.NoError(suite.T(), err)
+	first := mailer.lastToken()
+	inv, err = suite.authSvc.CreateInvitation(ctx, auth.InviteRequest{Email: "bob@example.com", Role: "ANALYZER"}, admin, true)
+	require.NoError(suite.T(), err)
+	_, err = suite.authSvc.AcceptInvitation(ctx, first, "bob", "bobs-pass-1234")
+	require.ErrorIs(suite.T(), err, auth.ErrInvalidInvitation)
+	require.ErrorIs(suite.T(), suite.authSvc.RevokeInvitation(ctx, inv.ID, leader, false), auth.ErrNotTeamLeader)
+	require.NoError(suite.T(), suite.authSvc.RevokeInvitation(ctx, inv.ID, admin, true))
+	require.ErrorIs(suite.T(), suite.authSvc.RevokeInvitation(ctx, inv.ID, admin, true), auth.ErrInvitationNotPending)
+	_, err = suite.authSvc.AcceptInvitation(ctx, mailer.lastToken(), "bob", "bobs-pass-1234")
+	require.ErrorIs(suite.T(), err, auth.ErrInvalidInvitation)
+
+	revoked, err := suite.authSvc.ListInvitations(ctx, db.InvitationRevoked, admin, true)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), revoked, 2)
+	all, err := suite.authSvc.ListInvitations(ctx, "", leader, false)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), all, 1)
+	require.Equal(suite.T(), db.InvitationAccepted, all[0].Status(time.Now()))
+}
+
+func (suite *AuthTestSuite) TestRoleManagement() {
+	ctx := context.Background()
+	defs, err := db.LoadRoleDefinitions("")
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), suite.dbx.SeedRoles(ctx, defs))
+	require.NoError(suite.T(), suite.dbx.SeedDefaultPermissions(ctx))
+	admin := suite.createTestUser("admin@example.com", "admin", "ADMIN")
+
+	role, err := suite.authSvc.CreateRole(ctx, auth.RoleInput{
+		Code:        "AUDITOR",
+		Name:        "Auditor",
+		Permissions: []string{db.PermAuditRead, db.PermAuditRead},
+	}, "admin")
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), []string{db.PermAuditRead}, role.Permissions)
+	_, err = suite.authSvc.CreateRole(ctx, auth.RoleInput{Code: "AUDITOR", Name: "Auditor"}, "admin")
+	require.ErrorIs(suite.T(), err, auth.ErrRoleExists)
+	_, err = suite.authSvc.CreateRole(ctx, auth.RoleInput{Code: "BROKEN", Name: "Broken", Permissions: []string{"nope"}}, "admin")
+	require.ErrorIs(suite.T(), err, auth.ErrUnknownPermission)
+	_, err = suite.authSvc.UpdateRole(ctx, "BROKEN", "Broken", "", "admin")
+	require.ErrorIs(suite.T(), err, auth.ErrRoleNotFound)
+
+	updated, err := suite.authSvc.UpdateRole(ctx, "AUDITOR", "Compliance auditor", "Reads the audit log", "admin")
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), "Compliance auditor", updated.Name)
+
+	// Permission changes are audited with the old and new grants.
+	_, err = suite.authSvc.SetRolePermissions(ctx, "AUDITOR", []string{db.PermAuditRead, db.PermSQLLogRead}, "admin")
+	require.NoError(suite.T(), err)
+	changes, _, err := suite.authSvc.Audit().List(ctx, audit.Filter{Action: audit.ActionRolePermissions, TargetID: "AUDITOR"}, 10, 0)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), changes, 1)
+	require.Equal(suite.T(), []any{db.PermAuditRead}, changes[0].Before["permissions"])
+	require.Equal(suite.T(), []any{db.PermAuditRead, db.PermSQLLogRead}, changes[0].After["permissions"])
+
+	// Built-in roles from the roles file are protected.
+	_, err = suite.authSvc.UpdateRole(ctx, "USER", "Member", "", "admin")
+	require.ErrorIs(suite.T(), err, auth.ErrBuiltInRole)
+	require.ErrorIs(suite.T(), suite.authSvc.DeleteRole(ctx, "MONITOR"), auth.ErrBuiltInRole)
+
+	// Custom roles can be assigned, and block deletion while in use.
+	u := suite.createTestUser("carol@example.com", "carol", "USER")
+	_, err = suite.authSvc.UpdateUserRole(ctx, u.ID, "AUDITOR", "admin")
+	require.NoError(suite.T(), err)
+	_, err = suite.authSvc.UpdateUserRole(ctx, u.ID, "NOPE", "admin")
+	require.ErrorIs(suite.T(), err, auth.ErrInvalidRole)
+	require.ErrorIs(suite.T(), suite.authSvc.DeleteRole(ctx, "AUDITOR"), auth.ErrRoleInUse)
+	_, err = suite.authSvc.UpdateUserRole(ctx, u.ID, "USER", "admin")
+	require.NoError(suite.T(), err)
+
+	// A delegated user manager can only hand out roles within their own permissions.
+	_, err = suite.authSvc.CreateRole(ctx, auth.RoleInput{
+		Code:        "USER_MANAGER",
+		Name:        "User manager",
+		Permissions: []string{db.PermUsersManage, db.PermSQLLogRead, db.PermSQLLogUpload},
+	}, "admin")
+	require.NoError(suite.T(), err)
+	managerCtx := authctx.WithUser(ctx, &db.User{ID: admin.ID, Username: "manager", Role: "USER_MANAGER"})
+	_, err = suite.authSvc.CreateUser(managerCtx, "erin", "erin@example.com", "erins-pass-123", "AUDITOR", "manager")
+	require.ErrorIs(suite.T(), err, auth.ErrRoleNotDelegable)
+	_, err = suite.authSvc.UpdateUserRole(managerCtx, u.ID, "AUDITOR", "manager")
+	require.ErrorIs(suite.T(), err, auth.ErrRoleNotDelegable)
+	_, err = suite.authSvc.UpdateUserRole(managerCtx, u.ID, "ADMIN", "manager")
+	require.ErrorIs(suite.T(), err, auth.ErrAdminAssign)
+	results, err := suite.authSvc.ImportUsers(managerCtx, []auth.ImportRow{
+		{Line: 2, Username: "erin", Email: "erin@example.com", Role: "AUDITOR"},
+		{Line: 3, Username: "frank", Email: "frank@example.com", Role: "USER"},
+	}, auth.ImportPassword, true, "manager")
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), auth.ImportInvalidRole, results[0].Err.Code)
+	require.Nil(suite.T(), results[1].Err)
+	_, err = suite.authSvc.UpdateUserRole(managerCtx, u.ID, "USER", "manager")
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), suite.authSvc.DeleteRole(ctx, "USER_MANAGER"))
+
+	inv, err := suite.authSvc.CreateInvitation(ctx, auth.InviteRequest{Email: "dave@example.com", Role: "AUDITOR"}, admin, true)
+	require.NoError(suite.T(), err)
+	require.ErrorIs(suite.T(), suite.authSvc.DeleteRole(ctx, "AUDITOR"), auth.ErrRoleInUse)
+	require.NoError(suite.T(), suite.authSvc.RevokeInvitation(ctx, inv.ID, admin, true))
+
+	require.NoError(suite.T(), suite.authSvc.DeleteRole(ctx, "AUDITOR"))
+	require.ErrorIs(suite.T(), suite.authSvc.DeleteRole(ctx, "AUDITOR"), auth.ErrRoleNotFound)
+	perms, err := suite.authSvc.PermissionsForRole(ctx, "AUDITOR")
+	require.NoError(suite.T(), err)
+	require.Empty(suite.T(), perms)
+}
+
+func (suite *AuthTestSuite) TestSeedRoles() {
+	ctx := context.Background()
+	require.NoError(suite.T(), suite.dbx.Gorm.Model(&db.Role{}).Where("code = ?", "MONITOR").
+		Updates(map[string]interface{}{"name": "Old name", "description": "Old description", "require_2fa": true}).Error)
+	defer suite.dbx.Gorm.Model(&db.Role{}).Where("code = ?", "MONITOR").Update("require_2fa", false)
+
+	require.NoError(suite.T(), suite.dbx.SeedRoles(ctx, []db.RoleDefinition{
+		{Code: "USER", Name: "User"},
+		{Code: "ADMIN", Name: "Administrator"},
+		{Code: "MONITOR", Name: "Monitor", Description: "System monitor role"},
+	}))
+	var monitor db.Role
+	require.NoError(suite.T(), suite.dbx.Gorm.First(&monitor, "code = ?", "MONITOR").Error)
+	require.Equal(suite.T(), "Monitor", monitor.Name)
+	require.Equal(suite.T(), "System monitor role", monitor.Description)
+	require.True(suite.T(), monitor.BuiltIn)
+	require.True(suite.T(), monitor.Require2FA)
+
+	// Roles left out of the file become custom roles.
+	var analyzer db.Role
+	require.NoError(suite.T(), suite.dbx.Gorm.First(&analyzer, "code = ?", "ANALYZER").Error)
+	require.False(suite.T(), analyzer.BuiltIn)
+}
+
+func (suite *AuthTestSuite) TestExportUsersCSV_Batches() {
+	ctx := context.Background()
+	// More than two export batches, inserted directly to skip password hashing.
+	users := make([]db.User, 1203)
+	for i := range users {
+		users[i] = db.User{
+			Username:  fmt.Sprintf("batch%04d", i),
+			Email:     fmt.Sprintf("batch%04d@example.com", i),
+			Role:      "USER",
+			CreatedBy: "test",
+			UpdatedBy: "test",
+		}
+	}
+	require.NoError(suite.T(), suite.dbx.Gorm.CreateInBatches(users, 200).Error)
+
+	var buf bytes.Buffer
+	require.NoError(suite.T(), suite.authSvc.ExportUsersCSV(ctx, auth.UserQuery{Search: "batch"}, &buf))
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), records, len(users)+1)
+	for i, rec := range records[1:] {
+		require.Equal(suite.T(), fmt.Sprintf("batch%04d", i), rec[1])
+	}
+}
+
+func (suite *AuthTestSuite) teamID(name string) string {
+	var t db.Team
+	require.NoError(suite.T(), suite.dbx.Gorm.First(&t, "name = ?", name).Error)
+	return t.ID
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-demo/internal/auth"
+	"go-demo/internal/authctx"
+	"go-demo/internal/db"
+
+	"github.com/google/uuid"
+)
+
+type CreateInvitationReq struct {
+	Email string `json:"email"`
+	// Role defaults to USER.
+	Role string `json:"role,omitempty"`
+	// TeamID is required for team leaders.
+	TeamID string `json:"team_id,omitempty"`
+	// ExpiresAt defaults to now + INVITE_TTL; at most 30 days ahead.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type InvitationResp struct {
+	ID          string     `json:"id"`
+	Email       string     `json:"email"`
+	Role        string     `json:"role"`
+	TeamID      string     `json:"team_id,omitempty"`
+	Status      string     `json:"status"`
+	InvitedBy   string     `json:"invited_by"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	AcceptedAt  *time.Time `json:"accepted_at,omitempty"`
+	UserID      string     `json:"user_id,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy   string     `json:"revoked_by,omitempty"`
+	CreatedTime time.Time  `json:"created_time"`
+}
+
+type AcceptInvitationReq struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func toInvitationResp(inv db.Invitation) InvitationResp {
+	resp := InvitationResp{
+		ID:          inv.ID,
+		Email:       inv.Email,
+		Role:        inv.Role,
+		Status:      inv.Status(time.Now()),
+		InvitedBy:   inv.InvitedBy,
+		ExpiresAt:   inv.ExpiresAt,
+		AcceptedAt:  inv.AcceptedAt,
+		RevokedAt:   inv.RevokedAt,
+		RevokedBy:   inv.RevokedBy,
+		CreatedTime: inv.CreatedTime,
+	}
+	if inv.TeamID != nil {
+		resp.TeamID = *inv.TeamID
+	}
+	if inv.UserID != nil {
+		resp.UserID = *inv.UserID
+	}
+	return resp
+}
+
+// writeInvitationError maps invitation service errors to responses.
+func (h Auth) writeInvitationError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, auth.ErrRegistrationDisabled):
+		writeError(w, http.StatusForbidden, "registration_disabled", "registration is disabled")
+	case errors.Is(err, auth.ErrInvalidInvite):
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+	case errors.Is(err, auth.ErrAdminAssign):
+		writeError(w, http.StatusBadRequest, "invalid_role", err.Error())
+	case errors.Is(err, auth.ErrInvalidInvitation):
+		writeError(w, http.StatusBadRequest, "invalid_token", "invalid or expired invitation")
+	case errors.Is(err, auth.ErrUserExists):
+		writeError(w, http.StatusConflict, "user_exists", "username or email already exists")
+	case errors.Is(err, auth.ErrInvitationNotPending):
+		writeError(w, http.StatusConflict, "invitation_not_pending", "invitation was already accepted or revoked")
+	case errors.Is(err, auth.ErrInvitationNotFound):
+		writeError(w, http.StatusNotFound, "invitation_not_found", "invitation not found")
+	case errors.Is(err, auth.ErrTeamNotFound):
+		writeError(w, http.StatusNotFound, "team_not_found", "team not found")
+	case errors.Is(err, auth.ErrNotTeamLeader):
+		writeError(w, http.StatusForbidden, "forbidden", "only user managers and leaders of the team can manage its invitations")
+	default:
+		if writePasswordPolicyError(w, err) {
+			return
+		}
+		h.Log.Error(action+" failed", "err", err)
+		writeError(w, http.StatusInternalServerError, "server_error", "could not "+action)
+	}
+}
+
+// CreateInvitation godoc
+// @Summary Invite a user
+// @Description Mails a sign-up link to an email address with a pre-assigned role and optional team. Users with users:manage may invite with any role except ADMIN; team leaders may invite into a team they lead, with roles whose permissions their own role has. A pending invitation for the same address is replaced.
+// @Tags invitations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateInvitationReq true "Invitation"
+// @Success 201 {object} InvitationResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 409 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/invitations [post]
+func (h Auth) CreateInvitation() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		u, ok := authctx.UserFrom(r.Context())
+		if !ok || u == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		var req CreateInvitationReq
+		if !h.decodeBody(w, r, &req) {
+			return
+		}
+		if strings.TrimSpace(req.Email) == "" {
+			writeError(w, http.StatusBadRequest, "bad_request", "email is required")
+			return
+		}
+		if req.TeamID != "" {
+			if _, err := uuid.Parse(req.TeamID); err != nil {
+				writeError(w, http.StatusBadRequest, "bad_request", "team_id must be a UUID")
+				return
+			}
+		}
+		in := auth.InviteRequest{Email: req.Email, Role: req.Role, TeamID: req.TeamID}
+		if req.ExpiresAt != nil {
+			in.ExpiresAt = *req.ExpiresAt
+		}
+
+		asManager := authctx.HasPermission(r.Context(), db.PermUsersManage)
+		inv, err := h.S.CreateInvitation(r.Context(), in, u, asManager)
+		if err != nil {
+			h.writeInvitationError(w, err, "create invitation")
+			return
+		}
+		h.Log.Info("invitation created", "invitation_id", inv.ID, "role", inv.Role, "by", u.Username)
+		writeJSON(w, http.StatusCreated, toInvitationResp(*inv))
+	})
+}
+
+// ListInvitations godoc
+// @Summary List invitations
+// @Description Newest first. Users with users:manage see every invitation, team leaders those to the teams they lead.
+// @Tags invitations
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "pending, accepted, revoked or expired"
+// @Success 200 {array} InvitationResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/invitations [get]
+func (h Auth) ListInvitations() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := authctx.UserFrom(r.Context())
+		if !ok || u == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		asManager := authctx.HasPermission(r.Context(), db.PermUsersManage)
+		invs, err := h.S.ListInvitations(r.Context(), strings.TrimSpace(r.URL.Query().Get("status")), u, asManager)
+		if err != nil {
+			h.writeInvitationError(w, err, "list invitations")
+			return
+		}
+		resp := make([]InvitationResp, 0, len(invs))
+		for _, inv := range invs {
+			resp = append(resp, toInvitationResp(inv))
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
+
+// RevokeInvitation godoc
+// @Summary Revoke an invitation
+// @Description Withdraws a pending invitation so its link stops working. Users with users:manage may revoke any invitation, team leaders those to their teams.
+// @Tags invitations
+// @Security BearerAuth
+// @Param id path string true "Invitation ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 409 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/invitations/{id} [delete]
+func (h Auth) RevokeInvitation() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := authctx.UserFrom(r.Context())
+		if !ok || u == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		id := r.PathValue("id")
+		if _, err := uuid.Parse(id); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_path", "invitation ID must be a UUID")
+			return
+		}
+		asManager := authctx.HasPermission(r.Context(), db.PermUsersManage)
+		if err := h.S.RevokeInvitation(r.Context(), id, u, asManager); err != nil {
+			h.writeInvitationError(w, err, "revoke invitation")
+			return
+		}
+		h.Log.Info("invitation revoked", "invitation_id", id, "by", u.Username)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// AcceptInvitation godoc
+// @Summary Accept an invitation
+// @Description Creates the invited account with the invitation's email, role and team; the email address counts as verified. Works in the open and invite registration modes.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token path string true "Invitation token from the email"
+// @Param request body AcceptInvitationReq true "Username and password"
+// @Success 201 {object} UserResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 409 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/auth/invitations/{token}/accept [post]
+func (h Auth) AcceptInvitation() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		var req AcceptInvitationReq
+		if !h.decodeBody(w, r, &req) {
+			return
+		}
+		if strings.TrimSpace(req.Username) == "" || req.Password == "" {
+			writeError(w, http.StatusBadRequest, "bad_request", "username and password are required")
+			return
+		}
+		u, err := h.S.AcceptInvitation(r.Context(), r.PathValue("token"), req.Username, req.Password)
+		if err != nil {
+			h.writeInvitationError(w, err, "accept invitation")
+			return
+		}
+		writeJSON(w, http.StatusCreated, toUserResp(u))
+	})
+}
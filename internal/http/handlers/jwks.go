@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"go-demo/internal/auth"
+)
+
+type JWKSResp struct {
+	Keys []auth.JWK `json:"keys"`
+}
+
+// JWKS godoc
+// @Summary Access token signing keys
+// @Description Public keys (JWK Set) for verifying RS256/EdDSA access tokens, selected by the token's kid. Includes keys staged for upcoming rotations and keys still valid for tokens signed before a rotation. Empty while tokens are signed with HS256.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} JWKSResp
+// @Router /.well-known/jwks.json [get]
+func (h Auth) JWKS() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Verifiers refetch on an unknown kid, so a short cache is enough.
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		writeJSON(w, http.StatusOK, JWKSResp{Keys: h.S.KeyRing().JWKS(time.Now())})
+	})
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-demo/internal/auth"
+	"go-demo/internal/authctx"
+
+	"github.com/google/uuid"
+)
+
+type LockoutResp struct {
+	UserID           string     `json:"user_id"`
+	Username         string     `json:"username"`
+	Email            string     `json:"email"`
+	FailedLoginCount int        `json:"failed_login_count"`
+	LastFailedAt     *time.Time `json:"last_failed_at,omitempty"`
+	LockedUntil      *time.Time `json:"locked_until,omitempty"`
+	Locked           bool       `json:"locked"`
+}
+
+func toLockoutResp(l auth.Lockout) LockoutResp {
+	return LockoutResp{
+		UserID:           l.UserID,
+		Username:         l.Username,
+		Email:            l.Email,
+		FailedLoginCount: l.FailedLoginCount,
+		LastFailedAt:     l.LastFailedAt,
+		LockedUntil:      l.LockedUntil,
+		Locked:           l.LockedUntil != nil && l.LockedUntil.After(time.Now()),
+	}
+}
+
+// setRetryAfter sets the Retry-After header in whole seconds, rounded up.
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+}
+
+func writeRateLimited(w http.ResponseWriter, retry time.Duration) {
+	setRetryAfter(w, retry)
+	writeError(w, http.StatusTooManyRequests, "rate_limited", "too many attempts; try again later")
+}
+
+// ListLockouts godoc
+// @Summary List login lockouts (Admin only)
+// @Description Lists accounts that are locked or have failed logins since their last successful one (users:manage required)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} LockoutResp
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/lockouts [get]
+func (h Auth) ListLockouts() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lockouts, err := h.S.ListLockouts(r.Context())
+		if err != nil {
+			h.Log.Error("list lockouts failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not list lockouts")
+			return
+		}
+		out := make([]LockoutResp, 0, len(lockouts))
+		for _, l := range lockouts {
+			out = append(out, toLockoutResp(l))
+		}
+		writeJSON(w, http.StatusOK, out)
+	})
+}
+
+// GetUserLockout godoc
+// @Summary Get a user's lockout state (Admin only)
+// @Description Returns the failed login count and lock expiry of a user (users:manage required)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} LockoutResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/users/{id}/lockout [get]
+func (h Auth) GetUserLockout() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.PathValue("id")
+		if _, err := uuid.Parse(userID); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_path", "user ID must be a UUID")
+			return
+		}
+		l, err := h.S.GetLockout(r.Context(), userID)
+		if err != nil {
+			if errors.Is(err, auth.ErrUserNotFound) {
+				writeError(w, http.StatusNotFound, "user_not_found", "user not found")
+				return
+			}
+			h.Log.Error("get lockout failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not load lockout")
+			return
+		}
+		writeJSON(w, http.StatusOK, toLockoutResp(*l))
+	})
+}
+
+// ClearUserLockout godoc
+// @Summary Clear a user's lockout (Admin only)
+// @Description Unlocks the account and resets its failed login count (users:manage required)
+// @Tags admin
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/users/{id}/lockout [delete]
+func (h Auth) ClearUserLockout() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adminUser, ok := authctx.UserFrom(r.Context())
+		if !ok || adminUser == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		userID := r.PathValue("id")
+		if _, err := uuid.Parse(userID); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_path", "user ID must be a UUID")
+			return
+		}
+		if err := h.S.ClearLockout(r.Context(), userID, adminUser.Username); err != nil {
+			if errors.Is(err, auth.ErrUserNotFound) {
+				writeError(w, http.StatusNotFound, "user_not_found", "user not found")
+				return
+			}
+			h.Log.Error("clear lockout failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not clear lockout")
+			return
+		}
+		h.Log.Info("user lockout cleared", "user_id", userID, "by", adminUser.Username)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
 	"go-demo/internal/auth"
 	"go-demo/internal/authctx"
+	"go-demo/internal/db"
+	"go-demo/internal/sqllog"
+
+	"github.com/google/uuid"
 )
 
 func bearerToken(r *http.Request) string {
@@ -23,35 +28,105 @@ func bearerToken(r *http.Request) string {
 	return strings.TrimSpace(parts[1])
 }
 
-// RequireAuth returns a middleware that verifies the Bearer token,
-// loads the user, and injects it into request context.
+// RequireAuth returns a middleware that verifies the Bearer token, or a
+// service account's X-API-Key, rejects revoked tokens and suspended or deleted
+// users, and injects the user and their role's permissions (narrowed to the
+// key's scopes) into request context. Users whose role requires 2FA are refused
+// until they have enrolled. In stateless mode the user, permissions and
+// enrollment state come from the token's claims.
 func RequireAuth(s *auth.Service) func(http.Handler) http.Handler {
+	return requireAuth(s, false)
+}
+
+// RequireAuthAllowEnrollment is RequireAuth for the endpoints a user needs to
+// enroll in 2FA (reading the profile, 2FA setup and verify, logout); it skips
+// the enrollment check. Changing the profile or password waits for enrollment.
+func RequireAuthAllowEnrollment(s *auth.Service) func(http.Handler) http.Handler {
+	return requireAuth(s, true)
+}
+
+func requireAuth(s *auth.Service, allowEnrollment bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			tok := bearerToken(r)
-			if tok == "" {
+			apiKey := strings.TrimSpace(r.Header.Get("X-API-Key"))
+			if tok == "" && apiKey == "" {
 				writeError(w, http.StatusUnauthorized, "unauthorized", "missing bearer token")
 				return
 			}
-			sub, err := s.ParseToken(tok)
-			if err != nil || sub == "" {
+
+			var (
+				u       *db.User
+				key     *db.APIKey
+				claims  *auth.Claims
+				tokInfo authctx.Token
+				err     error
+			)
+			if tok != "" {
+				u, claims, err = s.Authenticate(r.Context(), tok)
+				if err == nil {
+					tokInfo = authctx.Token{ID: claims.ID, SessionID: claims.SessionID}
+					if claims.ExpiresAt != nil {
+						tokInfo.ExpiresAt = claims.ExpiresAt.Time
+					}
+				}
+			} else {
+				u, key, err = s.AuthenticateAPIKey(withClient(r), apiKey)
+				if err == nil {
+					tokInfo = authctx.Token{APIKeyID: key.ID}
+					if key.ExpiresAt != nil {
+						tokInfo.ExpiresAt = *key.ExpiresAt
+					}
+				}
+			}
+			switch {
+			case err == nil:
+			case errors.Is(err, auth.ErrInvalidCredentials) && tok == "":
+				writeError(w, http.StatusUnauthorized, "unauthorized", "invalid API key")
+				return
+			case errors.Is(err, auth.ErrInvalidCredentials):
 				writeError(w, http.StatusUnauthorized, "unauthorized", "invalid token")
 				return
-			}
-			u, err := s.GetUserByID(r.Context(), sub)
-			if err != nil || u == nil {
+			case errors.Is(err, auth.ErrTokenRevoked):
+				writeError(w, http.StatusUnauthorized, "token_revoked", "token has been revoked")
+				return
+			case errors.Is(err, auth.ErrUserNotFound):
 				writeError(w, http.StatusUnauthorized, "unauthorized", "user not found")
 				return
+			case errors.Is(err, auth.ErrUserInactive):
+				writeError(w, http.StatusUnauthorized, "account_inactive", "account is not active")
+				return
+			default:
+				writeError(w, http.StatusInternalServerError, "internal_error", "could not verify token")
+				return
+			}
+			// Stateless tokens carry the enrollment state and permissions.
+			var (
+				perms    []string
+				required bool
+			)
+			if claims != nil && s.Stateless() {
+				perms, required = claims.Permissions, claims.Enroll2FA
+			} else if perms, required, err = s.RoleAccess(r.Context(), u); err != nil {
+				writeError(w, http.StatusInternalServerError, "internal_error", "could not load permissions")
+				return
+			}
+			if required && !allowEnrollment {
+				writeError(w, http.StatusForbidden, "2fa_enrollment_required", "your role requires two-factor authentication; enroll via /v1/auth/2fa/setup")
+				return
 			}
-			ctx := authctx.WithUser(r.Context(), u)
+			ctx := authctx.WithUser(withClient(r), u)
+			ctx = authctx.WithPermissions(ctx, auth.ScopePermissions(perms, key))
+			ctx = authctx.WithToken(ctx, tokInfo)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-// RequireAdminRole returns a middleware that requires the user to have ADMIN role.
-// This middleware should be used after RequireAuth middleware.
-func RequireAdminRole() func(http.Handler) http.Handler {
+// RequirePermission returns a middleware that requires the user's role to grant perm.
+// Must be used after RequireAuth, which loads the permissions into the context.
+// Example: handlers.RequireAuth(authSvc)(handlers.RequirePermission(db.PermReportExport)(h))
+func RequirePermission(perm string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			u, ok := authctx.UserFrom(r.Context())
@@ -59,8 +134,8 @@ func RequireAdminRole() func(http.Handler) http.Handler {
 				writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
 				return
 			}
-			if u.Role != "ADMIN" {
-				writeError(w, http.StatusForbidden, "forbidden", "admin role required")
+			if !authctx.HasPermission(r.Context(), perm) {
+				writeError(w, http.StatusForbidden, "forbidden", "missing permission "+perm)
 				return
 			}
 			next.ServeHTTP(w, r)
@@ -68,72 +143,19 @@ func RequireAdminRole() func(http.Handler) http.Handler {
 	}
 }
 
-// RequireRoles allows any of the provided roles. Use after RequireAuth.
-func RequireRoles(roles ...http.Handler) http.Handler {
+// WithTeamFilter applies the optional "team" query parameter to SQL log reads,
+// limiting them to databases granted to that team. It never widens access.
+func WithTeamFilter(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		u, ok := authctx.UserFrom(r.Context())
-		if !ok || u == nil {
-			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
-			return
-		}
-		// Check if user role is in allowed list (case-insensitive)
-		role := u.Role
-		allowed := false
-		for _, want := range []string{"ADMIN", "TEAM_LEADER"} {
-			if strings.EqualFold(role, want) {
-				allowed = true
-				break
-			}
-		}
-		if !allowed {
-			writeError(w, http.StatusForbidden, "forbidden", "insufficient role")
-			return
-		}
-		// Pass through
-		wrapped := roles
-		if len(wrapped) == 0 {
-			// No-op if no inner handlers were provided
-			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}).ServeHTTP(w, r)
+		team := strings.TrimSpace(r.URL.Query().Get("team"))
+		if team == "" {
+			next.ServeHTTP(w, r)
 			return
 		}
-		// If roles slice contains a single handler, treat as normal next
-		if len(wrapped) == 1 {
-			wrapped[0].ServeHTTP(w, r)
+		if _, err := uuid.Parse(team); err != nil {
+			writeError(w, http.StatusBadRequest, "bad_request", "team must be a UUID")
 			return
 		}
-		// Chain any provided handlers in order
-		var h http.Handler = wrapped[len(wrapped)-1]
-		for i := len(wrapped) - 2; i >= 0; i-- {
-			cur := wrapped[i]
-			prev := h
-			h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				cur.ServeHTTP(w, r)
-				prev.ServeHTTP(w, r)
-			})
-		}
-		h.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(sqllog.WithTeamFilter(r.Context(), team)))
 	})
 }
-
-// RequireAnyRole returns a middleware that allows any of the provided roles.
-// Must be used after RequireAuth, similar to RequireAdminRole.
-// Example: handlers.RequireAuth(authSvc)(handlers.RequireAnyRole("ADMIN","TEAM_LEADER")(h))
-func RequireAnyRole(roles ...string) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			u, ok := authctx.UserFrom(r.Context())
-			if !ok || u == nil {
-				writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
-				return
-			}
-			role := strings.TrimSpace(u.Role)
-			for _, want := range roles {
-				if strings.EqualFold(role, strings.TrimSpace(want)) {
-					next.ServeHTTP(w, r)
-					return
-				}
-			}
-			writeError(w, http.StatusForbidden, "forbidden", "insufficient role")
-		})
-	}
-}
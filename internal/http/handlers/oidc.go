@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-demo/internal/auth"
+	"go-demo/internal/oidc"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcCookiePath  = "/v1/auth/oidc"
+	// oidcStateTTL bounds how long the user may take at the identity provider.
+	oidcStateTTL = 10 * time.Minute
+)
+
+// OIDC serves single sign-on through an OpenID Connect provider.
+type OIDC struct {
+	S        *auth.Service
+	Log      *slog.Logger
+	Provider *oidc.Provider
+
+	// Roles maps provider claims to role codes; users without a match get DefaultRole.
+	Roles       oidc.RoleMapping
+	DefaultRole string
+	// StateKey signs the state cookie kept between login and callback.
+	StateKey []byte
+	// SecureCookie marks the state cookie Secure; set it when served over HTTPS.
+	SecureCookie bool
+}
+
+func NewOIDC(s *auth.Service, log *slog.Logger, p *oidc.Provider) OIDC {
+	return OIDC{S: s, Log: log, Provider: p, DefaultRole: "USER"}
+}
+
+func (h OIDC) setStateCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     oidcCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   h.SecureCookie,
+		// Lax so the cookie is sent on the provider's top-level redirect back.
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Login godoc
+// @Summary Start single sign-on
+// @Description Redirects to the identity provider (authorization code flow with PKCE). The state, nonce and code verifier are kept in a signed, short-lived cookie.
+// @Tags auth
+// @Success 302 "Redirect to the identity provider"
+// @Failure 502 {object} ErrorEnvelope
+// @Router /v1/auth/oidc/login [get]
+func (h OIDC) Login() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st, err := oidc.NewState(oidcStateTTL)
+		if err != nil {
+			h.Log.Error("oidc state failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not start login")
+			return
+		}
+		authURL, err := h.Provider.AuthCodeURL(r.Context(), st.State, st.Nonce, st.Verifier)
+		if err != nil {
+			h.Log.Error("oidc discovery failed", "err", err)
+			writeError(w, http.StatusBadGateway, "oidc_unavailable", "identity provider is unavailable")
+			return
+		}
+		sealed, err := oidc.Seal(h.StateKey, st)
+		if err != nil {
+			h.Log.Error("oidc state failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not start login")
+			return
+		}
+		h.setStateCookie(w, sealed, int(oidcStateTTL.Seconds()))
+		http.Redirect(w, r, authURL, http.StatusFound)
+	})
+}
+
+// Callback godoc
+// @Summary Finish single sign-on
+// @Description Redirect target of the identity provider. Exchanges the code, validates the ID token against the provider's JWKS, provisions the user on first login and returns the same tokens as /v1/auth/login. New users are refused with 403 registration_closed when REGISTRATION_MODE is invite and no pending invitation matches their verified email, and with registration_disabled when it is disabled.
+// @Tags auth
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State sent in the authorization request"
+// @Success 200 {object} LoginResp
+// @Success 202 {object} LoginChallengeResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 409 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Failure 502 {object} ErrorEnvelope
+// @Router /v1/auth/oidc/callback [get]
+func (h OIDC) Callback() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		cookie, err := r.Cookie(oidcStateCookie)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_state", "login state missing; start again at /v1/auth/oidc/login")
+			return
+		}
+		// The state is single-use.
+		h.setStateCookie(w, "", -1)
+		st, err := oidc.Open(h.StateKey, cookie.Value)
+		if err != nil || !hmac.Equal([]byte(st.State), []byte(q.Get("state"))) {
+			writeError(w, http.StatusBadRequest, "invalid_state", "login state is invalid or expired")
+			return
+		}
+		if e := q.Get("error"); e != "" {
+			writeError(w, http.StatusUnauthorized, "oidc_denied", strings.TrimSpace(e+": "+q.Get("error_description")))
+			return
+		}
+		if q.Get("code") == "" {
+			writeError(w, http.StatusBadRequest, "bad_request", "code is required")
+			return
+		}
+
+		id, err := h.Provider.Exchange(r.Context(), q.Get("code"), st.Verifier, st.Nonce)
+		if err != nil {
+			h.Log.Warn("oidc exchange failed", "err", err)
+			if errors.Is(err, oidc.ErrExchange) || errors.Is(err, oidc.ErrInvalidIDToken) {
+				writeError(w, http.StatusUnauthorized, "oidc_failed", "identity provider login could not be verified")
+				return
+			}
+			writeError(w, http.StatusBadGateway, "oidc_unavailable", "identity provider is unavailable")
+			return
+		}
+
+		u, tok, exp, rtok, rexp, err := h.S.LoginExternal(withClient(r), auth.ExternalIdentity{
+			Issuer:        id.Issuer,
+			Subject:       id.Subject,
+			Email:         id.Email,
+			EmailVerified: id.EmailVerified,
+			Username:      id.Username,
+			Role:          h.Roles.Role(id.Claims),
+			RoleMapped:    h.Roles.Configured(),
+		}, h.DefaultRole)
+		if err != nil {
+			var challenge *auth.SecondFactorChallenge
+			switch {
+			case errors.As(err, &challenge):
+				writeJSON(w, http.StatusAccepted, LoginChallengeResp{
+					ChallengeToken: challenge.Token,
+					ExpiresAt:      challenge.ExpiresAt,
+				})
+			case errors.Is(err, auth.ErrExternalEmailMissing):
+				writeError(w, http.StatusForbidden, "oidc_email_missing", "identity provider did not share an email address")
+			case errors.Is(err, auth.ErrExternalEmailTaken):
+				writeError(w, http.StatusConflict, "user_exists", "an account with this email already exists; sign in with its password")
+			case errors.Is(err, auth.ErrRegistrationClosed):
+				writeError(w, http.StatusForbidden, "registration_closed", "registration requires an invitation")
+			case errors.Is(err, auth.ErrRegistrationDisabled):
+				writeError(w, http.StatusForbidden, "registration_disabled", "registration is disabled")
+			case errors.Is(err, auth.ErrUserInactive):
+				writeError(w, http.StatusForbidden, "account_inactive", "account is suspended or deleted")
+			case errors.Is(err, auth.ErrEmailNotVerified):
+				writeError(w, http.StatusForbidden, "email_not_verified", "verify your email address before logging in")
+			default:
+				h.Log.Error("oidc login failed", "err", err, "issuer", id.Issuer, "subject", id.Subject)
+				writeError(w, http.StatusInternalServerError, "server_error", "could not login")
+			}
+			return
+		}
+		writeJSON(w, http.StatusOK, LoginResp{
+			Token:            tok,
+			ExpiresAt:        exp,
+			RefreshToken:     rtok,
+			RefreshExpiresAt: rexp,
+			User:             toUserResp(u),
+		})
+	})
+}
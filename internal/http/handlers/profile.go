@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"go-demo/internal/auth"
+	"go-demo/internal/authctx"
+)
+
+type ChangePasswordReq struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ChangePasswordResp struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type UpdateMeReq struct {
+	Username *string `json:"username,omitempty"`
+	Email    *string `json:"email,omitempty"`
+}
+
+// ChangePassword godoc
+// @Summary Change own password
+// @Description Changes the caller's password after checking the current one. Wrong current passwords count towards the account lockout. All other sessions are signed out; the current session continues with the access token returned here.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ChangePasswordReq true "Current and new password"
+// @Success 200 {object} ChangePasswordResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 423 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/auth/me/password [put]
+func (h Auth) ChangePassword() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		u, ok := authctx.UserFrom(r.Context())
+		if !ok || u == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		var req ChangePasswordReq
+		if !h.decodeBody(w, r, &req) {
+			return
+		}
+		if req.CurrentPassword == "" || req.NewPassword == "" {
+			writeError(w, http.StatusBadRequest, "bad_request", "current_password and new_password are required")
+			return
+		}
+		tok, _ := authctx.TokenFrom(r.Context())
+
+		access, exp, err := h.S.ChangePassword(r.Context(), u.ID, tok.SessionID, req.CurrentPassword, req.NewPassword)
+		if err != nil {
+			var locked *auth.LockedError
+			switch {
+			case errors.As(err, &locked):
+				setRetryAfter(w, time.Until(locked.Until))
+				writeError(w, http.StatusLocked, "account_locked", "too many failed attempts; try again later")
+			case errors.Is(err, auth.ErrWrongPassword):
+				writeError(w, http.StatusBadRequest, "invalid_current_password", "current password is incorrect")
+			case writePasswordPolicyError(w, err):
+			case errors.Is(err, auth.ErrUserNotFound):
+				writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			default:
+				h.Log.Error("change password failed", "user_id", u.ID, "err", err)
+				writeError(w, http.StatusInternalServerError, "server_error", "could not change password")
+			}
+			return
+		}
+		writeJSON(w, http.StatusOK, ChangePasswordResp{Token: access, ExpiresAt: exp})
+	})
+}
+
+// UpdateMe godoc
+// @Summary Update own profile
+// @Description Changes the caller's username and/or email. Omitted fields are left as they are. A new email address must be verified again.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body UpdateMeReq true "Fields to change"
+// @Success 200 {object} UserResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 409 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/auth/me [patch]
+func (h Auth) UpdateMe() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		u, ok := authctx.UserFrom(r.Context())
+		if !ok || u == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		var req UpdateMeReq
+		if !h.decodeBody(w, r, &req) {
+			return
+		}
+
+		updated, err := h.S.UpdateProfile(r.Context(), u.ID, req.Username, req.Email)
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrInvalidProfile):
+				writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+			case errors.Is(err, auth.ErrUserExists):
+				writeError(w, http.StatusConflict, "user_exists", "username or email already exists")
+			case errors.Is(err, auth.ErrUserNotFound):
+				writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			default:
+				h.Log.Error("update profile failed", "user_id", u.ID, "err", err)
+				writeError(w, http.StatusInternalServerError, "server_error", "could not update profile")
+			}
+			return
+		}
+		resp := toUserResp(updated)
+		resp.Permissions = authctx.PermissionsFrom(r.Context())
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"go-demo/internal/auth"
+	"go-demo/internal/authctx"
+)
+
+type PermissionResp struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+type RoleResp struct {
+	Code        string   `json:"code"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Require2FA  bool     `json:"require_2fa"`
+	BuiltIn     bool     `json:"built_in"`
+	Permissions []string `json:"permissions"`
+}
+
+type CreateRoleReq struct {
+	// Code is upper case letters, digits and underscores, e.g. AUDITOR.
+	Code        string   `json:"code"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type UpdateRoleReq struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type SetRolePermissionsReq struct {
+	Permissions []string `json:"permissions"`
+}
+
+// ListPermissions godoc
+// @Summary List permissions
+// @Description Lists every permission that can be granted to a role (roles:manage required)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} PermissionResp
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/permissions [get]
+func (h Auth) ListPermissions() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		perms, err := h.S.ListPermissions(r.Context())
+		if err != nil {
+			h.Log.Error("list permissions failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not list permissions")
+			return
+		}
+		resp := make([]PermissionResp, 0, len(perms))
+		for _, p := range perms {
+			resp = append(resp, PermissionResp{Code: p.Code, Description: p.Description})
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
+
+// ListRoles godoc
+// @Summary List roles with permissions
+// @Description Lists roles and the permissions granted to each (roles:manage required). Built-in roles come from the roles file (ROLES_FILE) and cannot be modified or deleted through the API.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} RoleResp
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/roles [get]
+func (h Auth) ListRoles() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roles, err := h.S.ListRolesWithPermissions(r.Context())
+		if err != nil {
+			h.Log.Error("list roles failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not list roles")
+			return
+		}
+		resp := make([]RoleResp, 0, len(roles))
+		for _, rp := range roles {
+			resp = append(resp, RoleResp{
+				Code:        rp.Code,
+				Name:        rp.Name,
+				Description: rp.Description,
+				Require2FA:  rp.Require2FA,
+				BuiltIn:     rp.BuiltIn,
+				Permissions: rp.Permissions,
+			})
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
+
+// SetRolePermissions godoc
+// @Summary Replace a role's permissions
+// @Description Replaces the permissions granted to a role (roles:manage required). ADMIN must keep roles:manage.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param code path string true "Role code"
+// @Param request body SetRolePermissionsReq true "Permissions to grant"
+// @Success 200 {object} RoleResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/roles/{code}/permissions [put]
+func (h Auth) SetRolePermissions() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		adminUser, ok := authctx.UserFrom(r.Context())
+		if !ok || adminUser == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+
+		code := r.PathValue("code")
+		if code == "" {
+			writeError(w, http.StatusBadRequest, "invalid_path", "role code is required")
+			return
+		}
+
+		dec := json.NewDecoder(io.LimitReader(r.Body, h.MaxBodyBytes))
+		dec.DisallowUnknownFields()
+
+		var req SetRolePermissionsReq
+		if err := dec.Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "bad_request", "invalid JSON payload")
+			return
+		}
+
+		perms, err := h.S.SetRolePermissions(r.Context(), code, req.Permissions, adminUser.Username)
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrRoleNotFound):
+				writeError(w, http.StatusNotFound, "role_not_found", "role not found")
+			case errors.Is(err, auth.ErrUnknownPermission):
+				writeError(w, http.StatusBadRequest, "invalid_permission", "unknown permission specified")
+			case errors.Is(err, auth.ErrAdminLockout):
+				writeError(w, http.StatusBadRequest, "invalid_operation", err.Error())
+			default:
+				h.Log.Error("set role permissions failed", "err", err)
+				writeError(w, http.StatusInternalServerError, "server_error", "could not update role permissions")
+			}
+			return
+		}
+		writeJSON(w, http.StatusOK, RoleResp{Code: code, Permissions: perms})
+	})
+}
+
+// writeRoleError maps role management errors to responses.
+func (h Auth) writeRoleError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidRole):
+		writeError(w, http.StatusBadRequest, "invalid_role", err.Error())
+	case errors.Is(err, auth.ErrUnknownPermission):
+		writeError(w, http.StatusBadRequest, "invalid_permission", "unknown permission specified")
+	case errors.Is(err, auth.ErrRoleNotFound):
+		writeError(w, http.StatusNotFound, "role_not_found", "role not found")
+	case errors.Is(err, auth.ErrBuiltInRole):
+		writeError(w, http.StatusForbidden, "role_built_in", err.Error())
+	case errors.Is(err, auth.ErrRoleExists):
+		writeError(w, http.StatusConflict, "role_exists", "role already exists")
+	case errors.Is(err, auth.ErrRoleInUse):
+		writeError(w, http.StatusConflict, "role_in_use", err.Error())
+	default:
+		h.Log.Error(action+" failed", "err", err)
+		writeError(w, http.StatusInternalServerError, "server_error", "could not "+action)
+	}
+}
+
+// CreateRole godoc
+// @Summary Create a custom role
+// @Description Adds a role that can be assigned to users, service accounts and invitations (roles:manage required)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateRoleReq true "Role"
+// @Success 201 {object} RoleResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 409 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/roles [post]
+func (h Auth) CreateRole() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		adminUser, ok := authctx.UserFrom(r.Context())
+		if !ok || adminUser == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		var req CreateRoleReq
+		if !h.decodeBody(w, r, &req) {
+			return
+		}
+
+		role, err := h.S.CreateRole(r.Context(), auth.RoleInput{
+			Code:        req.Code,
+			Name:        req.Name,
+			Description: req.Description,
+			Permissions: req.Permissions,
+		}, adminUser.Username)
+		if err != nil {
+			h.writeRoleError(w, err, "create role")
+			return
+		}
+		writeJSON(w, http.StatusCreated, RoleResp{
+			Code:        role.Code,
+			Name:        role.Name,
+			Description: role.Description,
+			Permissions: role.Permissions,
+		})
+	})
+}
+
+// UpdateRole godoc
+// @Summary Update a custom role
+// @Description Replaces the name and description of a custom role (roles:manage required). Permissions and 2FA are changed with their own endpoints.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param code path string true "Role code"
+// @Param request body UpdateRoleReq true "Role"
+// @Success 200 {object} RoleResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/roles/{code} [put]
+func (h Auth) UpdateRole() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		adminUser, ok := authctx.UserFrom(r.Context())
+		if !ok || adminUser == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		var req UpdateRoleReq
+		if !h.decodeBody(w, r, &req) {
+			return
+		}
+
+		role, err := h.S.UpdateRole(r.Context(), r.PathValue("code"), req.Name, req.Description, adminUser.Username)
+		if err != nil {
+			h.writeRoleError(w, err, "update role")
+			return
+		}
+		perms, err := h.S.PermissionsForRole(r.Context(), role.Code)
+		if err != nil {
+			h.writeRoleError(w, err, "update role")
+			return
+		}
+		writeJSON(w, http.StatusOK, RoleResp{
+			Code:        role.Code,
+			Name:        role.Name,
+			Description: role.Description,
+			Require2FA:  role.Require2FA,
+			Permissions: perms,
+		})
+	})
+}
+
+// DeleteRole godoc
+// @Summary Delete a custom role
+// @Description Deletes a custom role and its permission grants (roles:manage required). Refused with 409 role_in_use while users (including deleted ones) or pending invitations have the role.
+// @Tags admin
+// @Security BearerAuth
+// @Param code path string true "Role code"
+// @Success 204 "No Content"
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 409 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/roles/{code} [delete]
+func (h Auth) DeleteRole() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adminUser, ok := authctx.UserFrom(r.Context())
+		if !ok || adminUser == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		code := r.PathValue("code")
+		if err := h.S.DeleteRole(r.Context(), code); err != nil {
+			h.writeRoleError(w, err, "delete role")
+			return
+		}
+		h.Log.Info("role deleted", "role", code, "by", adminUser.Username)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-demo/internal/auth"
+	"go-demo/internal/authctx"
+	"go-demo/internal/config"
+	"go-demo/internal/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequirePermission(t *testing.T) {
+	h := RequirePermission(db.PermAuditRead)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	call := func(u *db.User, perms ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/admin/audit", nil)
+		if u != nil {
+			req = req.WithContext(authctx.WithPermissions(authctx.WithUser(req.Context(), u), perms))
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	u := &db.User{ID: "u1", Username: "alice", Role: "MONITOR"}
+	require.Equal(t, http.StatusUnauthorized, call(nil).Code)
+	rec := call(u, db.PermSQLLogRead)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), "missing permission "+db.PermAuditRead)
+	require.Equal(t, http.StatusNoContent, call(u, db.PermSQLLogRead, db.PermAuditRead).Code)
+}
+
+func TestMe_ListsPermissions(t *testing.T) {
+	h := NewAuth(auth.NewService(nil, config.Config{}, slog.Default()), slog.Default(), 1024)
+	req := httptest.NewRequest(http.MethodGet, "/v1/auth/me", nil)
+	ctx := authctx.WithUser(req.Context(), &db.User{ID: "u1", Username: "alice", Role: "ANALYZER"})
+	ctx = authctx.WithPermissions(ctx, []string{db.PermSQLLogRead, db.PermAIAnalyze})
+	rec := httptest.NewRecorder()
+	h.Me().ServeHTTP(rec, req.WithContext(ctx))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp UserResp
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, "ANALYZER", resp.Role)
+	require.Equal(t, []string{db.PermAIAnalyze, db.PermSQLLogRead}, resp.Permissions)
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"go-demo/internal/auth"
+	"go-demo/internal/authctx"
+
+	"github.com/google/uuid"
+)
+
+type LogoutReq struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type SessionResp struct {
+	ID         string    `json:"id"`
+	Label      string    `json:"label"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// withClient records the caller's user agent and address for session metadata.
+func withClient(r *http.Request) context.Context {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return authctx.WithClient(r.Context(), authctx.Client{UserAgent: r.UserAgent(), IP: ip})
+}
+
+func toSessionResps(sessions []auth.Session, currentID string) []SessionResp {
+	out := make([]SessionResp, 0, len(sessions))
+	for _, s := range sessions {
+		out = append(out, SessionResp{
+			ID:         s.ID,
+			Label:      s.Label,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    currentID != "" && s.ID == currentID,
+		})
+	}
+	return out
+}
+
+// Logout godoc
+// @Summary Log out
+// @Description Revokes the access token used for the request and ends its session. A refresh_token in the body ends that token's session too.
+// @Tags auth
+// @Accept json
+// @Security BearerAuth
+// @Param request body LogoutReq false "Refresh token to revoke"
+// @Success 204 "No Content"
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/auth/logout [post]
+func (h Auth) Logout() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		u, ok := authctx.UserFrom(r.Context())
+		if !ok || u == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		tok, _ := authctx.TokenFrom(r.Context())
+
+		var req LogoutReq
+		dec := json.NewDecoder(io.LimitReader(r.Body, h.MaxBodyBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, http.StatusBadRequest, "bad_request", "invalid JSON payload")
+			return
+		}
+
+		if err := h.S.Logout(r.Context(), u.ID, tok.ID, tok.ExpiresAt, tok.SessionID, req.RefreshToken); err != nil {
+			h.Log.Error("logout failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not log out")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// LogoutAll godoc
+// @Summary Log out everywhere
+// @Description Revokes all of the caller's refresh tokens and invalidates every access token issued to them.
+// @Tags auth
+// @Security BearerAuth
+// @Success 204 "No Content"
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/auth/logout-all [post]
+func (h Auth) LogoutAll() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := authctx.UserFrom(r.Context())
+		if !ok || u == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		if err := h.S.RevokeAllSessions(r.Context(), u.ID); err != nil {
+			h.Log.Error("logout all failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not log out")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// RevokeUserSessions godoc
+// @Summary Revoke a user's sessions (Admin only)
+// @Description Revokes all refresh tokens of a user and invalidates their access tokens (users:manage required)
+// @Tags admin
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/users/{id}/sessions [delete]
+func (h Auth) RevokeUserSessions() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adminUser, ok := authctx.UserFrom(r.Context())
+		if !ok || adminUser == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		userID := r.PathValue("id")
+		if _, err := uuid.Parse(userID); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_path", "user ID must be a UUID")
+			return
+		}
+		if err := h.S.RevokeAllSessions(r.Context(), userID); err != nil {
+			if errors.Is(err, auth.ErrUserNotFound) {
+				writeError(w, http.StatusNotFound, "user_not_found", "user not found")
+				return
+			}
+			h.Log.Error("revoke user sessions failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not revoke sessions")
+			return
+		}
+		h.Log.Info("user sessions revoked", "user_id", userID, "by", adminUser.Username)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// ListSessions godoc
+// @Summary List my sessions
+// @Description Lists the devices the caller is signed in on. The session of the current access token is flagged with current=true.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} SessionResp
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/auth/sessions [get]
+func (h Auth) ListSessions() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := authctx.UserFrom(r.Context())
+		if !ok || u == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		sessions, err := h.S.ListSessions(r.Context(), u.ID)
+		if err != nil {
+			h.Log.Error("list sessions failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not list sessions")
+			return
+		}
+		tok, _ := authctx.TokenFrom(r.Context())
+		writeJSON(w, http.StatusOK, toSessionResps(sessions, tok.SessionID))
+	})
+}
+
+// RevokeSession godoc
+// @Summary Revoke one of my sessions
+// @Description Signs the caller out on one device; its refresh and access tokens stop working.
+// @Tags auth
+// @Security BearerAuth
+// @Param id path string true "Session ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/auth/sessions/{id} [delete]
+func (h Auth) RevokeSession() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := authctx.UserFrom(r.Context())
+		if !ok || u == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		h.revokeSession(w, r, u.ID, r.PathValue("id"))
+	})
+}
+
+// ListUserSessions godoc
+// @Summary List a user's sessions (Admin only)
+// @Description Lists the devices a user is signed in on (users:manage required)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {array} SessionResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/users/{id}/sessions [get]
+func (h Auth) ListUserSessions() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.PathValue("id")
+		if _, err := uuid.Parse(userID); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_path", "user ID must be a UUID")
+			return
+		}
+		sessions, err := h.S.ListSessions(r.Context(), userID)
+		if err != nil {
+			h.Log.Error("list user sessions failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not list sessions")
+			return
+		}
+		writeJSON(w, http.StatusOK, toSessionResps(sessions, ""))
+	})
+}
+
+// RevokeUserSession godoc
+// @Summary Revoke one of a user's sessions (Admin only)
+// @Description Signs a user out on one device (users:manage required)
+// @Tags admin
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param session_id path string true "Session ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/users/{id}/sessions/{session_id} [delete]
+func (h Auth) RevokeUserSession() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adminUser, ok := authctx.UserFrom(r.Context())
+		if !ok || adminUser == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		userID := r.PathValue("id")
+		if _, err := uuid.Parse(userID); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_path", "user ID must be a UUID")
+			return
+		}
+		if h.revokeSession(w, r, userID, r.PathValue("session_id")) {
+			h.Log.Info("user session revoked", "user_id", userID, "session_id", r.PathValue("session_id"), "by", adminUser.Username)
+		}
+	})
+}
+
+// revokeSession ends sessionID of userID and writes the response. It reports whether a session was revoked.
+func (h Auth) revokeSession(w http.ResponseWriter, r *http.Request, userID, sessionID string) bool {
+	if _, err := uuid.Parse(sessionID); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_path", "session ID must be a UUID")
+		return false
+	}
+	if err := h.S.RevokeSession(r.Context(), userID, sessionID); err != nil {
+		if errors.Is(err, auth.ErrSessionNotFound) {
+			writeError(w, http.StatusNotFound, "session_not_found", "session not found")
+			return false
+		}
+		h.Log.Error("revoke session failed", "err", err)
+		writeError(w, http.StatusInternalServerError, "server_error", "could not revoke session")
+		return false
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-demo/internal/authctx"
+	"go-demo/internal/sqllog"
+
+	"github.com/google/uuid"
+)
+
+type SQLLogGrants struct {
+	repo         *sqllog.Repository
+	log          *slog.Logger
+	maxBodyBytes int64
+}
+
+func NewSQLLogGrants(repo *sqllog.Repository, log *slog.Logger, maxBodyBytes int64) *SQLLogGrants {
+	if log == nil {
+		log = slog.Default()
+	}
+	return &SQLLogGrants{repo: repo, log: log, maxBodyBytes: maxBodyBytes}
+}
+
+type DBGrantReq struct {
+	SubjectType string `json:"subject_type"`
+	SubjectID   string `json:"subject_id"`
+	DBName      string `json:"db_name"`
+}
+
+type DBGrantResp struct {
+	ID          uint64    `json:"id"`
+	SubjectType string    `json:"subject_type"`
+	SubjectID   string    `json:"subject_id"`
+	DBName      string    `json:"db_name"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type ListDBGrantsResponse struct {
+	Items []DBGrantResp `json:"items"`
+}
+
+func toDBGrantResp(g sqllog.DBGrant) DBGrantResp {
+	return DBGrantResp{
+		ID:          g.ID,
+		SubjectType: g.SubjectType,
+		SubjectID:   g.SubjectID,
+		DBName:      g.DBName,
+		CreatedBy:   g.CreatedBy,
+		CreatedAt:   g.CreatedAt,
+	}
+}
+
+// List godoc
+// @Summary List database grants
+// @Description Lists which subjects may read which databases' SQL logs (grants:manage required). Users with sqllog:all_dbs see every database without grants.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param subject_type query string false "Filter by subject type (user, team)"
+// @Param subject_id query string false "Filter by subject ID"
+// @Param db query string false "Filter by database name"
+// @Success 200 {object} ListDBGrantsResponse
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/db-grants [get]
+func (h *SQLLogGrants) List() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		grants, err := h.repo.ListGrants(r.Context(),
+			strings.TrimSpace(q.Get("subject_type")),
+			strings.TrimSpace(q.Get("subject_id")),
+			strings.TrimSpace(q.Get("db")),
+		)
+		if err != nil {
+			h.log.Error("list grants failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "internal_error", "could not list grants")
+			return
+		}
+		items := make([]DBGrantResp, 0, len(grants))
+		for _, g := range grants {
+			items = append(items, toDBGrantResp(g))
+		}
+		writeJSON(w, http.StatusOK, ListDBGrantsResponse{Items: items})
+	})
+}
+
+// Create godoc
+// @Summary Grant access to a database
+// @Description Allows a subject to read one database's SQL logs, reports and AI analysis (grants:manage required).
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body DBGrantReq true "Grant"
+// @Success 201 {object} DBGrantResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 409 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/db-grants [post]
+func (h *SQLLogGrants) Create() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		adminUser, ok := authctx.UserFrom(r.Context())
+		if !ok || adminUser == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+
+		dec := json.NewDecoder(io.LimitReader(r.Body, h.maxBodyBytes))
+		dec.DisallowUnknownFields()
+
+		var req DBGrantReq
+		if err := dec.Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "bad_request", "invalid JSON payload")
+			return
+		}
+		req.SubjectType = strings.ToLower(strings.TrimSpace(req.SubjectType))
+		req.SubjectID = strings.TrimSpace(req.SubjectID)
+		req.DBName = strings.TrimSpace(req.DBName)
+		if req.SubjectType == "" {
+			req.SubjectType = sqllog.GrantSubjectUser
+		}
+		if req.SubjectID == "" {
+			writeError(w, http.StatusBadRequest, "bad_request", "subject_id is required")
+			return
+		}
+		if !dbNameRE.MatchString(req.DBName) {
+			writeError(w, http.StatusBadRequest, "bad_request", "invalid db_name; allowed [A-Za-z0-9_.-], max length 128")
+			return
+		}
+		if _, err := uuid.Parse(req.SubjectID); err != nil {
+			writeError(w, http.StatusBadRequest, "bad_request", "subject_id must be a UUID")
+			return
+		}
+
+		g := sqllog.DBGrant{
+			SubjectType: req.SubjectType,
+			SubjectID:   req.SubjectID,
+			DBName:      req.DBName,
+			CreatedBy:   adminUser.Username,
+		}
+		if err := h.repo.CreateGrant(r.Context(), &g); err != nil {
+			switch {
+			case errors.Is(err, sqllog.ErrGrantSubjectType):
+				writeError(w, http.StatusBadRequest, "bad_request", "invalid subject_type")
+			case errors.Is(err, sqllog.ErrGrantSubject):
+				writeError(w, http.StatusNotFound, "subject_not_found", "grant subject not found")
+			case errors.Is(err, sqllog.ErrGrantExists):
+				writeError(w, http.StatusConflict, "grant_exists", "grant already exists")
+			default:
+				h.log.Error("create grant failed", "err", err)
+				writeError(w, http.StatusInternalServerError, "internal_error", "could not create grant")
+			}
+			return
+		}
+		h.log.Info("db grant created", "by", adminUser.Username, "subject_type", g.SubjectType, "subject_id", g.SubjectID, "db_name", g.DBName)
+		writeJSON(w, http.StatusCreated, toDBGrantResp(g))
+	})
+}
+
+// Delete godoc
+// @Summary Revoke a database grant
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Grant ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/db-grants/{id} [delete]
+func (h *SQLLogGrants) Delete() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adminUser, ok := authctx.UserFrom(r.Context())
+		if !ok || adminUser == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil || id == 0 {
+			writeError(w, http.StatusBadRequest, "invalid_path", "grant ID must be a positive integer")
+			return
+		}
+		if err := h.repo.DeleteGrant(r.Context(), id); err != nil {
+			if errors.Is(err, sqllog.ErrGrantNotFound) {
+				writeError(w, http.StatusNotFound, "grant_not_found", "grant not found")
+				return
+			}
+			h.log.Error("delete grant failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "internal_error", "could not delete grant")
+			return
+		}
+		h.log.Info("db grant deleted", "by", adminUser.Username, "id", id)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -7,6 +7,8 @@ import (
 
 	"log/slog"
 
+	"go-demo/internal/authctx"
+	"go-demo/internal/db"
 	"go-demo/internal/sqllog"
 )
 
@@ -28,9 +30,10 @@ type ListDatabasesResponse struct {
 }
 
 type SQLLogItem struct {
-	SQLQuery   string `json:"sql_query"`
-	ExecTimeMs int64  `json:"exec_time_ms"`
-	ExecCount  int64  `json:"exec_count"`
+	SQLQuery    string `json:"sql_query"`
+	SQLQueryRaw string `json:"sql_query_raw,omitempty"`
+	ExecTimeMs  int64  `json:"exec_time_ms"`
+	ExecCount   int64  `json:"exec_count"`
 }
 
 type ListByDBResponse struct {
@@ -40,16 +43,18 @@ type ListByDBResponse struct {
 
 // Internal response item type used at runtime
 type sqlLogItem struct {
-	SQLQuery   string `json:"sql_query"`
-	ExecTimeMs int64  `json:"exec_time_ms"`
-	ExecCount  int64  `json:"exec_count"`
+	SQLQuery    string `json:"sql_query"`
+	SQLQueryRaw string `json:"sql_query_raw,omitempty"`
+	ExecTimeMs  int64  `json:"exec_time_ms"`
+	ExecCount   int64  `json:"exec_count"`
 }
 
 // ListDatabases godoc
 // @Summary List databases with SQL logs
-// @Description Returns distinct database names that have SQL log entries.
+// @Description Returns distinct database names that have SQL log entries and that the caller has been granted.
 // @Tags sql-logs
 // @Produce json
+// @Param team query string false "Only databases granted to this team ID"
 // @Success 200 {object} ListDatabasesResponse
 // @Failure 500 {object} ErrorEnvelope
 // @Router /v1/sql-logs/databases [get]
@@ -88,12 +93,14 @@ func (h *SQLLogQuery) ListDatabases() http.Handler {
 
 // ListByDB godoc
 // @Summary List SQL queries by database
-// @Description Provide database name via query parameter "db" to list its SQL queries.
+// @Description Provide database name via query parameter "db" to list its SQL queries. "sql_query_raw" (unredacted text) is only returned to callers with the sqllog:raw permission when raw retention is enabled.
 // @Tags sql-logs
 // @Produce json
 // @Param db query string true "Database name"
+// @Param team query string false "Only databases granted to this team ID"
 // @Success 200 {object} ListByDBResponse
 // @Failure 400 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
 // @Failure 500 {object} ErrorEnvelope
 // @Router /v1/sql-logs [get]
 func (h *SQLLogQuery) ListByDB() http.Handler {
@@ -112,6 +119,17 @@ func (h *SQLLogQuery) ListByDB() http.Handler {
 			return
 		}
 
+		allowed, err := h.repo.CanAccessDB(r.Context(), dbName)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "internal_error", "failed to check access")
+			h.log.Error("check db access failed", "db", dbName, "err", err)
+			return
+		}
+		if !allowed {
+			writeError(w, http.StatusForbidden, "forbidden", "no access to this database")
+			return
+		}
+
 		rows, err := h.repo.FindByDB(r.Context(), dbName)
 		if err != nil {
 			writeError(w, http.StatusInternalServerError, "internal_error", "failed to query logs")
@@ -125,16 +143,26 @@ func (h *SQLLogQuery) ListByDB() http.Handler {
 			})
 			return
 		}
+		showRaw := canViewRawSQL(r)
 		items := make([]sqlLogItem, 0, len(rows))
 		for _, r := range rows {
-			items = append(items, sqlLogItem{
+			it := sqlLogItem{
 				SQLQuery:   r.SQLQuery,
 				ExecTimeMs: r.ExecTimeMs,
 				ExecCount:  r.ExecCount,
-			})
+			}
+			if showRaw && r.SQLQueryRaw != nil {
+				it.SQLQueryRaw = *r.SQLQueryRaw
+			}
+			items = append(items, it)
 		}
 		writeJSON(w, http.StatusOK, map[string]any{
 			"items": items,
 		})
 	})
 }
+
+// canViewRawSQL reports whether the caller may see unredacted query text.
+func canViewRawSQL(r *http.Request) bool {
+	return authctx.HasPermission(r.Context(), db.PermSQLLogRaw)
+}
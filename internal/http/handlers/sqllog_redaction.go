@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"go-demo/internal/authctx"
+	"go-demo/internal/sqllog"
+)
+
+type SQLLogRedaction struct {
+	repo         *sqllog.Repository
+	log          *slog.Logger
+	maxBodyBytes int64
+}
+
+func NewSQLLogRedaction(repo *sqllog.Repository, log *slog.Logger, maxBodyBytes int64) *SQLLogRedaction {
+	if log == nil {
+		log = slog.Default()
+	}
+	return &SQLLogRedaction{repo: repo, log: log, maxBodyBytes: maxBodyBytes}
+}
+
+// RedactionPolicyReq is the body of PUT /v1/admin/redaction.
+type RedactionPolicyReq struct {
+	RedactAtIngest bool                   `json:"redact_at_ingest"`
+	RedactAtExport bool                   `json:"redact_at_export"`
+	RetainRaw      bool                   `json:"retain_raw"`
+	Rules          []sqllog.RedactionRule `json:"rules"`
+}
+
+// RedactionPolicyResp describes the effective redaction policy.
+type RedactionPolicyResp struct {
+	RedactAtIngest bool                   `json:"redact_at_ingest"`
+	RedactAtExport bool                   `json:"redact_at_export"`
+	RetainRaw      bool                   `json:"retain_raw"`
+	Rules          []sqllog.RedactionRule `json:"rules"`
+	DefaultRules   []sqllog.RedactionRule `json:"default_rules"`
+}
+
+func toRedactionPolicyResp(p sqllog.RedactionPolicy) RedactionPolicyResp {
+	rules := p.Rules
+	if rules == nil {
+		rules = []sqllog.RedactionRule{}
+	}
+	return RedactionPolicyResp{
+		RedactAtIngest: p.RedactAtIngest,
+		RedactAtExport: p.RedactAtExport,
+		RetainRaw:      p.RetainRaw,
+		Rules:          rules,
+		DefaultRules:   sqllog.DefaultPIIRules,
+	}
+}
+
+// GetPolicy godoc
+// @Summary Get SQL redaction policy
+// @Description Requires redaction:manage. Returns where redaction is applied and the custom PII rules. Queries are always redacted before being sent to the AI provider.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} RedactionPolicyResp
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/redaction [get]
+func (h *SQLLogRedaction) GetPolicy() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := h.repo.RedactionPolicy(r.Context())
+		if err != nil {
+			h.log.Error("load redaction policy failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "internal_error", "could not load redaction policy")
+			return
+		}
+		writeJSON(w, http.StatusOK, toRedactionPolicyResp(p))
+	})
+}
+
+// UpdatePolicy godoc
+// @Summary Update SQL redaction policy
+// @Description Requires redaction:manage. Toggles redaction at ingest and export, raw text retention (visible with sqllog:raw only) and custom regex rules. Applies to data ingested or exported afterwards; other instances pick up the change within 10 seconds.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body RedactionPolicyReq true "Redaction policy"
+// @Success 200 {object} RedactionPolicyResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/redaction [put]
+func (h *SQLLogRedaction) UpdatePolicy() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		adminUser, ok := authctx.UserFrom(r.Context())
+		if !ok || adminUser == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+
+		dec := json.NewDecoder(io.LimitReader(r.Body, h.maxBodyBytes))
+		dec.DisallowUnknownFields()
+
+		var req RedactionPolicyReq
+		if err := dec.Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "bad_request", "invalid JSON payload")
+			return
+		}
+		for _, rule := range req.Rules {
+			if rule.Name == "" {
+				writeError(w, http.StatusBadRequest, "invalid_rule", "every rule needs a name")
+				return
+			}
+		}
+		// Checked here so a bad pattern is reported as a client error.
+		if _, err := sqllog.NewRedactor(req.Rules); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_rule", err.Error())
+			return
+		}
+
+		p, err := h.repo.UpdateRedactionPolicy(r.Context(), sqllog.RedactionPolicy{
+			RedactAtIngest: req.RedactAtIngest,
+			RedactAtExport: req.RedactAtExport,
+			RetainRaw:      req.RetainRaw,
+			Rules:          req.Rules,
+			UpdatedBy:      adminUser.Username,
+		})
+		if err != nil {
+			h.log.Error("update redaction policy failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "internal_error", "could not update redaction policy")
+			return
+		}
+		h.log.Info("redaction policy updated",
+			"by", adminUser.Username,
+			"redact_at_ingest", p.RedactAtIngest,
+			"redact_at_export", p.RedactAtExport,
+			"retain_raw", p.RetainRaw,
+			"rules", len(p.Rules),
+		)
+		writeJSON(w, http.StatusOK, toRedactionPolicyResp(p))
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"go-demo/internal/audit"
 	"go-demo/internal/sqllog"
 )
 
@@ -16,6 +17,9 @@ type SQLLogReport struct {
 	repo         *sqllog.Repository
 	log          *slog.Logger
 	maxBodyBytes int64
+
+	// Audit records CSV and PDF exports; nil disables.
+	Audit *audit.Recorder
 }
 
 func NewSQLLogReport(repo *sqllog.Repository, log *slog.Logger, maxBodyBytes int64) *SQLLogReport {
@@ -27,7 +31,7 @@ func NewSQLLogReport(repo *sqllog.Repository, log *slog.Logger, maxBodyBytes int
 
 // ReportJSON godoc
 // @Summary SQL log report (JSON)
-// @Description Aggregated anomalies and metrics within a time range. Defaults: last 7 days. Thresholds: slow_ms >= 1000 OR (exec_time_ms >= 500 AND exec_count >= 100).
+// @Description Aggregated anomalies and metrics within a time range. Defaults: last 7 days. Thresholds: slow_ms >= 1000 OR (exec_time_ms >= 500 AND exec_count >= 100). Anomaly SQL is redacted when the redaction policy enables it at export.
 // @Tags sql-logs
 // @Produce json
 // @Security BearerAuth
@@ -41,6 +45,7 @@ func NewSQLLogReport(repo *sqllog.Repository, log *slog.Logger, maxBodyBytes int
 // @Param cap query int false "Hard cap upper bound for anomalies count"
 // @Param pcts query string false "Comma separated percentiles in 0..100. Default 50,75,90,95,99"
 // @Param top_patterns query int false "Top query patterns count. Default 20, min 1, max 200"
+// @Param team query string false "Only databases granted to this team ID"
 // @Success 200 {object} sqllog.ReportData
 // @Failure 400 {object} ErrorEnvelope
 // @Failure 500 {object} ErrorEnvelope
@@ -62,13 +67,18 @@ func (h *SQLLogReport) ReportJSON() http.Handler {
 			writeError(w, http.StatusInternalServerError, "internal_error", "could not build report")
 			return
 		}
+		if err := h.repo.RedactForExport(r.Context(), &data); err != nil {
+			h.log.Error("redact report failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "internal_error", "could not build report")
+			return
+		}
 		writeJSON(w, http.StatusOK, data)
 	})
 }
 
 // ReportCSV godoc
 // @Summary SQL log report (CSV)
-// @Description Download the aggregated report as CSV.
+// @Description Download the aggregated report as CSV. Anomaly SQL is redacted when the redaction policy enables it at export.
 // @Tags sql-logs
 // @Produce text/csv
 // @Security BearerAuth
@@ -82,6 +92,7 @@ func (h *SQLLogReport) ReportJSON() http.Handler {
 // @Param cap query int false "Hard cap upper bound for anomalies count"
 // @Param pcts query string false "Comma separated percentiles in 0..100. Default 50,75,90,95,99"
 // @Param top_patterns query int false "Top query patterns count. Default 20, min 1, max 200"
+// @Param team query string false "Only databases granted to this team ID"
 // @Success 200 {string} string "CSV content"
 // @Failure 400 {object} ErrorEnvelope
 // @Failure 500 {object} ErrorEnvelope
@@ -103,12 +114,18 @@ func (h *SQLLogReport) ReportCSV() http.Handler {
 			writeError(w, http.StatusInternalServerError, "internal_error", "could not build report")
 			return
 		}
+		if err := h.repo.RedactForExport(r.Context(), &data); err != nil {
+			h.log.Error("redact report failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "internal_error", "could not build report")
+			return
+		}
 		b, err := h.repo.ExportCSV(data)
 		if err != nil {
 			h.log.Error("export csv failed", "err", err)
 			writeError(w, http.StatusInternalServerError, "internal_error", "could not export csv")
 			return
 		}
+		h.auditExport(r, filter, "csv")
 		name := buildFilename("csv")
 		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
 		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
@@ -118,7 +135,7 @@ func (h *SQLLogReport) ReportCSV() http.Handler {
 
 // ReportPDF godoc
 // @Summary SQL log report (PDF)
-// @Description Download the aggregated report as PDF.
+// @Description Download the aggregated report as PDF. Anomaly SQL is redacted when the redaction policy enables it at export.
 // @Tags sql-logs
 // @Produce application/pdf
 // @Security BearerAuth
@@ -132,6 +149,7 @@ func (h *SQLLogReport) ReportCSV() http.Handler {
 // @Param cap query int false "Hard cap upper bound for anomalies count"
 // @Param pcts query string false "Comma separated percentiles in 0..100. Default 50,75,90,95,99"
 // @Param top_patterns query int false "Top query patterns count. Default 20, min 1, max 200"
+// @Param team query string false "Only databases granted to this team ID"
 // @Success 200 {string} string "PDF content"
 // @Failure 400 {object} ErrorEnvelope
 // @Failure 500 {object} ErrorEnvelope
@@ -153,12 +171,18 @@ func (h *SQLLogReport) ReportPDF() http.Handler {
 			writeError(w, http.StatusInternalServerError, "internal_error", "could not build report")
 			return
 		}
+		if err := h.repo.RedactForExport(r.Context(), &data); err != nil {
+			h.log.Error("redact report failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "internal_error", "could not build report")
+			return
+		}
 		b, err := h.repo.ExportPDF(data)
 		if err != nil {
 			h.log.Error("export pdf failed", "err", err)
 			writeError(w, http.StatusInternalServerError, "internal_error", "could not export pdf")
 			return
 		}
+		h.auditExport(r, filter, "pdf")
 		name := buildFilename("pdf")
 		w.Header().Set("Content-Type", "application/pdf")
 		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
@@ -166,6 +190,23 @@ func (h *SQLLogReport) ReportPDF() http.Handler {
 	})
 }
 
+// auditExport records a report download.
+func (h *SQLLogReport) auditExport(r *http.Request, f sqllog.ReportFilter, format string) {
+	details := map[string]any{
+		"format": format,
+		"from":   f.From.Format(time.RFC3339),
+		"to":     f.To.Format(time.RFC3339),
+	}
+	if team := r.URL.Query().Get("team"); team != "" {
+		details["team"] = team
+	}
+	e := audit.Event{Action: audit.ActionReportExport, Details: details}
+	if f.DB != "" {
+		e.TargetType, e.TargetID = audit.TargetDatabase, f.DB
+	}
+	h.Audit.Record(r.Context(), e)
+}
+
 // parseReportFilter reads from,to,db,limit from query.
 // - from/to accept RFC3339 or "2006-01-02" (date only). Defaults to last 7 days.
 // - limit defaults to 500 and max 5000.
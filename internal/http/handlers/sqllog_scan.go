@@ -30,6 +30,7 @@ func NewSQLLogScan(repo *sqllog.Repository, log *slog.Logger) *SQLLogScan {
 // @Param dbName query string false "Database name to filter results"
 // @Param exec_time_ms query int false "Minimum exec_time_ms to be considered abnormal" default(500)
 // @Param exec_count query int false "Minimum exec_count to be considered abnormal" default(100)
+// @Param team query string false "Only databases granted to this team ID"
 // @Success 200 {object} map[string]any
 // @Failure 400 {object} ErrorEnvelope
 // @Failure 500 {object} ErrorEnvelope
@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"go-demo/internal/audit"
 	"go-demo/internal/sqllog"
 )
 
@@ -18,6 +19,9 @@ type SQLLogUpload struct {
 	repo         *sqllog.Repository
 	log          *slog.Logger
 	maxBodyBytes int64
+
+	// Audit records uploads; nil disables.
+	Audit *audit.Recorder
 }
 
 func NewSQLLogUpload(repo *sqllog.Repository, log *slog.Logger, maxBodyBytes int64) *SQLLogUpload {
@@ -115,6 +119,12 @@ func (h *SQLLogUpload) Upload() http.Handler {
 			}
 			inserted = len(entries)
 		}
+		h.Audit.Record(ctx, audit.Event{
+			Action:     audit.ActionSQLLogUpload,
+			TargetType: audit.TargetFile,
+			TargetID:   header.Filename,
+			Details:    map[string]any{"total_lines": total, "inserted": inserted, "skipped": skipped},
+		})
 
 		if total == 0 || inserted == 0 && skipped > 0 {
 			// No valid records
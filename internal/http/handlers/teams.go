@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"go-demo/internal/auth"
+	"go-demo/internal/authctx"
+	"go-demo/internal/db"
+
+	"github.com/google/uuid"
+)
+
+type CreateTeamReq struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type TeamResp struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedTime time.Time `json:"created_time"`
+}
+
+type TeamMemberResp struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	IsLeader bool   `json:"is_leader"`
+}
+
+type SetTeamMemberReq struct {
+	Leader bool `json:"leader"`
+}
+
+func toTeamResp(t db.Team) TeamResp {
+	return TeamResp{
+		ID:          t.ID,
+		Name:        t.Name,
+		Description: t.Description,
+		CreatedBy:   t.CreatedBy,
+		CreatedTime: t.CreatedTime,
+	}
+}
+
+// writeTeamError maps team service errors to responses.
+func (h Auth) writeTeamError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, auth.ErrTeamNotFound):
+		writeError(w, http.StatusNotFound, "team_not_found", "team not found")
+	case errors.Is(err, auth.ErrUserNotFound):
+		writeError(w, http.StatusNotFound, "user_not_found", "user not found")
+	case errors.Is(err, auth.ErrMemberNotFound):
+		writeError(w, http.StatusNotFound, "member_not_found", "user is not a member of this team")
+	case errors.Is(err, auth.ErrNotTeamLeader), errors.Is(err, auth.ErrLeaderProtected):
+		writeError(w, http.StatusForbidden, "forbidden", err.Error())
+	default:
+		h.Log.Error(action+" failed", "err", err)
+		writeError(w, http.StatusInternalServerError, "server_error", "could not "+action)
+	}
+}
+
+// CreateTeam godoc
+// @Summary Create team
+// @Description Creates a team (teams:manage required). Grant it databases via /v1/admin/db-grants with subject_type "team".
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateTeamReq true "Team"
+// @Success 201 {object} TeamResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 409 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/teams [post]
+func (h Auth) CreateTeam() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		adminUser, ok := authctx.UserFrom(r.Context())
+		if !ok || adminUser == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+
+		dec := json.NewDecoder(io.LimitReader(r.Body, h.MaxBodyBytes))
+		dec.DisallowUnknownFields()
+
+		var req CreateTeamReq
+		if err := dec.Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "bad_request", "invalid JSON payload")
+			return
+		}
+		if req.Name == "" {
+			writeError(w, http.StatusBadRequest, "bad_request", "name is required")
+			return
+		}
+
+		t, err := h.S.CreateTeam(r.Context(), req.Name, req.Description, adminUser.Username)
+		if err != nil {
+			if errors.Is(err, auth.ErrTeamExists) {
+				writeError(w, http.StatusConflict, "team_exists", "team already exists")
+				return
+			}
+			h.Log.Error("create team failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not create team")
+			return
+		}
+		writeJSON(w, http.StatusCreated, toTeamResp(*t))
+	})
+}
+
+// DeleteTeam godoc
+// @Summary Delete team
+// @Description Deletes a team with its memberships and database grants (teams:manage required)
+// @Tags teams
+// @Security BearerAuth
+// @Param id path string true "Team ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/teams/{id} [delete]
+func (h Auth) DeleteTeam() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		teamID := r.PathValue("id")
+		if _, err := uuid.Parse(teamID); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_path", "team ID must be a UUID")
+			return
+		}
+		if err := h.S.DeleteTeam(r.Context(), teamID); err != nil {
+			h.writeTeamError(w, err, "delete team")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// ListTeams godoc
+// @Summary List teams
+// @Description Team managers see all teams; other users see the teams they belong to.
+// @Tags teams
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} TeamResp
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/teams [get]
+func (h Auth) ListTeams() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := authctx.UserFrom(r.Context())
+		if !ok || u == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		userID := u.ID
+		if authctx.HasPermission(r.Context(), db.PermTeamsManage) {
+			userID = ""
+		}
+		teams, err := h.S.ListTeams(r.Context(), userID)
+		if err != nil {
+			h.Log.Error("list teams failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not list teams")
+			return
+		}
+		resp := make([]TeamResp, 0, len(teams))
+		for _, t := range teams {
+			resp = append(resp, toTeamResp(t))
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
+
+// ListTeamMembers godoc
+// @Summary List team members
+// @Description Visible to team members and team managers.
+// @Tags teams
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Team ID"
+// @Success 200 {array} TeamMemberResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/teams/{id}/members [get]
+func (h Auth) ListTeamMembers() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := authctx.UserFrom(r.Context())
+		if !ok || u == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		teamID := r.PathValue("id")
+		if _, err := uuid.Parse(teamID); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_path", "team ID must be a UUID")
+			return
+		}
+		if !authctx.HasPermission(r.Context(), db.PermTeamsManage) {
+			m, err := h.S.TeamMembership(r.Context(), teamID, u.ID)
+			if err != nil {
+				h.writeTeamError(w, err, "list team members")
+				return
+			}
+			if m == nil {
+				writeError(w, http.StatusForbidden, "forbidden", "not a member of this team")
+				return
+			}
+		}
+		members, err := h.S.ListTeamMembers(r.Context(), teamID)
+		if err != nil {
+			h.writeTeamError(w, err, "list team members")
+			return
+		}
+		resp := make([]TeamMemberResp, 0, len(members))
+		for _, m := range members {
+			resp = append(resp, TeamMemberResp{UserID: m.UserID, Username: m.Username, Email: m.Email, IsLeader: m.IsLeader})
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
+
+// SetTeamMember godoc
+// @Summary Add or update a team member
+// @Description Team leaders may add regular members to their own team; only team managers may set leader=true or change a leader.
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Team ID"
+// @Param user_id path string true "User ID"
+// @Param request body SetTeamMemberReq false "Membership"
+// @Success 204 "No Content"
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/teams/{id}/members/{user_id} [put]
+func (h Auth) SetTeamMember() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		u, ok := authctx.UserFrom(r.Context())
+		if !ok || u == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		teamID, userID, ok := teamMemberPath(w, r)
+		if !ok {
+			return
+		}
+
+		var req SetTeamMemberReq
+		dec := json.NewDecoder(io.LimitReader(r.Body, h.MaxBodyBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, http.StatusBadRequest, "bad_request", "invalid JSON payload")
+			return
+		}
+
+		asManager := authctx.HasPermission(r.Context(), db.PermTeamsManage)
+		if err := h.S.SetTeamMember(r.Context(), teamID, userID, req.Leader, u, asManager); err != nil {
+			h.writeTeamError(w, err, "set team member")
+			return
+		}
+		h.Log.Info("team member set", "team_id", teamID, "user_id", userID, "leader", req.Leader, "by", u.Username)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// RemoveTeamMember godoc
+// @Summary Remove a team member
+// @Description Team leaders may remove regular members from their own team; team managers may remove anyone.
+// @Tags teams
+// @Security BearerAuth
+// @Param id path string true "Team ID"
+// @Param user_id path string true "User ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/teams/{id}/members/{user_id} [delete]
+func (h Auth) RemoveTeamMember() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := authctx.UserFrom(r.Context())
+		if !ok || u == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		teamID, userID, ok := teamMemberPath(w, r)
+		if !ok {
+			return
+		}
+		asManager := authctx.HasPermission(r.Context(), db.PermTeamsManage)
+		if err := h.S.RemoveTeamMember(r.Context(), teamID, userID, u, asManager); err != nil {
+			h.writeTeamError(w, err, "remove team member")
+			return
+		}
+		h.Log.Info("team member removed", "team_id", teamID, "user_id", userID, "by", u.Username)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func teamMemberPath(w http.ResponseWriter, r *http.Request) (teamID, userID string, ok bool) {
+	teamID, userID = r.PathValue("id"), r.PathValue("user_id")
+	if _, err := uuid.Parse(teamID); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_path", "team ID must be a UUID")
+		return "", "", false
+	}
+	if _, err := uuid.Parse(userID); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_path", "user ID must be a UUID")
+		return "", "", false
+	}
+	return teamID, userID, true
+}
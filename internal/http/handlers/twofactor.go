@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"go-demo/internal/auth"
+	"go-demo/internal/authctx"
+
+	"github.com/google/uuid"
+)
+
+type LoginChallengeResp struct {
+	ChallengeToken string    `json:"challenge_token"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+type LoginTwoFactorReq struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"` // TOTP or recovery code
+}
+
+type TwoFactorSetupResp struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type TwoFactorCodeReq struct {
+	Code string `json:"code"`
+}
+
+type RecoveryCodesResp struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type SetRoleTwoFactorReq struct {
+	Required bool `json:"required"`
+}
+
+// LoginTwoFactor godoc
+// @Summary Complete login with a second factor
+// @Description Exchanges the challenge token from /v1/auth/login and a TOTP or recovery code for access and refresh tokens. Wrong codes count as failed logins.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body LoginTwoFactorReq true "Challenge and code"
+// @Success 200 {object} LoginResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 423 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/auth/login/2fa [post]
+func (h Auth) LoginTwoFactor() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		var req LoginTwoFactorReq
+		if !h.decodeBody(w, r, &req) {
+			return
+		}
+		if req.ChallengeToken == "" || req.Code == "" {
+			writeError(w, http.StatusBadRequest, "bad_request", "challenge_token and code are required")
+			return
+		}
+
+		u, tok, exp, rtok, rexp, err := h.S.CompleteLogin(withClient(r), req.ChallengeToken, req.Code)
+		if err != nil {
+			var locked *auth.LockedError
+			switch {
+			case errors.Is(err, auth.ErrInvalidUserToken):
+				writeError(w, http.StatusUnauthorized, "invalid_challenge", "login challenge is invalid or expired; log in again")
+			case errors.Is(err, auth.ErrInvalidOTP):
+				writeError(w, http.StatusUnauthorized, "invalid_code", "invalid two-factor code")
+			case errors.As(err, &locked):
+				setRetryAfter(w, time.Until(locked.Until))
+				writeError(w, http.StatusLocked, "account_locked", "too many failed logins; try again later")
+			case errors.Is(err, auth.ErrUserInactive):
+				writeError(w, http.StatusForbidden, "account_inactive", "account is suspended or deleted")
+			default:
+				h.Log.Error("two-factor login failed", "err", err)
+				writeError(w, http.StatusInternalServerError, "server_error", "could not login")
+			}
+			return
+		}
+
+		writeJSON(w, http.StatusOK, LoginResp{
+			Token:            tok,
+			ExpiresAt:        exp,
+			RefreshToken:     rtok,
+			RefreshExpiresAt: rexp,
+			User:             toUserResp(u),
+		})
+	})
+}
+
+// SetupTwoFactor godoc
+// @Summary Start 2FA enrollment
+// @Description Generates a TOTP secret for the caller. Add it to an authenticator app (the otpauth_uri can be shown as a QR code), then confirm with /v1/auth/2fa/verify.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} TwoFactorSetupResp
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 409 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/auth/2fa/setup [post]
+func (h Auth) SetupTwoFactor() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := authctx.UserFrom(r.Context())
+		if !ok || u == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		secret, uri, err := h.S.SetupTOTP(r.Context(), u.ID)
+		if err != nil {
+			if errors.Is(err, auth.Err2FAAlreadyEnabled) {
+				writeError(w, http.StatusConflict, "2fa_already_enabled", "two-factor authentication is already enabled")
+				return
+			}
+			h.Log.Error("2fa setup failed", "user_id", u.ID, "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not start two-factor setup")
+			return
+		}
+		writeJSON(w, http.StatusOK, TwoFactorSetupResp{Secret: secret, OTPAuthURI: uri})
+	})
+}
+
+// VerifyTwoFactor godoc
+// @Summary Confirm 2FA enrollment
+// @Description Enables two-factor authentication with a code from the authenticator app and returns single-use recovery codes. They are shown only once. Wrong codes count towards the login lockout.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body TwoFactorCodeReq true "Current TOTP code"
+// @Success 200 {object} RecoveryCodesResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 409 {object} ErrorEnvelope
+// @Failure 423 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/auth/2fa/verify [post]
+func (h Auth) VerifyTwoFactor() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		u, ok := authctx.UserFrom(r.Context())
+		if !ok || u == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		var req TwoFactorCodeReq
+		if !h.decodeBody(w, r, &req) {
+			return
+		}
+		codes, err := h.S.EnableTOTP(r.Context(), u.ID, req.Code)
+		if err != nil {
+			var locked *auth.LockedError
+			switch {
+			case errors.As(err, &locked):
+				setRetryAfter(w, time.Until(locked.Until))
+				writeError(w, http.StatusLocked, "account_locked", "too many failed attempts; try again later")
+			case errors.Is(err, auth.ErrInvalidOTP):
+				writeError(w, http.StatusBadRequest, "invalid_code", "invalid two-factor code")
+			case errors.Is(err, auth.Err2FASetupMissing):
+				writeError(w, http.StatusBadRequest, "2fa_setup_missing", "start enrollment with /v1/auth/2fa/setup first")
+			case errors.Is(err, auth.Err2FAAlreadyEnabled):
+				writeError(w, http.StatusConflict, "2fa_already_enabled", "two-factor authentication is already enabled")
+			default:
+				h.Log.Error("2fa verify failed", "user_id", u.ID, "err", err)
+				writeError(w, http.StatusInternalServerError, "server_error", "could not enable two-factor authentication")
+			}
+			return
+		}
+		writeJSON(w, http.StatusOK, RecoveryCodesResp{RecoveryCodes: codes})
+	})
+}
+
+// DisableTwoFactor godoc
+// @Summary Disable 2FA
+// @Description Turns two-factor authentication off after checking a current TOTP or recovery code. Wrong codes count towards the login lockout, which also blocks this endpoint. If the caller's role requires 2FA they must enroll again before using other endpoints.
+// @Tags auth
+// @Accept json
+// @Security BearerAuth
+// @Param request body TwoFactorCodeReq true "TOTP or recovery code"
+// @Success 204 "No Content"
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 423 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/auth/2fa/disable [post]
+func (h Auth) DisableTwoFactor() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		u, ok := authctx.UserFrom(r.Context())
+		if !ok || u == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		var req TwoFactorCodeReq
+		if !h.decodeBody(w, r, &req) {
+			return
+		}
+		if err := h.S.DisableTOTP(r.Context(), u.ID, req.Code); err != nil {
+			var locked *auth.LockedError
+			switch {
+			case errors.As(err, &locked):
+				setRetryAfter(w, time.Until(locked.Until))
+				writeError(w, http.StatusLocked, "account_locked", "too many failed attempts; try again later")
+			case errors.Is(err, auth.ErrInvalidOTP):
+				writeError(w, http.StatusBadRequest, "invalid_code", "invalid two-factor code")
+			case errors.Is(err, auth.Err2FANotEnabled):
+				writeError(w, http.StatusBadRequest, "2fa_not_enabled", "two-factor authentication is not enabled")
+			default:
+				h.Log.Error("2fa disable failed", "user_id", u.ID, "err", err)
+				writeError(w, http.StatusInternalServerError, "server_error", "could not disable two-factor authentication")
+			}
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// ResetUserTwoFactor godoc
+// @Summary Reset a user's 2FA (Admin only)
+// @Description Turns two-factor authentication off for a user who lost their authenticator and recovery codes, and revokes their sessions (users:manage required)
+// @Tags admin
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/users/{id}/2fa [delete]
+func (h Auth) ResetUserTwoFactor() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adminUser, ok := authctx.UserFrom(r.Context())
+		if !ok || adminUser == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		userID := r.PathValue("id")
+		if _, err := uuid.Parse(userID); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_path", "user ID must be a UUID")
+			return
+		}
+		if err := h.S.ResetTOTP(r.Context(), userID, adminUser.Username); err != nil {
+			if errors.Is(err, auth.ErrUserNotFound) {
+				writeError(w, http.StatusNotFound, "user_not_found", "user not found")
+				return
+			}
+			h.Log.Error("2fa reset failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not reset two-factor authentication")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// SetRoleTwoFactor godoc
+// @Summary Require 2FA for a role
+// @Description Sets whether members of a role must enroll in two-factor authentication. Until they do, only the profile, 2FA and logout endpoints accept their tokens (roles:manage required)
+// @Tags admin
+// @Accept json
+// @Security BearerAuth
+// @Param code path string true "Role code"
+// @Param request body SetRoleTwoFactorReq true "Requirement"
+// @Success 204 "No Content"
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 404 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/roles/{code}/2fa [put]
+func (h Auth) SetRoleTwoFactor() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		adminUser, ok := authctx.UserFrom(r.Context())
+		if !ok || adminUser == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+		code := r.PathValue("code")
+		if code == "" {
+			writeError(w, http.StatusBadRequest, "invalid_path", "role code is required")
+			return
+		}
+		var req SetRoleTwoFactorReq
+		if !h.decodeBody(w, r, &req) {
+			return
+		}
+		if err := h.S.SetRoleRequire2FA(r.Context(), code, req.Required, adminUser.Username); err != nil {
+			if errors.Is(err, auth.ErrRoleNotFound) {
+				writeError(w, http.StatusNotFound, "role_not_found", "role not found")
+				return
+			}
+			h.Log.Error("set role 2fa failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not update role")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
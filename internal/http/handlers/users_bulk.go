@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go-demo/internal/auth"
+	"go-demo/internal/authctx"
+
+	"github.com/google/uuid"
+)
+
+// maxBulkUsers caps the number of users one bulk request may act on.
+const maxBulkUsers = 500
+
+// Bulk user actions.
+const (
+	bulkDeactivate = "deactivate"
+	bulkChangeRole = "change_role"
+	bulkDelete     = "delete"
+)
+
+type BulkUsersReq struct {
+	// Action is deactivate, change_role or delete.
+	Action string   `json:"action"`
+	IDs    []string `json:"ids"`
+	// Role is the new role for change_role.
+	Role string `json:"role,omitempty"`
+}
+
+type BulkItemError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type BulkUserResult struct {
+	ID    string         `json:"id"`
+	OK    bool           `json:"ok"`
+	Error *BulkItemError `json:"error,omitempty"`
+}
+
+type BulkUsersResp struct {
+	Action    string           `json:"action"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Results   []BulkUserResult `json:"results"`
+}
+
+// BulkUsers godoc
+// @Summary Bulk user actions (Admin only)
+// @Description Deactivates, changes the role of, or deletes up to 500 users (users:manage required). Each user is processed on its own; the response reports the result per ID, in request order with duplicates removed. ADMIN users and the caller's own account are refused.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body BulkUsersReq true "Bulk action"
+// @Success 200 {object} BulkUsersResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Router /v1/admin/users/bulk [post]
+func (h Auth) BulkUsers() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		adminUser, ok := authctx.UserFrom(r.Context())
+		if !ok || adminUser == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+
+		dec := json.NewDecoder(io.LimitReader(r.Body, h.MaxBodyBytes))
+		dec.DisallowUnknownFields()
+
+		var req BulkUsersReq
+		if err := dec.Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "bad_request", "invalid JSON payload")
+			return
+		}
+		switch req.Action {
+		case bulkDeactivate, bulkDelete:
+			if req.Role != "" {
+				writeError(w, http.StatusBadRequest, "bad_request", "role is only allowed with change_role")
+				return
+			}
+		case bulkChangeRole:
+			if req.Role == "" {
+				writeError(w, http.StatusBadRequest, "invalid_role", "invalid role specified")
+				return
+			}
+		default:
+			writeError(w, http.StatusBadRequest, "bad_request", "action must be deactivate, change_role or delete")
+			return
+		}
+
+		ids := make([]string, 0, len(req.IDs))
+		seen := make(map[string]bool, len(req.IDs))
+		for _, id := range req.IDs {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == 0 {
+			writeError(w, http.StatusBadRequest, "bad_request", "ids is required")
+			return
+		}
+		if len(ids) > maxBulkUsers {
+			writeError(w, http.StatusBadRequest, "bad_request", fmt.Sprintf("at most %d ids per request", maxBulkUsers))
+			return
+		}
+
+		resp := BulkUsersResp{Action: req.Action, Results: make([]BulkUserResult, 0, len(ids))}
+		for _, id := range ids {
+			res := BulkUserResult{ID: id, OK: true}
+			if err := h.bulkUserAction(r, req, id, adminUser.ID, adminUser.Username); err != nil {
+				res.OK, res.Error = false, bulkItemError(err)
+				if res.Error.Code == "server_error" {
+					h.Log.Error("bulk user action failed", "action", req.Action, "user_id", id, "err", err)
+				}
+				resp.Failed++
+			} else {
+				resp.Succeeded++
+			}
+			resp.Results = append(resp.Results, res)
+		}
+
+		h.Log.Info("bulk user action", "action", req.Action, "succeeded", resp.Succeeded, "failed", resp.Failed,
+			"by", adminUser.Username)
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
+
+var (
+	errBulkInvalidID = errors.New("user ID must be a UUID")
+	errBulkSelf      = errors.New("cannot change your own account")
+)
+
+// bulkUserAction applies req.Action to one user.
+func (h Auth) bulkUserAction(r *http.Request, req BulkUsersReq, id, callerID, callerName string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return errBulkInvalidID
+	}
+	if id == callerID {
+		return errBulkSelf
+	}
+	var err error
+	switch req.Action {
+	case bulkDeactivate:
+		_, err = h.S.UpdateUserStatus(r.Context(), id, false, callerName)
+	case bulkChangeRole:
+		_, err = h.S.UpdateUserRole(r.Context(), id, req.Role, callerName)
+	case bulkDelete:
+		err = h.S.DeleteUser(r.Context(), id, callerName)
+	}
+	return err
+}
+
+// bulkItemError maps the error of one bulk item to the codes the single-user
+// endpoints use.
+func bulkItemError(err error) *BulkItemError {
+	switch {
+	case errors.Is(err, errBulkInvalidID):
+		return &BulkItemError{Code: "invalid_id", Message: err.Error()}
+	case errors.Is(err, errBulkSelf):
+		return &BulkItemError{Code: "invalid_operation", Message: err.Error()}
+	case errors.Is(err, auth.ErrUserNotFound):
+		return &BulkItemError{Code: "user_not_found", Message: "user not found"}
+	case errors.Is(err, auth.ErrUserDeleted):
+		return &BulkItemError{Code: "user_deleted", Message: "user is deleted; restore it first"}
+	case errors.Is(err, auth.ErrInvalidRole), errors.Is(err, auth.ErrAdminAssign), errors.Is(err, auth.ErrRoleNotDelegable):
+		return &BulkItemError{Code: "invalid_role", Message: err.Error()}
+	case errors.Is(err, auth.ErrAdminStatusChange), errors.Is(err, auth.ErrAdminRoleChange),
+		errors.Is(err, auth.ErrAdminDelete):
+		return &BulkItemError{Code: "invalid_operation", Message: err.Error()}
+	}
+	return &BulkItemError{Code: "server_error", Message: "could not update user"}
+}
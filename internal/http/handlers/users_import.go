@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-demo/internal/auth"
+	"go-demo/internal/authctx"
+)
+
+type ImportUserResult struct {
+	Line     int    `json:"line"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+	Team     string `json:"team,omitempty"`
+	UserID   string `json:"user_id,omitempty"`
+	// TemporaryPassword is only returned once, in password mode.
+	TemporaryPassword string         `json:"temporary_password,omitempty"`
+	Error             *BulkItemError `json:"error,omitempty"`
+}
+
+type ImportUsersResp struct {
+	DryRun  bool               `json:"dry_run"`
+	Mode    string             `json:"mode"`
+	Valid   int                `json:"valid"`
+	Created int                `json:"created"`
+	Failed  int                `json:"failed"`
+	Rows    []ImportUserResult `json:"rows"`
+}
+
+// ImportUsers godoc
+// @Summary Import users from CSV (Admin only)
+// @Description Creates users from a CSV file with the columns username, email, role (empty means USER) and optional team (name), users:manage required. Each row is validated and created on its own and reported with its line number. With dry_run=true nothing is written. mode=password returns a temporary password per user (shown once), which stops working after INVITE_TTL unless the user changes it; mode=invite mails a link to choose a password instead.
+// @Tags admin
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "CSV file"
+// @Param dry_run query bool false "Validate only" default(false)
+// @Param mode query string false "password or invite" default(password)
+// @Success 200 {object} ImportUsersResp
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Failure 500 {object} ErrorEnvelope
+// @Router /v1/admin/users/import [post]
+func (h Auth) ImportUsers() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adminUser, ok := authctx.UserFrom(r.Context())
+		if !ok || adminUser == nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "authentication required")
+			return
+		}
+
+		q := r.URL.Query()
+		dryRun := false
+		if v := q.Get("dry_run"); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "bad_request", "dry_run must be true or false")
+				return
+			}
+			dryRun = b
+		}
+		mode := q.Get("mode")
+		if mode == "" {
+			mode = auth.ImportPassword
+		}
+		if mode != auth.ImportPassword && mode != auth.ImportInvite {
+			writeError(w, http.StatusBadRequest, "bad_request", "mode must be password or invite")
+			return
+		}
+
+		if h.MaxBodyBytes > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, h.MaxBodyBytes)
+		}
+		if err := r.ParseMultipartForm(8 << 20); err != nil {
+			writeError(w, http.StatusBadRequest, "bad_request", "invalid multipart form")
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "bad_request", "missing file")
+			return
+		}
+		defer safeClose(file)
+
+		rows, err := auth.ParseUserImport(file)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidImport) {
+				writeError(w, http.StatusBadRequest, "invalid_file", err.Error())
+				return
+			}
+			h.Log.Error("read user import failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not read file")
+			return
+		}
+
+		results, err := h.S.ImportUsers(r.Context(), rows, mode, dryRun, adminUser.Username)
+		if err != nil {
+			h.Log.Error("import users failed", "err", err)
+			writeError(w, http.StatusInternalServerError, "server_error", "could not import users")
+			return
+		}
+
+		resp := ImportUsersResp{DryRun: dryRun, Mode: mode, Rows: make([]ImportUserResult, 0, len(results))}
+		for _, res := range results {
+			out := ImportUserResult{
+				Line:              res.Line,
+				Username:          res.Username,
+				Email:             res.Email,
+				Role:              res.Role,
+				Team:              res.Team,
+				UserID:            res.UserID,
+				TemporaryPassword: res.Password,
+			}
+			if res.Err != nil {
+				out.Error = &BulkItemError{Code: res.Err.Code, Message: res.Err.Message}
+				resp.Failed++
+			} else {
+				resp.Valid++
+			}
+			if res.UserID != "" {
+				resp.Created++
+			}
+			resp.Rows = append(resp.Rows, out)
+		}
+
+		h.Log.Info("users imported", "dry_run", dryRun, "mode", mode, "created", resp.Created, "failed", resp.Failed,
+			"by", adminUser.Username)
+		// The response may contain temporary passwords.
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
+
+// ExportUsersCSV godoc
+// @Summary Export users (CSV, Admin only)
+// @Description Downloads the users matching the filters, ordered by username, for access reviews: ID, username, email, role, status, teams (semicolon separated), service account, email verified, 2FA, last login, creation time and creator. Cells starting with =, +, -, @, tab or carriage return are prefixed with a single quote. users:manage required.
+// @Tags admin
+// @Produce text/csv
+// @Security BearerAuth
+// @Param q query string false "Case-insensitive substring of username or email"
+// @Param role query string false "Role code"
+// @Param status query string false "active, suspended or deleted"
+// @Success 200 {string} string "CSV content"
+// @Failure 400 {object} ErrorEnvelope
+// @Failure 401 {object} ErrorEnvelope
+// @Failure 403 {object} ErrorEnvelope
+// @Router /v1/admin/users/export.csv [get]
+func (h Auth) ExportUsersCSV() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		uq := auth.UserQuery{
+			Search: q.Get("q"),
+			Role:   strings.TrimSpace(q.Get("role")),
+			Status: strings.TrimSpace(q.Get("status")),
+		}
+		// Validate before the headers are sent.
+		if err := uq.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+
+		name := fmt.Sprintf("users-%s.csv", time.Now().UTC().Format("20060102-1504"))
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		// The body is streamed, so a failure part way can only be logged.
+		if err := h.S.ExportUsersCSV(r.Context(), uq, w); err != nil {
+			h.Log.Error("export users failed", "err", err)
+		}
+	})
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-demo/internal/auth"
+	"go-demo/internal/authctx"
+	"go-demo/internal/config"
+	"go-demo/internal/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateUser_RefusesAdmin(t *testing.T) {
+	h := NewAuth(auth.NewService(nil, config.Config{}, slog.Default()), slog.Default(), 1024)
+	req := httptest.NewRequest(http.MethodPost, "/v1/admin/users",
+		strings.NewReader(`{"username":"eve","email":"eve@example.com","password":"eves-pass-123","role":"ADMIN"}`))
+	req = req.WithContext(authctx.WithUser(req.Context(), &db.User{ID: "u1", Username: "manager", Role: "USER_ADMINS"}))
+	rec := httptest.NewRecorder()
+	h.CreateUser().ServeHTTP(rec, req)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), `"invalid_role"`)
+}
@@ -10,11 +10,9 @@ import (
 	"net/http"
 	"strings"
 	"time"
-)
-
-type ctxKey int
 
-const requestIDKey ctxKey = iota
+	"go-demo/internal/authctx"
+)
 
 func withRequestID(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -23,16 +21,12 @@ func withRequestID(next http.Handler) http.Handler {
 			id = genID()
 		}
 		w.Header().Set("X-Request-Id", id)
-		ctx := context.WithValue(r.Context(), requestIDKey, id)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, r.WithContext(authctx.WithRequestID(r.Context(), id)))
 	})
 }
 
 func getRequestID(ctx context.Context) string {
-	if v, ok := ctx.Value(requestIDKey).(string); ok {
-		return v
-	}
-	return ""
+	return authctx.RequestIDFrom(ctx)
 }
 
 type statusWriter struct {
@@ -54,6 +48,21 @@ func (w *statusWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// Flush implements http.Flusher so streaming handlers keep working behind this wrapper.
+func (w *statusWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 // bodyCaptureWriter captures response body up to max bytes while writing through.
 type bodyCaptureWriter struct {
 	http.ResponseWriter
@@ -88,6 +97,23 @@ func (w *bodyCaptureWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// Flush implements http.Flusher so Server-Sent Events and other streaming
+// responses are delivered immediately instead of being buffered.
+func (w *bodyCaptureWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+// (e.g. for per-request write deadlines on long-lived streams).
+func (w *bodyCaptureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 // teeReadCloser duplicates reads into an internal buffer up to max bytes.
 type teeReadCloser struct {
 	rc  io.ReadCloser
@@ -1,8 +1,11 @@
 package http
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"expvar"
 	nhttp "net/http"
+	"strings"
 
 	"log/slog"
 
@@ -10,7 +13,10 @@ import (
 
 	"go-demo/internal/auth"
 	"go-demo/internal/config"
+	"go-demo/internal/db"
 	"go-demo/internal/http/handlers"
+	"go-demo/internal/oidc"
+	"go-demo/internal/ratelimit"
 	"go-demo/internal/sqllog"
 )
 
@@ -37,61 +43,170 @@ func NewRouter(cfg config.Config, log *slog.Logger, authSvc *auth.Service, sqlLo
 	// Auth endpoints
 	if authSvc != nil {
 		ah := handlers.NewAuth(authSvc, log, cfg.MaxBodyBytes)
+		ah.LoginIPLimiter = ratelimit.New(cfg.LoginRateLimitIP, cfg.LoginRateWindow)
+		ah.LoginIdentifierLimiter = ratelimit.New(cfg.LoginRateLimitIdentifier, cfg.LoginRateWindow)
+		mux.Handle("GET /.well-known/jwks.json", ah.JWKS())
 		mux.Handle("POST /v1/auth/register", ah.Register())
 		mux.Handle("POST /v1/auth/login", ah.Login())
+		mux.Handle("POST /v1/auth/login/2fa", ah.LoginTwoFactor())
 		mux.Handle("POST /v1/auth/refresh", ah.Refresh())
-		mux.Handle("GET /v1/auth/me", handlers.RequireAuth(authSvc)(ah.Me()))
-
-		// Admin endpoints - require ADMIN role
-		adminMiddleware := func(h nhttp.Handler) nhttp.Handler {
-			return handlers.RequireAuth(authSvc)(handlers.RequireAdminRole()(h))
+		mux.Handle("POST /v1/auth/password/forgot", ah.ForgotPassword())
+		mux.Handle("POST /v1/auth/password/reset", ah.ResetPassword())
+		mux.Handle("POST /v1/auth/verify-email", ah.VerifyEmail())
+		mux.Handle("POST /v1/auth/verify-email/resend", ah.ResendVerification())
+		mux.Handle("POST /v1/auth/invitations/{token}/accept", ah.AcceptInvitation())
+		if cfg.OIDCIssuer != "" {
+			oh := handlers.NewOIDC(authSvc, log, oidc.NewProvider(oidc.Config{
+				Issuer:       cfg.OIDCIssuer,
+				ClientID:     cfg.OIDCClientID,
+				ClientSecret: cfg.OIDCClientSecret,
+				RedirectURL:  cfg.OIDCRedirectURL,
+				Scopes:       cfg.OIDCScopes,
+			}, nil))
+			// The role map is validated at startup.
+			rules, _ := oidc.ParseRoleMap(cfg.OIDCRoleMap)
+			oh.Roles = oidc.RoleMapping{Claim: cfg.OIDCRoleClaim, Rules: rules}
+			oh.DefaultRole = cfg.OIDCDefaultRole
+			stateKey := sha256.Sum256([]byte("oidc-state:" + cfg.JWTSecret))
+			oh.StateKey = stateKey[:]
+			if cfg.JWTSecret == "" {
+				// Without a shared secret the key is per process; logins must
+				// finish on the instance that started them.
+				oh.StateKey = make([]byte, 32)
+				if _, err := rand.Read(oh.StateKey); err != nil {
+					panic(err)
+				}
+			}
+			oh.SecureCookie = strings.HasPrefix(cfg.OIDCRedirectURL, "https://")
+			mux.Handle("GET /v1/auth/oidc/login", oh.Login())
+			mux.Handle("GET /v1/auth/oidc/callback", oh.Callback())
 		}
-		mux.Handle("POST /v1/admin/users", adminMiddleware(ah.CreateUser()))
-		mux.Handle("GET /v1/admin/users", adminMiddleware(ah.ListUsers()))
-		mux.Handle("PUT /v1/admin/users/{id}/status", adminMiddleware(ah.UpdateUserStatus()))
-		mux.Handle("PUT /v1/admin/users/{id}/role", adminMiddleware(ah.UpdateUserRole()))
-		mux.Handle("DELETE /v1/admin/users/{id}", adminMiddleware(ah.DeleteUser()))
+		// Users who still have to enroll in 2FA can reach these.
+		enrollAuth := handlers.RequireAuthAllowEnrollment(authSvc)
+		mux.Handle("GET /v1/auth/me", enrollAuth(ah.Me()))
+		mux.Handle("POST /v1/auth/2fa/setup", enrollAuth(ah.SetupTwoFactor()))
+		mux.Handle("POST /v1/auth/2fa/verify", enrollAuth(ah.VerifyTwoFactor()))
+		mux.Handle("POST /v1/auth/2fa/disable", handlers.RequireAuth(authSvc)(ah.DisableTwoFactor()))
+		mux.Handle("PATCH /v1/auth/me", handlers.RequireAuth(authSvc)(ah.UpdateMe()))
+		mux.Handle("PUT /v1/auth/me/password", handlers.RequireAuth(authSvc)(ah.ChangePassword()))
+		mux.Handle("POST /v1/auth/logout", enrollAuth(ah.Logout()))
+		mux.Handle("POST /v1/auth/logout-all", enrollAuth(ah.LogoutAll()))
+		mux.Handle("GET /v1/auth/sessions", handlers.RequireAuth(authSvc)(ah.ListSessions()))
+		mux.Handle("DELETE /v1/auth/sessions/{id}", handlers.RequireAuth(authSvc)(ah.RevokeSession()))
+
+		// Admin endpoints - gated by permission
+		usersMiddleware := requirePermission(authSvc, db.PermUsersManage)
+		mux.Handle("POST /v1/admin/users", usersMiddleware(ah.CreateUser()))
+		mux.Handle("GET /v1/admin/users", usersMiddleware(ah.ListUsers()))
+		mux.Handle("POST /v1/admin/users/bulk", usersMiddleware(ah.BulkUsers()))
+		mux.Handle("POST /v1/admin/users/import", usersMiddleware(ah.ImportUsers()))
+		mux.Handle("GET /v1/admin/users/export.csv", usersMiddleware(ah.ExportUsersCSV()))
+		mux.Handle("PUT /v1/admin/users/{id}/status", usersMiddleware(ah.UpdateUserStatus()))
+		mux.Handle("PUT /v1/admin/users/{id}/role", usersMiddleware(ah.UpdateUserRole()))
+		mux.Handle("DELETE /v1/admin/users/{id}", usersMiddleware(ah.DeleteUser()))
+		mux.Handle("POST /v1/admin/users/{id}/restore", usersMiddleware(ah.RestoreUser()))
+		mux.Handle("GET /v1/admin/users/{id}/sessions", usersMiddleware(ah.ListUserSessions()))
+		mux.Handle("DELETE /v1/admin/users/{id}/sessions", usersMiddleware(ah.RevokeUserSessions()))
+		mux.Handle("DELETE /v1/admin/users/{id}/sessions/{session_id}", usersMiddleware(ah.RevokeUserSession()))
+		mux.Handle("GET /v1/admin/lockouts", usersMiddleware(ah.ListLockouts()))
+		mux.Handle("GET /v1/admin/users/{id}/lockout", usersMiddleware(ah.GetUserLockout()))
+		mux.Handle("DELETE /v1/admin/users/{id}/lockout", usersMiddleware(ah.ClearUserLockout()))
+		mux.Handle("DELETE /v1/admin/users/{id}/2fa", usersMiddleware(ah.ResetUserTwoFactor()))
+
+		rolesMiddleware := requirePermission(authSvc, db.PermRolesManage)
+		mux.Handle("GET /v1/admin/permissions", rolesMiddleware(ah.ListPermissions()))
+		mux.Handle("GET /v1/admin/roles", rolesMiddleware(ah.ListRoles()))
+		mux.Handle("POST /v1/admin/roles", rolesMiddleware(ah.CreateRole()))
+		mux.Handle("PUT /v1/admin/roles/{code}", rolesMiddleware(ah.UpdateRole()))
+		mux.Handle("DELETE /v1/admin/roles/{code}", rolesMiddleware(ah.DeleteRole()))
+		mux.Handle("PUT /v1/admin/roles/{code}/permissions", rolesMiddleware(ah.SetRolePermissions()))
+		mux.Handle("PUT /v1/admin/roles/{code}/2fa", rolesMiddleware(ah.SetRoleTwoFactor()))
+
+		// Service accounts authenticate with API keys instead of passwords
+		apiKeysMiddleware := requirePermission(authSvc, db.PermAPIKeysManage)
+		mux.Handle("POST /v1/admin/service-accounts", apiKeysMiddleware(ah.CreateServiceAccount()))
+		mux.Handle("GET /v1/admin/service-accounts", apiKeysMiddleware(ah.ListServiceAccounts()))
+		mux.Handle("POST /v1/admin/service-accounts/{id}/keys", apiKeysMiddleware(ah.CreateAPIKey()))
+		mux.Handle("GET /v1/admin/service-accounts/{id}/keys", apiKeysMiddleware(ah.ListAPIKeys()))
+		mux.Handle("POST /v1/admin/service-accounts/{id}/keys/{key_id}/rotate", apiKeysMiddleware(ah.RotateAPIKey()))
+		mux.Handle("DELETE /v1/admin/service-accounts/{id}/keys/{key_id}", apiKeysMiddleware(ah.RevokeAPIKey()))
+
+		// Teams: managers administer all teams, leaders manage their own members
+		teamsMiddleware := requirePermission(authSvc, db.PermTeamsManage)
+		mux.Handle("POST /v1/admin/teams", teamsMiddleware(ah.CreateTeam()))
+		mux.Handle("DELETE /v1/admin/teams/{id}", teamsMiddleware(ah.DeleteTeam()))
+		mux.Handle("GET /v1/teams", handlers.RequireAuth(authSvc)(ah.ListTeams()))
+		mux.Handle("GET /v1/teams/{id}/members", handlers.RequireAuth(authSvc)(ah.ListTeamMembers()))
+		mux.Handle("PUT /v1/teams/{id}/members/{user_id}", handlers.RequireAuth(authSvc)(ah.SetTeamMember()))
+		mux.Handle("DELETE /v1/teams/{id}/members/{user_id}", handlers.RequireAuth(authSvc)(ah.RemoveTeamMember()))
+
+		// Invitations: managers invite with any role but ADMIN, leaders into their own teams
+		mux.Handle("POST /v1/invitations", handlers.RequireAuth(authSvc)(ah.CreateInvitation()))
+		mux.Handle("GET /v1/invitations", handlers.RequireAuth(authSvc)(ah.ListInvitations()))
+		mux.Handle("DELETE /v1/invitations/{id}", handlers.RequireAuth(authSvc)(ah.RevokeInvitation()))
+
+		// Audit log of security and administrative actions
+		al := handlers.NewAuditLog(authSvc.Audit(), log)
+		auditMiddleware := requirePermission(authSvc, db.PermAuditRead)
+		mux.Handle("GET /v1/admin/audit", auditMiddleware(al.List()))
+		mux.Handle("GET /v1/admin/audit.csv", auditMiddleware(al.ExportCSV()))
 	}
 
-	// SQL log upload endpoint + report endpoints (admin only)
-	if sqlLogRepo != nil {
+	// SQL log upload and query endpoints
+	if authSvc != nil && sqlLogRepo != nil {
+		// Reads accept an optional ?team= filter
+		readMiddleware := func(h nhttp.Handler) nhttp.Handler {
+			return requirePermission(authSvc, db.PermSQLLogRead)(handlers.WithTeamFilter(h))
+		}
+
 		up := handlers.NewSQLLogUpload(sqlLogRepo, log, cfg.MaxBodyBytes)
-		mux.Handle("POST /v1/sql-logs/upload", handlers.RequireAuth(authSvc)(up.Upload()))
+		up.Audit = authSvc.Audit()
+		mux.Handle("POST /v1/sql-logs/upload", requirePermission(authSvc, db.PermSQLLogUpload)(up.Upload()))
 
 		// SQL log query endpoints
 		q := handlers.NewSQLLogQuery(sqlLogRepo, log)
-		mux.Handle("GET /v1/sql-logs/databases", handlers.RequireAuth(authSvc)(q.ListDatabases()))
-		mux.Handle("GET /v1/sql-logs", handlers.RequireAuth(authSvc)(q.ListByDB()))
-	}
-	// SQL log scan endpoint (authenticated)
-	if authSvc != nil && sqlLogRepo != nil {
+		mux.Handle("GET /v1/sql-logs/databases", readMiddleware(q.ListDatabases()))
+		mux.Handle("GET /v1/sql-logs", readMiddleware(q.ListByDB()))
+
+		// SQL log scan endpoint
 		scan := handlers.NewSQLLogScan(sqlLogRepo, log)
 		// Support both GET (manual/curl) and POST (UI actions) to avoid 404 when UI uses POST
-		mux.Handle("GET /v1/sql-logs/scan", handlers.RequireAuth(authSvc)(scan.Scan()))
-		mux.Handle("POST /v1/sql-logs/scan", handlers.RequireAuth(authSvc)(scan.Scan()))
+		mux.Handle("GET /v1/sql-logs/scan", readMiddleware(scan.Scan()))
+		mux.Handle("POST /v1/sql-logs/scan", readMiddleware(scan.Scan()))
 		// Handle CORS preflight even when ALLOWED_ORIGINS is empty (returns 204)
 		mux.Handle("OPTIONS /v1/sql-logs/scan", nhttp.HandlerFunc(func(w nhttp.ResponseWriter, r *nhttp.Request) {
 			w.WriteHeader(nhttp.StatusNoContent)
 		}))
 	}
 
-	// AI analysis endpoint
-	if sqlLogRepo != nil {
+	// AI analysis endpoints (quota-limited and audited per user)
+	if authSvc != nil && sqlLogRepo != nil {
 		ai := handlers.NewAIAnalysisHandler(sqlLogRepo, log, cfg)
-		mux.Handle("GET /v1/ai-analysis", ai.AIAnalysis())
-		// Reporting endpoints: JSON remains ADMIN-only; CSV/PDF allow ADMIN or TEAM_LEADER
-		if authSvc != nil {
-			rep := handlers.NewSQLLogReport(sqlLogRepo, log, cfg.MaxBodyBytes)
-			adminMiddleware := func(h nhttp.Handler) nhttp.Handler {
-				return handlers.RequireAuth(authSvc)(handlers.RequireAdminRole()(h))
-			}
-			roleMiddleware := func(h nhttp.Handler) nhttp.Handler {
-				return handlers.RequireAuth(authSvc)(handlers.RequireAnyRole("ADMIN", "TEAM_LEADER")(h))
-			}
-			mux.Handle("GET /v1/sql-logs/report", adminMiddleware(rep.ReportJSON()))
-			mux.Handle("GET /v1/sql-logs/report.csv", roleMiddleware(rep.ReportCSV()))
-			mux.Handle("GET /v1/sql-logs/report.pdf", roleMiddleware(rep.ReportPDF()))
-		}
+		ai.Audit = authSvc.Audit()
+		aiMiddleware := requirePermission(authSvc, db.PermAIAnalyze)
+		mux.Handle("GET /v1/ai-analysis", aiMiddleware(ai.AIAnalysis()))
+		mux.Handle("GET /v1/ai-analysis/stream", aiMiddleware(ai.AIAnalysisStream()))
+	}
+
+	// Reporting, redaction policy and database grant endpoints
+	if authSvc != nil && sqlLogRepo != nil {
+		rep := handlers.NewSQLLogReport(sqlLogRepo, log, cfg.MaxBodyBytes)
+		rep.Audit = authSvc.Audit()
+		exportMiddleware := requirePermission(authSvc, db.PermReportExport)
+		mux.Handle("GET /v1/sql-logs/report", requirePermission(authSvc, db.PermReportView)(handlers.WithTeamFilter(rep.ReportJSON())))
+		mux.Handle("GET /v1/sql-logs/report.csv", exportMiddleware(handlers.WithTeamFilter(rep.ReportCSV())))
+		mux.Handle("GET /v1/sql-logs/report.pdf", exportMiddleware(handlers.WithTeamFilter(rep.ReportPDF())))
+
+		red := handlers.NewSQLLogRedaction(sqlLogRepo, log, cfg.MaxBodyBytes)
+		redactionMiddleware := requirePermission(authSvc, db.PermRedactionManage)
+		mux.Handle("GET /v1/admin/redaction", redactionMiddleware(red.GetPolicy()))
+		mux.Handle("PUT /v1/admin/redaction", redactionMiddleware(red.UpdatePolicy()))
+
+		grants := handlers.NewSQLLogGrants(sqlLogRepo, log, cfg.MaxBodyBytes)
+		grantsMiddleware := requirePermission(authSvc, db.PermGrantsManage)
+		mux.Handle("GET /v1/admin/db-grants", grantsMiddleware(grants.List()))
+		mux.Handle("POST /v1/admin/db-grants", grantsMiddleware(grants.Create()))
+		mux.Handle("DELETE /v1/admin/db-grants/{id}", grantsMiddleware(grants.Delete()))
 	}
 
 	// Compose middleware (order matters; first is outermost)
@@ -102,3 +217,10 @@ func NewRouter(cfg config.Config, log *slog.Logger, authSvc *auth.Service, sqlLo
 		func(h nhttp.Handler) nhttp.Handler { return withRequestLogging(log, cfg.MaxBodyBytes)(h) },
 	)
 }
+
+// requirePermission combines authentication with a permission check.
+func requirePermission(authSvc *auth.Service, perm string) func(nhttp.Handler) nhttp.Handler {
+	return func(h nhttp.Handler) nhttp.Handler {
+		return handlers.RequireAuth(authSvc)(handlers.RequirePermission(perm)(h))
+	}
+}
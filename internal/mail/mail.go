@@ -0,0 +1,58 @@
+// Package mail sends transactional email such as password reset and
+// verification links.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"go-demo/internal/config"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// New returns the Mailer selected by cfg.MailDriver: "smtp", "file" or "log" (default).
+func New(cfg config.Config, log *slog.Logger) (Mailer, error) {
+	switch cfg.MailDriver {
+	case "", "log":
+		return NewLogMailer(log), nil
+	case "file":
+		if cfg.MailDir == "" {
+			return nil, fmt.Errorf("MAIL_DIR is required for the file mail driver")
+		}
+		return NewFileMailer(cfg.MailDir, cfg.MailFrom), nil
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for the smtp mail driver")
+		}
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom), nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_DRIVER %q", cfg.MailDriver)
+	}
+}
+
+// LogMailer writes messages to the application log instead of sending them.
+// Intended for local development only: the log contains the message body.
+type LogMailer struct {
+	log *slog.Logger
+}
+
+func NewLogMailer(log *slog.Logger) *LogMailer {
+	return &LogMailer{log: log}
+}
+
+func (m *LogMailer) Send(_ context.Context, msg Message) error {
+	m.log.Info("mail (log driver)", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
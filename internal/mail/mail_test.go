@@ -0,0 +1,36 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildMessageStripsHeaderInjection(t *testing.T) {
+	raw := string(buildMessage("no-reply@example.com", Message{
+		To:      "user@example.com\r\nBcc: evil@example.com",
+		Subject: "Hello",
+		Body:    "line one\nline two",
+	}))
+	require.Contains(t, raw, "To: user@example.comBcc: evil@example.com\r\n")
+	require.NotContains(t, raw, "\r\nBcc:")
+	require.True(t, strings.HasSuffix(raw, "\r\n\r\nline one\r\nline two"))
+}
+
+func TestFileMailerWritesMessage(t *testing.T) {
+	dir := t.TempDir()
+	m := NewFileMailer(dir, "no-reply@example.com")
+	require.NoError(t, m.Send(context.Background(), Message{To: "a/b@example.com", Subject: "Hi", Body: "token=abc"}))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.Contains(t, filepath.Base(files[0]), "a_b@example.com")
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	require.Contains(t, string(data), "token=abc")
+}
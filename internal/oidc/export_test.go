@@ -0,0 +1,12 @@
+package oidc
+
+import "context"
+
+// VerifyIDTokenForTest exposes ID token validation to the external test package.
+func VerifyIDTokenForTest(p *Provider, raw, nonce string) (*Identity, error) {
+	meta, err := p.discover(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return p.verifyIDToken(context.Background(), meta, raw, nonce)
+}
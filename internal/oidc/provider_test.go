@@ -0,0 +1,151 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+
+	"go-demo/internal/oidc"
+	"go-demo/internal/oidc/oidctest"
+)
+
+const redirectURL = "http://app.test/v1/auth/oidc/callback"
+
+// authorize follows the provider's redirect and returns the code and state it sends back.
+func authorize(t *testing.T, authURL string) (string, string) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	return loc.Query().Get("code"), loc.Query().Get("state")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	idp := oidctest.New("demo", "s3cret")
+	defer idp.Close()
+	idp.SetClaims(map[string]interface{}{
+		"sub":                "user-1",
+		"email":              "alice@example.com",
+		"email_verified":     true,
+		"preferred_username": "alice",
+		"groups":             []string{"staff", "sql-admins"},
+	})
+
+	ctx := context.Background()
+	p := oidc.NewProvider(oidc.Config{Issuer: idp.Issuer(), ClientID: "demo", ClientSecret: "s3cret", RedirectURL: redirectURL}, nil)
+	st, err := oidc.NewState(time.Minute)
+	require.NoError(t, err)
+	authURL, err := p.AuthCodeURL(ctx, st.State, st.Nonce, st.Verifier)
+	require.NoError(t, err)
+
+	code, state := authorize(t, authURL)
+	require.Equal(t, st.State, state)
+
+	// The code is bound to the PKCE verifier.
+	_, err = p.Exchange(ctx, code, "wrong-verifier", st.Nonce)
+	require.ErrorIs(t, err, oidc.ErrExchange)
+
+	code, _ = authorize(t, authURL)
+	_, err = p.Exchange(ctx, code, st.Verifier, "other-nonce")
+	require.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+
+	code, _ = authorize(t, authURL)
+	id, err := p.Exchange(ctx, code, st.Verifier, st.Nonce)
+	require.NoError(t, err)
+	require.Equal(t, "user-1", id.Subject)
+	require.Equal(t, idp.Issuer(), id.Issuer)
+	require.Equal(t, "alice@example.com", id.Email)
+	require.True(t, id.EmailVerified)
+	require.Equal(t, "alice", id.Username)
+
+	m := oidc.RoleMapping{Claim: "groups", Rules: []oidc.RoleRule{{Value: "analysts", Role: "ANALYZER"}, {Value: "sql-admins", Role: "ADMIN"}}}
+	require.Equal(t, "ADMIN", m.Role(id.Claims))
+	require.True(t, m.Configured())
+	require.False(t, oidc.RoleMapping{Claim: "groups"}.Configured())
+}
+
+func TestExchangeRejectsWrongClient(t *testing.T) {
+	idp := oidctest.New("demo", "s3cret")
+	defer idp.Close()
+	idp.SetClaims(map[string]interface{}{"sub": "user-1"})
+
+	ctx := context.Background()
+	p := oidc.NewProvider(oidc.Config{Issuer: idp.Issuer(), ClientID: "demo", ClientSecret: "wrong", RedirectURL: redirectURL}, nil)
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", "verifier-verifier-verifier-verifier-verifier")
+	require.NoError(t, err)
+	code, _ := authorize(t, authURL)
+	_, err = p.Exchange(ctx, code, "verifier-verifier-verifier-verifier-verifier", "nonce")
+	require.ErrorIs(t, err, oidc.ErrExchange)
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	idp := oidctest.New("demo", "s3cret")
+	defer idp.Close()
+
+	p := oidc.NewProvider(oidc.Config{Issuer: idp.Issuer() + "/realms/other", ClientID: "demo"}, nil)
+	_, err := p.AuthCodeURL(context.Background(), "s", "n", "v")
+	require.Error(t, err)
+}
+
+func TestSignedIDTokenClaims(t *testing.T) {
+	// Tokens signed by the IdP but issued for another audience or already
+	// expired must not be accepted, even with a matching nonce.
+	idp := oidctest.New("demo", "s3cret")
+	defer idp.Close()
+	now := time.Now()
+	for name, claims := range map[string]jwt.MapClaims{
+		"audience": {"iss": idp.Issuer(), "aud": "other", "sub": "u", "nonce": "n", "iat": now.Unix(), "exp": now.Add(time.Minute).Unix()},
+		"expired":  {"iss": idp.Issuer(), "aud": "demo", "sub": "u", "nonce": "n", "iat": now.Add(-time.Hour).Unix(), "exp": now.Add(-10 * time.Minute).Unix()},
+		"issuer":   {"iss": "https://evil.test", "aud": "demo", "sub": "u", "nonce": "n", "iat": now.Unix(), "exp": now.Add(time.Minute).Unix()},
+	} {
+		_, err := oidc.VerifyIDTokenForTest(oidc.NewProvider(oidc.Config{Issuer: idp.Issuer(), ClientID: "demo"}, nil), idp.SignIDToken(claims), "n")
+		require.ErrorIs(t, err, oidc.ErrInvalidIDToken, name)
+	}
+}
+
+func TestStateSealAndOpen(t *testing.T) {
+	key := []byte("state-key")
+	st, err := oidc.NewState(time.Minute)
+	require.NoError(t, err)
+	require.Len(t, st.Verifier, 43)
+
+	sealed, err := oidc.Seal(key, st)
+	require.NoError(t, err)
+	got, err := oidc.Open(key, sealed)
+	require.NoError(t, err)
+	require.Equal(t, st.State, got.State)
+	require.Equal(t, st.Nonce, got.Nonce)
+
+	_, err = oidc.Open([]byte("other-key"), sealed)
+	require.ErrorIs(t, err, oidc.ErrInvalidState)
+	_, err = oidc.Open(key, "x"+sealed)
+	require.ErrorIs(t, err, oidc.ErrInvalidState)
+
+	st.ExpiresAt = time.Now().Add(-time.Second)
+	sealed, err = oidc.Seal(key, st)
+	require.NoError(t, err)
+	_, err = oidc.Open(key, sealed)
+	require.ErrorIs(t, err, oidc.ErrInvalidState)
+}
+
+func TestParseRoleMap(t *testing.T) {
+	rules, err := oidc.ParseRoleMap(" analysts=ANALYZER, sql-admins = ADMIN ,")
+	require.NoError(t, err)
+	require.Equal(t, []oidc.RoleRule{{Value: "analysts", Role: "ANALYZER"}, {Value: "sql-admins", Role: "ADMIN"}}, rules)
+
+	_, err = oidc.ParseRoleMap("admins")
+	require.Error(t, err)
+
+	m := oidc.RoleMapping{Claim: "realm_access.roles", Rules: rules}
+	claims := map[string]interface{}{"realm_access": map[string]interface{}{"roles": []interface{}{"analysts"}}}
+	require.Equal(t, "ANALYZER", m.Role(claims))
+	require.Equal(t, "", m.Role(map[string]interface{}{"groups": "analysts"}))
+}
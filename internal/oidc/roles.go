@@ -0,0 +1,84 @@
+package oidc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RoleRule maps one claim value to a role code.
+type RoleRule struct {
+	Value string
+	Role  string
+}
+
+// RoleMapping picks a DEMO.ROLE code from an identity's claims. Claim is a
+// claim name, or a dotted path into nested objects such as realm_access.roles;
+// its value may be a string or a list of strings. Rules are tried in order and
+// the first whose value is present wins.
+type RoleMapping struct {
+	Claim string
+	Rules []RoleRule
+}
+
+// ParseRoleMap parses "value=ROLE,value=ROLE" as used by OIDC_ROLE_MAP.
+func ParseRoleMap(s string) ([]RoleRule, error) {
+	var rules []RoleRule
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		value, role, ok := strings.Cut(part, "=")
+		value, role = strings.TrimSpace(value), strings.TrimSpace(role)
+		if !ok || value == "" || role == "" {
+			return nil, fmt.Errorf("invalid role mapping %q: want value=ROLE", part)
+		}
+		rules = append(rules, RoleRule{Value: value, Role: role})
+	}
+	return rules, nil
+}
+
+// Configured reports whether a claim and at least one rule are set.
+func (m RoleMapping) Configured() bool {
+	return m.Claim != "" && len(m.Rules) > 0
+}
+
+// Role returns the mapped role, or "" when no rule matches.
+func (m RoleMapping) Role(claims map[string]interface{}) string {
+	if !m.Configured() {
+		return ""
+	}
+	values := claimValues(claims, m.Claim)
+	for _, r := range m.Rules {
+		for _, v := range values {
+			if v == r.Value {
+				return r.Role
+			}
+		}
+	}
+	return ""
+}
+
+func claimValues(claims map[string]interface{}, path string) []string {
+	var cur interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = obj[part]
+	}
+	switch v := cur.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
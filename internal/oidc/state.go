@@ -0,0 +1,85 @@
+package oidc
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrInvalidState = errors.New("invalid or expired login state")
+
+// State is what the login step remembers for the callback. It travels in a
+// signed cookie, so no server-side storage is needed between the two requests.
+type State struct {
+	State     string    `json:"s"`
+	Nonce     string    `json:"n"`
+	Verifier  string    `json:"v"`
+	ExpiresAt time.Time `json:"e"`
+}
+
+// NewState returns a State with fresh random values valid for ttl.
+func NewState(ttl time.Duration) (State, error) {
+	var vals [3]string
+	for i := range vals {
+		v, err := randomString(32)
+		if err != nil {
+			return State{}, err
+		}
+		vals[i] = v
+	}
+	return State{State: vals[0], Nonce: vals[1], Verifier: vals[2], ExpiresAt: time.Now().Add(ttl)}, nil
+}
+
+// Seal encodes st and signs it with key (HMAC-SHA256).
+func Seal(key []byte, st State) (string, error) {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + sign(key, payload), nil
+}
+
+// Open verifies and decodes a value produced by Seal.
+func Open(key []byte, sealed string) (State, error) {
+	payload, sig, ok := strings.Cut(sealed, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(sign(key, payload))) {
+		return State{}, ErrInvalidState
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return State{}, ErrInvalidState
+	}
+	var st State
+	if err := json.Unmarshal(b, &st); err != nil || time.Now().After(st.ExpiresAt) {
+		return State{}, ErrInvalidState
+	}
+	return st, nil
+}
+
+func sign(key []byte, payload string) string {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+// randomString returns n random bytes, base64url encoded. 32 bytes give a
+// 43-character PKCE verifier.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// challengeS256 derives the PKCE code challenge from a verifier (RFC 7636).
+func challengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,72 @@
+// Package ratelimit provides an in-memory fixed-window rate limiter.
+//
+// Counters live in the process, so each API instance enforces its own limits.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type window struct {
+	start time.Time
+	count int
+}
+
+// Limiter allows up to limit events per key within each window.
+// A nil Limiter, or one with a limit of 0, allows everything.
+type Limiter struct {
+	limit  int
+	period time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastPrune time.Time
+}
+
+// New returns a Limiter allowing limit events per key every period.
+func New(limit int, period time.Duration) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		period:  period,
+		now:     time.Now,
+		windows: make(map[string]*window),
+	}
+}
+
+// Allow records an event for key. When the key is over its limit it returns
+// false and the time until the current window ends.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil || l.limit <= 0 || l.period <= 0 {
+		return true, 0
+	}
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastPrune) >= l.period {
+		l.prune(now)
+	}
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.period {
+		w = &window{start: now}
+		l.windows[key] = w
+	}
+	if w.count >= l.limit {
+		return false, w.start.Add(l.period).Sub(now)
+	}
+	w.count++
+	return true, 0
+}
+
+// prune drops expired windows so idle keys do not accumulate.
+func (l *Limiter) prune(now time.Time) {
+	for k, w := range l.windows {
+		if now.Sub(w.start) >= l.period {
+			delete(l.windows, k)
+		}
+	}
+	l.lastPrune = now
+}
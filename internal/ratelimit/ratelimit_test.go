@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := New(2, time.Minute)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		ok, _ := l.Allow("a")
+		require.True(t, ok, "attempt %d", i+1)
+	}
+	ok, retry := l.Allow("a")
+	require.False(t, ok)
+	require.Equal(t, time.Minute, retry)
+
+	ok, _ = l.Allow("b")
+	require.True(t, ok, "keys are limited independently")
+
+	now = now.Add(time.Minute)
+	ok, _ = l.Allow("a")
+	require.True(t, ok, "a new window starts after the period")
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	var nilLimiter *Limiter
+	ok, _ := nilLimiter.Allow("a")
+	require.True(t, ok)
+
+	l := New(0, time.Minute)
+	for i := 0; i < 100; i++ {
+		ok, _ := l.Allow("a")
+		require.True(t, ok)
+	}
+}
+
+func TestLimiterPrunesExpiredWindows(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := New(1, time.Minute)
+	l.now = func() time.Time { return now }
+	l.Allow("a")
+	l.Allow("b")
+
+	now = now.Add(2 * time.Minute)
+	l.Allow("c")
+	require.Len(t, l.windows, 1)
+}
@@ -0,0 +1,196 @@
+package sqllog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-demo/internal/authctx"
+	"go-demo/internal/db"
+
+	"gorm.io/gorm"
+)
+
+// Grant subject types.
+const (
+	GrantSubjectUser = "user"
+	GrantSubjectTeam = "team"
+)
+
+var (
+	ErrGrantExists      = errors.New("grant already exists")
+	ErrGrantNotFound    = errors.New("grant not found")
+	ErrGrantSubject     = errors.New("grant subject not found")
+	ErrGrantSubjectType = errors.New("invalid grant subject type")
+)
+
+// DBGrant gives a subject read access to one database's SQL logs.
+type DBGrant struct {
+	ID          uint64    `gorm:"primaryKey;autoIncrement;column:id"`
+	SubjectType string    `gorm:"column:subject_type;type:varchar(16);not null;uniqueIndex:ux_db_grant"`
+	SubjectID   string    `gorm:"column:subject_id;type:varchar(64);not null;uniqueIndex:ux_db_grant"`
+	DBName      string    `gorm:"column:db_name;type:text;not null;uniqueIndex:ux_db_grant;index"`
+	CreatedBy   string    `gorm:"column:created_by;type:varchar(64)"`
+	CreatedAt   time.Time `gorm:"column:created_at;autoCreateTime"`
+}
+
+// TableName returns the fully qualified table under DEMO schema.
+func (DBGrant) TableName() string {
+	return "DEMO.DB_GRANT"
+}
+
+type teamFilterKey struct{}
+
+// WithTeamFilter narrows SQL log reads in ctx to the databases granted to teamID.
+// It never widens access: the caller's own grants still apply.
+func WithTeamFilter(ctx context.Context, teamID string) context.Context {
+	return context.WithValue(ctx, teamFilterKey{}, teamID)
+}
+
+// accessFilter restricts SQL log reads to the databases granted to the caller
+// (directly or through their teams) and optionally to one team's databases.
+type accessFilter struct {
+	all    bool
+	userID string
+	teamID string
+}
+
+// accessFilterFrom derives the caller's access from ctx. Calls without an
+// authenticated user (startup load, background jobs) and users holding
+// sqllog:all_dbs see every database.
+func accessFilterFrom(ctx context.Context) accessFilter {
+	teamID, _ := ctx.Value(teamFilterKey{}).(string)
+	u, ok := authctx.UserFrom(ctx)
+	if !ok || u == nil || authctx.HasPermission(ctx, db.PermSQLLogAllDBs) {
+		return accessFilter{all: true, teamID: teamID}
+	}
+	return accessFilter{userID: u.ID, teamID: teamID}
+}
+
+// grantCond matches DB_GRANT rows (aliased g) that apply to the filter.
+func (a accessFilter) grantCond() (string, []any) {
+	var parts []string
+	var args []any
+	if !a.all {
+		parts = append(parts, `((g.subject_type = ? AND g.subject_id = ?) OR `+
+			`(g.subject_type = ? AND g.subject_id IN (SELECT m.team_id::text FROM "DEMO"."TEAM_MEMBER" m WHERE m.user_id = ?)))`)
+		args = append(args, GrantSubjectUser, a.userID, GrantSubjectTeam, a.userID)
+	}
+	if a.teamID != "" {
+		parts = append(parts, `g.db_name IN (SELECT t.db_name FROM "DEMO"."DB_GRANT" t WHERE t.subject_type = ? AND t.subject_id = ?)`)
+		args = append(args, GrantSubjectTeam, a.teamID)
+	}
+	return strings.Join(parts, " AND "), args
+}
+
+// clause returns a condition on db_name, or "" when unrestricted.
+func (a accessFilter) clause() (string, []any) {
+	cond, args := a.grantCond()
+	if cond == "" {
+		return "", nil
+	}
+	return `db_name IN (SELECT g.db_name FROM "DEMO"."DB_GRANT" g WHERE ` + cond + `)`, args
+}
+
+func (a accessFilter) apply(tx *gorm.DB) *gorm.DB {
+	if c, args := a.clause(); c != "" {
+		return tx.Where(c, args...)
+	}
+	return tx
+}
+
+// scoped returns a session limited to the SQL logs the caller in ctx may read.
+func (r *Repository) scoped(ctx context.Context) *gorm.DB {
+	return accessFilterFrom(ctx).apply(r.db.WithContext(ctx))
+}
+
+// CanAccessDB reports whether the caller in ctx may read dbName.
+func (r *Repository) CanAccessDB(ctx context.Context, dbName string) (bool, error) {
+	cond, args := accessFilterFrom(ctx).grantCond()
+	if cond == "" {
+		return true, nil
+	}
+	var cnt int64
+	err := r.db.WithContext(ctx).
+		Table(`"DEMO"."DB_GRANT" g`).
+		Where("g.db_name = ?", dbName).
+		Where(cond, args...).
+		Count(&cnt).Error
+	return cnt > 0, err
+}
+
+// ListGrants returns grants, optionally filtered by subject and/or database.
+func (r *Repository) ListGrants(ctx context.Context, subjectType, subjectID, dbName string) ([]DBGrant, error) {
+	q := r.db.WithContext(ctx).Model(&DBGrant{})
+	if subjectType != "" {
+		q = q.Where("subject_type = ?", subjectType)
+	}
+	if subjectID != "" {
+		q = q.Where("subject_id = ?", subjectID)
+	}
+	if dbName != "" {
+		q = q.Where("db_name = ?", dbName)
+	}
+	var out []DBGrant
+	err := q.Order("db_name, subject_type, subject_id").Find(&out).Error
+	return out, err
+}
+
+// CreateGrant stores a new grant after checking that its subject exists.
+func (r *Repository) CreateGrant(ctx context.Context, g *DBGrant) error {
+	if g.SubjectID == "" || g.DBName == "" {
+		return fmt.Errorf("missing required fields")
+	}
+	if err := r.checkGrantSubject(ctx, g.SubjectType, g.SubjectID); err != nil {
+		return err
+	}
+
+	var cnt int64
+	if err := r.db.WithContext(ctx).
+		Model(&DBGrant{}).
+		Where("subject_type = ? AND subject_id = ? AND db_name = ?", g.SubjectType, g.SubjectID, g.DBName).
+		Count(&cnt).Error; err != nil {
+		return fmt.Errorf("check grant: %w", err)
+	}
+	if cnt > 0 {
+		return ErrGrantExists
+	}
+	if err := r.db.WithContext(ctx).Create(g).Error; err != nil {
+		return fmt.Errorf("create grant: %w", err)
+	}
+	return nil
+}
+
+// DeleteGrant removes a grant by ID.
+func (r *Repository) DeleteGrant(ctx context.Context, id uint64) error {
+	res := r.db.WithContext(ctx).Delete(&DBGrant{}, id)
+	if res.Error != nil {
+		return fmt.Errorf("delete grant: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrGrantNotFound
+	}
+	return nil
+}
+
+func (r *Repository) checkGrantSubject(ctx context.Context, subjectType, subjectID string) error {
+	var model any
+	switch subjectType {
+	case GrantSubjectUser:
+		model = &db.User{}
+	case GrantSubjectTeam:
+		model = &db.Team{}
+	default:
+		return ErrGrantSubjectType
+	}
+	var cnt int64
+	if err := r.db.WithContext(ctx).Model(model).Where("id = ?", subjectID).Count(&cnt).Error; err != nil {
+		return fmt.Errorf("check subject: %w", err)
+	}
+	if cnt == 0 {
+		return ErrGrantSubject
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package sqllog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go-demo/internal/authctx"
+	"go-demo/internal/db"
+)
+
+func TestAccessFilterFrom(t *testing.T) {
+	// No caller: system access.
+	a := accessFilterFrom(context.Background())
+	require.True(t, a.all)
+	c, _ := a.clause()
+	require.Empty(t, c)
+
+	// Plain user: limited to their grants.
+	ctx := authctx.WithUser(context.Background(), &db.User{ID: "u-1"})
+	ctx = authctx.WithPermissions(ctx, []string{db.PermSQLLogRead})
+	a = accessFilterFrom(ctx)
+	require.False(t, a.all)
+	c, args := a.clause()
+	require.Contains(t, c, `"DEMO"."DB_GRANT"`)
+	require.Equal(t, []any{GrantSubjectUser, "u-1", GrantSubjectTeam, "u-1"}, args)
+
+	// A team filter narrows the user's own grants.
+	a = accessFilterFrom(WithTeamFilter(ctx, "t-1"))
+	c, args = a.clause()
+	require.Contains(t, c, `"DEMO"."TEAM_MEMBER"`)
+	require.Equal(t, []any{GrantSubjectUser, "u-1", GrantSubjectTeam, "u-1", GrantSubjectTeam, "t-1"}, args)
+
+	// sqllog:all_dbs bypasses grants but still honours the team filter.
+	ctx = authctx.WithPermissions(ctx, []string{db.PermSQLLogRead, db.PermSQLLogAllDBs})
+	require.True(t, accessFilterFrom(ctx).all)
+	c, args = accessFilterFrom(WithTeamFilter(ctx, "t-1")).clause()
+	require.NotEmpty(t, c)
+	require.Equal(t, []any{GrantSubjectTeam, "t-1"}, args)
+}
+
+func TestWhereClauseArgsIncludesAccess(t *testing.T) {
+	r := &Repository{}
+	f := ReportFilter{DB: "db1", access: accessFilter{userID: "u-1"}}
+	clause, args := r.whereClauseArgs(f)
+	require.Contains(t, clause, "db_name = ?")
+	require.Contains(t, clause, `"DEMO"."DB_GRANT"`)
+	require.Len(t, args, 7)
+}
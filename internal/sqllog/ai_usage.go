@@ -0,0 +1,111 @@
+package sqllog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrAIQuotaExceeded is returned by ReserveAIUsage when the user has no
+// allowance left.
+var ErrAIQuotaExceeded = errors.New("AI quota exceeded")
+
+// aiQuotaWindow is the rolling window the daily AI quotas apply to.
+const aiQuotaWindow = 24 * time.Hour
+
+// AIInvocation is the audit record of one AI analysis request.
+type AIInvocation struct {
+	ID               uint64    `gorm:"primaryKey;autoIncrement;column:id"`
+	UserID           string    `gorm:"column:user_id;type:uuid;index;not null"`
+	Username         string    `gorm:"column:username;type:varchar(64)"`
+	DBName           string    `gorm:"column:db_name;type:text;not null"`
+	Endpoint         string    `gorm:"column:endpoint;type:varchar(64)"`
+	QueryCount       int       `gorm:"column:query_count;not null"`
+	PromptTokens     int       `gorm:"column:prompt_tokens;not null"`
+	CompletionTokens int       `gorm:"column:completion_tokens;not null"`
+	TotalTokens      int       `gorm:"column:total_tokens;not null"`
+	CreatedAt        time.Time `gorm:"column:created_at;autoCreateTime;index"`
+}
+
+// TableName returns the fully qualified table under DEMO schema.
+func (AIInvocation) TableName() string {
+	return "DEMO.AI_INVOCATION"
+}
+
+// AIUsage aggregates a user's AI consumption over a window.
+type AIUsage struct {
+	Invocations int64
+	Queries     int64
+	Tokens      int64
+}
+
+// ReserveAIUsage records inv before the analysis runs, trimming
+// inv.QueryCount to what is left of queriesPerDay over the last 24 hours. It
+// returns ErrAIQuotaExceeded when nothing is left or tokensPerDay is used up;
+// zero limits are unlimited. Reservations of the same user are serialized by
+// a transaction-scoped advisory lock, so concurrent requests cannot overrun
+// the query limit. Tokens are only known afterwards and are added by
+// FinishAIInvocation.
+func (r *Repository) ReserveAIUsage(ctx context.Context, inv *AIInvocation, queriesPerDay, tokensPerDay int64) error {
+	if inv.UserID == "" || inv.DBName == "" {
+		return fmt.Errorf("missing required fields")
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if queriesPerDay > 0 || tokensPerDay > 0 {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "ai-quota:"+inv.UserID).Error; err != nil {
+				return fmt.Errorf("lock ai usage: %w", err)
+			}
+			used, err := aiUsageSince(tx, inv.UserID, time.Now().Add(-aiQuotaWindow))
+			if err != nil {
+				return err
+			}
+			if tokensPerDay > 0 && used.Tokens >= tokensPerDay {
+				return ErrAIQuotaExceeded
+			}
+			if queriesPerDay > 0 {
+				remaining := queriesPerDay - used.Queries
+				if remaining <= 0 {
+					return ErrAIQuotaExceeded
+				}
+				inv.QueryCount = int(min(int64(inv.QueryCount), remaining))
+			}
+		}
+		return tx.Create(inv).Error
+	})
+}
+
+// FinishAIInvocation stores the final query count and token usage of a
+// reserved invocation.
+func (r *Repository) FinishAIInvocation(ctx context.Context, inv *AIInvocation) error {
+	return r.db.WithContext(ctx).Model(&AIInvocation{}).Where("id = ?", inv.ID).Updates(map[string]interface{}{
+		"query_count":       inv.QueryCount,
+		"prompt_tokens":     inv.PromptTokens,
+		"completion_tokens": inv.CompletionTokens,
+		"total_tokens":      inv.TotalTokens,
+	}).Error
+}
+
+// AIUsageSince returns the user's AI consumption recorded at or after since.
+func (r *Repository) AIUsageSince(ctx context.Context, userID string, since time.Time) (AIUsage, error) {
+	return aiUsageSince(r.db.WithContext(ctx), userID, since)
+}
+
+func aiUsageSince(tx *gorm.DB, userID string, since time.Time) (AIUsage, error) {
+	var row struct {
+		Invocations int64
+		Queries     int64
+		Tokens      int64
+	}
+	err := tx.
+		Model(&AIInvocation{}).
+		Select("COUNT(*) AS invocations, COALESCE(SUM(query_count),0) AS queries, COALESCE(SUM(total_tokens),0) AS tokens").
+		Where("user_id = ? AND created_at >= ?", userID, since).
+		Scan(&row).Error
+	if err != nil {
+		return AIUsage{}, fmt.Errorf("ai usage: %w", err)
+	}
+	return AIUsage{Invocations: row.Invocations, Queries: row.Queries, Tokens: row.Tokens}, nil
+}
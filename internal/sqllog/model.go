@@ -10,6 +10,10 @@ type SQLLog struct {
 	ExecTimeMs int64     `gorm:"column:exec_time_ms;not null"`
 	ExecCount  int64     `gorm:"column:exec_count;not null"`
 	CreatedAt  time.Time `gorm:"column:created_at;autoCreateTime"`
+
+	// SQLQueryRaw holds the unredacted text when the redaction policy retains it.
+	// Only privileged roles may see it.
+	SQLQueryRaw *string `gorm:"column:sql_query_raw;type:text" json:"-"`
 }
 
 // TableName returns the fully qualified table under DEMO schema.
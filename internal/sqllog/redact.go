@@ -0,0 +1,242 @@
+package sqllog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// redactionPolicyID is the primary key of the single stored policy row.
+const redactionPolicyID = 1
+
+// literalRules mask SQL literals in the same order as normalizationSQL
+// (string -> uuid -> datetime -> number), without lowercasing or collapsing whitespace.
+var literalRules = []*regexp.Regexp{
+	regexp.MustCompile(`'([^']|'')*'`),
+	regexp.MustCompile(`\b[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}\b`),
+	regexp.MustCompile(`\b[0-9]{4}-[0-9]{2}-[0-9]{2}((\s|T)[0-9]{2}:[0-9]{2}:[0-9]{2}(\.[0-9]+)?)?\b`),
+	regexp.MustCompile(`\b[0-9]+(\.[0-9]+)?\b`),
+}
+
+// DefaultPIIRules catch PII that may appear outside quoted literals (comments, hints,
+// identifiers built from user data). They run before literal masking.
+var DefaultPIIRules = []RedactionRule{
+	{Name: "email", Pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`, Replacement: "<email>"},
+	{Name: "card", Pattern: `\b[0-9]{4}[ -]?[0-9]{4}[ -]?[0-9]{4}[ -]?[0-9]{1,7}\b`, Replacement: "<card>"},
+	{Name: "phone", Pattern: `\+?[0-9]{1,3}?[ .-]?\(?[0-9]{2,4}\)?[ .-][0-9]{3,4}[ .-][0-9]{3,4}\b`, Replacement: "<phone>"},
+}
+
+// RedactionRule is a named regular expression whose matches are replaced.
+type RedactionRule struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement,omitempty"` // defaults to "?"
+}
+
+// RedactionPolicy controls where redaction is applied. Redaction before LLM
+// submission is not configurable and always happens.
+type RedactionPolicy struct {
+	ID             uint            `gorm:"primaryKey;column:id" json:"-"`
+	RedactAtIngest bool            `gorm:"column:redact_at_ingest;not null" json:"redact_at_ingest"`
+	RedactAtExport bool            `gorm:"column:redact_at_export;not null" json:"redact_at_export"`
+	RetainRaw      bool            `gorm:"column:retain_raw;not null" json:"retain_raw"`
+	Rules          []RedactionRule `gorm:"column:rules;type:jsonb;serializer:json" json:"rules"`
+	UpdatedBy      string          `gorm:"column:updated_by;type:varchar(64)" json:"updated_by,omitempty"`
+	UpdatedAt      time.Time       `gorm:"column:updated_at;autoUpdateTime" json:"updated_at,omitempty"`
+}
+
+// TableName returns the fully qualified table under DEMO schema.
+func (RedactionPolicy) TableName() string {
+	return "DEMO.REDACTION_POLICY"
+}
+
+type compiledRule struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// Redactor masks SQL literals and PII in query text. It is safe for concurrent use.
+type Redactor struct {
+	rules []compiledRule
+}
+
+// NewRedactor compiles the default PII rules followed by custom rules.
+func NewRedactor(custom []RedactionRule) (*Redactor, error) {
+	all := append(append([]RedactionRule{}, DefaultPIIRules...), custom...)
+	rd := &Redactor{rules: make([]compiledRule, 0, len(all))}
+	for _, r := range all {
+		if strings.TrimSpace(r.Pattern) == "" {
+			return nil, fmt.Errorf("rule %q: empty pattern", r.Name)
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		repl := r.Replacement
+		if repl == "" {
+			repl = "?"
+		}
+		rd.rules = append(rd.rules, compiledRule{re: re, replacement: repl})
+	}
+	return rd, nil
+}
+
+// Redact returns s with PII rule matches and SQL literals masked.
+func (rd *Redactor) Redact(s string) string {
+	for _, r := range rd.rules {
+		s = r.re.ReplaceAllLiteralString(s, r.replacement)
+	}
+	for _, re := range literalRules {
+		s = re.ReplaceAllLiteralString(s, "?")
+	}
+	return s
+}
+
+// redactionCacheTTL is how long the effective policy is reused before it is
+// read again, so that changes made through another instance take effect.
+const redactionCacheTTL = 10 * time.Second
+
+// redactionState caches the effective policy and its compiled redactor.
+type redactionState struct {
+	mu       sync.RWMutex
+	defaults RedactionPolicy
+	policy   *RedactionPolicy
+	redactor *Redactor
+	loadedAt time.Time
+}
+
+// SetRedactionDefaults sets the policy used until an admin stores one.
+func (r *Repository) SetRedactionDefaults(p RedactionPolicy) {
+	r.redaction.mu.Lock()
+	defer r.redaction.mu.Unlock()
+	r.redaction.defaults = p
+	r.redaction.policy = nil
+	r.redaction.redactor = nil
+}
+
+// RedactionPolicy returns the stored policy, or the configured defaults when none is stored.
+func (r *Repository) RedactionPolicy(ctx context.Context) (RedactionPolicy, error) {
+	p, _, err := r.loadRedaction(ctx)
+	return p, err
+}
+
+// Redactor returns the redactor built from the effective policy's rules.
+func (r *Repository) Redactor(ctx context.Context) (*Redactor, error) {
+	_, rd, err := r.loadRedaction(ctx)
+	return rd, err
+}
+
+// UpdateRedactionPolicy validates and stores the policy, replacing any previous one.
+func (r *Repository) UpdateRedactionPolicy(ctx context.Context, p RedactionPolicy) (RedactionPolicy, error) {
+	rd, err := NewRedactor(p.Rules)
+	if err != nil {
+		return RedactionPolicy{}, err
+	}
+	p.ID = redactionPolicyID
+	if p.Rules == nil {
+		p.Rules = []RedactionRule{}
+	}
+	err = r.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&p).Error
+	if err != nil {
+		return RedactionPolicy{}, fmt.Errorf("save redaction policy: %w", err)
+	}
+
+	r.redaction.mu.Lock()
+	r.redaction.policy = &p
+	r.redaction.redactor = rd
+	r.redaction.loadedAt = time.Now()
+	r.redaction.mu.Unlock()
+	return p, nil
+}
+
+// loadRedaction returns the effective policy and redactor, reading the stored
+// policy again once the cached one is older than redactionCacheTTL.
+func (r *Repository) loadRedaction(ctx context.Context) (RedactionPolicy, *Redactor, error) {
+	r.redaction.mu.RLock()
+	if r.redaction.policy != nil && time.Since(r.redaction.loadedAt) < redactionCacheTTL {
+		p, rd := *r.redaction.policy, r.redaction.redactor
+		r.redaction.mu.RUnlock()
+		return p, rd, nil
+	}
+	r.redaction.mu.RUnlock()
+
+	var p RedactionPolicy
+	err := r.db.WithContext(ctx).First(&p, redactionPolicyID).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		r.redaction.mu.RLock()
+		p = r.redaction.defaults
+		r.redaction.mu.RUnlock()
+	case err != nil:
+		return RedactionPolicy{}, nil, fmt.Errorf("load redaction policy: %w", err)
+	}
+	rd, err := NewRedactor(p.Rules)
+	if err != nil {
+		return RedactionPolicy{}, nil, err
+	}
+
+	r.redaction.mu.Lock()
+	r.redaction.policy = &p
+	r.redaction.redactor = rd
+	r.redaction.loadedAt = time.Now()
+	r.redaction.mu.Unlock()
+	return p, rd, nil
+}
+
+// redactForIngest masks entries in place when the policy asks for it, keeping the
+// original text in SQLQueryRaw if raw retention is enabled.
+func (r *Repository) redactForIngest(ctx context.Context, entries []SQLLog) error {
+	p, rd, err := r.loadRedaction(ctx)
+	if err != nil {
+		return err
+	}
+	if !p.RedactAtIngest {
+		return nil
+	}
+	for i := range entries {
+		raw := entries[i].SQLQuery
+		entries[i].SQLQuery = rd.Redact(raw)
+		if p.RetainRaw {
+			entries[i].SQLQueryRaw = &raw
+		}
+	}
+	return nil
+}
+
+// RedactForExport masks anomaly SQL and top patterns in data when the policy
+// asks for it.
+func (r *Repository) RedactForExport(ctx context.Context, data *ReportData) error {
+	p, rd, err := r.loadRedaction(ctx)
+	if err != nil {
+		return err
+	}
+	if !p.RedactAtExport {
+		return nil
+	}
+	rd.RedactReport(data)
+	return nil
+}
+
+// RedactReport masks anomaly SQL and top patterns in data. Normalization only
+// replaces literals, so patterns can still carry PII in identifiers, comments
+// or unquoted tokens.
+func (rd *Redactor) RedactReport(data *ReportData) {
+	for i := range data.Anomalies {
+		data.Anomalies[i].SQLQuery = rd.Redact(data.Anomalies[i].SQLQuery)
+	}
+	for i := range data.TopPatternsOverall {
+		data.TopPatternsOverall[i].Pattern = rd.Redact(data.TopPatternsOverall[i].Pattern)
+	}
+	for _, patterns := range data.TopPatternsByDB {
+		for i := range patterns {
+			patterns[i].Pattern = rd.Redact(patterns[i].Pattern)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package sqllog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactorRedact(t *testing.T) {
+	rd, err := NewRedactor(nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "numeric literal",
+			in:   "SELECT * FROM accounts WHERE account_id = 555",
+			want: "SELECT * FROM accounts WHERE account_id = ?",
+		},
+		{
+			name: "string literal with escaped quote",
+			in:   "SELECT id FROM users WHERE name = 'O''Brien'",
+			want: "SELECT id FROM users WHERE name = ?",
+		},
+		{
+			name: "uuid and datetime",
+			in:   "DELETE FROM t WHERE id = 3f2504e0-4f89-11d3-9a0c-0305e82c3301 AND ts < 2024-09-06 12:00:00",
+			want: "DELETE FROM t WHERE id = ? AND ts < ?",
+		},
+		{
+			name: "unquoted email",
+			in:   "SELECT 1 -- requested by jane.doe@example.com",
+			want: "SELECT ? -- requested by <email>",
+		},
+		{
+			name: "card number",
+			in:   "SELECT * FROM payments /* card 4111 1111 1111 1111 */",
+			want: "SELECT * FROM payments /* card <card> */",
+		},
+		{
+			name: "identifiers keep digits",
+			in:   "SELECT col1 FROM table2",
+			want: "SELECT col1 FROM table2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, rd.Redact(tt.in))
+		})
+	}
+}
+
+func TestRedactorCustomRules(t *testing.T) {
+	rd, err := NewRedactor([]RedactionRule{{Name: "tenant", Pattern: `tenant_[a-z]+`, Replacement: "tenant_x"}})
+	require.NoError(t, err)
+	require.Equal(t, "SELECT * FROM tenant_x.orders", rd.Redact("SELECT * FROM tenant_acme.orders"))
+
+	_, err = NewRedactor([]RedactionRule{{Name: "bad", Pattern: `(`}})
+	require.Error(t, err)
+
+	_, err = NewRedactor([]RedactionRule{{Name: "empty", Pattern: " "}})
+	require.Error(t, err)
+}
+
+func TestRedactorRedactReport(t *testing.T) {
+	rd, err := NewRedactor([]RedactionRule{{Name: "tenant", Pattern: `tenant_[a-z]+`, Replacement: "tenant_x"}})
+	require.NoError(t, err)
+	data := &ReportData{
+		Anomalies:          []AnomalyDetail{{SQLQuery: "SELECT * FROM tenant_acme.orders WHERE id = 1"}},
+		TopPatternsOverall: []PatternStat{{Pattern: "SELECT * FROM tenant_acme.orders /* bob@example.com */", Occurrences: 3}},
+		TopPatternsByDB: map[string][]PatternStat{
+			"app": {{Pattern: "SELECT * FROM tenant_globex.users", Occurrences: 2}},
+		},
+	}
+	rd.RedactReport(data)
+	require.NotContains(t, data.Anomalies[0].SQLQuery, "tenant_acme")
+	require.Equal(t, "SELECT * FROM tenant_x.orders /* <email> */", data.TopPatternsOverall[0].Pattern)
+	require.Equal(t, int64(3), data.TopPatternsOverall[0].Occurrences)
+	require.Equal(t, "SELECT * FROM tenant_x.users", data.TopPatternsByDB["app"][0].Pattern)
+}
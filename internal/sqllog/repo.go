@@ -7,20 +7,24 @@ import (
 	"gorm.io/gorm"
 )
 
+// Repository reads and writes SQL logs. Reads are limited to the databases
+// granted to the caller in the context (see access.go).
 type Repository struct {
-	db *gorm.DB
+	db        *gorm.DB
+	redaction redactionState
 }
 
 func NewRepository(db *gorm.DB) *Repository {
 	return &Repository{db: db}
 }
 
-// Migrate ensures the DEMO.SQL_LOG table exists.
+// Migrate ensures the DEMO.SQL_LOG, DEMO.AI_INVOCATION, DEMO.REDACTION_POLICY and DEMO.DB_GRANT tables exist.
 func (r *Repository) Migrate(ctx context.Context) error {
-	return r.db.WithContext(ctx).AutoMigrate(&SQLLog{})
+	return r.db.WithContext(ctx).AutoMigrate(&SQLLog{}, &AIInvocation{}, &RedactionPolicy{}, &DBGrant{})
 }
 
 // InsertBatch inserts entries in batches for performance.
+// Entries are redacted in place first when the redaction policy enables it at ingest.
 func (r *Repository) InsertBatch(ctx context.Context, entries []SQLLog) error {
 	if len(entries) == 0 {
 		return nil
@@ -31,6 +35,9 @@ func (r *Repository) InsertBatch(ctx context.Context, entries []SQLLog) error {
 			return fmt.Errorf("missing required fields at index %d", i)
 		}
 	}
+	if err := r.redactForIngest(ctx, entries); err != nil {
+		return err
+	}
 	return r.db.WithContext(ctx).CreateInBatches(entries, 500).Error
 }
 
@@ -44,7 +51,7 @@ const (
 // defined by exec_time_ms > 500 AND exec_count > 100.
 func (r *Repository) CountAbnormal(ctx context.Context) (int64, error) {
 	var cnt int64
-	err := r.db.WithContext(ctx).
+	err := r.scoped(ctx).
 		Model(&SQLLog{}).
 		Where("exec_time_ms > ? AND exec_count > ?", AbnormalExecTimeThreshold, AbnormalExecCountThreshold).
 		Count(&cnt).Error
@@ -61,7 +68,7 @@ func (r *Repository) ListAbnormal(ctx context.Context, limit int) ([]SQLLog, err
 		limit = 1000
 	}
 	var items []SQLLog
-	err := r.db.WithContext(ctx).
+	err := r.scoped(ctx).
 		Where("exec_time_ms > ? AND exec_count > ?", AbnormalExecTimeThreshold, AbnormalExecCountThreshold).
 		Order("exec_time_ms DESC, exec_count DESC").
 		Limit(limit).
@@ -72,7 +79,7 @@ func (r *Repository) ListAbnormal(ctx context.Context, limit int) ([]SQLLog, err
 // CountAbnormalWithThresholds returns the count of records above provided thresholds.
 func (r *Repository) CountAbnormalWithThresholds(ctx context.Context, execTimeThreshold int64, execCountThreshold int64) (int64, error) {
 	var cnt int64
-	err := r.db.WithContext(ctx).
+	err := r.scoped(ctx).
 		Model(&SQLLog{}).
 		Where("exec_time_ms > ? AND exec_count > ?", execTimeThreshold, execCountThreshold).
 		Count(&cnt).Error
@@ -88,7 +95,7 @@ func (r *Repository) ListAbnormalWithThresholds(ctx context.Context, limit int,
 		limit = 1000
 	}
 	var items []SQLLog
-	err := r.db.WithContext(ctx).
+	err := r.scoped(ctx).
 		Where("exec_time_ms > ? AND exec_count > ?", execTimeThreshold, execCountThreshold).
 		Order("exec_time_ms DESC, exec_count DESC").
 		Limit(limit).
@@ -99,7 +106,7 @@ func (r *Repository) ListAbnormalWithThresholds(ctx context.Context, limit int,
 // CountAbnormalByDB returns the total number of abnormal queries for a specific database.
 func (r *Repository) CountAbnormalByDB(ctx context.Context, dbName string) (int64, error) {
 	var cnt int64
-	err := r.db.WithContext(ctx).
+	err := r.scoped(ctx).
 		Model(&SQLLog{}).
 		Where("db_name = ? AND exec_time_ms > ? AND exec_count > ?", dbName, AbnormalExecTimeThreshold, AbnormalExecCountThreshold).
 		Count(&cnt).Error
@@ -115,7 +122,7 @@ func (r *Repository) ListAbnormalByDB(ctx context.Context, dbName string, limit
 		limit = 1000
 	}
 	var items []SQLLog
-	err := r.db.WithContext(ctx).
+	err := r.scoped(ctx).
 		Where("db_name = ? AND exec_time_ms > ? AND exec_count > ?", dbName, AbnormalExecTimeThreshold, AbnormalExecCountThreshold).
 		Order("exec_time_ms DESC, exec_count DESC").
 		Limit(limit).
@@ -126,7 +133,7 @@ func (r *Repository) ListAbnormalByDB(ctx context.Context, dbName string, limit
 // CountAbnormalByDBWithThresholds returns the count for a specific database above provided thresholds.
 func (r *Repository) CountAbnormalByDBWithThresholds(ctx context.Context, dbName string, execTimeThreshold int64, execCountThreshold int64) (int64, error) {
 	var cnt int64
-	err := r.db.WithContext(ctx).
+	err := r.scoped(ctx).
 		Model(&SQLLog{}).
 		Where("db_name = ? AND exec_time_ms > ? AND exec_count > ?", dbName, execTimeThreshold, execCountThreshold).
 		Count(&cnt).Error
@@ -142,7 +149,7 @@ func (r *Repository) ListAbnormalByDBWithThresholds(ctx context.Context, dbName
 		limit = 1000
 	}
 	var items []SQLLog
-	err := r.db.WithContext(ctx).
+	err := r.scoped(ctx).
 		Where("db_name = ? AND exec_time_ms > ? AND exec_count > ?", dbName, execTimeThreshold, execCountThreshold).
 		Order("exec_time_ms DESC, exec_count DESC").
 		Limit(limit).
@@ -153,14 +160,14 @@ func (r *Repository) ListAbnormalByDBWithThresholds(ctx context.Context, dbName
 // ListDatabases returns distinct database names present in the log table.
 func (r *Repository) ListDatabases(ctx context.Context) ([]string, error) {
 	var names []string
-	err := r.db.WithContext(ctx).Model(&SQLLog{}).Distinct().Pluck("db_name", &names).Error
+	err := r.scoped(ctx).Model(&SQLLog{}).Distinct().Pluck("db_name", &names).Error
 	return names, err
 }
 
 // FindByDB returns all SQL log entries for a specific database.
 func (r *Repository) FindByDB(ctx context.Context, dbName string) ([]SQLLog, error) {
 	var rows []SQLLog
-	err := r.db.WithContext(ctx).
+	err := r.scoped(ctx).
 		Where("db_name = ?", dbName).
 		Order("created_at DESC, id DESC").
 		Find(&rows).Error
@@ -171,7 +178,7 @@ func (r *Repository) FindByDB(ctx context.Context, dbName string) ([]SQLLog, err
 // FindSlowQueries returns SQL queries that are slow and frequently executed
 func (r *Repository) FindSlowQueries(ctx context.Context, dbName string) ([]SQLLog, error) {
 	var results []SQLLog
-	err := r.db.WithContext(ctx).
+	err := r.scoped(ctx).
 		Where("db_name = ? AND exec_time_ms > ? AND exec_count > ?", dbName, 500, 100).
 		Find(&results).Error
 	return results, err
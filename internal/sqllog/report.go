@@ -51,6 +51,9 @@ type ReportFilter struct {
 	// Extended stats
 	Pcts        []float64 // percentile fractions in [0..1]
 	TopPatterns int       // number of patterns to return per scope
+
+	// access is resolved from the caller by Analyze; it is not user-settable.
+	access accessFilter
 }
 
 // ReportSummary contains the high-level metrics.
@@ -154,6 +157,7 @@ func (r *Repository) Analyze(ctx context.Context, f ReportFilter) (ReportData, e
 	if f.TopPatterns > maxTopPatterns {
 		f.TopPatterns = maxTopPatterns
 	}
+	f.access = accessFilterFrom(ctx)
 
 	// Summary total count
 	var total int64
@@ -249,7 +253,7 @@ func (r *Repository) applyFilters(db *gorm.DB, f ReportFilter) *gorm.DB {
 	if strings.TrimSpace(f.DB) != "" {
 		db = db.Where("db_name = ?", strings.TrimSpace(f.DB))
 	}
-	return db
+	return f.access.apply(db)
 }
 
 func (r *Repository) applyAnomalyFilters(db *gorm.DB, f ReportFilter) *gorm.DB {
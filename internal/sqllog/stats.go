@@ -163,7 +163,8 @@ ORDER BY db_name ASC, occurrences DESC, pattern ASC
 	return overall, byDB, nil
 }
 
-// whereClauseArgs builds the SQL WHERE clause and args for created_at and optional db_name.
+// whereClauseArgs builds the SQL WHERE clause and args for created_at, optional db_name
+// and the caller's database grants.
 func (r *Repository) whereClauseArgs(f ReportFilter) (clause string, args []any) {
 	parts := []string{`created_at >= ?`, `created_at <= ?`}
 	args = []any{f.From, f.To}
@@ -171,6 +172,10 @@ func (r *Repository) whereClauseArgs(f ReportFilter) (clause string, args []any)
 		parts = append(parts, `db_name = ?`)
 		args = append(args, strings.TrimSpace(f.DB))
 	}
+	if c, cargs := f.access.clause(); c != "" {
+		parts = append(parts, c)
+		args = append(args, cargs...)
+	}
 	return strings.Join(parts, " AND "), args
 }
 
@@ -7,6 +7,9 @@ const BASE_URL = __ENV.BASE_URL || 'http://localhost:8080';
 const IDENTIFIER = __ENV.IDENTIFIER || 'admin@example.com';
 const PASSWORD = __ENV.PASSWORD || 'admin123';
 
+// Login is rate limited per IP and identifier; start the API with
+// LOGIN_RATE_LIMIT_IP=0 LOGIN_RATE_LIMIT_IDENTIFIER=0 when load testing.
+
 // Test options (override with: k6 run -e VUS=50 -e DURATION=2m k6/login_test.js)
 export const options = {
   vus: Number(__ENV.VUS || 20),